@@ -11,20 +11,29 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/example/fileprocessor/internal/auth"
+	"github.com/example/fileprocessor/internal/catalog"
 	"github.com/example/fileprocessor/internal/config"
 	"github.com/example/fileprocessor/internal/handlers"
 	"github.com/example/fileprocessor/internal/middleware"
+	"github.com/example/fileprocessor/internal/pipeline"
 	"github.com/example/fileprocessor/internal/processors"
+	"github.com/example/fileprocessor/internal/scheduler"
+	"github.com/example/fileprocessor/internal/storage"
+	"github.com/example/fileprocessor/internal/worker"
 )
 
 var (
 	configFile = flag.String("config", "fileprocessor.ini", "Configuration file path")
 	testConfig = flag.Bool("test-config", false, "Test configuration and exit")
 	verbose    = flag.Bool("verbose", false, "Enable verbose logging")
+	workerMode = flag.Bool("worker", false, "Run as a remote worker that leases tasks from a server")
+	serverURL  = flag.String("server-url", "", "Server a remote worker connects to (overrides workers.serverURL)")
+	workerID   = flag.String("worker-id", "", "Remote worker ID (defaults to hostname and process ID)")
 	version    = "1.3.0" // Version number for the application
 )
 
@@ -72,12 +81,66 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// Apply processor selection settings
+	if err := processors.DefaultRegistry.Configure(config.AppConfig.Processors.Disabled, config.AppConfig.Processors.Priorities); err != nil {
+		log.Printf("Warning: Invalid processor configuration: %v", err)
+	}
+	if ladder := config.AppConfig.Processors.StreamLadder; ladder != "" {
+		if parsed, err := processors.ParseBitrateLadder(ladder); err != nil {
+			log.Printf("Warning: Invalid stream ladder, using the default: %v", err)
+		} else {
+			processors.DefaultBitrateLadder = parsed
+		}
+	}
+	if formats := config.AppConfig.Processors.NormalizeFormats; len(formats) > 0 {
+		if parsed, err := processors.ParseNormalizeFormats(strings.Join(formats, ",")); err != nil {
+			log.Printf("Warning: Invalid normalize formats, using the default: %v", err)
+		} else {
+			processors.DefaultNormalizeFormats = parsed
+		}
+	}
+	if target := config.AppConfig.Processors.LoudnessTarget; target != 0 {
+		if target < -70 || target > -5 {
+			log.Printf("Warning: Loudness target must be between -70 and -5 LUFS, using the default")
+		} else {
+			processors.DefaultLoudnessTarget = target
+		}
+	}
+	if mb := config.AppConfig.Processors.MaxMemoryMB; mb != 0 {
+		if mb < 0 {
+			log.Printf("Warning: Processor memory limit must be positive, using the default")
+		} else {
+			processors.DefaultMaxMemorySize = int64(mb) << 20
+		}
+	}
+
+	// Detect the external tools processors run, so missing ones are reported
+	// up front rather than showing up as silently missing results
+	for name, path := range config.AppConfig.Processors.Tools {
+		processors.DefaultTools.SetPath(name, path)
+	}
+	tools := processors.DefaultTools.Detect(context.Background())
+	for _, tool := range tools {
+		if !tool.Available {
+			log.Printf("Warning: %s is not available, features that need it are disabled: %s", tool.Name, tool.Error)
+		} else if *verbose {
+			log.Printf("Found %s %s at %s", tool.Name, tool.Version, tool.Resolved)
+		}
+	}
+
 	// Test configuration if requested
 	if *testConfig {
+		processors.WriteCapabilityReport(os.Stdout, tools, processors.DefaultRegistry.List())
 		fmt.Println("Configuration test successful")
 		return
 	}
 
+	// Run as a remote worker instead of a server if requested
+	if *workerMode {
+		runWorker()
+		return
+	}
+
 	// Print banner and version
 	fmt.Printf("\n=================================\n")
 	fmt.Printf("File Management System v%s\n", version)
@@ -93,12 +156,43 @@ func main() {
 	// Initialize worker pool with configured number of workers
 	log.Printf("Initializing worker pool with %d workers", config.AppConfig.Workers.Count)
 	processors.InitializeWorkerPool(config.AppConfig.Workers.Count, config.AppConfig.Workers.QueueSize)
+	processors.DefaultPool.SetLeaseTimeout(time.Duration(config.AppConfig.Workers.LeaseTimeout) * time.Second)
 
-	// Initialize file handler
-	fileHandler, err := handlers.NewFileHandler()
+	// Open the file catalog that links files to their derived files
+	if err := catalog.Initialize(filepath.Join(config.AppConfig.Server.DataDir, "catalog.json")); err != nil {
+		log.Fatalf("Failed to open file catalog: %v", err)
+	}
+
+	// Initialize file handler over the configured local storage
+	defaultStorage, err := storage.CreateProvider("local", config.AppConfig.Storage.Local)
 	if err != nil {
 		log.Fatalf("Failed to initialize file handler: %v", err)
 	}
+	fileHandler := handlers.NewFileHandler(defaultStorage)
+
+	// Initialize processing pipelines
+	pipelineManager, err := pipeline.NewManager(filepath.Join(config.AppConfig.Server.DataDir, "pipelines.json"))
+	if err != nil {
+		log.Fatalf("Failed to load pipelines: %v", err)
+	}
+	pipelineHandler := handlers.NewPipelineHandler(pipelineManager, fileHandler)
+
+	// Initialize the job scheduler if enabled
+	var jobScheduler *scheduler.Scheduler
+	var schedulerHandler *handlers.SchedulerHandler
+	if config.AppConfig.Scheduler.Enabled {
+		log.Println("Initializing job scheduler")
+		jobScheduler = scheduler.NewScheduler(
+			config.GetSchedulerStateFile(),
+			time.Duration(config.AppConfig.Scheduler.CheckInterval)*time.Second)
+		schedulerHandler = handlers.NewSchedulerHandler(jobScheduler, fileHandler)
+		if err := jobScheduler.Start(); err != nil {
+			log.Printf("Failed to start job scheduler: %v", err)
+			log.Println("Scheduled jobs will be disabled")
+			jobScheduler = nil
+			schedulerHandler = nil
+		}
+	}
 
 	// Initialize LAN transfer handler if enabled
 	var lanHandler *handlers.LANTransferHandler
@@ -118,7 +212,7 @@ func main() {
 	}
 
 	// Initialize authentication if enabled
-	var authHandler *auth.AuthHandler
+	var authHandler *auth.Handler
 	if config.AppConfig.Features.EnableAuth {
 		log.Println("Initializing authentication system")
 
@@ -143,7 +237,7 @@ func main() {
 			redirectURL,
 		)
 
-		authHandler = auth.DefaultAuthHandler
+		authHandler = auth.NewHandler(auth.DefaultAuthManager)
 		log.Printf("OAuth redirects configured to: %s", redirectURL)
 	}
 
@@ -166,6 +260,22 @@ func main() {
 	mux.HandleFunc("/api/delete", fileHandler.DeleteFile)
 	mux.HandleFunc("/api/storage/status", fileHandler.GetStorageProviderStatus)
 	mux.HandleFunc("/api/preview/{id}", fileHandler.MediaPreviewHandler) // New endpoint for media previews
+	mux.HandleFunc("/api/process", fileHandler.ProcessFiles)
+	mux.HandleFunc("/api/process/status", fileHandler.GetBatchStatus)
+	mux.HandleFunc("/api/files/derived", fileHandler.ListDerivedFiles)
+	mux.HandleFunc("/api/files/{id}/transform", fileHandler.TransformImage)
+	mux.HandleFunc("/api/files/{id}/convert", fileHandler.ConvertFile)
+	mux.HandleFunc("/api/files/{id}/share-policy", fileHandler.HandleSharePolicy)
+	mux.HandleFunc("/api/stream/{id}/{path...}", fileHandler.StreamFile)
+	mux.HandleFunc("/api/images/clusters", fileHandler.ListImageClusters)
+	mux.HandleFunc("/api/images/similar", fileHandler.FindSimilarImages)
+	mux.HandleFunc("/api/search", fileHandler.SearchText)
+	mux.HandleFunc("/api/processors", fileHandler.ListProcessors)
+
+	// Pipeline routes
+	mux.HandleFunc("/api/pipelines", pipelineHandler.HandlePipelines)
+	mux.HandleFunc("/api/pipelines/run", pipelineHandler.HandleRunPipeline)
+	mux.HandleFunc("/api/pipelines/runs", pipelineHandler.HandleRuns)
 
 	// WebSocket endpoint for real-time updates
 	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
@@ -178,6 +288,21 @@ func main() {
 		w.Write([]byte("OK"))
 	})
 
+	// Remote worker routes if a worker token is configured
+	if config.AppConfig.Workers.RemoteToken != "" {
+		workerHandler := handlers.NewWorkerHandler(config.AppConfig.Workers.RemoteToken, fileHandler)
+		mux.HandleFunc(worker.LeasePath, workerHandler.HandleLease)
+		mux.HandleFunc(worker.HeartbeatPath, workerHandler.HandleHeartbeat)
+		mux.HandleFunc(worker.CompletePath, workerHandler.HandleComplete)
+		mux.HandleFunc("/api/workers", workerHandler.ListWorkers)
+	}
+
+	// Scheduler routes if enabled
+	if schedulerHandler != nil {
+		mux.HandleFunc("/api/schedules", schedulerHandler.HandleJobs)
+		mux.HandleFunc("/api/schedules/run", schedulerHandler.HandleRunJob)
+	}
+
 	// LAN transfer routes if enabled
 	if lanHandler != nil {
 		mux.HandleFunc("/api/lan/discover", lanHandler.HandleDiscoverPeers)
@@ -301,6 +426,13 @@ func main() {
 		log.Printf("Server forced to shutdown: %v", err)
 	}
 
+	// Stop the scheduler and pending batch submissions before the worker pool they submit to
+	if jobScheduler != nil {
+		jobScheduler.Stop()
+	}
+	fileHandler.Close()
+	pipelineManager.Close()
+
 	// Stop the worker pool
 	processors.ShutdownWorkerPool()
 	log.Println("Worker pool stopped")
@@ -313,6 +445,46 @@ func main() {
 	log.Println("Server shutdown complete")
 }
 
+// runWorker runs this process as a remote worker until interrupted. The worker
+// reads and writes files through storage configured the same way as the server's.
+func runWorker() {
+	url := config.AppConfig.Workers.ServerURL
+	if *serverURL != "" {
+		url = *serverURL
+	}
+
+	id := *workerID
+	if id == "" {
+		hostname, _ := os.Hostname()
+		id = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+
+	providers := func(storageType string) (storage.Provider, error) {
+		switch storageType {
+		case "", "local":
+			return storage.CreateProvider("local", config.AppConfig.Storage.Local)
+		case "s3", "amazon", "aws":
+			return storage.CreateProvider(storageType, config.AppConfig.Storage.S3)
+		case "gcs", "google":
+			return storage.CreateProvider(storageType, config.AppConfig.Storage.Google)
+		}
+		return nil, fmt.Errorf("unsupported storage type: %s", storageType)
+	}
+
+	w := worker.New(id, url, config.AppConfig.Workers.RemoteToken, config.AppConfig.Workers.Count, providers)
+	if config.AppConfig.Workers.LeaseTimeout > 0 {
+		w.HeartbeatInterval = time.Duration(config.AppConfig.Workers.LeaseTimeout) * time.Second / 3
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	fmt.Printf("File Management System v%s - remote worker %s\n", version, id)
+	if err := w.Run(ctx); err != nil {
+		log.Fatalf("Worker failed: %v", err)
+	}
+}
+
 func setupRoutes(mux *http.ServeMux, fileHandler *handlers.FileHandler) {
 	// File API routes
 	mux.HandleFunc("/api/upload", fileHandler.UploadFile)
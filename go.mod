@@ -6,8 +6,11 @@ require (
 	cloud.google.com/go/storage v1.52.0
 	github.com/aws/aws-sdk-go v1.55.7
 	github.com/gorilla/websocket v1.5.3
+	github.com/ledongthuc/pdf v0.0.0-20250511090121-5959a4027728
 	github.com/unidoc/unioffice v1.39.0
+	golang.org/x/image v0.25.0
 	golang.org/x/oauth2 v0.29.0
+	golang.org/x/text v0.24.0
 	google.golang.org/api v0.230.0
 )
 
@@ -52,7 +55,6 @@ require (
 	golang.org/x/net v0.39.0 // indirect
 	golang.org/x/sync v0.13.0 // indirect
 	golang.org/x/sys v0.32.0 // indirect
-	golang.org/x/text v0.24.0 // indirect
 	golang.org/x/time v0.11.0 // indirect
 	google.golang.org/genproto v0.0.0-20250303144028-a0af3efb3deb // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20250414145226-207652e42e2e // indirect
@@ -0,0 +1,446 @@
+// Package catalog keeps an index of stored files, their extracted metadata and
+// the derived files (previews, extracted tracks, pipeline outputs) linked to them
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/fileprocessor/internal/processors"
+	"github.com/example/fileprocessor/internal/storage"
+)
+
+// Entry describes a stored file known to the catalog
+type Entry struct {
+	ID          string            `json:"id"`
+	StorageType string            `json:"storageType"`
+	Name        string            `json:"name"`
+	ContentType string            `json:"contentType"`
+	Size        int64             `json:"size"`
+	ParentID    string            `json:"parentId,omitempty"` // Set on derived files
+	Role        string            `json:"role,omitempty"`     // Role of a derived file relative to its parent
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Derived     map[string]string `json:"derived,omitempty"` // role -> derived file ID
+	SharePolicy *SharePolicy      `json:"sharePolicy,omitempty"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
+}
+
+// Catalog is an index of file entries persisted to a JSON file, with a search
+// index of timed text persisted next to it
+type Catalog struct {
+	path       string
+	entries    map[string]*Entry
+	texts      map[string]*indexedText // derived file ID -> indexed text
+	textsDirty bool
+	mu         sync.RWMutex
+	saveMu     sync.Mutex
+}
+
+// DefaultCatalog is the catalog used by the application (nil until initialized)
+var DefaultCatalog *Catalog
+
+// Initialize opens the default catalog at the given path
+func Initialize(path string) error {
+	c, err := Open(path)
+	if err != nil {
+		return err
+	}
+	DefaultCatalog = c
+	return nil
+}
+
+// Open loads a catalog from path, starting empty if the file doesn't exist yet
+func Open(path string) (*Catalog, error) {
+	c := &Catalog{
+		path:    path,
+		entries: make(map[string]*Entry),
+	}
+	if err := c.loadTexts(); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog: %w", err)
+	}
+
+	var entries []*Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse catalog: %w", err)
+	}
+	for _, entry := range entries {
+		c.entries[entry.ID] = entry
+	}
+
+	return c, nil
+}
+
+// Get returns a copy of the entry with the given ID
+func (c *Catalog) Get(id string) (Entry, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[id]
+	if !ok {
+		return Entry{}, false
+	}
+	return entry.clone(), true
+}
+
+// Put adds or replaces an entry, keeping the links to derived files and the
+// share policy already recorded
+func (c *Catalog) Put(entry Entry) error {
+	c.mu.Lock()
+	if existing, ok := c.entries[entry.ID]; ok {
+		if entry.Derived == nil {
+			entry.Derived = existing.Derived
+		}
+		if entry.SharePolicy == nil {
+			entry.SharePolicy = existing.SharePolicy
+		}
+	}
+	entry.UpdatedAt = time.Now()
+	stored := entry.clone()
+	c.entries[entry.ID] = &stored
+	c.mu.Unlock()
+
+	return c.save()
+}
+
+// SetMetadata merges metadata into an entry, creating a minimal entry if needed
+func (c *Catalog) SetMetadata(id, storageType string, metadata map[string]string) error {
+	c.mu.Lock()
+	entry, ok := c.entries[id]
+	if !ok {
+		entry = &Entry{ID: id, StorageType: storageType}
+		c.entries[id] = entry
+	}
+	if entry.Metadata == nil {
+		entry.Metadata = make(map[string]string)
+	}
+	for k, v := range metadata {
+		entry.Metadata[k] = v
+	}
+	entry.UpdatedAt = time.Now()
+	c.mu.Unlock()
+
+	return c.save()
+}
+
+// AddDerivedFiles records children as derived files of parentID, saving the
+// catalog once. Besides files with the same role as a child, files in a role
+// group (see roleGroup) the children write to but that none of them replace
+// are unlinked, as they are left over from an earlier run. It returns the IDs
+// of the unlinked files.
+func (c *Catalog) AddDerivedFiles(parentID string, children []Entry) ([]string, error) {
+	c.mu.Lock()
+	parent, ok := c.entries[parentID]
+	if !ok {
+		parent = &Entry{ID: parentID, StorageType: children[0].StorageType}
+		c.entries[parentID] = parent
+	}
+	if parent.Derived == nil {
+		parent.Derived = make(map[string]string)
+	}
+
+	roles := make(map[string]bool, len(children))
+	groups := make(map[string]bool)
+	for _, child := range children {
+		roles[child.Role] = true
+		if group := roleGroup(child.Role); group != "" {
+			groups[group] = true
+		}
+	}
+
+	var replaced []string
+	unlink := func(id string) {
+		delete(c.entries, id)
+		c.dropText(id)
+		replaced = append(replaced, id)
+	}
+	for role, id := range parent.Derived {
+		if !roles[role] && groups[roleGroup(role)] {
+			delete(parent.Derived, role)
+			unlink(id)
+		}
+	}
+
+	now := time.Now()
+	for _, child := range children {
+		previous := parent.Derived[child.Role]
+		parent.Derived[child.Role] = child.ID
+
+		child.ParentID = parentID
+		child.UpdatedAt = now
+		stored := child.clone()
+		c.entries[child.ID] = &stored
+
+		if previous != "" && previous != child.ID {
+			unlink(previous)
+		}
+	}
+	parent.UpdatedAt = now
+	c.mu.Unlock()
+
+	return replaced, c.save()
+}
+
+// roleGroup returns the group of a derived file role whose files a new run
+// replaces together: the top directory of a stream path, such as "stream:hls/"
+// for "stream:hls/720p/seg_00001.ts". A run with a shorter bitrate ladder or
+// fewer thumbnails then leaves no stale files behind. Other roles have no group.
+func roleGroup(role string) string {
+	path, ok := strings.CutPrefix(role, processors.StreamRolePrefix)
+	if !ok {
+		return ""
+	}
+	dir, _, ok := strings.Cut(path, "/")
+	if !ok {
+		return ""
+	}
+	return processors.StreamRolePrefix + dir + "/"
+}
+
+// DerivedID returns the ID of the file derived from parentID with the given role
+func (c *Catalog) DerivedID(parentID, role string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	parent, ok := c.entries[parentID]
+	if !ok {
+		return "", false
+	}
+	id, ok := parent.Derived[role]
+	return id, ok
+}
+
+// Derived returns the entries derived from parentID
+func (c *Catalog) Derived(parentID string) []Entry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	parent, ok := c.entries[parentID]
+	if !ok {
+		return nil
+	}
+
+	var derived []Entry
+	for _, id := range parent.Derived {
+		if entry, ok := c.entries[id]; ok {
+			derived = append(derived, entry.clone())
+		}
+	}
+	sort.Slice(derived, func(i, j int) bool {
+		return derived[i].Role < derived[j].Role
+	})
+	return derived
+}
+
+// Remove deletes an entry and everything derived from it, returning the IDs of
+// the removed derived entries so their files can be deleted too
+func (c *Catalog) Remove(id string) ([]string, error) {
+	c.mu.Lock()
+	var removed []string
+	var remove func(id string)
+	remove = func(id string) {
+		entry, ok := c.entries[id]
+		if !ok {
+			return
+		}
+		delete(c.entries, id)
+		c.dropText(id)
+		for _, childID := range entry.Derived {
+			removed = append(removed, childID)
+			remove(childID)
+		}
+		if parent, ok := c.entries[entry.ParentID]; ok {
+			for role, childID := range parent.Derived {
+				if childID == id {
+					delete(parent.Derived, role)
+				}
+			}
+		}
+	}
+	remove(id)
+	c.mu.Unlock()
+
+	return removed, c.save()
+}
+
+// All returns every entry, ordered by ID
+func (c *Catalog) All() []Entry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entries := make([]Entry, 0, len(c.entries))
+	for _, entry := range c.entries {
+		entries = append(entries, entry.clone())
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+// save writes the catalog to disk
+func (c *Catalog) save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+
+	data, err := json.MarshalIndent(c.All(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode catalog: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create catalog directory: %w", err)
+	}
+
+	// Write to a temporary file first so a crash can't leave a truncated catalog
+	tmpFile := c.path + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write catalog: %w", err)
+	}
+	if err := os.Rename(tmpFile, c.path); err != nil {
+		return err
+	}
+	return c.saveTexts()
+}
+
+// clone returns a deep copy of the entry
+func (e *Entry) clone() Entry {
+	copied := *e
+	if e.Metadata != nil {
+		copied.Metadata = make(map[string]string, len(e.Metadata))
+		for k, v := range e.Metadata {
+			copied.Metadata[k] = v
+		}
+	}
+	if e.Derived != nil {
+		copied.Derived = make(map[string]string, len(e.Derived))
+		for k, v := range e.Derived {
+			copied.Derived[k] = v
+		}
+	}
+	return copied
+}
+
+// StoreDerived stores derived files through the provider, links them to the
+// parent file in the default catalog and returns a role -> file ID map.
+// Files replaced by a newer derived file with the same role are deleted.
+func StoreDerived(ctx context.Context, provider storage.Provider, storageType, parentID string, files []processors.DerivedFile) (map[string]string, error) {
+	entries, err := StoreFiles(ctx, provider, storageType, parentID, files)
+	RecordDerived(ctx, provider, parentID, entries)
+
+	stored := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		stored[entry.Role] = entry.ID
+	}
+	return stored, err
+}
+
+// StoreFiles stores derived files through the provider without recording them
+// in the catalog. Remote workers use it and report the entries back to the server.
+func StoreFiles(ctx context.Context, provider storage.Provider, storageType, parentID string, files []processors.DerivedFile) ([]Entry, error) {
+	entries := make([]Entry, 0, len(files))
+
+	for _, file := range files {
+		content, size, err := file.Open()
+		if err != nil {
+			return entries, fmt.Errorf("failed to read derived file %s: %w", file.Name, err)
+		}
+		entry, err := storeFile(ctx, provider, storageType, parentID, file, content, size)
+		content.Close()
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// StoreDerivedStream stores a derived file whose content is read from a
+// reader rather than held in file.Data, and links it to the parent file in the
+// default catalog. Conversions use it for outputs that may not fit in memory.
+func StoreDerivedStream(ctx context.Context, provider storage.Provider, storageType, parentID string, file processors.DerivedFile, content io.Reader, size int64) (Entry, error) {
+	entry, err := storeFile(ctx, provider, storageType, parentID, file, content, size)
+	if err != nil {
+		return Entry{}, err
+	}
+	RecordDerived(ctx, provider, parentID, []Entry{entry})
+	return entry, nil
+}
+
+// storeFile stores one derived file with metadata describing its origin
+func storeFile(ctx context.Context, provider storage.Provider, storageType, parentID string, file processors.DerivedFile, content io.Reader, size int64) (Entry, error) {
+	metadata := map[string]string{
+		"filename":    file.Name,
+		"contentType": file.ContentType,
+		"derivedFrom": parentID,
+		"role":        file.Role,
+		"uploadedAt":  time.Now().Format(time.RFC3339),
+	}
+	for k, v := range file.Metadata {
+		if _, exists := metadata[k]; !exists {
+			metadata[k] = v
+		}
+	}
+
+	id, err := provider.Store(ctx, file.Name, content, size, metadata)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to store derived file %s: %w", file.Name, err)
+	}
+
+	return Entry{
+		ID:          id,
+		StorageType: storageType,
+		Name:        file.Name,
+		ContentType: file.ContentType,
+		Size:        size,
+		Role:        file.Role,
+		Metadata:    metadata,
+	}, nil
+}
+
+// RecordDerived links stored derived files to their parent in the default
+// catalog, deleting files they replace or leave over from an earlier run and
+// indexing searchable text tracks
+func RecordDerived(ctx context.Context, provider storage.Provider, parentID string, entries []Entry) {
+	if DefaultCatalog == nil || len(entries) == 0 {
+		return
+	}
+
+	replaced, err := DefaultCatalog.AddDerivedFiles(parentID, entries)
+	if err != nil {
+		log.Printf("Failed to record derived files of %s in catalog: %v", parentID, err)
+	}
+	for _, id := range replaced {
+		if err := provider.Delete(ctx, id); err != nil {
+			log.Printf("Failed to delete replaced derived file %s: %v", id, err)
+		}
+	}
+	for _, entry := range entries {
+		if entry.Metadata[processors.MetadataSearchable] != "" {
+			if err := indexDerivedText(ctx, provider, parentID, entry); err != nil {
+				log.Printf("Failed to index text of derived file %s: %v", entry.ID, err)
+			}
+		}
+	}
+}
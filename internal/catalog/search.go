@@ -0,0 +1,260 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/example/fileprocessor/internal/processors"
+	"github.com/example/fileprocessor/internal/storage"
+)
+
+// DefaultSearchLimit is the number of hits returned when a search sets no limit
+const DefaultSearchLimit = 50
+
+// TextDocument is the timed text of a derived file, such as a subtitle or
+// chapter track, indexed for search
+type TextDocument struct {
+	ID       string           `json:"id"`     // ID of the derived file
+	FileID   string           `json:"fileId"` // ID of the file it was derived from
+	Role     string           `json:"role"`
+	Kind     string           `json:"kind"` // e.g. "subtitles" or "chapters"
+	Language string           `json:"language,omitempty"`
+	Cues     []processors.Cue `json:"cues"`
+}
+
+// SearchHit is a cue matching a search
+type SearchHit struct {
+	FileID     string  `json:"fileId"`
+	FileName   string  `json:"fileName,omitempty"`
+	DocumentID string  `json:"documentId"`
+	Role       string  `json:"role"`
+	Kind       string  `json:"kind"`
+	Language   string  `json:"language,omitempty"`
+	Start      float64 `json:"start"` // In seconds
+	End        float64 `json:"end"`   // In seconds
+	Text       string  `json:"text"`
+}
+
+// indexedText is a text document with the cues each of its terms appears in
+type indexedText struct {
+	doc   TextDocument
+	terms map[string][]int
+}
+
+// newIndexedText tokenizes the cues of a document
+func newIndexedText(doc TextDocument) *indexedText {
+	indexed := &indexedText{doc: doc, terms: make(map[string][]int)}
+	for i, cue := range doc.Cues {
+		seen := make(map[string]bool)
+		for _, term := range searchTerms(cue.Text) {
+			if !seen[term] {
+				seen[term] = true
+				indexed.terms[term] = append(indexed.terms[term], i)
+			}
+		}
+	}
+	return indexed
+}
+
+// matches returns the cues containing term, or any term it prefixes
+func (t *indexedText) matches(term string, prefix bool) map[int]bool {
+	cues := make(map[int]bool)
+	for _, i := range t.terms[term] {
+		cues[i] = true
+	}
+	if prefix {
+		for indexed, positions := range t.terms {
+			if strings.HasPrefix(indexed, term) {
+				for _, i := range positions {
+					cues[i] = true
+				}
+			}
+		}
+	}
+	return cues
+}
+
+// searchTerms splits text into lower-case words
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// IndexText adds a text document to the search index, replacing a document
+// with the same ID
+func (c *Catalog) IndexText(doc TextDocument) error {
+	c.mu.Lock()
+	if c.texts == nil {
+		c.texts = make(map[string]*indexedText)
+	}
+	c.texts[doc.ID] = newIndexedText(doc)
+	c.textsDirty = true
+	c.mu.Unlock()
+
+	return c.save()
+}
+
+// dropText removes a document from the search index; the caller holds c.mu
+func (c *Catalog) dropText(id string) {
+	if _, ok := c.texts[id]; ok {
+		delete(c.texts, id)
+		c.textsDirty = true
+	}
+}
+
+// Search returns the cues containing every word of query, the last word also
+// matching as a prefix so partly typed queries find results. Hits are ordered
+// by file, track and time.
+func (c *Catalog) Search(query string, limit int) []SearchHit {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var hits []SearchHit
+	for _, text := range c.texts {
+		var cues map[int]bool
+		for i, term := range terms {
+			matched := text.matches(term, i == len(terms)-1)
+			if cues == nil {
+				cues = matched
+				continue
+			}
+			for cue := range cues {
+				if !matched[cue] {
+					delete(cues, cue)
+				}
+			}
+		}
+
+		var fileName string
+		if parent, ok := c.entries[text.doc.FileID]; ok {
+			fileName = parent.Name
+		}
+		for i := range cues {
+			cue := text.doc.Cues[i]
+			hits = append(hits, SearchHit{
+				FileID:     text.doc.FileID,
+				FileName:   fileName,
+				DocumentID: text.doc.ID,
+				Role:       text.doc.Role,
+				Kind:       text.doc.Kind,
+				Language:   text.doc.Language,
+				Start:      cue.Start,
+				End:        cue.End,
+				Text:       cue.Text,
+			})
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].FileID != hits[j].FileID {
+			return hits[i].FileID < hits[j].FileID
+		}
+		if hits[i].Role != hits[j].Role {
+			return hits[i].Role < hits[j].Role
+		}
+		return hits[i].Start < hits[j].Start
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// textIndexPath returns the path of the search index kept next to the catalog
+func textIndexPath(catalogPath string) string {
+	return strings.TrimSuffix(catalogPath, filepath.Ext(catalogPath)) + ".text.json"
+}
+
+// loadTexts reads the search index kept next to the catalog, if any
+func (c *Catalog) loadTexts() error {
+	c.texts = make(map[string]*indexedText)
+	if c.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(textIndexPath(c.path))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read search index: %w", err)
+	}
+
+	var docs []TextDocument
+	if err := json.Unmarshal(data, &docs); err != nil {
+		return fmt.Errorf("failed to parse search index: %w", err)
+	}
+	for _, doc := range docs {
+		c.texts[doc.ID] = newIndexedText(doc)
+	}
+	return nil
+}
+
+// saveTexts writes the search index if it changed since it was last written;
+// the caller holds c.saveMu
+func (c *Catalog) saveTexts() error {
+	c.mu.Lock()
+	if !c.textsDirty {
+		c.mu.Unlock()
+		return nil
+	}
+	docs := make([]TextDocument, 0, len(c.texts))
+	for _, text := range c.texts {
+		docs = append(docs, text.doc)
+	}
+	c.textsDirty = false
+	c.mu.Unlock()
+
+	sort.Slice(docs, func(i, j int) bool { return docs[i].ID < docs[j].ID })
+	data, err := json.Marshal(docs)
+	if err != nil {
+		return fmt.Errorf("failed to encode search index: %w", err)
+	}
+
+	path := textIndexPath(c.path)
+	tmpFile := path + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write search index: %w", err)
+	}
+	return os.Rename(tmpFile, path)
+}
+
+// indexDerivedText reads a stored WebVTT track flagged as searchable and adds
+// its cues to the search index of the default catalog
+func indexDerivedText(ctx context.Context, provider storage.Provider, parentID string, entry Entry) error {
+	reader, _, err := provider.Retrieve(ctx, entry.ID)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve %s: %w", entry.ID, err)
+	}
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", entry.ID, err)
+	}
+
+	return DefaultCatalog.IndexText(TextDocument{
+		ID:       entry.ID,
+		FileID:   parentID,
+		Role:     entry.Role,
+		Kind:     entry.Metadata[processors.MetadataSearchable],
+		Language: entry.Metadata["language"],
+		Cues:     processors.ParseWebVTT(data),
+	})
+}
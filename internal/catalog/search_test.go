@@ -0,0 +1,123 @@
+package catalog
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/example/fileprocessor/internal/processors"
+)
+
+// indexTracks adds a video with English subtitles and chapters, and a
+// second video with French subtitles, to the catalog and its search index
+func indexTracks(t *testing.T, c *Catalog) {
+	t.Helper()
+	for _, entry := range []Entry{{ID: "video-1", Name: "onboarding.mp4"}, {ID: "video-2", Name: "security.mp4"}} {
+		if err := c.Put(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, doc := range []TextDocument{
+		{ID: "subs-1", FileID: "video-1", Role: "stream:subtitles/subtitles-2-eng.vtt", Kind: "subtitles", Language: "eng", Cues: []processors.Cue{
+			{Start: 30, End: 32, Text: "Your badge opens the front door."},
+			{Start: 1, End: 4, Text: "Welcome to the onboarding course!"},
+			{Start: 60, End: 62, Text: "Keep your badge with you."},
+		}},
+		{ID: "chapters-1", FileID: "video-1", Role: "stream:chapters.vtt", Kind: "chapters", Cues: []processors.Cue{
+			{Start: 0, End: 60, Text: "Welcome"},
+			{Start: 60, End: 120, Text: "Badges and doors"},
+		}},
+		{ID: "subs-2", FileID: "video-2", Role: "stream:subtitles/subtitles-2-fre.vtt", Kind: "subtitles", Language: "fre", Cues: []processors.Cue{
+			{Start: 5, End: 7, Text: "Bienvenue à la formation sécurité"},
+		}},
+	} {
+		if err := c.IndexText(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// hitKeys describes search hits by document and start time
+func hitKeys(hits []SearchHit) []string {
+	keys := []string{}
+	for _, hit := range hits {
+		keys = append(keys, fmt.Sprintf("%s@%g", hit.DocumentID, hit.Start))
+	}
+	return keys
+}
+
+func TestSearch(t *testing.T) {
+	c := openCatalog(t)
+	indexTracks(t, c)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// Hits are ordered by file, then track role, then time
+		{"welcome", []string{"chapters-1@0", "subs-1@1"}},
+		{"KEEP!", []string{"subs-1@60"}},
+		// The last word also matches as a prefix
+		{"badge", []string{"chapters-1@60", "subs-1@30", "subs-1@60"}},
+		{"bad", []string{"chapters-1@60", "subs-1@30", "subs-1@60"}},
+		// Every word has to appear in the cue, the others whole
+		{"door badge", []string{"subs-1@30"}},
+		{"badge doors", []string{}},
+		{"badges door", []string{"chapters-1@60"}},
+		{"sécurité", []string{"subs-2@5"}},
+		{"form", []string{"subs-2@5"}},
+		{"missing", []string{}},
+	}
+	for _, tt := range tests {
+		if got := hitKeys(c.Search(tt.query, 0)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	if hits := c.Search("  !? ", 0); hits != nil {
+		t.Errorf("Search without words = %+v, want nil", hits)
+	}
+	if hits := c.Search("bad", 2); len(hits) != 2 || hits[0].DocumentID != "chapters-1" {
+		t.Errorf("limited search = %v, want the first two hits", hitKeys(hits))
+	}
+
+	hit := c.Search("bienvenue", 0)[0]
+	want := SearchHit{FileID: "video-2", FileName: "security.mp4", DocumentID: "subs-2", Role: "stream:subtitles/subtitles-2-fre.vtt",
+		Kind: "subtitles", Language: "fre", Start: 5, End: 7, Text: "Bienvenue à la formation sécurité"}
+	if hit != want {
+		t.Errorf("hit = %+v, want %+v", hit, want)
+	}
+}
+
+func TestSearchIndexPersistence(t *testing.T) {
+	c := openCatalog(t)
+	indexTracks(t, c)
+
+	// The index is saved next to the catalog and loaded with it
+	reopened, err := Open(c.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hitKeys(reopened.Search("keep", 0)); !reflect.DeepEqual(got, []string{"subs-1@60"}) {
+		t.Errorf("search after reopening = %v", got)
+	}
+
+	// Re-indexing a document replaces it
+	if err := reopened.IndexText(TextDocument{ID: "subs-1", FileID: "video-1", Cues: []processors.Cue{{Start: 9, End: 10, Text: "Replaced"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := hitKeys(reopened.Search("keep", 0)); !reflect.DeepEqual(got, []string{}) {
+		t.Errorf("search after replacing = %v, want none", got)
+	}
+
+	// Removing a file drops its indexed tracks
+	if err := reopened.Put(Entry{ID: "subs-2", ParentID: "video-2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Remove("subs-2"); err != nil {
+		t.Fatal(err)
+	}
+	if hits := reopened.Search("bienvenue", 0); len(hits) != 0 {
+		t.Errorf("removed track still found: %v", hitKeys(hits))
+	}
+}
@@ -0,0 +1,62 @@
+package catalog
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/example/fileprocessor/internal/processors"
+)
+
+// SharePolicy lists the redactions and watermark an image must carry when it
+// is served. Policies are replaced as a whole and never modified in place, so
+// entries can share them between copies.
+type SharePolicy struct {
+	processors.ProtectOptions
+	Downloads bool      `json:"downloads"` // Apply to downloads of the original
+	Previews  bool      `json:"previews"`  // Apply to previews and thumbnails
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Validate normalizes the policy and checks it is complete. A policy that
+// names neither downloads nor previews applies to both.
+func (p *SharePolicy) Validate() error {
+	if err := p.ProtectOptions.Validate(); err != nil {
+		return err
+	}
+	if !p.Downloads && !p.Previews {
+		p.Downloads, p.Previews = true, true
+	}
+	return nil
+}
+
+// SharePolicy returns the share policy of entry id, if it has one
+func (c *Catalog) SharePolicy(id string) (*SharePolicy, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[id]
+	if !ok || entry.SharePolicy == nil {
+		return nil, false
+	}
+	return entry.SharePolicy, true
+}
+
+// SetSharePolicy sets the share policy of entry id, or removes it when policy is nil
+func (c *Catalog) SetSharePolicy(id string, policy *SharePolicy) error {
+	c.mu.Lock()
+	entry, ok := c.entries[id]
+	if !ok {
+		c.mu.Unlock()
+		return fmt.Errorf("file %s not found in catalog", id)
+	}
+	if policy != nil {
+		stored := *policy
+		stored.UpdatedAt = time.Now()
+		policy = &stored
+	}
+	entry.SharePolicy = policy
+	entry.UpdatedAt = time.Now()
+	c.mu.Unlock()
+
+	return c.save()
+}
@@ -0,0 +1,123 @@
+package catalog
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/example/fileprocessor/internal/processors"
+)
+
+// DefaultSimilarityThreshold is the largest Hamming distance between two
+// 64-bit image hashes for the images to count as visually similar
+const DefaultSimilarityThreshold = 10
+
+// Match is an entry similar to another one
+type Match struct {
+	Entry    Entry `json:"entry"`
+	Distance int   `json:"distance"` // Hamming distance between the hashes
+}
+
+// hashedEntry is an entry with a parsed image hash
+type hashedEntry struct {
+	entry *Entry
+	hash  uint64
+}
+
+// hashedEntries returns the entries that have a valid hash under the metadata key
+func (c *Catalog) hashedEntries(key string) []hashedEntry {
+	var hashed []hashedEntry
+	for _, entry := range c.entries {
+		value, ok := entry.Metadata[key]
+		if !ok {
+			continue
+		}
+		if hash, err := processors.ParseImageHash(value); err == nil {
+			hashed = append(hashed, hashedEntry{entry: entry, hash: hash})
+		}
+	}
+
+	// Map order is random; sort so results are stable
+	sort.Slice(hashed, func(i, j int) bool { return hashed[i].entry.ID < hashed[j].entry.ID })
+	return hashed
+}
+
+// Similar returns the entries whose image hash under key (processors.MetadataPHash
+// or processors.MetadataDHash) is within threshold of the hash of entry id,
+// closest first
+func (c *Catalog) Similar(id, key string, threshold int) ([]Match, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[id]
+	if !ok {
+		return nil, fmt.Errorf("file %s not found in catalog", id)
+	}
+	hash, err := processors.ParseImageHash(entry.Metadata[key])
+	if err != nil {
+		return nil, fmt.Errorf("file %s has no %s hash; process it as an image first", id, key)
+	}
+
+	matches := []Match{}
+	for _, other := range c.hashedEntries(key) {
+		if other.entry.ID == id {
+			continue
+		}
+		if distance := processors.HammingDistance(hash, other.hash); distance <= threshold {
+			matches = append(matches, Match{Entry: other.entry.clone(), Distance: distance})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Distance < matches[j].Distance })
+	return matches, nil
+}
+
+// Clusters groups the entries whose image hashes under key are within
+// threshold of each other. Similarity is transitive within a cluster: two
+// images end up together when a chain of similar images links them. Only
+// clusters of two or more entries are returned, largest first.
+func (c *Catalog) Clusters(key string, threshold int) [][]Entry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	hashed := c.hashedEntries(key)
+
+	// Union-find over every pair of similar images
+	parent := make([]int, len(hashed))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range hashed {
+		for j := i + 1; j < len(hashed); j++ {
+			if processors.HammingDistance(hashed[i].hash, hashed[j].hash) <= threshold {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	groups := make(map[int][]Entry)
+	for i, h := range hashed {
+		root := find(i)
+		groups[root] = append(groups[root], h.entry.clone())
+	}
+
+	clusters := [][]Entry{}
+	for _, group := range groups {
+		if len(group) > 1 {
+			clusters = append(clusters, group)
+		}
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i]) != len(clusters[j]) {
+			return len(clusters[i]) > len(clusters[j])
+		}
+		return clusters[i][0].ID < clusters[j][0].ID
+	})
+	return clusters
+}
@@ -0,0 +1,121 @@
+package catalog
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/example/fileprocessor/internal/processors"
+)
+
+// openCatalog opens an empty catalog in a temporary directory
+func openCatalog(t *testing.T) *Catalog {
+	t.Helper()
+	c, err := Open(filepath.Join(t.TempDir(), "catalog.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// putHashed adds an image entry with a pHash
+func putHashed(t *testing.T, c *Catalog, id string, hash uint64) {
+	t.Helper()
+	err := c.Put(Entry{ID: id, StorageType: "local", Name: id, ContentType: "image/png",
+		Metadata: map[string]string{processors.MetadataPHash: processors.FormatImageHash(hash)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// clusterIDs returns the IDs of the entries of each cluster
+func clusterIDs(clusters [][]Entry) [][]string {
+	ids := make([][]string, len(clusters))
+	for i, cluster := range clusters {
+		for _, entry := range cluster {
+			ids[i] = append(ids[i], entry.ID)
+		}
+	}
+	return ids
+}
+
+func TestClusters(t *testing.T) {
+	c := openCatalog(t)
+	// a, b and c are linked by a chain: a-b and b-c are 3 bits apart, a-c 6
+	putHashed(t, c, "a", 0)
+	putHashed(t, c, "b", 0b111)
+	putHashed(t, c, "c", 0b111111)
+	// d and e are a pair far from the chain
+	putHashed(t, c, "d", 0xff00000000000000)
+	putHashed(t, c, "e", 0xff00000000000001)
+	putHashed(t, c, "lonely", 0x00ff00ff00ff0000)
+	// Entries without a valid hash are left out
+	if err := c.Put(Entry{ID: "text", Name: "notes.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Put(Entry{ID: "bad", Metadata: map[string]string{processors.MetadataPHash: "not a hash"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		threshold int
+		want      [][]string
+	}{
+		{0, [][]string{}},
+		{1, [][]string{{"d", "e"}}},
+		{3, [][]string{{"a", "b", "c"}, {"d", "e"}}},
+		{64, [][]string{{"a", "b", "c", "d", "e", "lonely"}}},
+	}
+	for _, tt := range tests {
+		if got := clusterIDs(c.Clusters(processors.MetadataPHash, tt.threshold)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("threshold %d: clusters = %v, want %v", tt.threshold, got, tt.want)
+		}
+	}
+
+	// Clusters only look at the requested hash
+	if clusters := c.Clusters(processors.MetadataDHash, 64); len(clusters) != 0 {
+		t.Errorf("dHash clusters = %v, want none", clusterIDs(clusters))
+	}
+}
+
+func TestSimilar(t *testing.T) {
+	c := openCatalog(t)
+	putHashed(t, c, "a", 0)
+	putHashed(t, c, "far", 0xffff)
+	putHashed(t, c, "near", 0b1)
+	putHashed(t, c, "near-too", 0b10)
+	putHashed(t, c, "mid", 0b111)
+
+	matches, err := c.Similar("a", processors.MetadataPHash, DefaultSimilarityThreshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range matches {
+		got = append(got, m.Entry.ID)
+		if m.Distance != processors.HammingDistance(0, mustParse(t, m.Entry.Metadata[processors.MetadataPHash])) {
+			t.Errorf("%s: distance %d doesn't match its hash", m.Entry.ID, m.Distance)
+		}
+	}
+	// Closest first, ties by ID, and never the file itself
+	if want := []string{"near", "near-too", "mid"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("similar = %v, want %v", got, want)
+	}
+
+	if _, err := c.Similar("missing", processors.MetadataPHash, 10); err == nil {
+		t.Error("expected an error for an unknown file")
+	}
+	if _, err := c.Similar("a", processors.MetadataDHash, 10); err == nil {
+		t.Error("expected an error for a file without that hash")
+	}
+}
+
+// mustParse parses a hash formatted by processors.FormatImageHash
+func mustParse(t *testing.T, s string) uint64 {
+	t.Helper()
+	hash, err := processors.ParseImageHash(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
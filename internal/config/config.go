@@ -8,15 +8,18 @@ import (
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 )
 
 // Settings holds the application configuration
 type Settings struct {
-	Server   ServerConfig  `json:"server"`
-	Storage  StorageConfig `json:"storage"`
-	Workers  WorkerConfig  `json:"workers"`
-	Features FeatureConfig `json:"features"`
-	Auth     AuthConfig    `json:"auth"`
+	Server     ServerConfig     `json:"server"`
+	Storage    StorageConfig    `json:"storage"`
+	Workers    WorkerConfig     `json:"workers"`
+	Features   FeatureConfig    `json:"features"`
+	Auth       AuthConfig       `json:"auth"`
+	Scheduler  SchedulerConfig  `json:"scheduler"`
+	Processors ProcessorsConfig `json:"processors"`
 }
 
 // ServerConfig contains server-related configuration
@@ -24,6 +27,7 @@ type ServerConfig struct {
 	Port            int    `json:"port"`
 	UIDir           string `json:"uiDir"`
 	UploadsDir      string `json:"uploadsDir"`
+	DataDir         string `json:"dataDir"`
 	CertFile        string `json:"certFile"`
 	KeyFile         string `json:"keyFile"`
 	ShutdownTimeout int    `json:"shutdownTimeout"`
@@ -44,6 +48,16 @@ type WorkerConfig struct {
 	Count       int `json:"count"`
 	QueueSize   int `json:"queueSize"`
 	MaxAttempts int `json:"maxAttempts"`
+
+	// RemoteToken is the shared secret remote workers authenticate with;
+	// remote workers are disabled when it is empty
+	RemoteToken string `json:"remoteToken"`
+
+	// LeaseTimeout is how many seconds a remote worker may hold a task without a heartbeat
+	LeaseTimeout int `json:"leaseTimeout"`
+
+	// ServerURL is the coordinating server a process started with --worker connects to
+	ServerURL string `json:"serverURL"`
 }
 
 // FeatureConfig contains feature flags
@@ -62,6 +76,40 @@ type AuthConfig struct {
 	OAuthRedirectURL   string `json:"oauthRedirectURL"`
 }
 
+// ProcessorsConfig contains processor selection settings
+type ProcessorsConfig struct {
+	Disabled   []string       `json:"disabled"`   // Names of processors that are never used
+	Priorities map[string]int `json:"priorities"` // Priority overrides by processor name
+
+	// StripLocation removes GPS metadata from uploaded images before they are stored
+	StripLocation bool `json:"stripLocation"`
+
+	// StreamLadder is the default bitrate ladder of adaptive video streams, as
+	// comma-separated height:kbps pairs (e.g. "1080:5000,720:2800")
+	StreamLadder string `json:"streamLadder"`
+
+	// NormalizeFormats are the formats (mp3, opus, aac) of normalized audio
+	// transcodes, and LoudnessTarget their integrated loudness in LUFS
+	NormalizeFormats []string `json:"normalizeFormats"`
+	LoudnessTarget   float64  `json:"loudnessTarget"`
+
+	// MaxMemoryMB is the largest input in megabytes a processor holds in
+	// memory; larger files are streamed, spooled to temporary files, or
+	// rejected by processors that need the whole file
+	MaxMemoryMB int `json:"maxMemoryMB"`
+
+	// Tools maps external tools (ffmpeg, ffprobe, pdftoppm) to the executables
+	// to run; tools not listed are looked up on PATH
+	Tools map[string]string `json:"tools"`
+}
+
+// SchedulerConfig contains scheduled job configuration
+type SchedulerConfig struct {
+	Enabled       bool   `json:"enabled"`
+	StateFile     string `json:"stateFile"`
+	CheckInterval int    `json:"checkInterval"` // Seconds between checks for due jobs
+}
+
 // AppConfig is the global application configuration
 var AppConfig Settings
 
@@ -73,6 +121,7 @@ func LoadConfig(configFile string) error {
 			Port:            8080,
 			UIDir:           "./ui",
 			UploadsDir:      "./uploads",
+			DataDir:         "./data",
 			ShutdownTimeout: 30,
 			Host:            "0.0.0.0", // Default to all interfaces
 		},
@@ -81,9 +130,10 @@ func LoadConfig(configFile string) error {
 			Local:           map[string]string{"basePath": "./uploads"},
 		},
 		Workers: WorkerConfig{
-			Count:       runtime.NumCPU(),
-			QueueSize:   100,
-			MaxAttempts: 3,
+			Count:        runtime.NumCPU(),
+			QueueSize:    100,
+			MaxAttempts:  3,
+			LeaseTimeout: 60,
 		},
 		Features: FeatureConfig{
 			EnableLAN:             true,
@@ -95,6 +145,11 @@ func LoadConfig(configFile string) error {
 		Auth: AuthConfig{
 			OAuthRedirectURL: "http://localhost:8080/api/auth/callback",
 		},
+		Scheduler: SchedulerConfig{
+			// Off unless asked for: job routes can purge files
+			Enabled:       false,
+			CheckInterval: 30,
+		},
 	}
 
 	// Load from config file if it exists
@@ -139,6 +194,10 @@ func overrideWithEnv() {
 		AppConfig.Server.UploadsDir = uploadsDir
 	}
 
+	if dataDir := os.Getenv("FP_DATA_DIR"); dataDir != "" {
+		AppConfig.Server.DataDir = dataDir
+	}
+
 	if host := os.Getenv("FP_HOST"); host != "" {
 		AppConfig.Server.Host = host
 	}
@@ -157,6 +216,12 @@ func overrideWithEnv() {
 			AppConfig.Workers.Count = wc
 		}
 	}
+	if token := os.Getenv("FP_WORKER_TOKEN"); token != "" {
+		AppConfig.Workers.RemoteToken = token
+	}
+	if serverURL := os.Getenv("FP_SERVER_URL"); serverURL != "" {
+		AppConfig.Workers.ServerURL = serverURL
+	}
 
 	// Feature flags
 	if enableLAN := os.Getenv("FP_ENABLE_LAN"); enableLAN != "" {
@@ -167,6 +232,46 @@ func overrideWithEnv() {
 		AppConfig.Features.EnableAuth = enableAuth == "true" || enableAuth == "1"
 	}
 
+	if enableScheduler := os.Getenv("FP_ENABLE_SCHEDULER"); enableScheduler != "" {
+		AppConfig.Scheduler.Enabled = enableScheduler == "true" || enableScheduler == "1"
+	}
+
+	// Processor config
+	if disabled := os.Getenv("FP_DISABLED_PROCESSORS"); disabled != "" {
+		AppConfig.Processors.Disabled = strings.Split(disabled, ",")
+	}
+	if strip := os.Getenv("FP_STRIP_LOCATION"); strip != "" {
+		AppConfig.Processors.StripLocation = strip == "true" || strip == "1"
+	}
+	if ladder := os.Getenv("FP_STREAM_LADDER"); ladder != "" {
+		AppConfig.Processors.StreamLadder = ladder
+	}
+	if formats := os.Getenv("FP_NORMALIZE_FORMATS"); formats != "" {
+		AppConfig.Processors.NormalizeFormats = strings.Split(formats, ",")
+	}
+	for env, tool := range map[string]string{
+		"FP_FFMPEG_PATH":   "ffmpeg",
+		"FP_FFPROBE_PATH":  "ffprobe",
+		"FP_PDFTOPPM_PATH": "pdftoppm",
+	} {
+		if path := os.Getenv(env); path != "" {
+			if AppConfig.Processors.Tools == nil {
+				AppConfig.Processors.Tools = make(map[string]string)
+			}
+			AppConfig.Processors.Tools[tool] = path
+		}
+	}
+	if maxMemory := os.Getenv("FP_MAX_MEMORY_MB"); maxMemory != "" {
+		if mb, err := strconv.Atoi(maxMemory); err == nil {
+			AppConfig.Processors.MaxMemoryMB = mb
+		}
+	}
+	if target := os.Getenv("FP_LOUDNESS_TARGET"); target != "" {
+		if t, err := strconv.ParseFloat(target, 64); err == nil {
+			AppConfig.Processors.LoudnessTarget = t
+		}
+	}
+
 	// Auth config
 	if clientID := os.Getenv("FP_GOOGLE_CLIENT_ID"); clientID != "" {
 		AppConfig.Auth.GoogleClientID = clientID
@@ -186,6 +291,7 @@ func ensureDirectoriesExist() error {
 	dirs := []string{
 		AppConfig.Server.UIDir,
 		AppConfig.Server.UploadsDir,
+		AppConfig.Server.DataDir,
 	}
 
 	for _, dir := range dirs {
@@ -208,6 +314,14 @@ func ensureDirectoriesExist() error {
 	return nil
 }
 
+// GetSchedulerStateFile returns the path of the file that stores scheduled jobs
+func GetSchedulerStateFile() string {
+	if AppConfig.Scheduler.StateFile != "" {
+		return AppConfig.Scheduler.StateFile
+	}
+	return filepath.Join(AppConfig.Server.DataDir, "schedules.json")
+}
+
 // GetAddressString returns the address string for the server to listen on
 func GetAddressString() string {
 	return fmt.Sprintf("%s:%d", AppConfig.Server.Host, AppConfig.Server.Port)
@@ -0,0 +1,444 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/example/fileprocessor/internal/catalog"
+	"github.com/example/fileprocessor/internal/models"
+	"github.com/example/fileprocessor/internal/processors"
+	"github.com/example/fileprocessor/internal/storage"
+)
+
+// BatchRequest is the body of a request to process files that are already stored
+type BatchRequest struct {
+	FileIDs     []string             `json:"fileIds,omitempty"`
+	Prefix      string               `json:"prefix,omitempty"`
+	StorageType string               `json:"storageType,omitempty"`
+	Options     *BatchProcessOptions `json:"options,omitempty"`
+}
+
+// BatchProcessOptions mirrors processors.ProcessOptions for JSON requests
+type BatchProcessOptions struct {
+	GeneratePreview bool                   `json:"generatePreview"`
+	ExtractMetadata bool                   `json:"extractMetadata"`
+	MaxPreviewSize  int                    `json:"maxPreviewSize"`
+	Options         map[string]interface{} `json:"options,omitempty"`
+	Processor       string                 `json:"processor,omitempty"` // Overrides processor selection by name
+}
+
+// BatchItem tracks the processing of a single file within a batch
+type BatchItem struct {
+	FileID  string `json:"fileId"`
+	Name    string `json:"name"`
+	TaskID  string `json:"taskId"`
+	Status  string `json:"status"` // "pending", "done", "failed"
+	Summary string `json:"summary,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Batch tracks a group of processing tasks submitted together
+type Batch struct {
+	ID          string       `json:"id"`
+	Status      string       `json:"status"` // "running", "completed"
+	StorageType string       `json:"storageType"`
+	Total       int          `json:"total"`
+	Done        int          `json:"done"`
+	Failed      int          `json:"failed"`
+	Pending     int          `json:"pending"`
+	Items       []*BatchItem `json:"items"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	CompletedAt time.Time    `json:"completedAt,omitempty"`
+}
+
+// BatchManager keeps track of submitted batches
+type BatchManager struct {
+	batches map[string]*Batch
+	mu      sync.RWMutex
+}
+
+// batchRetention is how long completed batches are kept for status queries
+const batchRetention = 24 * time.Hour
+
+// NewBatchManager creates a new batch manager
+func NewBatchManager() *BatchManager {
+	return &BatchManager{
+		batches: make(map[string]*Batch),
+	}
+}
+
+// Create registers a new batch for the given files
+func (m *BatchManager) Create(storageType string, files []*models.File) *Batch {
+	batch := &Batch{
+		ID:          fmt.Sprintf("batch-%d", time.Now().UnixNano()),
+		Status:      "running",
+		StorageType: storageType,
+		Total:       len(files),
+		Pending:     len(files),
+		Items:       make([]*BatchItem, 0, len(files)),
+		CreatedAt:   time.Now(),
+	}
+
+	for _, file := range files {
+		batch.Items = append(batch.Items, &BatchItem{
+			FileID: file.ID,
+			Name:   file.Name,
+			TaskID: fmt.Sprintf("%s-%s", batch.ID, file.ID),
+			Status: "pending",
+		})
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Drop old completed batches so the map doesn't grow forever
+	for id, b := range m.batches {
+		if b.Status == "completed" && time.Since(b.CompletedAt) > batchRetention {
+			delete(m.batches, id)
+		}
+	}
+
+	m.batches[batch.ID] = batch
+	return batch
+}
+
+// Get returns a snapshot of a batch by ID
+func (m *BatchManager) Get(id string) (*Batch, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	batch, ok := m.batches[id]
+	if !ok {
+		return nil, false
+	}
+	return batch.snapshot(), true
+}
+
+// Complete records the outcome of one item and returns a snapshot of the batch
+func (m *BatchManager) Complete(batchID string, index int, result *processors.ProcessResult, err error) *Batch {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	batch, ok := m.batches[batchID]
+	if !ok || index < 0 || index >= len(batch.Items) {
+		return nil
+	}
+
+	item := batch.Items[index]
+	if item.Status != "pending" {
+		return batch.snapshot()
+	}
+
+	if err != nil {
+		item.Status = "failed"
+		item.Error = err.Error()
+		batch.Failed++
+	} else {
+		item.Status = "done"
+		if result != nil {
+			item.Summary = result.Summary
+		}
+		batch.Done++
+	}
+	batch.Pending--
+
+	if batch.Pending == 0 {
+		batch.Status = "completed"
+		batch.CompletedAt = time.Now()
+	}
+
+	return batch.snapshot()
+}
+
+// snapshot returns a copy of the batch that is safe to serialize outside the lock
+func (b *Batch) snapshot() *Batch {
+	copied := *b
+	copied.Items = make([]*BatchItem, len(b.Items))
+	for i, item := range b.Items {
+		itemCopy := *item
+		copied.Items[i] = &itemCopy
+	}
+	return &copied
+}
+
+// ProcessFiles handles requests to process files that are already in storage
+func (h *FileHandler) ProcessFiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.FileIDs) == 0 && req.Prefix == "" {
+		sendJSONError(w, "Either fileIds or prefix is required", http.StatusBadRequest)
+		return
+	}
+
+	storageType := req.StorageType
+	if storageType == "" {
+		storageType = "local"
+	}
+
+	provider, err := h.resolveProvider(r, storageType)
+	if err != nil {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	files, err := collectStoredFiles(r.Context(), provider, storageType, req.FileIDs, req.Prefix)
+	if err != nil {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(files) == 0 {
+		sendJSONError(w, "No files matched the request", http.StatusNotFound)
+		return
+	}
+
+	options := defaultProcessOptions()
+	if req.Options != nil {
+		options = processors.ProcessOptions{
+			GeneratePreview: req.Options.GeneratePreview,
+			ExtractMetadata: req.Options.ExtractMetadata,
+			MaxPreviewSize:  req.Options.MaxPreviewSize,
+			Options:         req.Options.Options,
+			Processor:       req.Options.Processor,
+		}
+	}
+	if options.Processor != "" && processors.GetProcessorByName(options.Processor) == nil {
+		sendJSONError(w, fmt.Sprintf("Unknown or disabled processor: %s", options.Processor), http.StatusBadRequest)
+		return
+	}
+
+	batch := h.batches.Create(storageType, files)
+	h.submitBatch(batch, provider, files, options)
+
+	DefaultWebSocketHub.Broadcast("batch_started", map[string]interface{}{
+		"batchId": batch.ID,
+		"total":   batch.Total,
+	})
+
+	response := models.APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Queued %d files for processing", batch.Total),
+		Data:    batch,
+	}
+
+	sendJSONResponse(w, response, http.StatusAccepted)
+}
+
+// GetBatchStatus handles requests for the status of a processing batch
+func (h *FileHandler) GetBatchStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	batchID := r.URL.Query().Get("id")
+	if batchID == "" {
+		sendJSONError(w, "Batch ID is required", http.StatusBadRequest)
+		return
+	}
+
+	batch, ok := h.batches.Get(batchID)
+	if !ok {
+		sendJSONError(w, "Batch not found", http.StatusNotFound)
+		return
+	}
+
+	response := models.APIResponse{
+		Success: true,
+		Data:    batch,
+	}
+
+	sendJSONResponse(w, response, http.StatusOK)
+}
+
+// Batch submission backs off while the worker queue is full, from
+// batchRetryMin up to batchRetryMax between attempts, and gives up on the rest
+// of a batch once the queue has had no room for batchQueueWait
+var (
+	batchRetryMin  = 100 * time.Millisecond
+	batchRetryMax  = 5 * time.Second
+	batchQueueWait = 2 * time.Minute
+)
+
+// submitBatch enqueues one task per file. Submission runs in the background so a
+// batch larger than the queue waits for room instead of failing outright. If the
+// queue stays full too long or the handler is closed, the items not yet
+// submitted are marked failed.
+func (h *FileHandler) submitBatch(batch *Batch, provider storage.Provider, files []*models.File, options processors.ProcessOptions) {
+	go func() {
+		for i, file := range files {
+			index, file := i, file
+			taskID := batch.Items[index].TaskID
+
+			processFn := func() (*processors.ProcessResult, error) {
+				return runProcessor(context.Background(), provider, file, options)
+			}
+			onComplete := func(result *processors.ProcessResult, err error) {
+				h.reportBatchProgress(batch.ID, index, result, err)
+			}
+
+			err := submitWithBackoff(h.ctx, newProcessingTask(taskID, processFn, file, options, onComplete))
+			if err == nil {
+				continue
+			}
+			log.Printf("Failed to submit batch task %s: %v", taskID, err)
+			if errors.Is(err, processors.ErrQueueFull) || h.ctx.Err() != nil {
+				// The rest would wait on the same queue; fail them now
+				for rest := index; rest < len(files); rest++ {
+					h.reportBatchProgress(batch.ID, rest, nil, err)
+				}
+				return
+			}
+			h.reportBatchProgress(batch.ID, index, nil, err)
+		}
+	}()
+}
+
+// submitWithBackoff submits a task, retrying with exponential backoff while the
+// queue is full. It returns ErrQueueFull if the queue has no room within
+// batchQueueWait, or the context's error if it's cancelled first.
+func submitWithBackoff(ctx context.Context, task *processors.Task) error {
+	deadline := time.NewTimer(batchQueueWait)
+	defer deadline.Stop()
+
+	delay := batchRetryMin
+	for {
+		err := processors.Submit(task)
+		if !errors.Is(err, processors.ErrQueueFull) {
+			return err
+		}
+
+		retry := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			retry.Stop()
+			return fmt.Errorf("batch submission stopped: %w", ctx.Err())
+		case <-deadline.C:
+			retry.Stop()
+			return fmt.Errorf("%w: no room for %s", err, batchQueueWait)
+		case <-retry.C:
+		}
+		if delay *= 2; delay > batchRetryMax {
+			delay = batchRetryMax
+		}
+	}
+}
+
+// reportBatchProgress records a finished item and pushes the aggregate progress to subscribers
+func (h *FileHandler) reportBatchProgress(batchID string, index int, result *processors.ProcessResult, err error) {
+	snapshot := h.batches.Complete(batchID, index, result, err)
+	if snapshot == nil {
+		return
+	}
+
+	content := map[string]interface{}{
+		"batchId": snapshot.ID,
+		"total":   snapshot.Total,
+		"done":    snapshot.Done,
+		"failed":  snapshot.Failed,
+		"pending": snapshot.Pending,
+		"item":    snapshot.Items[index],
+	}
+
+	DefaultWebSocketHub.SendTaskUpdate(batchID, "batch_progress", content)
+	if snapshot.Status == "completed" {
+		DefaultWebSocketHub.SendTaskUpdate(batchID, "batch_completed", content)
+	}
+}
+
+// collectStoredFiles builds file models for the requested IDs and for every
+// file under a prefix, each file once. Derived files (thumbnails, variants,
+// stream segments) under the prefix are left out: they are regenerated from
+// their original rather than processed themselves.
+func collectStoredFiles(ctx context.Context, provider storage.Provider, storageType string, ids []string, prefix string) ([]*models.File, error) {
+	var files []*models.File
+	seen := make(map[string]bool)
+
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		reader, metadata, err := provider.Retrieve(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve file %s: %v", id, err)
+		}
+		reader.Close()
+
+		files = append(files, storedFileModel(storage.FileInfo{ID: id, Metadata: metadata}, storageType))
+	}
+
+	if prefix != "" {
+		infos, err := provider.List(ctx, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files: %v", err)
+		}
+		for _, info := range infos {
+			if seen[info.ID] || isDerivedFile(info) {
+				continue
+			}
+			seen[info.ID] = true
+			files = append(files, storedFileModel(info, storageType))
+		}
+	}
+
+	return files, nil
+}
+
+// isDerivedFile reports whether a stored file was derived from another one,
+// according to the catalog or the metadata it was stored with
+func isDerivedFile(info storage.FileInfo) bool {
+	if info.Metadata["derivedFrom"] != "" {
+		return true
+	}
+	if catalog.DefaultCatalog != nil {
+		if entry, ok := catalog.DefaultCatalog.Get(info.ID); ok && entry.ParentID != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// storedFileModel converts storage file info into a file model, filling in
+// the name and content type from the stored metadata when available
+func storedFileModel(info storage.FileInfo, storageType string) *models.File {
+	name := info.Metadata["filename"]
+	if name == "" {
+		name = info.Name
+	}
+	if name == "" {
+		name = info.ID
+	}
+
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = info.Metadata["contentType"]
+	}
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType = processors.GetContentTypeByExt(name)
+	}
+
+	return &models.File{
+		ID:          info.ID,
+		Name:        name,
+		Size:        info.Size,
+		ContentType: contentType,
+		StorageType: storageType,
+		StorageID:   info.ID,
+		Metadata:    info.Metadata,
+	}
+}
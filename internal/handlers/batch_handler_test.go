@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example/fileprocessor/internal/catalog"
+	"github.com/example/fileprocessor/internal/models"
+	"github.com/example/fileprocessor/internal/processors"
+	"github.com/example/fileprocessor/internal/storage"
+)
+
+// writeStored writes a file straight into local storage under a chosen ID,
+// with the metadata file local storage keeps next to it
+func writeStored(t *testing.T, dir, id, content string, metadata map[string]string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, id), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var meta strings.Builder
+	for k, v := range metadata {
+		meta.WriteString(k + "=" + v + "\n")
+	}
+	if err := os.WriteFile(filepath.Join(dir, id+".meta"), []byte(meta.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newBatchStorage returns local storage holding two reports, a thumbnail of
+// the first that local storage knows is derived, and a variant of the second
+// that only the catalog knows is derived
+func newBatchStorage(t *testing.T) (storage.Provider, *catalog.Catalog) {
+	t.Helper()
+	c := useCatalog(t)
+	dir := t.TempDir()
+	provider := storage.NewLocalStorage()
+	if err := provider.Initialize(map[string]string{"basePath": dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	writeStored(t, dir, "report-a.txt", "first report", map[string]string{"filename": "a.txt"})
+	writeStored(t, dir, "report-b.txt", "second report", map[string]string{"filename": "b.txt"})
+	writeStored(t, dir, "report-a-thumb.png", "png", map[string]string{"filename": "thumb.png", "derivedFrom": "report-a.txt"})
+	writeStored(t, dir, "report-b-variant.txt", "variant", nil)
+	writeStored(t, dir, "other.txt", "unrelated", nil)
+
+	if _, err := c.AddDerivedFiles("report-b.txt", []catalog.Entry{{ID: "report-b-variant.txt", StorageType: "local", Role: "variant"}}); err != nil {
+		t.Fatal(err)
+	}
+	return provider, c
+}
+
+// fileIDs returns the IDs of files, sorted
+func fileIDs(files []*models.File) []string {
+	ids := make([]string, len(files))
+	for i, file := range files {
+		ids[i] = file.ID
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestCollectStoredFiles(t *testing.T) {
+	provider, _ := newBatchStorage(t)
+
+	tests := []struct {
+		name   string
+		ids    []string
+		prefix string
+		want   []string
+	}{
+		{"ids", []string{"report-a.txt", "other.txt"}, "", []string{"other.txt", "report-a.txt"}},
+		{"repeated ids", []string{"other.txt", "other.txt"}, "", []string{"other.txt"}},
+		// Derived files are only processed when asked for by ID
+		{"derived by id", []string{"report-a-thumb.png"}, "", []string{"report-a-thumb.png"}},
+		{"prefix skips derived files", nil, "report", []string{"report-a.txt", "report-b.txt"}},
+		{"ids overlapping the prefix", []string{"report-a.txt", "other.txt"}, "report",
+			[]string{"other.txt", "report-a.txt", "report-b.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := collectStoredFiles(context.Background(), provider, "local", tt.ids, tt.prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fileIDs(files); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("files = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := collectStoredFiles(context.Background(), provider, "local", []string{"missing.txt"}, ""); err == nil {
+		t.Error("expected an error for a file that isn't stored")
+	}
+}
+
+func TestStoredFileModel(t *testing.T) {
+	file := storedFileModel(storage.FileInfo{ID: "123-notes", Metadata: map[string]string{"filename": "notes.csv"}}, "local")
+	if file.Name != "notes.csv" || !strings.HasPrefix(file.ContentType, "text/csv") || file.StorageID != "123-notes" {
+		t.Errorf("file = %+v, want notes.csv as CSV stored under 123-notes", file)
+	}
+
+	file = storedFileModel(storage.FileInfo{ID: "raw", ContentType: "application/octet-stream"}, "local")
+	if file.Name != "raw" || file.ContentType != "application/octet-stream" {
+		t.Errorf("file = %+v, want the ID as name", file)
+	}
+}
+
+// postBatch sends a batch processing request
+func postBatch(h *FileHandler, body interface{}) (*httptest.ResponseRecorder, *Batch) {
+	data, _ := json.Marshal(body)
+	rec := httptest.NewRecorder()
+	h.ProcessFiles(rec, httptest.NewRequest(http.MethodPost, "/api/process", bytes.NewReader(data)))
+
+	var resp struct {
+		Data *Batch `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec, resp.Data
+}
+
+// waitForBatch polls the batch status endpoint until the batch completes
+func waitForBatch(t *testing.T, h *FileHandler, id string) *Batch {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		rec := httptest.NewRecorder()
+		h.GetBatchStatus(rec, httptest.NewRequest(http.MethodGet, "/api/process/status?id="+id, nil))
+		var resp struct {
+			Data *Batch `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Data == nil {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		if resp.Data.Status == "completed" {
+			return resp.Data
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("batch %s did not complete", id)
+	return nil
+}
+
+func TestProcessFiles(t *testing.T) {
+	provider, _ := newBatchStorage(t)
+	previous := processors.DefaultPool
+	processors.DefaultPool = processors.NewWorkerPool(2, 10, 1)
+	t.Cleanup(func() {
+		processors.DefaultPool.Stop()
+		processors.DefaultPool = previous
+	})
+	h := NewFileHandler(provider)
+
+	rec, batch := postBatch(h, BatchRequest{FileIDs: []string{"report-a.txt", "other.txt"}, Prefix: "report"})
+	if rec.Code != http.StatusAccepted || batch == nil {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if batch.Total != 3 {
+		t.Errorf("Total = %d, want 3 files, each once", batch.Total)
+	}
+
+	done := waitForBatch(t, h, batch.ID)
+	if done.Done != 3 || done.Failed != 0 || done.Pending != 0 {
+		t.Errorf("batch finished with %d done, %d failed, %d pending; want 3 done", done.Done, done.Failed, done.Pending)
+	}
+	for _, item := range done.Items {
+		if item.Status != "done" || item.Summary == "" {
+			t.Errorf("item %s: %s %q", item.FileID, item.Status, item.Error)
+		}
+	}
+
+	// A forced processor that fails reports each item as failed
+	rec, batch = postBatch(h, BatchRequest{FileIDs: []string{"other.txt"}, Options: &BatchProcessOptions{Processor: "pdf"}})
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if done := waitForBatch(t, h, batch.ID); done.Failed != 1 || done.Items[0].Error == "" {
+		t.Errorf("batch = %+v, want its one item failed", done)
+	}
+}
+
+func TestProcessFilesErrors(t *testing.T) {
+	provider, _ := newBatchStorage(t)
+	h := NewFileHandler(provider)
+
+	tests := []struct {
+		name   string
+		body   interface{}
+		status int
+	}{
+		{"nothing requested", BatchRequest{}, http.StatusBadRequest},
+		{"missing file", BatchRequest{FileIDs: []string{"missing.txt"}}, http.StatusBadRequest},
+		{"no match", BatchRequest{Prefix: "none-"}, http.StatusNotFound},
+		{"unknown processor", BatchRequest{FileIDs: []string{"other.txt"}, Options: &BatchProcessOptions{Processor: "missing"}}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rec, _ := postBatch(h, tt.body); rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.status)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.GetBatchStatus(rec, httptest.NewRequest(http.MethodGet, "/api/process/status?id=batch-missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown batch: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestBatchManagerComplete(t *testing.T) {
+	m := NewBatchManager()
+	batch := m.Create("local", []*models.File{{ID: "a"}, {ID: "b"}})
+
+	m.Complete(batch.ID, 0, &processors.ProcessResult{Summary: "ok"}, nil)
+	// A repeated report for an item is ignored
+	m.Complete(batch.ID, 0, nil, errors.New("late"))
+	snapshot := m.Complete(batch.ID, 1, nil, errors.New("failed"))
+
+	if snapshot.Status != "completed" || snapshot.Done != 1 || snapshot.Failed != 1 || snapshot.Pending != 0 {
+		t.Errorf("batch = %+v, want completed with one done and one failed", snapshot)
+	}
+	if m.Complete(batch.ID, 5, nil, nil) != nil || m.Complete("missing", 0, nil, nil) != nil {
+		t.Error("Complete accepted an unknown item")
+	}
+}
+
+// useFullPool installs a default pool whose one worker is busy and whose
+// queue is full, so every submission fails with ErrQueueFull
+func useFullPool(t *testing.T) {
+	t.Helper()
+	previous := processors.DefaultPool
+	pool := processors.NewWorkerPool(1, 1, 1)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	busy := processors.NewTask("busy", func() (*processors.ProcessResult, error) {
+		close(started)
+		<-release
+		return &processors.ProcessResult{}, nil
+	})
+	if err := pool.Submit(busy); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	queued := processors.NewTask("queued", func() (*processors.ProcessResult, error) {
+		return &processors.ProcessResult{}, nil
+	})
+	if err := pool.Submit(queued); err != nil {
+		t.Fatal(err)
+	}
+	processors.DefaultPool = pool
+	t.Cleanup(func() {
+		close(release)
+		pool.Stop()
+		processors.DefaultPool = previous
+	})
+}
+
+func TestProcessFilesQueueFull(t *testing.T) {
+	provider, _ := newBatchStorage(t)
+	useFullPool(t)
+	saved := [3]time.Duration{batchRetryMin, batchRetryMax, batchQueueWait}
+	t.Cleanup(func() { batchRetryMin, batchRetryMax, batchQueueWait = saved[0], saved[1], saved[2] })
+	batchRetryMin, batchRetryMax, batchQueueWait = time.Millisecond, 10*time.Millisecond, 50*time.Millisecond
+
+	// Once the queue has stayed full past the wait, every item fails with the queue-full error
+	h := NewFileHandler(provider)
+	_, batch := postBatch(h, BatchRequest{FileIDs: []string{"report-a.txt", "other.txt"}})
+	done := waitForBatch(t, h, batch.ID)
+	if done.Failed != 2 {
+		t.Fatalf("batch = %+v, want both items failed", done)
+	}
+	for _, item := range done.Items {
+		if !strings.Contains(item.Error, processors.ErrQueueFull.Error()) {
+			t.Errorf("item %s: error %q, want the queue-full error", item.FileID, item.Error)
+		}
+	}
+
+	// Closing the handler stops the wait without reaching the deadline
+	batchQueueWait = time.Hour
+	h = NewFileHandler(provider)
+	_, batch = postBatch(h, BatchRequest{FileIDs: []string{"report-a.txt", "other.txt"}})
+	h.Close()
+	if done := waitForBatch(t, h, batch.ID); done.Failed != 2 || !strings.Contains(done.Items[1].Error, "stopped") {
+		t.Errorf("batch = %+v, want both items failed as stopped", done)
+	}
+}
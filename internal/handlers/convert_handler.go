@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/example/fileprocessor/internal/catalog"
+	"github.com/example/fileprocessor/internal/models"
+	"github.com/example/fileprocessor/internal/processors"
+)
+
+// convertRolePrefix prefixes the derived file role of converted files
+const convertRolePrefix = "convert:"
+
+// ConvertFile converts a stored CSV or JSON Lines file to another data format
+// and stores the result as a derived file. The file is read twice and the
+// output is written to a temporary file, so large files are never held in memory.
+func (h *FileHandler) ConvertFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fileID := r.PathValue("id")
+	if fileID == "" {
+		sendJSONError(w, "File ID is required", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	to := strings.ToLower(query.Get("to"))
+	if to == "" {
+		sendJSONError(w, "Target format (to) is required", http.StatusBadRequest)
+		return
+	}
+	ext, contentType, ok := processors.FormatFile(to)
+	if !ok {
+		sendJSONError(w, fmt.Sprintf("Unknown target format: %s", to), http.StatusBadRequest)
+		return
+	}
+
+	storageType := query.Get("storageType")
+	if storageType == "" {
+		storageType = "local"
+	}
+	provider, err := h.resolveProvider(r, storageType)
+	if err != nil {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reader, metadata, err := provider.Retrieve(r.Context(), fileID)
+	if err != nil {
+		sendJSONError(w, fmt.Sprintf("Failed to retrieve file: %v", err), http.StatusNotFound)
+		return
+	}
+	reader.Close()
+
+	name := metadata["filename"]
+	if name == "" {
+		name = fileID
+	}
+	from := strings.ToLower(query.Get("from"))
+	if from == "" {
+		from = processors.DataFormat(metadata["contentType"], name)
+	}
+	if from == "" {
+		sendJSONError(w, "Could not tell the format of the file; set from", http.StatusBadRequest)
+		return
+	}
+
+	// CSV dialect overrides, as for uploads
+	options := processors.ProcessOptions{Options: make(map[string]interface{})}
+	for _, key := range []string{"delimiter", "quote", "header"} {
+		if value := query.Get(key); value != "" {
+			options.Options[key] = value
+		}
+	}
+
+	output, err := ioutil.TempFile("", "convert-*"+ext)
+	if err != nil {
+		sendJSONError(w, fmt.Sprintf("Failed to create output file: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(output.Name())
+	defer output.Close()
+
+	open := func() (io.ReadCloser, error) {
+		reader, _, err := provider.Retrieve(r.Context(), fileID)
+		return reader, err
+	}
+	conversion, err := processors.Convert(r.Context(), open, from, to, options, output)
+	if err != nil {
+		status := http.StatusUnprocessableEntity
+		if errors.Is(err, processors.ErrUnsupportedConversion) {
+			status = http.StatusBadRequest
+		}
+		sendJSONError(w, fmt.Sprintf("Failed to convert file: %v", err), status)
+		return
+	}
+
+	size, err := output.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = output.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		sendJSONError(w, fmt.Sprintf("Failed to read converted file: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	derived := processors.DerivedFile{
+		Name:        strings.TrimSuffix(name, filepath.Ext(name)) + ext,
+		Role:        convertRolePrefix + to,
+		ContentType: contentType,
+		Metadata: map[string]string{
+			"convertedFrom": from,
+			"rows":          strconv.Itoa(conversion.Rows),
+		},
+	}
+	entry, err := catalog.StoreDerivedStream(r.Context(), provider, storageType, fileID, derived, output, size)
+	if err != nil {
+		sendJSONError(w, fmt.Sprintf("Failed to store converted file: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := models.APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Converted %d rows from %s to %s", conversion.Rows, from, to),
+		Data: map[string]interface{}{
+			"file":       entry,
+			"conversion": conversion,
+		},
+	}
+	sendJSONResponse(w, response, http.StatusOK)
+}
@@ -2,6 +2,7 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -9,27 +10,85 @@ import (
 	"log"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/example/fileprocessor/internal/catalog"
+	"github.com/example/fileprocessor/internal/config"
 	"github.com/example/fileprocessor/internal/models"
+	"github.com/example/fileprocessor/internal/pipeline"
 	"github.com/example/fileprocessor/internal/processors"
 	"github.com/example/fileprocessor/internal/storage"
-	"github.com/gorilla/mux"
 )
 
 // FileHandler handles file operations
 type FileHandler struct {
 	defaultStorage storage.Provider
+	batches        *BatchManager
+	pipelines      *pipeline.Manager
+
+	// ctx is cancelled by Close, stopping background work such as batch submission
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // NewFileHandler creates a new file handler
 func NewFileHandler(defaultStorage storage.Provider) *FileHandler {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &FileHandler{
 		defaultStorage: defaultStorage,
+		batches:        NewBatchManager(),
+		ctx:            ctx,
+		cancel:         cancel,
 	}
 }
 
+// Close stops the handler's background work. Batch items still waiting for
+// room in the worker queue are marked failed.
+func (h *FileHandler) Close() {
+	h.cancel()
+}
+
+// resolveProvider returns the storage provider for the given type, using the
+// default storage for local files and request parameters for cloud providers
+func (h *FileHandler) resolveProvider(r *http.Request, storageType string) (storage.Provider, error) {
+	if storageType == "" || storageType == "local" {
+		return h.defaultStorage, nil
+	}
+
+	// Check if the requested storage provider is available
+	available, reason := storage.IsProviderAvailable(storageType)
+	if !available {
+		return nil, fmt.Errorf("Storage provider '%s' is unavailable: %s", storageType, reason)
+	}
+
+	// Extract provider configuration from request
+	config := extractStorageConfig(r, storageType)
+	provider, err := storage.CreateProvider(storageType, config)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create storage provider: %v", err)
+	}
+
+	return provider, nil
+}
+
+// configuredProvider returns a storage provider built from the server configuration
+// rather than request parameters, for work that runs without a request
+func (h *FileHandler) configuredProvider(storageType string) (storage.Provider, error) {
+	var providerConfig map[string]string
+	switch storageType {
+	case "local":
+		return h.defaultStorage, nil
+	case "s3", "amazon", "aws":
+		providerConfig = config.AppConfig.Storage.S3
+	case "gcs", "google":
+		providerConfig = config.AppConfig.Storage.Google
+	}
+
+	return storage.CreateProvider(storageType, providerConfig)
+}
+
 // testCloudProviderAvailability attempts to initialize cloud providers with empty configs
 // to check if they're available, and marks them as unavailable if they're not
 func (h *FileHandler) testCloudProviderAvailability() {
@@ -145,8 +204,27 @@ func (h *FileHandler) UploadFile(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Remove location metadata from images before they're stored, if asked to
+	stripLocation := r.FormValue("stripLocation") == "true" || config.AppConfig.Processors.StripLocation
+	var content io.Reader = file
+	isImage := strings.HasPrefix(metadata["contentType"], "image/") ||
+		strings.HasPrefix(processors.GetContentTypeByExt(header.Filename), "image/")
+	if stripLocation && isImage {
+		// Images too large to strip in memory are refused rather than stored
+		// with their location
+		data, err := processors.ReadAllLimited(file)
+		if err != nil {
+			sendJSONError(w, fmt.Sprintf("Failed to read file: %v", err), imageErrorStatus(err, http.StatusInternalServerError))
+			return
+		}
+		if processors.StripLocation(data) {
+			metadata["locationStripped"] = "true"
+		}
+		content = bytes.NewReader(data)
+	}
+
 	// Store the file
-	id, err := provider.Store(r.Context(), header.Filename, file, header.Size, metadata)
+	id, err := provider.Store(r.Context(), header.Filename, content, header.Size, metadata)
 	if err != nil {
 		sendJSONError(w, fmt.Sprintf("Failed to store file: %v", err), http.StatusInternalServerError)
 		return
@@ -163,6 +241,16 @@ func (h *FileHandler) UploadFile(w http.ResponseWriter, r *http.Request) {
 		StorageID:   id,
 		Metadata:    metadata,
 	}
+	recordInCatalog(fileModel)
+
+	// Start a pipeline over the file if requested
+	var pipelineRun *pipeline.Run
+	if pipelineID := r.FormValue("pipeline"); pipelineID != "" && h.pipelines != nil {
+		pipelineRun, err = h.pipelines.Start(pipelineID, provider, fileModel)
+		if err != nil {
+			log.Printf("Warning: Failed to start pipeline %s for %s: %v", pipelineID, fileModel.Name, err)
+		}
+	}
 
 	// Process file if requested
 	var processedFile *models.ProcessedFile
@@ -170,35 +258,55 @@ func (h *FileHandler) UploadFile(w http.ResponseWriter, r *http.Request) {
 		// Create a task ID for tracking
 		taskID := fmt.Sprintf("process-%s-%d", id, time.Now().UnixNano())
 
+		// The request may name the processor to use instead of the automatic choice
+		options := defaultProcessOptions()
+		options.Processor = r.FormValue("processor")
+		options.Options = make(map[string]interface{})
+		if extract := r.FormValue("extract"); extract != "" {
+			options.Options["extract"] = extract
+		}
+		if stripLocation {
+			options.Options["stripLocation"] = true
+		}
+		if stream := r.FormValue("stream"); stream != "" {
+			options.Options["stream"] = stream
+		}
+		if ladder := r.FormValue("streamLadder"); ladder != "" {
+			options.Options["streamLadder"] = ladder
+		}
+		if thumbnails := r.FormValue("thumbnails"); thumbnails != "" {
+			options.Options["thumbnails"] = thumbnails
+		}
+		if r.FormValue("previewClip") == "true" {
+			options.Options["previewClip"] = true
+		}
+		if r.FormValue("extractTracks") == "true" {
+			options.Options["extractTracks"] = true
+		}
+		if r.FormValue("loudness") == "true" {
+			options.Options["loudness"] = true
+		}
+		if normalize := r.FormValue("normalize"); normalize != "" {
+			options.Options["normalize"] = normalize
+		}
+		if delimiter := r.FormValue("delimiter"); delimiter != "" {
+			options.Options["delimiter"] = delimiter
+		}
+		if header := r.FormValue("header"); header != "" {
+			options.Options["header"] = header
+		}
+
 		// Create a task function
 		processFn := func() (*processors.ProcessResult, error) {
-			// Get file content
-			reader, _, err := provider.Retrieve(r.Context(), fileModel.StorageID)
-			if err != nil {
-				return nil, fmt.Errorf("failed to retrieve file: %w", err)
-			}
-			defer reader.Close()
-
-			// Get processor for this file type
-			processor := processors.GetProcessor(fileModel.ContentType, filepath.Ext(fileModel.Name))
-			if processor == nil {
-				return nil, fmt.Errorf("no processor available for file type: %s", fileModel.ContentType)
-			}
-
-			// Process the file with progress reporting
-			options := processors.ProcessOptions{
-				GeneratePreview: true,
-				ExtractMetadata: true,
-				MaxPreviewSize:  1024 * 10, // 10KB
-			}
-
 			// Send processing started notification via WebSocket
 			DefaultWebSocketHub.Broadcast("processing_started", map[string]interface{}{
 				"taskId": taskID,
 				"file":   fileModel,
 			})
 
-			// Report progress updates
+			// Report progress updates until the task finishes
+			done := make(chan struct{})
+			defer close(done)
 			go func() {
 				progress := 0
 				ticker := time.NewTicker(500 * time.Millisecond)
@@ -212,16 +320,19 @@ func (h *FileHandler) UploadFile(w http.ResponseWriter, r *http.Request) {
 							"progress": progress,
 							"file":     fileModel,
 						})
-					case <-r.Context().Done():
+					case <-done:
 						return
 					}
 				}
 			}()
 
 			// Do the actual processing
-			result, err := processor.Process(r.Context(), reader, fileModel.Name, options)
+			return runProcessor(context.Background(), provider, fileModel, options)
+		}
 
-			// Send completion notification via WebSocket
+		// Send completion notification via WebSocket, whether the task ran
+		// here or on a remote worker
+		onComplete := func(result *processors.ProcessResult, err error) {
 			if err != nil {
 				DefaultWebSocketHub.SendTaskUpdate(taskID, "processing_failed", map[string]interface{}{
 					"error": err.Error(),
@@ -233,12 +344,10 @@ func (h *FileHandler) UploadFile(w http.ResponseWriter, r *http.Request) {
 					"summary": result.Summary,
 				})
 			}
-
-			return result, err
 		}
 
 		// Create and submit the task
-		task := processors.NewTask(taskID, processFn)
+		task := newProcessingTask(taskID, processFn, fileModel, options, onComplete)
 		processors.Submit(task)
 
 		// Wait briefly for quick tasks to complete
@@ -261,6 +370,9 @@ func (h *FileHandler) UploadFile(w http.ResponseWriter, r *http.Request) {
 					"status": "processing",
 				},
 			}
+			if pipelineRun != nil {
+				response.Data.(map[string]interface{})["pipelineRun"] = pipelineRun
+			}
 			sendJSONResponse(w, response, http.StatusOK)
 			return
 		}
@@ -278,6 +390,13 @@ func (h *FileHandler) UploadFile(w http.ResponseWriter, r *http.Request) {
 		response.Data = fileModel
 	}
 
+	if pipelineRun != nil {
+		response.Data = map[string]interface{}{
+			"file":        response.Data,
+			"pipelineRun": pipelineRun,
+		}
+	}
+
 	sendJSONResponse(w, response, http.StatusOK)
 }
 
@@ -342,6 +461,12 @@ func (h *FileHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
 		contentType = "application/octet-stream"
 	}
 
+	// Images under a share policy are only served watermarked and redacted
+	if policy, ok := sharePolicyFor(fileID, false); ok {
+		serveProtected(w, reader, policy, filename, "attachment")
+		return
+	}
+
 	w.Header().Set("Content-Type", contentType)
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
 
@@ -559,6 +684,9 @@ func (h *FileHandler) DeleteFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Delete the files derived from it
+	removeFromCatalog(r.Context(), provider, fileID)
+
 	// Send response
 	response := models.APIResponse{
 		Success: true,
@@ -568,11 +696,55 @@ func (h *FileHandler) DeleteFile(w http.ResponseWriter, r *http.Request) {
 	sendJSONResponse(w, response, http.StatusOK)
 }
 
+// removeFromCatalog removes a deleted file from the catalog, with its share
+// policy and search documents, and deletes the files derived from it. It
+// returns the IDs of the deleted derived files.
+func removeFromCatalog(ctx context.Context, provider storage.Provider, fileID string) []string {
+	if catalog.DefaultCatalog == nil {
+		return nil
+	}
+	derivedIDs, err := catalog.DefaultCatalog.Remove(fileID)
+	if err != nil {
+		log.Printf("Failed to update catalog after deleting %s: %v", fileID, err)
+	}
+	for _, derivedID := range derivedIDs {
+		if err := provider.Delete(ctx, derivedID); err != nil {
+			log.Printf("Failed to delete derived file %s: %v", derivedID, err)
+		}
+	}
+	return derivedIDs
+}
+
+// ListDerivedFiles handles requests to list the files derived from a file
+func (h *FileHandler) ListDerivedFiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fileID := r.URL.Query().Get("id")
+	if fileID == "" {
+		sendJSONError(w, "File ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var derived []catalog.Entry
+	if catalog.DefaultCatalog != nil {
+		derived = catalog.DefaultCatalog.Derived(fileID)
+	}
+
+	response := models.APIResponse{
+		Success: true,
+		Data:    derived,
+	}
+
+	sendJSONResponse(w, response, http.StatusOK)
+}
+
 // MediaPreviewHandler serves media preview for files
 func (h *FileHandler) MediaPreviewHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract the file ID from the URL parameters
-	vars := mux.Vars(r)
-	fileID := vars["id"]
+	// Extract the file ID from the URL path
+	fileID := r.PathValue("id")
 
 	if fileID == "" {
 		sendJSONError(w, "File ID is required", http.StatusBadRequest)
@@ -609,8 +781,28 @@ func (h *FileHandler) MediaPreviewHandler(w http.ResponseWriter, r *http.Request
 		}
 	}
 
+	// Images under a share policy are only previewed watermarked and redacted
+	policy, _ := sharePolicyFor(fileID, true)
+
 	// Try to get the preview version first (by convention, preview files have _preview suffix)
 	previewID := fileID + "_preview"
+
+	// A size asks for the stored thumbnail closest to it, made on the fly if
+	// the file has no thumbnails yet
+	if sizeParam := r.URL.Query().Get("size"); sizeParam != "" {
+		size, err := strconv.Atoi(sizeParam)
+		if err != nil || size <= 0 || size > maxThumbnailSize {
+			sendJSONError(w, fmt.Sprintf("Size must be between 1 and %d", maxThumbnailSize), http.StatusBadRequest)
+			return
+		}
+
+		thumbnailID, ok := findThumbnail(fileID, size)
+		if !ok {
+			serveGeneratedThumbnail(w, r, provider, fileID, size, policy)
+			return
+		}
+		previewID = thumbnailID
+	}
 	reader, metadata, err := provider.Retrieve(r.Context(), previewID)
 
 	// If preview doesn't exist, fall back to the original file
@@ -635,6 +827,11 @@ func (h *FileHandler) MediaPreviewHandler(w http.ResponseWriter, r *http.Request
 		contentType = "application/octet-stream"
 	}
 
+	if policy != nil {
+		serveProtected(w, reader, policy, filename, "inline")
+		return
+	}
+
 	w.Header().Set("Content-Type", contentType)
 
 	// For images and videos, use inline disposition so browser displays them
@@ -654,6 +851,63 @@ func (h *FileHandler) MediaPreviewHandler(w http.ResponseWriter, r *http.Request
 
 // Helper functions
 
+// maxThumbnailSize is the largest thumbnail size that can be requested
+const maxThumbnailSize = 4096
+
+// findThumbnail returns the ID of the stored thumbnail of a file that best
+// matches size: the smallest one at least that large, or else the largest
+func findThumbnail(fileID string, size int) (string, bool) {
+	if catalog.DefaultCatalog == nil {
+		return "", false
+	}
+
+	bestID, bestSize := "", 0
+	for _, entry := range catalog.DefaultCatalog.Derived(fileID) {
+		thumbSize, ok := processors.ParseThumbnailRole(entry.Role)
+		if !ok {
+			continue
+		}
+		// Prefer the smallest thumbnail that is large enough, then the largest one
+		better := bestID == "" ||
+			(thumbSize >= size && (bestSize < size || thumbSize < bestSize)) ||
+			(bestSize < size && thumbSize > bestSize)
+		if better {
+			bestID, bestSize = entry.ID, thumbSize
+		}
+	}
+	return bestID, bestID != ""
+}
+
+// serveGeneratedThumbnail makes a thumbnail of a stored image and writes it to the response
+func serveGeneratedThumbnail(w http.ResponseWriter, r *http.Request, provider storage.Provider, fileID string, size int, policy *catalog.SharePolicy) {
+	reader, _, err := provider.Retrieve(r.Context(), fileID)
+	if err != nil {
+		sendJSONError(w, fmt.Sprintf("Failed to retrieve file: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer reader.Close()
+
+	data, err := processors.ReadAllLimited(reader)
+	if err != nil {
+		sendJSONError(w, fmt.Sprintf("Failed to read file: %v", err), imageErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	thumbnail, contentType, err := processors.MakeThumbnail(data, size, "", 0)
+	if err != nil {
+		sendJSONError(w, fmt.Sprintf("Failed to create thumbnail: %v", err), imageErrorStatus(err, http.StatusUnsupportedMediaType))
+		return
+	}
+	if policy != nil {
+		serveProtected(w, bytes.NewReader(thumbnail), policy, fmt.Sprintf("%s_%d", filepath.Base(fileID), size), "inline")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(thumbnail)))
+	w.Write(thumbnail)
+}
+
 // createProcessedFile creates a processed file object from a processing result
 func createProcessedFile(file *models.File, result *processors.ProcessResult) *models.ProcessedFile {
 	// Generate preview URL if preview was generated
@@ -683,6 +937,16 @@ func createProcessedFile(file *models.File, result *processors.ProcessResult) *m
 
 // processUploadedFile processes a file using the appropriate processor
 func processUploadedFile(ctx context.Context, file *models.File, provider storage.Provider) (*models.ProcessedFile, error) {
+	result, err := runProcessor(ctx, provider, file, defaultProcessOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	return createProcessedFile(file, result), nil
+}
+
+// runProcessor retrieves a stored file and runs the matching processor over it
+func runProcessor(ctx context.Context, provider storage.Provider, file *models.File, options processors.ProcessOptions) (*processors.ProcessResult, error) {
 	// Get file content
 	reader, _, err := provider.Retrieve(ctx, file.StorageID)
 	if err != nil {
@@ -690,17 +954,10 @@ func processUploadedFile(ctx context.Context, file *models.File, provider storag
 	}
 	defer reader.Close()
 
-	// Get processor for this file type
-	processor := processors.GetProcessor(file.ContentType, filepath.Ext(file.Name))
-	if processor == nil {
-		return nil, fmt.Errorf("no processor available for file type: %s", file.ContentType)
-	}
-
-	// Process the file
-	options := processors.ProcessOptions{
-		GeneratePreview: true,
-		ExtractMetadata: true,
-		MaxPreviewSize:  1024 * 10, // 10KB
+	// Get processor for this file type, or the one the request asked for
+	processor, err := processors.SelectProcessor(options.Processor, file.ContentType, filepath.Ext(file.Name))
+	if err != nil {
+		return nil, err
 	}
 
 	result, err := processor.Process(ctx, reader, file.Name, options)
@@ -708,29 +965,95 @@ func processUploadedFile(ctx context.Context, file *models.File, provider storag
 		return nil, fmt.Errorf("failed to process file: %w", err)
 	}
 
-	// Generate preview URL if preview was generated
-	var previewURL string
-	if result.Preview != nil && len(result.Preview) > 0 {
-		// In a real app, you'd save the preview and generate a URL for it
-		// For now, we'll just report that a preview is available
-		previewURL = fmt.Sprintf("/api/preview/%s", file.ID)
+	// Store any files derived while processing next to the original
+	if len(result.Derived) > 0 {
+		if _, err := catalog.StoreDerived(ctx, provider, file.StorageType, file.ID, result.Derived); err != nil {
+			log.Printf("Failed to store derived files for %s: %v", file.ID, err)
+		}
 	}
+	result.Cleanup()
+	recordResultMetadata(file.ID, file.StorageType, result.Metadata)
 
-	// Create processed file
-	processedFile := &models.ProcessedFile{
-		File:         file,
-		Summary:      result.Summary,
-		PreviewURL:   previewURL,
-		ProcessedAt:  time.Now(),
-		ProcessStats: make(map[string]string),
+	return result, nil
+}
+
+// newProcessingTask creates a task that processes a stored file. When the file
+// lives in storage that remote workers can reach, the task carries a spec so
+// it can be leased by one of them instead of running locally.
+func newProcessingTask(taskID string, process func() (*processors.ProcessResult, error), file *models.File, options processors.ProcessOptions, onComplete func(*processors.ProcessResult, error)) *processors.Task {
+	task := processors.NewTask(taskID, process)
+	task.OnComplete = onComplete
+
+	if remoteStorage(file.StorageType) {
+		task.Spec = &processors.TaskSpec{
+			FileID:      file.ID,
+			StorageID:   file.StorageID,
+			StorageType: file.StorageType,
+			Name:        file.Name,
+			ContentType: file.ContentType,
+			Options:     options,
+		}
 	}
 
-	// Copy relevant metadata from result to process stats
-	for k, v := range result.Metadata {
-		processedFile.ProcessStats[k] = v
+	return task
+}
+
+// remoteStorage reports whether remote workers can reach files of the given
+// storage type: local storage on a shared volume, or cloud storage configured
+// on the server rather than supplied with the request
+func remoteStorage(storageType string) bool {
+	if config.AppConfig.Workers.RemoteToken == "" {
+		return false
 	}
 
-	return processedFile, nil
+	switch storageType {
+	case "", "local":
+		return true
+	case "s3", "amazon", "aws":
+		return config.AppConfig.Storage.S3["bucket"] != ""
+	case "gcs", "google":
+		return config.AppConfig.Storage.Google["bucket"] != ""
+	}
+	return false
+}
+
+// recordInCatalog adds a file to the default catalog, if one is configured
+func recordInCatalog(file *models.File) {
+	if catalog.DefaultCatalog == nil {
+		return
+	}
+
+	err := catalog.DefaultCatalog.Put(catalog.Entry{
+		ID:          file.ID,
+		StorageType: file.StorageType,
+		Name:        file.Name,
+		ContentType: file.ContentType,
+		Size:        file.Size,
+		Metadata:    file.Metadata,
+	})
+	if err != nil {
+		log.Printf("Failed to record %s in catalog: %v", file.ID, err)
+	}
+}
+
+// recordResultMetadata adds the metadata extracted while processing a file to
+// its entry in the default catalog, if one is configured
+func recordResultMetadata(fileID, storageType string, metadata map[string]string) {
+	if catalog.DefaultCatalog == nil || len(metadata) == 0 {
+		return
+	}
+	if err := catalog.DefaultCatalog.SetMetadata(fileID, storageType, metadata); err != nil {
+		log.Printf("Failed to record metadata of %s in catalog: %v", fileID, err)
+	}
+}
+
+// defaultProcessOptions returns the options used when a request doesn't specify any
+func defaultProcessOptions() processors.ProcessOptions {
+	return processors.ProcessOptions{
+		GeneratePreview: true,
+		ExtractMetadata: true,
+		MaxPreviewSize:  1024 * 10, // 10KB
+	}
 }
 
 // extractStorageConfig extracts storage configuration from the request
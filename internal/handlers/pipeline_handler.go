@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/example/fileprocessor/internal/models"
+	"github.com/example/fileprocessor/internal/pipeline"
+)
+
+// PipelineHandler handles pipeline definition and execution requests
+type PipelineHandler struct {
+	manager     *pipeline.Manager
+	fileHandler *FileHandler
+}
+
+// RunPipelineRequest is the body of a request to run a pipeline over a stored file
+type RunPipelineRequest struct {
+	PipelineID  string `json:"pipelineId"`
+	FileID      string `json:"fileId"`
+	StorageType string `json:"storageType,omitempty"`
+}
+
+// NewPipelineHandler creates a new pipeline handler. Run progress is reported
+// over WebSocket to clients subscribed to the run ID, and uploads with a
+// "pipeline" parameter are routed to the manager.
+func NewPipelineHandler(manager *pipeline.Manager, fileHandler *FileHandler) *PipelineHandler {
+	manager.SetNotifier(func(event string, run *pipeline.Run) {
+		DefaultWebSocketHub.SendTaskUpdate(run.ID, event, run)
+	})
+	fileHandler.pipelines = manager
+
+	return &PipelineHandler{
+		manager:     manager,
+		fileHandler: fileHandler,
+	}
+}
+
+// HandlePipelines handles listing, creating, updating and deleting pipeline definitions
+func (h *PipelineHandler) HandlePipelines(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		if id == "" {
+			sendJSONResponse(w, models.APIResponse{Success: true, Data: h.manager.List()}, http.StatusOK)
+			return
+		}
+
+		p, err := h.manager.Get(id)
+		if err != nil {
+			sendJSONError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		sendJSONResponse(w, models.APIResponse{Success: true, Data: p}, http.StatusOK)
+
+	case http.MethodPost, http.MethodPut:
+		var p pipeline.Pipeline
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			sendJSONError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		var saved pipeline.Pipeline
+		var err error
+		if r.Method == http.MethodPost {
+			saved, err = h.manager.Create(p)
+		} else {
+			if id == "" {
+				sendJSONError(w, "Pipeline ID is required", http.StatusBadRequest)
+				return
+			}
+			saved, err = h.manager.Update(id, p)
+		}
+		if err != nil {
+			sendJSONError(w, err.Error(), pipelineErrorStatus(err))
+			return
+		}
+
+		sendJSONResponse(w, models.APIResponse{
+			Success: true,
+			Message: "Pipeline saved successfully",
+			Data:    saved,
+		}, http.StatusOK)
+
+	case http.MethodDelete:
+		if id == "" {
+			sendJSONError(w, "Pipeline ID is required", http.StatusBadRequest)
+			return
+		}
+		if err := h.manager.Delete(id); err != nil {
+			sendJSONError(w, err.Error(), pipelineErrorStatus(err))
+			return
+		}
+		sendJSONResponse(w, models.APIResponse{
+			Success: true,
+			Message: "Pipeline deleted successfully",
+		}, http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleRunPipeline handles requests to run a pipeline over a stored file
+func (h *PipelineHandler) HandleRunPipeline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RunPipelineRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.PipelineID == "" || req.FileID == "" {
+		sendJSONError(w, "pipelineId and fileId are required", http.StatusBadRequest)
+		return
+	}
+
+	storageType := req.StorageType
+	if storageType == "" {
+		storageType = "local"
+	}
+
+	provider, err := h.fileHandler.resolveProvider(r, storageType)
+	if err != nil {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	files, err := collectStoredFiles(r.Context(), provider, storageType, []string{req.FileID}, "")
+	if err != nil {
+		sendJSONError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	run, err := h.manager.Start(req.PipelineID, provider, files[0])
+	if err != nil {
+		sendJSONError(w, err.Error(), pipelineErrorStatus(err))
+		return
+	}
+
+	sendJSONResponse(w, models.APIResponse{
+		Success: true,
+		Message: "Pipeline run queued",
+		Data:    run,
+	}, http.StatusAccepted)
+}
+
+// HandleRuns handles requests for the status of a run (id) or the runs over a file (fileId)
+func (h *PipelineHandler) HandleRuns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if id := r.URL.Query().Get("id"); id != "" {
+		run, err := h.manager.GetRun(id)
+		if err != nil {
+			sendJSONError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		sendJSONResponse(w, models.APIResponse{Success: true, Data: run}, http.StatusOK)
+		return
+	}
+
+	fileID := r.URL.Query().Get("fileId")
+	if fileID == "" {
+		sendJSONError(w, "Run ID or file ID is required", http.StatusBadRequest)
+		return
+	}
+
+	sendJSONResponse(w, models.APIResponse{Success: true, Data: h.manager.RunsForFile(fileID)}, http.StatusOK)
+}
+
+// pipelineErrorStatus maps pipeline errors to HTTP status codes
+func pipelineErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, pipeline.ErrPipelineNotFound), errors.Is(err, pipeline.ErrRunNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusBadRequest
+	}
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/example/fileprocessor/internal/models"
+	"github.com/example/fileprocessor/internal/processors"
+)
+
+// ListProcessors describes each registered processor, its content types and
+// the features available with the external tools found at startup
+func (h *FileHandler) ListProcessors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sendJSONResponse(w, models.APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"processors": processors.DefaultRegistry.List(),
+			"tools":      processors.DefaultTools.Statuses(),
+		},
+	}, http.StatusOK)
+}
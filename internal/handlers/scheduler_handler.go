@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example/fileprocessor/internal/models"
+	"github.com/example/fileprocessor/internal/processors"
+	"github.com/example/fileprocessor/internal/scheduler"
+	"github.com/example/fileprocessor/internal/storage"
+)
+
+// SchedulerHandler handles CRUD requests for scheduled jobs
+type SchedulerHandler struct {
+	scheduler   *scheduler.Scheduler
+	fileHandler *FileHandler
+}
+
+// NewSchedulerHandler creates a new scheduler handler and registers the
+// built-in job actions with the scheduler
+func NewSchedulerHandler(s *scheduler.Scheduler, fileHandler *FileHandler) *SchedulerHandler {
+	h := &SchedulerHandler{
+		scheduler:   s,
+		fileHandler: fileHandler,
+	}
+
+	s.RegisterAction("reprocess", h.reprocessAction)
+	s.RegisterAction("rebuild_previews", h.rebuildPreviewsAction)
+	s.RegisterAction("purge", h.purgeAction)
+
+	return h
+}
+
+// HandleJobs handles listing, creating, updating and deleting scheduled jobs
+func (h *SchedulerHandler) HandleJobs(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		if id == "" {
+			sendJSONResponse(w, models.APIResponse{
+				Success: true,
+				Data: map[string]interface{}{
+					"jobs":    h.scheduler.List(),
+					"actions": h.scheduler.Actions(),
+				},
+			}, http.StatusOK)
+			return
+		}
+
+		job, err := h.scheduler.Get(id)
+		if err != nil {
+			sendJSONError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		sendJSONResponse(w, models.APIResponse{Success: true, Data: job}, http.StatusOK)
+
+	case http.MethodPost, http.MethodPut:
+		var job scheduler.Job
+		if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+			sendJSONError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		var saved scheduler.Job
+		var err error
+		if r.Method == http.MethodPost {
+			saved, err = h.scheduler.Create(job)
+		} else {
+			if id == "" {
+				sendJSONError(w, "Job ID is required", http.StatusBadRequest)
+				return
+			}
+			saved, err = h.scheduler.Update(id, job)
+		}
+		if err != nil {
+			sendJSONError(w, err.Error(), schedulerErrorStatus(err))
+			return
+		}
+
+		sendJSONResponse(w, models.APIResponse{
+			Success: true,
+			Message: "Job saved successfully",
+			Data:    saved,
+		}, http.StatusOK)
+
+	case http.MethodDelete:
+		if id == "" {
+			sendJSONError(w, "Job ID is required", http.StatusBadRequest)
+			return
+		}
+		if err := h.scheduler.Delete(id); err != nil {
+			sendJSONError(w, err.Error(), schedulerErrorStatus(err))
+			return
+		}
+		sendJSONResponse(w, models.APIResponse{
+			Success: true,
+			Message: "Job deleted successfully",
+		}, http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleRunJob handles requests to run a scheduled job immediately
+func (h *SchedulerHandler) HandleRunJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		sendJSONError(w, "Job ID is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.scheduler.RunNow(id); err != nil {
+		sendJSONError(w, err.Error(), schedulerErrorStatus(err))
+		return
+	}
+
+	sendJSONResponse(w, models.APIResponse{
+		Success: true,
+		Message: "Job submitted",
+	}, http.StatusAccepted)
+}
+
+// schedulerErrorStatus maps scheduler errors to HTTP status codes
+func schedulerErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, scheduler.ErrJobNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, scheduler.ErrJobRunning):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// reprocessAction processes every file under a prefix, optionally filtered by extension.
+// Params: storageType, prefix, extensions (comma-separated, e.g. ".csv,.tsv"), processor
+func (h *SchedulerHandler) reprocessAction(ctx context.Context, params map[string]string) (string, error) {
+	options := defaultProcessOptions()
+	options.Processor = params["processor"]
+	return h.submitStoredFiles(ctx, params, options)
+}
+
+// rebuildPreviewsAction regenerates previews for every file under a prefix.
+// Params: storageType, prefix, extensions
+func (h *SchedulerHandler) rebuildPreviewsAction(ctx context.Context, params map[string]string) (string, error) {
+	options := defaultProcessOptions()
+	options.ExtractMetadata = false
+	return h.submitStoredFiles(ctx, params, options)
+}
+
+// submitStoredFiles queues the matching files as a batch
+func (h *SchedulerHandler) submitStoredFiles(ctx context.Context, params map[string]string, options processors.ProcessOptions) (string, error) {
+	storageType := params["storageType"]
+	if storageType == "" {
+		storageType = "local"
+	}
+
+	provider, err := h.fileHandler.configuredProvider(storageType)
+	if err != nil {
+		return "", err
+	}
+
+	files, err := collectStoredFiles(ctx, provider, storageType, nil, params["prefix"])
+	if err != nil {
+		return "", err
+	}
+	files = filterByExtension(files, params["extensions"])
+	if len(files) == 0 {
+		return "No files matched", nil
+	}
+
+	batch := h.fileHandler.batches.Create(storageType, files)
+	h.fileHandler.submitBatch(batch, provider, files, options)
+
+	return fmt.Sprintf("Queued %d files in batch %s", len(files), batch.ID), nil
+}
+
+// purgeAction deletes files older than a given age.
+// Params: storageType, prefix, olderThanDays, all (required as "true" to
+// purge without a prefix)
+func (h *SchedulerHandler) purgeAction(ctx context.Context, params map[string]string) (string, error) {
+	days, err := strconv.Atoi(params["olderThanDays"])
+	if err != nil || days <= 0 {
+		return "", fmt.Errorf("olderThanDays must be a positive number of days")
+	}
+
+	storageType := params["storageType"]
+	if storageType == "" {
+		storageType = "local"
+	}
+
+	provider, err := h.fileHandler.configuredProvider(storageType)
+	if err != nil {
+		return "", err
+	}
+
+	// Purging everything in storage is almost never intended, so it has to
+	// be asked for explicitly
+	prefix := params["prefix"]
+	if all, _ := strconv.ParseBool(params["all"]); prefix == "" && !all {
+		return "", fmt.Errorf("a prefix, or all set to true, is required to purge %s storage", storageType)
+	}
+
+	infos, err := provider.List(ctx, prefix)
+	if err != nil {
+		return "", fmt.Errorf("failed to list files: %w", err)
+	}
+
+	// Purged files leave the catalog as they do when deleted one at a time;
+	// their derived files go with them and may be further down the listing
+	cutoff := time.Now().AddDate(0, 0, -days)
+	deleted, failed := 0, 0
+	removed := make(map[string]bool)
+	for _, info := range infos {
+		if removed[info.ID] || !fileTime(info).Before(cutoff) {
+			continue
+		}
+		if err := provider.Delete(ctx, info.ID); err != nil {
+			failed++
+			continue
+		}
+		deleted++
+		for _, derivedID := range removeFromCatalog(ctx, provider, info.ID) {
+			removed[derivedID] = true
+		}
+	}
+
+	if failed > 0 {
+		return "", fmt.Errorf("deleted %d files, failed to delete %d files", deleted, failed)
+	}
+	return fmt.Sprintf("Deleted %d files older than %d days", deleted, days), nil
+}
+
+// filterByExtension keeps the files whose extension is in the comma-separated list
+func filterByExtension(files []*models.File, extensions string) []*models.File {
+	if extensions == "" {
+		return files
+	}
+
+	allowed := make(map[string]bool)
+	for _, ext := range strings.Split(extensions, ",") {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext != "" && !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		allowed[ext] = true
+	}
+
+	var filtered []*models.File
+	for _, file := range files {
+		if allowed[strings.ToLower(filepath.Ext(file.Name))] {
+			filtered = append(filtered, file)
+		}
+	}
+	return filtered
+}
+
+// fileTime returns the upload time recorded in the metadata, or the modification time
+func fileTime(info storage.FileInfo) time.Time {
+	if timeStr, ok := info.Metadata["uploadedAt"]; ok {
+		if uploadTime, err := time.Parse(time.RFC3339, timeStr); err == nil {
+			return uploadTime
+		}
+	}
+	return time.Unix(info.ModifiedAt, 0)
+}
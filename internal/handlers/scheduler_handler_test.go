@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/example/fileprocessor/internal/storage"
+)
+
+func TestPurgeAction(t *testing.T) {
+	useCatalog(t)
+	dir := t.TempDir()
+	provider := storage.NewLocalStorage()
+	if err := provider.Initialize(map[string]string{"basePath": dir}); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().AddDate(0, 0, -30).Format(time.RFC3339)
+	writeStored(t, dir, "logs-old.txt", "old log", map[string]string{"uploadedAt": old})
+	writeStored(t, dir, "other-old.txt", "old file", map[string]string{"uploadedAt": old})
+	writeStored(t, dir, "other-new.txt", "new file", map[string]string{"uploadedAt": time.Now().Format(time.RFC3339)})
+	h := &SchedulerHandler{fileHandler: NewFileHandler(provider)}
+
+	// Without a prefix, purging everything has to be asked for
+	for _, all := range []string{"", "false", "yes"} {
+		if _, err := h.purgeAction(context.Background(), map[string]string{"olderThanDays": "7", "all": all}); err == nil {
+			t.Errorf("all=%q: purged without a prefix", all)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "other-old.txt")); err != nil {
+		t.Fatalf("a refused purge deleted files: %v", err)
+	}
+
+	summary, err := h.purgeAction(context.Background(), map[string]string{"olderThanDays": "7", "all": "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Deleted 2 files older than 7 days"; summary != want {
+		t.Errorf("summary = %q, want %q", summary, want)
+	}
+	for name, kept := range map[string]bool{"logs-old.txt": false, "other-old.txt": false, "other-new.txt": true} {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != kept {
+			t.Errorf("%s: kept = %v, want %v", name, err == nil, kept)
+		}
+	}
+}
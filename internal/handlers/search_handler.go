@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/example/fileprocessor/internal/catalog"
+	"github.com/example/fileprocessor/internal/models"
+)
+
+// SearchText finds the subtitle and chapter cues containing every word of the
+// q query parameter, across the videos processed with the extractTracks option
+func (h *FileHandler) SearchText(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		sendJSONError(w, "Search query is required", http.StatusBadRequest)
+		return
+	}
+
+	limit := catalog.DefaultSearchLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 1000 {
+			sendJSONError(w, "Limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	if catalog.DefaultCatalog == nil {
+		sendJSONError(w, "File catalog is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	hits := catalog.DefaultCatalog.Search(query, limit)
+	if hits == nil {
+		hits = []catalog.SearchHit{}
+	}
+	sendJSONResponse(w, models.APIResponse{Success: true, Data: hits}, http.StatusOK)
+}
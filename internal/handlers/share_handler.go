@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/example/fileprocessor/internal/catalog"
+	"github.com/example/fileprocessor/internal/models"
+	"github.com/example/fileprocessor/internal/processors"
+)
+
+// HandleSharePolicy gets (GET), sets (PUT) or removes (DELETE) the share
+// policy of an image: the watermark and redactions applied whenever the image
+// is downloaded or previewed
+func (h *FileHandler) HandleSharePolicy(w http.ResponseWriter, r *http.Request) {
+	fileID := r.PathValue("id")
+	if fileID == "" {
+		sendJSONError(w, "File ID is required", http.StatusBadRequest)
+		return
+	}
+	if catalog.DefaultCatalog == nil {
+		sendJSONError(w, "File catalog is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		policy, ok := catalog.DefaultCatalog.SharePolicy(fileID)
+		if !ok {
+			sendJSONError(w, fmt.Sprintf("File %s has no share policy", fileID), http.StatusNotFound)
+			return
+		}
+		sendJSONResponse(w, models.APIResponse{Success: true, Data: policy}, http.StatusOK)
+
+	case http.MethodPut:
+		entry, ok := catalog.DefaultCatalog.Get(fileID)
+		if !ok {
+			sendJSONError(w, fmt.Sprintf("File %s not found in catalog", fileID), http.StatusNotFound)
+			return
+		}
+		if entry.ContentType != "" && (!strings.HasPrefix(entry.ContentType, "image/") || entry.ContentType == "image/svg+xml") {
+			sendJSONError(w, "Share policies can only be set on raster images", http.StatusBadRequest)
+			return
+		}
+
+		var policy catalog.SharePolicy
+		if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+			sendJSONError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := policy.Validate(); err != nil {
+			sendJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := catalog.DefaultCatalog.SetSharePolicy(fileID, &policy); err != nil {
+			sendJSONError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		saved, _ := catalog.DefaultCatalog.SharePolicy(fileID)
+		sendJSONResponse(w, models.APIResponse{
+			Success: true,
+			Message: "Share policy saved successfully",
+			Data:    saved,
+		}, http.StatusOK)
+
+	case http.MethodDelete:
+		if _, ok := catalog.DefaultCatalog.SharePolicy(fileID); !ok {
+			sendJSONError(w, fmt.Sprintf("File %s has no share policy", fileID), http.StatusNotFound)
+			return
+		}
+		if err := catalog.DefaultCatalog.SetSharePolicy(fileID, nil); err != nil {
+			sendJSONError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sendJSONResponse(w, models.APIResponse{
+			Success: true,
+			Message: "Share policy removed successfully",
+		}, http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// sharePolicyFor returns the share policy that applies when serving fileID
+// as a download or as a preview, if any. Derived files such as thumbnails
+// fall under the policy of the image they were made from.
+func sharePolicyFor(fileID string, preview bool) (*catalog.SharePolicy, bool) {
+	if catalog.DefaultCatalog == nil {
+		return nil, false
+	}
+	policy, ok := catalog.DefaultCatalog.SharePolicy(fileID)
+	if !ok {
+		if entry, found := catalog.DefaultCatalog.Get(fileID); found && entry.ParentID != "" {
+			policy, ok = catalog.DefaultCatalog.SharePolicy(entry.ParentID)
+			preview = true
+		}
+	}
+	if !ok || (preview && !policy.Previews) || (!preview && !policy.Downloads) {
+		return nil, false
+	}
+	return policy, true
+}
+
+// protectedCacheControl keeps caches from serving an image rendered under a
+// share policy after the policy changes
+const protectedCacheControl = "private, no-cache"
+
+// serveProtected reads an image, applies a share policy to it and writes the
+// result. The policy can't be skipped, so when it can't be applied nothing
+// is served.
+func serveProtected(w http.ResponseWriter, reader io.Reader, policy *catalog.SharePolicy, filename, disposition string) {
+	data, err := processors.ReadAllLimited(reader)
+	if err != nil {
+		sendJSONError(w, fmt.Sprintf("Failed to read file: %v", err), imageErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	protected, contentType, err := processors.NewImageProcessor().Protect(data, policy.ProtectOptions)
+	if err != nil {
+		sendJSONError(w, fmt.Sprintf("Failed to apply share policy: %v", err), imageErrorStatus(err, http.StatusUnsupportedMediaType))
+		return
+	}
+
+	// The image may have been re-encoded in another format
+	ext := ".jpg"
+	if contentType == "image/png" {
+		ext = ".png"
+	}
+	if !strings.EqualFold(filepath.Ext(filename), ext) && !(ext == ".jpg" && strings.EqualFold(filepath.Ext(filename), ".jpeg")) {
+		filename = strings.TrimSuffix(filename, filepath.Ext(filename)) + ext
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(protected)))
+	w.Header().Set("Cache-Control", protectedCacheControl)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("%s; filename=%s", disposition, filename))
+	if _, err := w.Write(protected); err != nil {
+		log.Printf("Error writing protected image: %v", err)
+	}
+}
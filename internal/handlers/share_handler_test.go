@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/example/fileprocessor/internal/catalog"
+	"github.com/example/fileprocessor/internal/processors"
+)
+
+func TestSharePolicyFor(t *testing.T) {
+	c := useCatalog(t)
+	provider := newLocalStorage(t)
+	original := storeFile(t, provider, c, "photo.png", []byte("png"), "", "")
+	thumbnail := storeFile(t, provider, c, "thumb.png", []byte("png"), original, "thumbnail")
+	unshared := storeFile(t, provider, c, "other.png", []byte("png"), "", "")
+	downloadsOnly := storeFile(t, provider, c, "scan.png", []byte("png"), "", "")
+	scanPreview := storeFile(t, provider, c, "scan-thumb.png", []byte("png"), downloadsOnly, "thumbnail")
+
+	protect := processors.ProtectOptions{Watermark: &processors.Watermark{Text: "Confidential"}}
+	if err := c.SetSharePolicy(original, &catalog.SharePolicy{ProtectOptions: protect, Downloads: true, Previews: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetSharePolicy(downloadsOnly, &catalog.SharePolicy{ProtectOptions: protect, Downloads: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		fileID  string
+		preview bool
+		want    bool
+	}{
+		{"original download", original, false, true},
+		{"original preview", original, true, true},
+		// Derived files have no policy of their own and carry their parent's
+		{"derived download", thumbnail, false, true},
+		{"derived preview", thumbnail, true, true},
+		{"no policy", unshared, false, false},
+		{"unknown file", "missing", false, false},
+		{"downloads only", downloadsOnly, false, true},
+		{"downloads only preview", downloadsOnly, true, false},
+		// Downloading a derived file is a preview of its parent
+		{"derived of downloads only", scanPreview, false, false},
+	}
+	for _, tt := range tests {
+		policy, ok := sharePolicyFor(tt.fileID, tt.preview)
+		if ok != tt.want {
+			t.Errorf("%s: applies = %v, want %v", tt.name, ok, tt.want)
+			continue
+		}
+		if ok && (policy.Watermark == nil || policy.Watermark.Text != "Confidential") {
+			t.Errorf("%s: policy = %+v, want the original's", tt.name, policy)
+		}
+	}
+
+	// A derived file's own policy takes precedence over its parent's
+	own := processors.ProtectOptions{Redactions: []processors.Redaction{{Width: 1, Height: 1}}}
+	if err := c.SetSharePolicy(thumbnail, &catalog.SharePolicy{ProtectOptions: own, Previews: true}); err != nil {
+		t.Fatal(err)
+	}
+	if policy, ok := sharePolicyFor(thumbnail, true); !ok || policy.Watermark != nil || len(policy.Redactions) != 1 {
+		t.Errorf("derived file with its own policy = %+v, %v; want its own", policy, ok)
+	}
+}
+
+func TestSharePolicyForNoCatalog(t *testing.T) {
+	previous := catalog.DefaultCatalog
+	catalog.DefaultCatalog = nil
+	t.Cleanup(func() { catalog.DefaultCatalog = previous })
+
+	if policy, ok := sharePolicyFor("photo.png", false); ok || policy != nil {
+		t.Errorf("sharePolicyFor without a catalog = %+v, %v; want none", policy, ok)
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/example/fileprocessor/internal/catalog"
+	"github.com/example/fileprocessor/internal/models"
+	"github.com/example/fileprocessor/internal/processors"
+)
+
+// ListImageClusters returns groups of visually similar images from the catalog
+func (h *FileHandler) ListImageClusters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key, threshold, ok := similarityParams(w, r)
+	if !ok {
+		return
+	}
+
+	clusters := catalog.DefaultCatalog.Clusters(key, threshold)
+	sendJSONResponse(w, models.APIResponse{Success: true, Data: clusters}, http.StatusOK)
+}
+
+// FindSimilarImages returns the images that look like the file given by id, closest first
+func (h *FileHandler) FindSimilarImages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fileID := r.URL.Query().Get("id")
+	if fileID == "" {
+		sendJSONError(w, "File ID is required", http.StatusBadRequest)
+		return
+	}
+
+	key, threshold, ok := similarityParams(w, r)
+	if !ok {
+		return
+	}
+
+	matches, err := catalog.DefaultCatalog.Similar(fileID, key, threshold)
+	if err != nil {
+		sendJSONError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	sendJSONResponse(w, models.APIResponse{Success: true, Data: matches}, http.StatusOK)
+}
+
+// similarityParams reads the hash (phash or dhash) and threshold query
+// parameters, writing an error response if they're invalid
+func similarityParams(w http.ResponseWriter, r *http.Request) (string, int, bool) {
+	if catalog.DefaultCatalog == nil {
+		sendJSONError(w, "File catalog is not available", http.StatusServiceUnavailable)
+		return "", 0, false
+	}
+
+	key := r.URL.Query().Get("hash")
+	switch key {
+	case "":
+		key = processors.MetadataPHash
+	case processors.MetadataPHash, processors.MetadataDHash:
+	default:
+		sendJSONError(w, "hash must be phash or dhash", http.StatusBadRequest)
+		return "", 0, false
+	}
+
+	threshold := catalog.DefaultSimilarityThreshold
+	if value := r.URL.Query().Get("threshold"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > 64 {
+			sendJSONError(w, "threshold must be between 0 and 64", http.StatusBadRequest)
+			return "", 0, false
+		}
+		threshold = n
+	}
+
+	return key, threshold, true
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/example/fileprocessor/internal/catalog"
+	"github.com/example/fileprocessor/internal/processors"
+)
+
+// StreamFile serves the playlists and segments of a video's adaptive streams,
+// its thumbnails, preview clip and extracted tracks, by their path below the stream root
+// (e.g. /api/stream/{id}/hls/master.m3u8). Playlists and thumbnail tracks refer
+// to other files by relative paths, which resolve to this route as well.
+func (h *FileHandler) StreamFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fileID := r.PathValue("id")
+	streamPath := path.Clean("/" + r.PathValue("path"))[1:]
+	if fileID == "" || streamPath == "" {
+		sendJSONError(w, "File ID and stream path are required", http.StatusBadRequest)
+		return
+	}
+	if catalog.DefaultCatalog == nil {
+		sendJSONError(w, "File catalog is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	derivedID, ok := catalog.DefaultCatalog.DerivedID(fileID, processors.StreamRolePrefix+streamPath)
+	if !ok {
+		sendJSONError(w, fmt.Sprintf("No stream file %s for %s; process the video with the stream, thumbnails or extractTracks option first", streamPath, fileID), http.StatusNotFound)
+		return
+	}
+
+	// Relative playlist URLs drop the query string, so the provider comes from
+	// the catalog and the server configuration rather than the request
+	entry, _ := catalog.DefaultCatalog.Get(derivedID)
+	storageType := entry.StorageType
+	if storageType == "" {
+		storageType = "local"
+	}
+	provider, err := h.configuredProvider(storageType)
+	if err != nil {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reader, metadata, err := provider.Retrieve(r.Context(), derivedID)
+	if err != nil {
+		sendJSONError(w, fmt.Sprintf("Failed to retrieve stream file: %v", err), http.StatusNotFound)
+		return
+	}
+	defer reader.Close()
+
+	// Preview clips and tracks can be large, so files from providers that
+	// can seek are served straight from the provider; the others are read
+	// into memory up to the memory limit
+	content, ok := reader.(io.ReadSeeker)
+	if !ok {
+		data, err := processors.ReadAllLimited(reader)
+		if err != nil {
+			sendJSONError(w, fmt.Sprintf("Failed to read stream file: %v", err), imageErrorStatus(err, http.StatusInternalServerError))
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+
+	contentType := metadata["contentType"]
+	if contentType == "" {
+		contentType = entry.ContentType
+	}
+	w.Header().Set("Content-Type", contentType)
+
+	// Processing the video again replaces its streams, so playlists are always
+	// revalidated and segments are only cached for a while
+	if strings.HasSuffix(streamPath, ".m3u8") || strings.HasSuffix(streamPath, ".mpd") {
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+	}
+
+	// ServeContent handles the range requests players make for segments
+	http.ServeContent(w, r, path.Base(streamPath), time.Time{}, content)
+}
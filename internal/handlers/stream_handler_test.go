@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/example/fileprocessor/internal/catalog"
+	"github.com/example/fileprocessor/internal/processors"
+	"github.com/example/fileprocessor/internal/storage"
+)
+
+// useCatalog installs an empty catalog for the duration of a test
+func useCatalog(t *testing.T) *catalog.Catalog {
+	t.Helper()
+	c, err := catalog.Open(filepath.Join(t.TempDir(), "catalog.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := catalog.DefaultCatalog
+	catalog.DefaultCatalog = c
+	t.Cleanup(func() { catalog.DefaultCatalog = previous })
+	return c
+}
+
+// newLocalStorage returns local storage in a temporary directory
+func newLocalStorage(t *testing.T) *storage.LocalStorage {
+	t.Helper()
+	provider := storage.NewLocalStorage()
+	if err := provider.Initialize(map[string]string{"basePath": t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+// storeFile stores content under name and records it in the catalog,
+// derived from parentID with role when parentID is set
+func storeFile(t *testing.T, provider storage.Provider, c *catalog.Catalog, name string, content []byte, parentID, role string) string {
+	t.Helper()
+	id, err := provider.Store(context.Background(), name, bytes.NewReader(content), int64(len(content)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := catalog.Entry{ID: id, StorageType: "local", Name: name,
+		ContentType: processors.GetContentTypeByExt(name), Size: int64(len(content)), Role: role}
+	if parentID == "" {
+		err = c.Put(entry)
+	} else {
+		_, err = c.AddDerivedFiles(parentID, []catalog.Entry{entry})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// unseekableStorage hides that retrieved files can seek, like a cloud provider
+type unseekableStorage struct {
+	storage.Provider
+}
+
+func (s unseekableStorage) Retrieve(ctx context.Context, id string) (io.ReadCloser, map[string]string, error) {
+	reader, metadata, err := s.Provider.Retrieve(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return struct{ io.ReadCloser }{reader}, metadata, nil
+}
+
+// serveStream requests a stream file with an optional range
+func serveStream(h *FileHandler, target, rangeHeader string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/stream/{id}/{path...}", h.StreamFile)
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestStreamFileRanges(t *testing.T) {
+	c := useCatalog(t)
+	provider := newLocalStorage(t)
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	videoID := storeFile(t, provider, c, "video.mp4", []byte("video"), "", "")
+	storeFile(t, provider, c, "preview.mp4", content, videoID, processors.StreamRolePrefix+"preview.mp4")
+
+	for name, h := range map[string]*FileHandler{
+		"seekable":   NewFileHandler(provider),
+		"unseekable": NewFileHandler(unseekableStorage{provider}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			rec := serveStream(h, "/api/stream/"+videoID+"/preview.mp4", "bytes=10-19")
+			if rec.Code != http.StatusPartialContent {
+				t.Fatalf("status = %d, want 206: %s", rec.Code, rec.Body)
+			}
+			if got := rec.Body.String(); got != "0123456789" {
+				t.Errorf("body = %q, want the requested range", got)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "video/mp4" {
+				t.Errorf("Content-Type = %q, want video/mp4", got)
+			}
+
+			rec = serveStream(h, "/api/stream/"+videoID+"/preview.mp4", "")
+			body, _ := ioutil.ReadAll(rec.Body)
+			if rec.Code != http.StatusOK || !bytes.Equal(body, content) {
+				t.Errorf("full request: status %d with %d bytes, want 200 with %d", rec.Code, len(body), len(content))
+			}
+		})
+	}
+
+	if rec := serveStream(NewFileHandler(provider), "/api/stream/"+videoID+"/missing.ts", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("missing stream file: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestStreamFileMemoryLimit(t *testing.T) {
+	c := useCatalog(t)
+	provider := newLocalStorage(t)
+	videoID := storeFile(t, provider, c, "video.mp4", []byte("video"), "", "")
+	storeFile(t, provider, c, "audio.m4a", make([]byte, 4096), videoID, processors.StreamRolePrefix+"tracks/audio.m4a")
+
+	previous := processors.DefaultMaxMemorySize
+	processors.DefaultMaxMemorySize = 1024
+	t.Cleanup(func() { processors.DefaultMaxMemorySize = previous })
+
+	// Files that can seek are served without holding them in memory
+	if rec := serveStream(NewFileHandler(provider), "/api/stream/"+videoID+"/tracks/audio.m4a", ""); rec.Code != http.StatusOK || rec.Body.Len() != 4096 {
+		t.Errorf("seekable: status %d with %d bytes, want 200 with 4096", rec.Code, rec.Body.Len())
+	}
+
+	// The others are only read up to the memory limit
+	rec := serveStream(NewFileHandler(unseekableStorage{provider}), "/api/stream/"+videoID+"/tracks/audio.m4a", "")
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("unseekable: status = %d, want 413", rec.Code)
+	}
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/example/fileprocessor/internal/catalog"
+	"github.com/example/fileprocessor/internal/processors"
+	"github.com/example/fileprocessor/internal/storage"
+)
+
+// transformRolePrefix prefixes the derived file role of cached image variants
+const transformRolePrefix = "transform:"
+
+// maxTransformVariants is how many cached variants are kept per image. Each
+// distinct set of parameters is a new variant, so the oldest are evicted
+// beyond it.
+var maxTransformVariants = 16
+
+// TransformImage serves a resized, cropped, rotated or re-encoded variant of a
+// stored image. Variants are stored as derived files keyed by their parameters,
+// so repeated requests are served from storage; at most maxTransformVariants
+// are kept per image.
+func (h *FileHandler) TransformImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fileID := r.PathValue("id")
+	if fileID == "" {
+		sendJSONError(w, "File ID is required", http.StatusBadRequest)
+		return
+	}
+
+	options, err := parseTransformOptions(r)
+	if err != nil {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	storageType := r.URL.Query().Get("storageType")
+	if storageType == "" {
+		storageType = "local"
+	}
+	provider, err := h.resolveProvider(r, storageType)
+	if err != nil {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Variants are previews, so they carry the image's share policy. Cached
+	// variants are stored without it and protected as they are served.
+	policy, _ := sharePolicyFor(fileID, true)
+
+	// Serve the cached variant if there is one
+	role := transformRolePrefix + options.Key()
+	if catalog.DefaultCatalog != nil {
+		if variantID, ok := catalog.DefaultCatalog.DerivedID(fileID, role); ok {
+			reader, metadata, err := provider.Retrieve(r.Context(), variantID)
+			if err == nil {
+				defer reader.Close()
+				data, err := processors.ReadAllLimited(reader)
+				if err == nil {
+					writeVariant(w, data, metadata["contentType"], "HIT", policy)
+					return
+				}
+			}
+			log.Printf("Cached variant %s of %s is unavailable, regenerating: %v", variantID, fileID, err)
+		}
+	}
+
+	reader, metadata, err := provider.Retrieve(r.Context(), fileID)
+	if err != nil {
+		sendJSONError(w, fmt.Sprintf("Failed to retrieve file: %v", err), http.StatusNotFound)
+		return
+	}
+	data, err := processors.ReadAllLimited(reader)
+	reader.Close()
+	if err != nil {
+		sendJSONError(w, fmt.Sprintf("Failed to read file: %v", err), imageErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	variant, contentType, err := processors.NewImageProcessor().Transform(data, options)
+	if err != nil {
+		sendJSONError(w, fmt.Sprintf("Failed to transform image: %v", err), imageErrorStatus(err, http.StatusUnsupportedMediaType))
+		return
+	}
+
+	// Cache the variant next to the original
+	if catalog.DefaultCatalog != nil {
+		name := metadata["filename"]
+		if name == "" {
+			name = fileID
+		}
+		ext := ".jpg"
+		if contentType == "image/png" {
+			ext = ".png"
+		}
+		derived := processors.DerivedFile{
+			Name:        fmt.Sprintf("%s_%s%s", strings.TrimSuffix(name, filepath.Ext(name)), options.Key(), ext),
+			Role:        role,
+			ContentType: contentType,
+			Data:        variant,
+		}
+		if _, err := catalog.StoreDerived(r.Context(), provider, storageType, fileID, []processors.DerivedFile{derived}); err != nil {
+			log.Printf("Failed to cache variant of %s: %v", fileID, err)
+		}
+		evictTransformVariants(r.Context(), provider, fileID)
+	}
+
+	writeVariant(w, variant, contentType, "MISS", policy)
+}
+
+// evictTransformVariants deletes the oldest cached variants of an image beyond
+// maxTransformVariants, from the catalog and from storage
+func evictTransformVariants(ctx context.Context, provider storage.Provider, fileID string) {
+	var variants []catalog.Entry
+	for _, entry := range catalog.DefaultCatalog.Derived(fileID) {
+		if strings.HasPrefix(entry.Role, transformRolePrefix) {
+			variants = append(variants, entry)
+		}
+	}
+	if len(variants) <= maxTransformVariants {
+		return
+	}
+
+	sort.Slice(variants, func(i, j int) bool {
+		return variants[i].UpdatedAt.Before(variants[j].UpdatedAt)
+	})
+	for _, entry := range variants[:len(variants)-maxTransformVariants] {
+		if _, err := catalog.DefaultCatalog.Remove(entry.ID); err != nil {
+			log.Printf("Failed to remove evicted variant %s of %s from catalog: %v", entry.ID, fileID, err)
+		}
+		if err := provider.Delete(ctx, entry.ID); err != nil {
+			log.Printf("Failed to delete evicted variant %s of %s: %v", entry.ID, fileID, err)
+		}
+	}
+}
+
+// imageErrorStatus returns the status for an error reading or decoding an
+// image: 413 for files and dimensions above the limits, or else status
+func imageErrorStatus(err error, status int) int {
+	if errors.Is(err, processors.ErrFileTooLarge) || errors.Is(err, processors.ErrImageTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return status
+}
+
+// writeVariant writes an image variant, applying the share policy of the
+// original image if it has one
+func writeVariant(w http.ResponseWriter, data []byte, contentType, cacheStatus string, policy *catalog.SharePolicy) {
+	if policy == nil {
+		writeImage(w, data, contentType, cacheStatus, false)
+		return
+	}
+	protected, contentType, err := processors.NewImageProcessor().Protect(data, policy.ProtectOptions)
+	if err != nil {
+		sendJSONError(w, fmt.Sprintf("Failed to apply share policy: %v", err), imageErrorStatus(err, http.StatusUnsupportedMediaType))
+		return
+	}
+	writeImage(w, protected, contentType, cacheStatus, true)
+}
+
+// parseTransformOptions reads the w, h, fit, format, quality and rotate query parameters
+func parseTransformOptions(r *http.Request) (processors.TransformOptions, error) {
+	query := r.URL.Query()
+	options := processors.TransformOptions{
+		Fit:    query.Get("fit"),
+		Format: query.Get("format"),
+	}
+
+	ints := map[string]*int{
+		"w":       &options.Width,
+		"h":       &options.Height,
+		"quality": &options.Quality,
+		"rotate":  &options.Rotate,
+	}
+	for name, target := range ints {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return options, fmt.Errorf("%s must be a number", name)
+		}
+		*target = n
+	}
+
+	return options, options.Validate()
+}
+
+// writeImage writes an image variant to the response. Variants never change
+// for a given file and parameters, so they can be cached by clients, unless
+// a share policy was applied: the policy can change at any time, so
+// protected variants are revalidated on every use.
+func writeImage(w http.ResponseWriter, data []byte, contentType, cacheStatus string, protected bool) {
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	if protected {
+		w.Header().Set("Cache-Control", protectedCacheControl)
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	}
+	w.Header().Set("X-Cache", cacheStatus)
+	if _, err := w.Write(data); err != nil {
+		log.Printf("Error writing image variant: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// transformImage requests a variant of a stored image
+func transformImage(h *FileHandler, id, query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/images/"+id+"?"+query, nil)
+	req.SetPathValue("id", id)
+	rec := httptest.NewRecorder()
+	h.TransformImage(rec, req)
+	return rec
+}
+
+func TestTransformImageEviction(t *testing.T) {
+	c := useCatalog(t)
+	provider := newLocalStorage(t)
+	saved := maxTransformVariants
+	t.Cleanup(func() { maxTransformVariants = saved })
+	maxTransformVariants = 2
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 40, 20))); err != nil {
+		t.Fatal(err)
+	}
+	id := storeFile(t, provider, c, "photo.png", buf.Bytes(), "", "")
+	h := NewFileHandler(provider)
+
+	variantIDs := make(map[string]string)
+	for _, width := range []string{"10", "12", "14"} {
+		if rec := transformImage(h, id, "w="+width); rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != "MISS" {
+			t.Fatalf("w=%s: status %d, cache %q: %s", width, rec.Code, rec.Header().Get("X-Cache"), rec.Body)
+		}
+		for _, entry := range c.Derived(id) {
+			if strings.HasPrefix(entry.Role, transformRolePrefix) {
+				variantIDs[width] = entry.ID
+			}
+		}
+	}
+
+	// The first variant was evicted from the catalog and from storage
+	if derived := c.Derived(id); len(derived) != 2 {
+		t.Fatalf("derived = %+v, want the two newest variants", derived)
+	}
+	if _, ok := c.Get(variantIDs["10"]); ok {
+		t.Error("evicted variant is still in the catalog")
+	}
+	if _, _, err := provider.Retrieve(context.Background(), variantIDs["10"]); err == nil {
+		t.Error("evicted variant is still stored")
+	}
+
+	// Kept variants are still served from storage, and the evicted one is regenerated
+	if rec := transformImage(h, id, "w=14"); rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("w=14: cache %q, want HIT", rec.Header().Get("X-Cache"))
+	}
+	if rec := transformImage(h, id, "w=10"); rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("w=10: cache %q, want MISS", rec.Header().Get("X-Cache"))
+	}
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/example/fileprocessor/internal/catalog"
+	"github.com/example/fileprocessor/internal/models"
+	"github.com/example/fileprocessor/internal/processors"
+	"github.com/example/fileprocessor/internal/worker"
+)
+
+// maxLeaseWait caps how long a lease request is held open
+const maxLeaseWait = 30 * time.Second
+
+// WorkerHandler serves the API remote workers use to lease tasks and report results
+type WorkerHandler struct {
+	token       string
+	fileHandler *FileHandler
+}
+
+// NewWorkerHandler creates a handler that accepts remote workers presenting the given token
+func NewWorkerHandler(token string, fileHandler *FileHandler) *WorkerHandler {
+	return &WorkerHandler{
+		token:       token,
+		fileHandler: fileHandler,
+	}
+}
+
+// authorize checks the bearer token sent by a remote worker
+func (h *WorkerHandler) authorize(w http.ResponseWriter, r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if h.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+		sendJSONError(w, "Invalid worker token", http.StatusUnauthorized)
+		return false
+	}
+	if processors.DefaultPool == nil {
+		sendJSONError(w, processors.ErrNoWorkerPool.Error(), http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+// HandleLease hands a queued task to a remote worker, waiting briefly if none is queued
+func (h *WorkerHandler) HandleLease(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorize(w, r) {
+		return
+	}
+
+	var req worker.LeaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.WorkerID == "" {
+		sendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	wait := time.Duration(req.WaitSeconds) * time.Second
+	if wait > maxLeaseWait {
+		wait = maxLeaseWait
+	}
+
+	var resp worker.LeaseResponse
+	if lease := processors.DefaultPool.Lease(r.Context(), req.WorkerID, wait); lease != nil {
+		resp.Lease = lease
+		resp.Spec = lease.Spec()
+	}
+
+	sendJSONResponse(w, models.APIResponse{Success: true, Data: resp}, http.StatusOK)
+}
+
+// HandleHeartbeat extends the leases held by a remote worker
+func (h *WorkerHandler) HandleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorize(w, r) {
+		return
+	}
+
+	var req worker.HeartbeatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.WorkerID == "" {
+		sendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	sendJSONResponse(w, models.APIResponse{
+		Success: true,
+		Data:    worker.HeartbeatResponse{LeaseIDs: processors.DefaultPool.Heartbeat(req.WorkerID, req.LeaseIDs)},
+	}, http.StatusOK)
+}
+
+// HandleComplete records the result a remote worker reports for a leased task
+func (h *WorkerHandler) HandleComplete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorize(w, r) {
+		return
+	}
+
+	var req worker.CompleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.WorkerID == "" || req.LeaseID == "" {
+		sendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var result *processors.ProcessResult
+	var taskErr error
+	if req.Error != "" || req.Result == nil {
+		taskErr = errors.New(req.Error)
+		if req.Error == "" {
+			taskErr = errors.New("remote worker reported no result")
+		}
+	} else {
+		result = req.Result.ProcessResult()
+	}
+
+	// Link the derived files the worker stored and record the extracted
+	// metadata before the task's completion hooks run, so they can find them
+	// in the catalog
+	if result != nil {
+		if lease, ok := processors.DefaultPool.GetLease(req.LeaseID); ok && lease.WorkerID == req.WorkerID {
+			spec := lease.Spec()
+			if len(req.Result.Derived) > 0 {
+				h.recordRemoteDerived(r, spec, req.Result.Derived)
+			}
+			recordResultMetadata(spec.FileID, spec.StorageType, result.Metadata)
+		}
+	}
+
+	if err := processors.DefaultPool.CompleteLease(req.WorkerID, req.LeaseID, result, taskErr); err != nil {
+		sendJSONError(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	sendJSONResponse(w, models.APIResponse{Success: true, Message: "Result recorded"}, http.StatusOK)
+}
+
+// ListWorkers returns the remote workers seen by the pool
+func (h *WorkerHandler) ListWorkers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorize(w, r) {
+		return
+	}
+
+	sendJSONResponse(w, models.APIResponse{Success: true, Data: processors.DefaultPool.RemoteWorkers()}, http.StatusOK)
+}
+
+// recordRemoteDerived links derived files stored by a remote worker to their parent file
+func (h *WorkerHandler) recordRemoteDerived(r *http.Request, spec *processors.TaskSpec, entries []catalog.Entry) {
+	provider, err := h.fileHandler.configuredProvider(spec.StorageType)
+	if err != nil {
+		log.Printf("Failed to record derived files for %s: %v", spec.FileID, err)
+		return
+	}
+	catalog.RecordDerived(r.Context(), provider, spec.FileID, entries)
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/example/fileprocessor/internal/models"
+	"github.com/example/fileprocessor/internal/processors"
+	"github.com/example/fileprocessor/internal/worker"
+)
+
+// useLeasingPool installs a default pool whose only local worker is kept
+// busy, so tasks with a spec wait for a remote worker
+func useLeasingPool(t *testing.T) {
+	t.Helper()
+	previous := processors.DefaultPool
+	pool := processors.NewWorkerPool(1, 10, 3)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	busy := processors.NewTask("busy", func() (*processors.ProcessResult, error) {
+		close(started)
+		<-release
+		return &processors.ProcessResult{}, nil
+	})
+	if err := pool.Submit(busy); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	processors.DefaultPool = pool
+	t.Cleanup(func() {
+		close(release)
+		pool.Stop()
+		processors.DefaultPool = previous
+	})
+}
+
+// postWorker sends a worker API request with a bearer token
+func postWorker(handler http.HandlerFunc, token string, body interface{}) (*httptest.ResponseRecorder, models.APIResponse) {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/api/workers", bytes.NewReader(data))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	var resp models.APIResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec, resp
+}
+
+func TestWorkerHandlerToken(t *testing.T) {
+	useLeasingPool(t)
+	h := NewWorkerHandler("secret", NewFileHandler(nil))
+	req := worker.LeaseRequest{WorkerID: "worker-a"}
+
+	for _, token := range []string{"", "wrong", "secret-but-longer"} {
+		for name, handler := range map[string]http.HandlerFunc{
+			"lease":     h.HandleLease,
+			"heartbeat": h.HandleHeartbeat,
+			"complete":  h.HandleComplete,
+		} {
+			if rec, _ := postWorker(handler, token, req); rec.Code != http.StatusUnauthorized {
+				t.Errorf("%s with token %q: status = %d, want 401", name, token, rec.Code)
+			}
+		}
+	}
+
+	// Without a configured token no worker is accepted
+	open := NewWorkerHandler("", NewFileHandler(nil))
+	if rec, _ := postWorker(open.HandleLease, "", req); rec.Code != http.StatusUnauthorized {
+		t.Errorf("lease with no server token: status = %d, want 401", rec.Code)
+	}
+}
+
+func TestWorkerHandlerLeaseAndComplete(t *testing.T) {
+	useLeasingPool(t)
+	useCatalog(t)
+	h := NewWorkerHandler("secret", NewFileHandler(newLocalStorage(t)))
+
+	task := processors.NewTask("task-1", func() (*processors.ProcessResult, error) { return nil, nil })
+	task.Spec = &processors.TaskSpec{FileID: "file-1", StorageType: "local"}
+	if err := processors.DefaultPool.Submit(task); err != nil {
+		t.Fatal(err)
+	}
+
+	rec, resp := postWorker(h.HandleLease, "secret", worker.LeaseRequest{WorkerID: "worker-a", WaitSeconds: 1})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("lease: status = %d: %s", rec.Code, rec.Body)
+	}
+	var leased worker.LeaseResponse
+	data, _ := json.Marshal(resp.Data)
+	if err := json.Unmarshal(data, &leased); err != nil || leased.Lease == nil || leased.Spec.FileID != "file-1" {
+		t.Fatalf("lease response = %s, want a lease on file-1", data)
+	}
+
+	// A lease ID the pool doesn't know, or one held by another worker, conflicts
+	for _, req := range []worker.CompleteRequest{
+		{WorkerID: "worker-a", LeaseID: "lease-stale", Result: &worker.Result{Summary: "late"}},
+		{WorkerID: "worker-b", LeaseID: leased.Lease.ID, Result: &worker.Result{Summary: "stolen"}},
+	} {
+		if rec, _ := postWorker(h.HandleComplete, "secret", req); rec.Code != http.StatusConflict {
+			t.Errorf("complete %s by %s: status = %d, want 409", req.LeaseID, req.WorkerID, rec.Code)
+		}
+	}
+
+	rec, _ = postWorker(h.HandleComplete, "secret", worker.CompleteRequest{
+		WorkerID: "worker-a",
+		LeaseID:  leased.Lease.ID,
+		Result:   &worker.Result{Summary: "done", Metadata: map[string]string{"pages": "3"}},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("complete: status = %d: %s", rec.Code, rec.Body)
+	}
+	select {
+	case result := <-task.Result:
+		if result.Summary != "done" {
+			t.Errorf("task result = %+v, want the reported one", result)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("task didn't complete")
+	}
+
+	// Once completed, the lease is stale
+	rec, _ = postWorker(h.HandleComplete, "secret", worker.CompleteRequest{
+		WorkerID: "worker-a", LeaseID: leased.Lease.ID, Error: "retry",
+	})
+	if rec.Code != http.StatusConflict {
+		t.Errorf("second completion: status = %d, want 409", rec.Code)
+	}
+}
+
+func TestWorkerHandlerHeartbeat(t *testing.T) {
+	useLeasingPool(t)
+	h := NewWorkerHandler("secret", NewFileHandler(nil))
+
+	rec, resp := postWorker(h.HandleHeartbeat, "secret", worker.HeartbeatRequest{WorkerID: "worker-a", LeaseIDs: []string{"lease-stale"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("heartbeat: status = %d: %s", rec.Code, rec.Body)
+	}
+	var heartbeat worker.HeartbeatResponse
+	data, _ := json.Marshal(resp.Data)
+	json.Unmarshal(data, &heartbeat)
+	if len(heartbeat.LeaseIDs) != 0 {
+		t.Errorf("heartbeat kept %v, want no leases", heartbeat.LeaseIDs)
+	}
+
+	if rec, _ := postWorker(h.HandleHeartbeat, "secret", map[string]string{}); rec.Code != http.StatusBadRequest {
+		t.Errorf("heartbeat without a worker ID: status = %d, want 400", rec.Code)
+	}
+}
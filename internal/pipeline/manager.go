@@ -0,0 +1,571 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/fileprocessor/internal/catalog"
+	"github.com/example/fileprocessor/internal/models"
+	"github.com/example/fileprocessor/internal/processors"
+	"github.com/example/fileprocessor/internal/storage"
+)
+
+// runRetention is how long finished runs are kept for status queries
+const runRetention = 24 * time.Hour
+
+// retryBackoff is how long a failed step waits before its first retry; each
+// further retry waits that much longer
+var retryBackoff = time.Second
+
+// NotifyFunc is called whenever a run changes state
+type NotifyFunc func(event string, run *Run)
+
+// Manager stores pipeline definitions and executes pipeline runs on the worker pool
+type Manager struct {
+	path      string
+	pipelines map[string]*Pipeline
+	runs      map[string]*Run
+	notify    NotifyFunc
+	mu        sync.RWMutex
+	saveMu    sync.Mutex
+
+	// ctx is cancelled by Close, cutting short runs waiting to retry a step
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewManager creates a manager that persists pipeline definitions to path
+func NewManager(path string) (*Manager, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &Manager{
+		path:      path,
+		pipelines: make(map[string]*Pipeline),
+		runs:      make(map[string]*Run),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pipelines: %w", err)
+	}
+
+	var pipelines []*Pipeline
+	if err := json.Unmarshal(data, &pipelines); err != nil {
+		return nil, fmt.Errorf("failed to parse pipelines: %w", err)
+	}
+	for _, p := range pipelines {
+		m.pipelines[p.ID] = p
+	}
+
+	return m, nil
+}
+
+// Close stops the manager's runs from waiting to retry failed steps; those
+// steps fail instead
+func (m *Manager) Close() {
+	m.cancel()
+}
+
+// SetNotifier sets the function called when a run changes state
+func (m *Manager) SetNotifier(notify NotifyFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notify = notify
+}
+
+// List returns all pipeline definitions ordered by name
+func (m *Manager) List() []Pipeline {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	pipelines := make([]Pipeline, 0, len(m.pipelines))
+	for _, p := range m.pipelines {
+		pipelines = append(pipelines, *p)
+	}
+	sort.Slice(pipelines, func(i, j int) bool {
+		return pipelines[i].Name < pipelines[j].Name
+	})
+	return pipelines
+}
+
+// Get returns a pipeline definition by ID
+func (m *Manager) Get(id string) (Pipeline, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	p, ok := m.pipelines[id]
+	if !ok {
+		return Pipeline{}, ErrPipelineNotFound
+	}
+	return *p, nil
+}
+
+// Create validates and stores a new pipeline definition
+func (m *Manager) Create(p Pipeline) (Pipeline, error) {
+	if err := p.Validate(); err != nil {
+		return Pipeline{}, err
+	}
+
+	p.ID = fmt.Sprintf("pipeline-%d", time.Now().UnixNano())
+	p.CreatedAt = time.Now()
+
+	m.mu.Lock()
+	m.pipelines[p.ID] = &p
+	m.mu.Unlock()
+
+	return p, m.save()
+}
+
+// Update replaces an existing pipeline definition
+func (m *Manager) Update(id string, p Pipeline) (Pipeline, error) {
+	if err := p.Validate(); err != nil {
+		return Pipeline{}, err
+	}
+
+	m.mu.Lock()
+	existing, ok := m.pipelines[id]
+	if !ok {
+		m.mu.Unlock()
+		return Pipeline{}, ErrPipelineNotFound
+	}
+	p.ID = id
+	p.CreatedAt = existing.CreatedAt
+	m.pipelines[id] = &p
+	m.mu.Unlock()
+
+	return p, m.save()
+}
+
+// Delete removes a pipeline definition
+func (m *Manager) Delete(id string) error {
+	m.mu.Lock()
+	if _, ok := m.pipelines[id]; !ok {
+		m.mu.Unlock()
+		return ErrPipelineNotFound
+	}
+	delete(m.pipelines, id)
+	m.mu.Unlock()
+
+	return m.save()
+}
+
+// GetRun returns a snapshot of a run by ID
+func (m *Manager) GetRun(id string) (*Run, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	run, ok := m.runs[id]
+	if !ok {
+		return nil, ErrRunNotFound
+	}
+	return run.snapshot(), nil
+}
+
+// RunsForFile returns snapshots of the runs over the given file, newest first
+func (m *Manager) RunsForFile(fileID string) []*Run {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var runs []*Run
+	for _, run := range m.runs {
+		if run.FileID == fileID {
+			runs = append(runs, run.snapshot())
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].CreatedAt.After(runs[j].CreatedAt)
+	})
+	return runs
+}
+
+// Start queues a run of the pipeline over a stored file
+func (m *Manager) Start(pipelineID string, provider storage.Provider, file *models.File) (*Run, error) {
+	p, err := m.Get(pipelineID)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &Run{
+		ID:          fmt.Sprintf("run-%d", time.Now().UnixNano()),
+		PipelineID:  p.ID,
+		FileID:      file.ID,
+		StorageType: file.StorageType,
+		Status:      "queued",
+		CreatedAt:   time.Now(),
+	}
+	for _, step := range p.Steps {
+		run.Steps = append(run.Steps, &StepRun{StepID: step.ID, Status: "pending"})
+	}
+
+	m.mu.Lock()
+	for id, r := range m.runs {
+		if !r.FinishedAt.IsZero() && time.Since(r.FinishedAt) > runRetention {
+			delete(m.runs, id)
+		}
+	}
+	m.runs[run.ID] = run
+	m.mu.Unlock()
+
+	task := processors.NewTask(run.ID, func() (*processors.ProcessResult, error) {
+		return m.execute(m.ctx, run, p, provider, file)
+	})
+	if err := processors.Submit(task); err != nil {
+		m.update(run, "pipeline_failed", func() {
+			run.Status = "failed"
+			run.FinishedAt = time.Now()
+		})
+		return nil, err
+	}
+
+	return run.snapshot(), nil
+}
+
+// stepOutput is the output of a step that later steps can consume
+type stepOutput struct {
+	name        string
+	contentType string
+	data        []byte
+}
+
+// execute runs the steps of a pipeline in dependency order
+func (m *Manager) execute(ctx context.Context, run *Run, p Pipeline, provider storage.Provider, file *models.File) (*processors.ProcessResult, error) {
+	m.update(run, "pipeline_started", func() {
+		run.Status = "running"
+	})
+
+	ordered, err := p.order()
+	if err != nil {
+		m.finishRun(run)
+		return nil, err
+	}
+
+	outputs := make(map[string]stepOutput)
+	succeeded := make(map[string]bool)
+
+	for _, step := range ordered {
+		stepRun := run.step(step.ID)
+
+		// Skip steps whose dependencies didn't succeed
+		blocked := ""
+		for _, dep := range step.dependencies() {
+			if !succeeded[dep] {
+				blocked = dep
+				break
+			}
+		}
+		if blocked != "" {
+			m.update(run, "pipeline_step", func() {
+				stepRun.Status = "skipped"
+				stepRun.Error = fmt.Sprintf("dependency %q did not succeed", blocked)
+			})
+			continue
+		}
+
+		output, err := m.executeStep(ctx, run, stepRun, p, step, provider, file, outputs)
+		if err != nil {
+			m.update(run, "pipeline_step", func() {
+				stepRun.Status = "failed"
+				stepRun.Error = err.Error()
+				stepRun.FinishedAt = time.Now()
+			})
+			continue
+		}
+
+		succeeded[step.ID] = true
+		if output != nil {
+			outputs[step.ID] = *output
+		}
+	}
+
+	snapshot := m.finishRun(run)
+	summary := fmt.Sprintf("Pipeline %s %s", p.Name, snapshot.Status)
+	if snapshot.Status == "failed" {
+		return nil, fmt.Errorf("%s", summary)
+	}
+	return &processors.ProcessResult{Summary: summary}, nil
+}
+
+// executeStep runs a single step with retries and stores its output
+func (m *Manager) executeStep(ctx context.Context, run *Run, stepRun *StepRun, p Pipeline, step Step, provider storage.Provider, file *models.File, outputs map[string]stepOutput) (*stepOutput, error) {
+	// Resolve the input of the step
+	inputName, inputType := file.Name, file.ContentType
+	if step.Input != "" {
+		input := outputs[step.Input]
+		inputName, inputType = input.name, input.contentType
+	}
+
+	processor, err := processors.SelectProcessor(step.Processor, inputType, filepath.Ext(inputName))
+	if err != nil {
+		return nil, fmt.Errorf("no processor available for %s: %w", inputName, err)
+	}
+
+	options := processors.ProcessOptions{
+		GeneratePreview: step.Output == OutputPreview,
+		ExtractMetadata: true,
+		MaxPreviewSize:  step.MaxPreviewSize,
+		Options:         step.Options,
+	}
+
+	m.update(run, "pipeline_step", func() {
+		stepRun.Status = "running"
+		stepRun.Processor = processor.Name()
+		stepRun.StartedAt = time.Now()
+	})
+
+	var result *processors.ProcessResult
+	for attempt := 1; attempt <= step.Retries+1; attempt++ {
+		m.update(run, "pipeline_step", func() {
+			stepRun.Attempts = attempt
+		})
+
+		err = nil
+		var reader io.ReadCloser
+		if step.Input == "" {
+			reader, _, err = provider.Retrieve(ctx, file.StorageID)
+			if err != nil {
+				err = fmt.Errorf("failed to retrieve file: %w", err)
+			}
+		} else {
+			reader = io.NopCloser(bytes.NewReader(outputs[step.Input].data))
+		}
+
+		if err == nil {
+			result, err = processor.Process(ctx, reader, inputName, options)
+			reader.Close()
+		}
+		if err == nil {
+			break
+		}
+
+		log.Printf("Pipeline run %s step %s attempt %d failed: %v", run.ID, step.ID, attempt, err)
+		if attempt <= step.Retries {
+			// Wait without holding the worker past a cancelled run
+			select {
+			case <-ctx.Done():
+				return nil, fmt.Errorf("%w (retry cancelled: %v)", err, ctx.Err())
+			case <-time.After(time.Duration(attempt) * retryBackoff):
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := selectOutput(step, inputName, result)
+	result.Cleanup()
+	if err != nil {
+		return nil, err
+	}
+
+	var outputID string
+	if output != nil {
+		role := fmt.Sprintf("pipeline/%s/%s", p.ID, step.ID)
+		stored, err := catalog.StoreDerived(ctx, provider, file.StorageType, file.ID, []processors.DerivedFile{{
+			Name:        output.name,
+			Role:        role,
+			ContentType: output.contentType,
+			Data:        output.data,
+		}})
+		if err != nil {
+			return nil, err
+		}
+		outputID = stored[role]
+	}
+
+	m.update(run, "pipeline_step", func() {
+		stepRun.Status = "succeeded"
+		stepRun.Summary = result.Summary
+		stepRun.Metadata = result.Metadata
+		stepRun.OutputID = outputID
+		if output != nil {
+			stepRun.OutputName = output.name
+		}
+		stepRun.FinishedAt = time.Now()
+	})
+
+	return output, nil
+}
+
+// selectOutput extracts the configured output from a step result
+func selectOutput(step Step, inputName string, result *processors.ProcessResult) (*stepOutput, error) {
+	base := strings.TrimSuffix(filepath.Base(inputName), filepath.Ext(inputName))
+	var output stepOutput
+
+	switch {
+	case step.Output == OutputNone:
+		return nil, nil
+
+	case step.Output == OutputPreview:
+		if len(result.Preview) == 0 {
+			return nil, fmt.Errorf("processor produced no preview")
+		}
+		output.data = result.Preview
+		output.contentType = http.DetectContentType(result.Preview)
+
+	case step.Output == OutputData:
+		switch data := result.Data.(type) {
+		case nil:
+			return nil, fmt.Errorf("processor produced no data")
+		case string:
+			output.data = []byte(data)
+			output.contentType = "text/plain"
+		case []byte:
+			output.data = data
+			output.contentType = http.DetectContentType(data)
+		case image.Image:
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, data); err != nil {
+				return nil, fmt.Errorf("failed to encode image output: %w", err)
+			}
+			output.data = buf.Bytes()
+			output.contentType = "image/png"
+		default:
+			encoded, err := json.Marshal(data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode data output: %w", err)
+			}
+			output.data = encoded
+			output.contentType = "application/json"
+		}
+
+	default:
+		role := strings.TrimPrefix(step.Output, derivedPrefix)
+		derived, ok := result.FindDerived(role)
+		if !ok {
+			return nil, fmt.Errorf("processor produced no %q output", role)
+		}
+		data, err := derived.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %q output: %w", role, err)
+		}
+		output.data = data
+		output.contentType = derived.ContentType
+		output.name = derived.Name
+	}
+
+	if step.ContentType != "" {
+		output.contentType = step.ContentType
+	}
+	// Drop parameters such as "; charset=utf-8" so processors can match the type
+	if mediaType, _, err := mime.ParseMediaType(output.contentType); err == nil {
+		output.contentType = mediaType
+	}
+
+	switch {
+	case step.OutputName != "":
+		output.name = step.OutputName
+	case output.name == "":
+		output.name = fmt.Sprintf("%s-%s%s", base, step.ID, extensionForType(output.contentType))
+	}
+
+	return &output, nil
+}
+
+// extensionForType returns a file extension for common content types
+func extensionForType(contentType string) string {
+	switch contentType {
+	case "text/plain":
+		return ".txt"
+	case "application/json":
+		return ".json"
+	case "text/csv":
+		return ".csv"
+	case "image/png":
+		return ".png"
+	case "image/jpeg":
+		return ".jpg"
+	case "image/gif":
+		return ".gif"
+	case "audio/mpeg":
+		return ".mp3"
+	case "video/mp4":
+		return ".mp4"
+	}
+	if exts, err := mime.ExtensionsByType(contentType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ".bin"
+}
+
+// step returns the status record of a step
+func (r *Run) step(id string) *StepRun {
+	for _, step := range r.Steps {
+		if step.StepID == id {
+			return step
+		}
+	}
+	return nil
+}
+
+// finishRun sets the final status of a run
+func (m *Manager) finishRun(run *Run) *Run {
+	var snapshot *Run
+	m.update(run, "pipeline_completed", func() {
+		run.Status = "succeeded"
+		for _, step := range run.Steps {
+			if step.Status != "succeeded" {
+				run.Status = "failed"
+			}
+		}
+		run.FinishedAt = time.Now()
+		snapshot = run.snapshot()
+	})
+	return snapshot
+}
+
+// update applies a change to a run under the lock and notifies listeners
+func (m *Manager) update(run *Run, event string, change func()) {
+	m.mu.Lock()
+	change()
+	snapshot := run.snapshot()
+	notify := m.notify
+	m.mu.Unlock()
+
+	if notify != nil {
+		notify(event, snapshot)
+	}
+}
+
+// save writes the pipeline definitions to disk
+func (m *Manager) save() error {
+	if m.path == "" {
+		return nil
+	}
+
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+
+	pipelines := m.List()
+	data, err := json.MarshalIndent(pipelines, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode pipelines: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		return fmt.Errorf("failed to create pipeline directory: %w", err)
+	}
+
+	tmpFile := m.path + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write pipelines: %w", err)
+	}
+	return os.Rename(tmpFile, m.path)
+}
@@ -0,0 +1,219 @@
+// Package pipeline chains file processors into user-defined DAG workflows
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/example/fileprocessor/internal/processors"
+)
+
+// Step output kinds
+const (
+	OutputPreview = "preview" // The step's ProcessResult.Preview
+	OutputData    = "data"    // The step's ProcessResult.Data, serialized
+	OutputNone    = "none"    // Nothing is stored; the step only contributes metadata
+	derivedPrefix = "derived:"
+)
+
+// Common errors
+var (
+	ErrPipelineNotFound = errors.New("pipeline not found")
+	ErrRunNotFound      = errors.New("pipeline run not found")
+)
+
+// Step is one processor invocation within a pipeline
+type Step struct {
+	// ID identifies the step within the pipeline
+	ID string `json:"id"`
+
+	// Processor is the name of the processor to run (e.g. "video"). When empty the
+	// processor is chosen from the content type of the step's input.
+	Processor string `json:"processor,omitempty"`
+
+	// Input is the ID of the step whose output this step consumes. When empty the
+	// step processes the original file.
+	Input string `json:"input,omitempty"`
+
+	// DependsOn lists additional steps that must succeed before this one runs
+	DependsOn []string `json:"dependsOn,omitempty"`
+
+	// Output selects what the step produces for later steps: "preview", "data",
+	// "none" or "derived:<role>" for a derived file with the given role
+	Output string `json:"output,omitempty"`
+
+	// OutputName overrides the file name the output is stored under
+	OutputName string `json:"outputName,omitempty"`
+
+	// ContentType overrides the detected content type of the output
+	ContentType string `json:"contentType,omitempty"`
+
+	// Options are passed to the processor as ProcessOptions.Options
+	Options map[string]interface{} `json:"options,omitempty"`
+
+	// MaxPreviewSize limits the preview size in bytes (0 for the processor default)
+	MaxPreviewSize int `json:"maxPreviewSize,omitempty"`
+
+	// Retries is the number of times a failed step is retried
+	Retries int `json:"retries,omitempty"`
+}
+
+// Pipeline is a named DAG of processing steps
+type Pipeline struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Steps       []Step    `json:"steps"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// StepRun tracks the execution of one step
+type StepRun struct {
+	StepID     string            `json:"stepId"`
+	Status     string            `json:"status"` // "pending", "running", "succeeded", "failed", "skipped"
+	Attempts   int               `json:"attempts"`
+	Processor  string            `json:"processor,omitempty"`
+	Summary    string            `json:"summary,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	OutputID   string            `json:"outputId,omitempty"`
+	OutputName string            `json:"outputName,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	StartedAt  time.Time         `json:"startedAt,omitempty"`
+	FinishedAt time.Time         `json:"finishedAt,omitempty"`
+}
+
+// Run tracks the execution of a pipeline over one file
+type Run struct {
+	ID          string     `json:"id"`
+	PipelineID  string     `json:"pipelineId"`
+	FileID      string     `json:"fileId"`
+	StorageType string     `json:"storageType"`
+	Status      string     `json:"status"` // "queued", "running", "succeeded", "failed"
+	Steps       []*StepRun `json:"steps"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	FinishedAt  time.Time  `json:"finishedAt,omitempty"`
+}
+
+// snapshot returns a copy of the run that is safe to serialize outside the lock
+func (r *Run) snapshot() *Run {
+	copied := *r
+	copied.Steps = make([]*StepRun, len(r.Steps))
+	for i, step := range r.Steps {
+		stepCopy := *step
+		copied.Steps[i] = &stepCopy
+	}
+	return &copied
+}
+
+// Validate checks that step IDs are unique, references resolve, processors
+// exist and the steps form an acyclic graph
+func (p *Pipeline) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("pipeline name is required")
+	}
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("pipeline must have at least one step")
+	}
+
+	ids := make(map[string]bool, len(p.Steps))
+	for i := range p.Steps {
+		step := &p.Steps[i]
+		if step.ID == "" {
+			return fmt.Errorf("step %d has no id", i+1)
+		}
+		if ids[step.ID] {
+			return fmt.Errorf("duplicate step id %q", step.ID)
+		}
+		ids[step.ID] = true
+
+		if step.Output == "" {
+			step.Output = OutputPreview
+		}
+		switch {
+		case step.Output == OutputPreview, step.Output == OutputData, step.Output == OutputNone:
+		case strings.HasPrefix(step.Output, derivedPrefix) && len(step.Output) > len(derivedPrefix):
+		default:
+			return fmt.Errorf("step %q has invalid output %q", step.ID, step.Output)
+		}
+
+		if step.Processor != "" && processors.GetProcessorByName(step.Processor) == nil {
+			return fmt.Errorf("step %q uses unknown processor %q", step.ID, step.Processor)
+		}
+		if step.Retries < 0 {
+			return fmt.Errorf("step %q has negative retries", step.ID)
+		}
+	}
+
+	for _, step := range p.Steps {
+		for _, dep := range step.dependencies() {
+			if !ids[dep] {
+				return fmt.Errorf("step %q depends on unknown step %q", step.ID, dep)
+			}
+			if dep == step.ID {
+				return fmt.Errorf("step %q depends on itself", step.ID)
+			}
+		}
+		if step.Input != "" {
+			for _, other := range p.Steps {
+				if other.ID == step.Input && other.Output == OutputNone {
+					return fmt.Errorf("step %q uses step %q as input, but it has no output", step.ID, other.ID)
+				}
+			}
+		}
+	}
+
+	if _, err := p.order(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// order returns the steps in topological order, keeping the declared order
+// between independent steps
+func (p *Pipeline) order() ([]Step, error) {
+	remaining := make(map[string]int, len(p.Steps))
+	for _, step := range p.Steps {
+		remaining[step.ID] = len(step.dependencies())
+	}
+
+	var ordered []Step
+	done := make(map[string]bool, len(p.Steps))
+	for len(ordered) < len(p.Steps) {
+		progressed := false
+		for _, step := range p.Steps {
+			if done[step.ID] || remaining[step.ID] > 0 {
+				continue
+			}
+			ordered = append(ordered, step)
+			done[step.ID] = true
+			progressed = true
+			for _, other := range p.Steps {
+				for _, dep := range other.dependencies() {
+					if dep == step.ID {
+						remaining[other.ID]--
+					}
+				}
+			}
+		}
+		if !progressed {
+			return nil, fmt.Errorf("pipeline steps contain a cycle")
+		}
+	}
+
+	return ordered, nil
+}
+
+// dependencies returns every step this step waits for
+func (s Step) dependencies() []string {
+	seen := make(map[string]bool)
+	var deps []string
+	for _, dep := range append([]string{s.Input}, s.DependsOn...) {
+		if dep != "" && !seen[dep] {
+			seen[dep] = true
+			deps = append(deps, dep)
+		}
+	}
+	return deps
+}
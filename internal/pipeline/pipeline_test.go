@@ -0,0 +1,373 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/example/fileprocessor/internal/models"
+	"github.com/example/fileprocessor/internal/processors"
+	"github.com/example/fileprocessor/internal/storage"
+)
+
+// testProcessor upper-cases its input into the preview, and fails the first
+// "failures" times it is run for a step (set through the "step" option)
+type testProcessor struct {
+	mu    sync.Mutex
+	calls []string       // Steps in the order they ran
+	runs  map[string]int // Runs per step
+}
+
+var recorder = &testProcessor{runs: make(map[string]int)}
+
+func init() {
+	processors.Register(recorder)
+}
+
+func (p *testProcessor) Name() string { return "pipeline-test" }
+
+func (p *testProcessor) CanProcess(contentType, ext string) bool { return false }
+
+func (p *testProcessor) Process(ctx context.Context, reader io.Reader, filename string, options processors.ProcessOptions) (*processors.ProcessResult, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	step := options.String("step", filename)
+	p.mu.Lock()
+	p.calls = append(p.calls, step)
+	p.runs[step]++
+	run := p.runs[step]
+	p.mu.Unlock()
+
+	if run <= options.Int("failures", 0) {
+		return nil, fmt.Errorf("attempt %d of %s failed", run, step)
+	}
+	return &processors.ProcessResult{
+		Summary:  step + " done",
+		Metadata: map[string]string{"input": string(data)},
+		Preview:  bytes.ToUpper(data),
+	}, nil
+}
+
+// reset forgets the runs recorded so far
+func (p *testProcessor) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = nil
+	p.runs = make(map[string]int)
+}
+
+func TestValidate(t *testing.T) {
+	step := func(id string, change func(*Step)) Step {
+		s := Step{ID: id, Processor: "pipeline-test"}
+		if change != nil {
+			change(&s)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name    string
+		steps   []Step
+		wantErr string
+	}{
+		{"valid chain", []Step{
+			step("a", nil),
+			step("b", func(s *Step) { s.Input = "a"; s.Output = OutputData }),
+			step("c", func(s *Step) { s.DependsOn = []string{"a", "b"}; s.Output = "derived:audio" }),
+		}, ""},
+		{"no steps", nil, "at least one step"},
+		{"missing id", []Step{step("", nil)}, "has no id"},
+		{"duplicate id", []Step{step("a", nil), step("a", nil)}, "duplicate step id"},
+		{"invalid output", []Step{step("a", func(s *Step) { s.Output = "thumbnail" })}, "invalid output"},
+		{"empty derived role", []Step{step("a", func(s *Step) { s.Output = "derived:" })}, "invalid output"},
+		{"unknown processor", []Step{step("a", func(s *Step) { s.Processor = "missing" })}, "unknown processor"},
+		{"negative retries", []Step{step("a", func(s *Step) { s.Retries = -1 })}, "negative retries"},
+		{"unknown input", []Step{step("a", func(s *Step) { s.Input = "missing" })}, `unknown step "missing"`},
+		{"unknown dependency", []Step{step("a", func(s *Step) { s.DependsOn = []string{"missing"} })}, `unknown step "missing"`},
+		{"self dependency", []Step{step("a", func(s *Step) { s.DependsOn = []string{"a"} })}, "depends on itself"},
+		{"input without output", []Step{
+			step("a", func(s *Step) { s.Output = OutputNone }),
+			step("b", func(s *Step) { s.Input = "a" }),
+		}, "has no output"},
+		{"cycle", []Step{
+			step("a", func(s *Step) { s.DependsOn = []string{"c"} }),
+			step("b", func(s *Step) { s.Input = "a" }),
+			step("c", func(s *Step) { s.Input = "b" }),
+		}, "cycle"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Pipeline{Name: "test", Steps: tt.steps}
+			err := p.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				if p.Steps[0].Output != OutputPreview {
+					t.Errorf("default output = %q, want %q", p.Steps[0].Output, OutputPreview)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := (&Pipeline{Steps: []Step{step("a", nil)}}).Validate(); err == nil {
+		t.Error("Validate() accepted a pipeline without a name")
+	}
+}
+
+func TestOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []Step
+		want  []string
+	}{
+		{"independent steps keep their order", []Step{{ID: "b"}, {ID: "a"}, {ID: "c"}}, []string{"b", "a", "c"}},
+		{"dependencies first", []Step{
+			{ID: "report", DependsOn: []string{"thumb", "text"}},
+			{ID: "text", Input: "extract"},
+			{ID: "thumb"},
+			{ID: "extract"},
+		}, []string{"thumb", "extract", "text", "report"}},
+		{"diamond", []Step{
+			{ID: "join", DependsOn: []string{"left", "right"}},
+			{ID: "right", Input: "root"},
+			{ID: "left", Input: "root"},
+			{ID: "root"},
+		}, []string{"root", "right", "left", "join"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ordered, err := (&Pipeline{Steps: tt.steps}).order()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, step := range ordered {
+				got = append(got, step.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectOutput(t *testing.T) {
+	derived := []processors.DerivedFile{{Name: "clip.mp3", Role: "audio", ContentType: "audio/mpeg", Data: []byte("ID3")}}
+	tests := []struct {
+		name     string
+		step     Step
+		result   processors.ProcessResult
+		wantName string
+		wantType string
+		wantData string
+		wantErr  string
+		wantNil  bool
+	}{
+		{name: "preview", step: Step{ID: "s", Output: OutputPreview},
+			result:   processors.ProcessResult{Preview: []byte("hello")},
+			wantName: "report-s.txt", wantType: "text/plain", wantData: "hello"},
+		{name: "missing preview", step: Step{ID: "s", Output: OutputPreview},
+			wantErr: "no preview"},
+		{name: "text data", step: Step{ID: "s", Output: OutputData},
+			result:   processors.ProcessResult{Data: "text"},
+			wantName: "report-s.txt", wantType: "text/plain", wantData: "text"},
+		{name: "structured data", step: Step{ID: "s", Output: OutputData},
+			result:   processors.ProcessResult{Data: map[string]int{"pages": 3}},
+			wantName: "report-s.json", wantType: "application/json", wantData: `{"pages":3}`},
+		{name: "image data", step: Step{ID: "s", Output: OutputData},
+			result:   processors.ProcessResult{Data: image.NewGray(image.Rect(0, 0, 1, 1))},
+			wantName: "report-s.png", wantType: "image/png"},
+		{name: "missing data", step: Step{ID: "s", Output: OutputData},
+			wantErr: "no data"},
+		{name: "none", step: Step{ID: "s", Output: OutputNone},
+			result:  processors.ProcessResult{Preview: []byte("ignored")},
+			wantNil: true},
+		{name: "derived file keeps its name", step: Step{ID: "s", Output: "derived:audio"},
+			result:   processors.ProcessResult{Derived: derived},
+			wantName: "clip.mp3", wantType: "audio/mpeg", wantData: "ID3"},
+		{name: "missing derived file", step: Step{ID: "s", Output: "derived:video"},
+			result:  processors.ProcessResult{Derived: derived},
+			wantErr: `no "video" output`},
+		{name: "overrides, without parameters", step: Step{ID: "s", Output: OutputPreview,
+			OutputName: "out.csv", ContentType: "text/csv; charset=utf-8"},
+			result:   processors.ProcessResult{Preview: []byte("a,b")},
+			wantName: "out.csv", wantType: "text/csv", wantData: "a,b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := selectOutput(tt.step, "dir/report.pdf", &tt.result)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantNil {
+				if output != nil {
+					t.Errorf("output = %+v, want nil", output)
+				}
+				return
+			}
+			if output.name != tt.wantName || output.contentType != tt.wantType {
+				t.Errorf("output %s (%s), want %s (%s)", output.name, output.contentType, tt.wantName, tt.wantType)
+			}
+			if tt.wantData != "" && string(output.data) != tt.wantData {
+				t.Errorf("output data = %q, want %q", output.data, tt.wantData)
+			}
+		})
+	}
+}
+
+func TestExecute(t *testing.T) {
+	recorder.reset()
+	previous := retryBackoff
+	retryBackoff = time.Millisecond
+	t.Cleanup(func() { retryBackoff = previous })
+
+	provider := storage.NewLocalStorage()
+	if err := provider.Initialize(map[string]string{"basePath": t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+	storageID, err := provider.Store(context.Background(), "notes.txt", strings.NewReader("hello"), 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := &models.File{ID: storageID, Name: "notes.txt", ContentType: "text/plain", StorageType: "local", StorageID: storageID}
+
+	options := func(step string, failures int) map[string]interface{} {
+		return map[string]interface{}{"step": step, "failures": failures}
+	}
+	p := Pipeline{ID: "p1", Name: "test", Steps: []Step{
+		{ID: "report", Processor: "pipeline-test", DependsOn: []string{"shout", "broken"}, Options: options("report", 0)},
+		{ID: "shout", Processor: "pipeline-test", Input: "flaky", Options: options("shout", 0)},
+		{ID: "flaky", Processor: "pipeline-test", Retries: 2, Options: options("flaky", 2)},
+		{ID: "broken", Processor: "pipeline-test", Retries: 1, Options: options("broken", 5)},
+	}}
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewManager("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := &Run{ID: "run-1", PipelineID: p.ID, FileID: file.ID}
+	for _, step := range p.Steps {
+		run.Steps = append(run.Steps, &StepRun{StepID: step.ID, Status: "pending"})
+	}
+
+	if _, err := m.execute(context.Background(), run, p, provider, file); err == nil {
+		t.Error("execute succeeded with a failed step")
+	}
+
+	// Steps run after their dependencies, and retries run straight away
+	wantCalls := []string{"flaky", "flaky", "flaky", "broken", "broken", "shout"}
+	if !reflect.DeepEqual(recorder.calls, wantCalls) {
+		t.Errorf("calls = %v, want %v", recorder.calls, wantCalls)
+	}
+
+	want := map[string]struct {
+		status   string
+		attempts int
+	}{
+		"flaky":  {"succeeded", 3},
+		"shout":  {"succeeded", 1},
+		"broken": {"failed", 2},
+		"report": {"skipped", 0},
+	}
+	for _, stepRun := range run.Steps {
+		w := want[stepRun.StepID]
+		if stepRun.Status != w.status || stepRun.Attempts != w.attempts {
+			t.Errorf("step %s: %s after %d attempts, want %s after %d", stepRun.StepID, stepRun.Status, stepRun.Attempts, w.status, w.attempts)
+		}
+	}
+	if run.Status != "failed" {
+		t.Errorf("run status = %q, want failed", run.Status)
+	}
+
+	// The chained step read the output of its input step, and its output is
+	// named after that
+	shout := run.step("shout")
+	if shout.Metadata["input"] != "HELLO" || shout.OutputName != "notes-flaky-shout.txt" {
+		t.Errorf("shout step read %q and wrote %s, want HELLO and notes-flaky-shout.txt", shout.Metadata["input"], shout.OutputName)
+	}
+	reader, _, err := provider.Retrieve(context.Background(), shout.OutputID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if data, _ := ioutil.ReadAll(reader); string(data) != "HELLO" {
+		t.Errorf("stored output = %q, want HELLO", data)
+	}
+	if _, err := m.GetRun("missing"); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("GetRun of an unknown run: err = %v, want ErrRunNotFound", err)
+	}
+}
+
+func TestExecuteCancelledRetry(t *testing.T) {
+	recorder.reset()
+	previous := retryBackoff
+	retryBackoff = time.Hour
+	t.Cleanup(func() { retryBackoff = previous })
+
+	provider := storage.NewLocalStorage()
+	if err := provider.Initialize(map[string]string{"basePath": t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+	storageID, err := provider.Store(context.Background(), "notes.txt", strings.NewReader("hello"), 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := &models.File{ID: storageID, Name: "notes.txt", ContentType: "text/plain", StorageType: "local", StorageID: storageID}
+
+	p := Pipeline{ID: "p1", Name: "test", Steps: []Step{
+		{ID: "flaky", Processor: "pipeline-test", Retries: 3, Options: map[string]interface{}{"step": "flaky", "failures": 1}},
+	}}
+	m, err := NewManager("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := &Run{ID: "run-1", PipelineID: p.ID, FileID: file.ID, Steps: []*StepRun{{StepID: "flaky", Status: "pending"}}}
+
+	// Closing the manager ends the wait for the retry instead of an hour's sleep
+	done := make(chan struct{})
+	go func() {
+		m.execute(m.ctx, run, p, provider, file)
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	m.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("execute still waiting to retry after Close")
+	}
+
+	step := run.step("flaky")
+	if step.Status != "failed" || step.Attempts != 1 || !strings.Contains(step.Error, "retry cancelled") {
+		t.Errorf("step = %+v, want failed after one attempt with the retry cancelled", step)
+	}
+}
@@ -0,0 +1,625 @@
+package processors
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Archive formats recognized by the archive processor
+const (
+	ArchiveFormatZip   = "zip"
+	ArchiveFormatTar   = "tar"
+	ArchiveFormatTarGz = "tar.gz"
+	ArchiveFormatGzip  = "gz" // A single gzip-compressed file
+)
+
+// Default limits used to protect against zip bombs and runaway extraction
+const (
+	defaultMaxArchiveRatio   = 100               // Uncompressed bytes per compressed byte
+	defaultMaxExtractSize    = 100 * 1024 * 1024 // Total bytes extracted from an archive and those nested in it
+	defaultMaxExtractEntries = 1000
+	defaultMaxArchiveDepth   = 3 // Levels of archives nested in archives that are extracted
+
+	// Entries listed in an archive document; reading a tar stream stops here
+	maxListedArchiveEntries = 10000
+
+	// Small files compress extremely well without being a threat, so ratios
+	// are only checked once this much data would be extracted
+	minBombSize = 1024 * 1024
+)
+
+// ArchiveEntry describes one entry of an archive
+type ArchiveEntry struct {
+	Path           string    `json:"path"`
+	Size           int64     `json:"size"`
+	CompressedSize int64     `json:"compressedSize"`
+	ModTime        time.Time `json:"modTime"`
+	IsDir          bool      `json:"isDir,omitempty"`
+	Unsafe         bool      `json:"unsafe,omitempty"` // Path escapes the extraction directory (zip-slip)
+
+	// Set for entries that were extracted and processed
+	Processor string            `json:"processor,omitempty"`
+	Summary   string            `json:"summary,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// ArchiveDocument is the structured data produced by the archive processor
+type ArchiveDocument struct {
+	Format         string         `json:"format"`
+	Entries        []ArchiveEntry `json:"entries"`
+	TotalSize      int64          `json:"totalSize"`
+	CompressedSize int64          `json:"compressedSize"`
+	Ratio          float64        `json:"ratio"`
+	UnsafeEntries  int            `json:"unsafeEntries"`
+	SuspectedBomb  bool           `json:"suspectedBomb"`
+	Extracted      int            `json:"extracted"`
+	SkipReason     string         `json:"skipReason,omitempty"` // Why extraction was skipped or stopped early
+	Truncated      bool           `json:"truncated,omitempty"`  // Entries were left out of the listing
+}
+
+// ArchiveProcessor lists the entries of ZIP and TAR archives and can extract
+// them. Gzip files that don't hold a tar archive are treated as an archive of
+// the one file they compress.
+//
+// Options:
+//   - extract: store the archive's files as derived files, processing each one
+//   - maxRatio: compression ratio above which the archive is treated as a zip bomb
+//   - maxExtractSize: total bytes that may be extracted, nested archives included
+//   - maxEntries: number of files that may be extracted, nested archives included
+//   - maxDepth: levels of nested archives that are extracted
+//
+// The limits can only be lowered from their defaults; larger values are ignored.
+type ArchiveProcessor struct{}
+
+// NewArchiveProcessor creates a new archive processor
+func NewArchiveProcessor() *ArchiveProcessor {
+	return &ArchiveProcessor{}
+}
+
+// archiveLimits holds the extraction limits for one archive
+type archiveLimits struct {
+	maxRatio   float64
+	maxSize    int64
+	maxEntries int
+}
+
+// extractBudget is what may still be extracted from an archive and the
+// archives nested in it. Each level is charged for what it extracts, so
+// nesting archives doesn't multiply the limits. Nested archives are
+// processed one after another, so it isn't locked.
+type extractBudget struct {
+	bytes   int64
+	entries int
+}
+
+// charge takes extracted files off the budget
+func (b *extractBudget) charge(files []DerivedFile) {
+	for _, file := range files {
+		b.bytes -= int64(len(file.Data))
+	}
+	b.entries -= len(files)
+}
+
+// Process processes an archive
+func (p *ArchiveProcessor) Process(ctx context.Context, reader io.Reader, filename string, options ProcessOptions) (*ProcessResult, error) {
+	// Zip archives need random access, so read the archive into memory, up
+	// to the memory limit
+	data, err := readAllLimited(reader, options.memoryLimit())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	limits := archiveLimits{
+		maxRatio:   archiveLimit(options.Float("maxRatio", defaultMaxArchiveRatio), defaultMaxArchiveRatio),
+		maxSize:    int64(archiveLimit(float64(options.Int("maxExtractSize", defaultMaxExtractSize)), defaultMaxExtractSize)),
+		maxEntries: int(archiveLimit(float64(options.Int("maxEntries", defaultMaxExtractEntries)), defaultMaxExtractEntries)),
+	}
+	depth := options.archiveDepth
+	maxDepth := int(archiveLimit(float64(options.Int("maxDepth", defaultMaxArchiveDepth)), defaultMaxArchiveDepth))
+	extract := options.Bool("extract") && depth < maxDepth
+
+	// The outermost archive sets the budget; nested ones get what is left of it
+	budget := options.extractBudget
+	if budget == nil {
+		budget = &extractBudget{bytes: limits.maxSize, entries: limits.maxEntries}
+		options.extractBudget = budget
+	}
+	limits.maxSize = min(limits.maxSize, max(budget.bytes, 0))
+	limits.maxEntries = min(limits.maxEntries, max(budget.entries, 0))
+
+	var doc *ArchiveDocument
+	var files []DerivedFile
+	switch archiveFormat(data) {
+	case ArchiveFormatZip:
+		doc, files, err = readZipArchive(data, limits, extract)
+	case ArchiveFormatTar:
+		doc, files, err = readTarArchive(bytes.NewReader(data), ArchiveFormatTar, int64(len(data)), limits, extract)
+	case ArchiveFormatTarGz:
+		gz, gzErr := gzip.NewReader(bytes.NewReader(data))
+		if gzErr != nil {
+			return nil, fmt.Errorf("failed to open gzip stream: %w", gzErr)
+		}
+		defer gz.Close()
+
+		// Only a tar archive has the ustar magic after its first header's name
+		decompressed := bufio.NewReaderSize(gz, 512)
+		head, _ := decompressed.Peek(262)
+		if len(head) == 262 && bytes.HasPrefix(head[257:], []byte("ustar")) {
+			doc, files, err = readTarArchive(decompressed, ArchiveFormatTarGz, int64(len(data)), limits, extract)
+		} else {
+			doc, files, err = readGzipFile(decompressed, gzipEntryName(gz.Header, filename), gz.Header.ModTime, int64(len(data)), limits, extract)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported archive format")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	result := &ProcessResult{
+		Metadata: make(map[string]string),
+		Data:     doc,
+	}
+
+	// Process each extracted file with the processor registered for it
+	if extract {
+		budget.charge(files)
+		result.Derived, result.tempDirs = processExtracted(ctx, doc, files, options, depth)
+	}
+
+	numFiles := 0
+	for _, entry := range doc.Entries {
+		if !entry.IsDir {
+			numFiles++
+		}
+	}
+
+	// Generate summary
+	result.Summary = fmt.Sprintf("%s archive with %d files, %d bytes uncompressed (ratio %.1f)",
+		strings.ToUpper(doc.Format), numFiles, doc.TotalSize, doc.Ratio)
+	if doc.SuspectedBomb {
+		result.Summary += ", suspected zip bomb"
+	}
+	if doc.UnsafeEntries > 0 {
+		result.Summary += fmt.Sprintf(", %d unsafe paths", doc.UnsafeEntries)
+	}
+
+	// Extract metadata
+	if options.ExtractMetadata {
+		result.Metadata["format"] = doc.Format
+		result.Metadata["entries"] = fmt.Sprintf("%d", len(doc.Entries))
+		result.Metadata["files"] = fmt.Sprintf("%d", numFiles)
+		result.Metadata["totalSize"] = fmt.Sprintf("%d", doc.TotalSize)
+		result.Metadata["compressedSize"] = fmt.Sprintf("%d", doc.CompressedSize)
+		result.Metadata["ratio"] = fmt.Sprintf("%.2f", doc.Ratio)
+		result.Metadata["unsafeEntries"] = fmt.Sprintf("%d", doc.UnsafeEntries)
+		result.Metadata["suspectedBomb"] = fmt.Sprintf("%t", doc.SuspectedBomb)
+		if extract {
+			result.Metadata["extracted"] = fmt.Sprintf("%d", doc.Extracted)
+		}
+		if doc.SkipReason != "" {
+			result.Metadata["extractionSkipped"] = doc.SkipReason
+		}
+	}
+
+	// Generate a listing of the entries as the preview
+	if options.GeneratePreview {
+		maxSize := options.MaxPreviewSize
+		if maxSize <= 0 {
+			maxSize = 1024 // Default to 1KB
+		}
+
+		result.Preview = []byte(truncateText(archiveListing(doc), maxSize))
+	}
+
+	return result, nil
+}
+
+// archiveLimit returns a requested extraction limit, which may lower the
+// server's default but never raise it. Values below zero are treated as zero.
+func archiveLimit(requested, defaultVal float64) float64 {
+	switch {
+	case !(requested <= defaultVal): // Also catches NaN
+		return defaultVal
+	case requested < 0:
+		return 0
+	}
+	return requested
+}
+
+// archiveFormat detects the format of an archive from its content
+func archiveFormat(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		return ArchiveFormatZip
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		// Plain gzip files are told apart once decompressed
+		return ArchiveFormatTarGz
+	case len(data) > 262 && bytes.HasPrefix(data[257:], []byte("ustar")):
+		return ArchiveFormatTar
+	}
+	return ""
+}
+
+// readZipArchive lists the entries of a zip archive, returning the contents of
+// safe files when extract is set
+func readZipArchive(data []byte, limits archiveLimits, extract bool) (*ArchiveDocument, []DerivedFile, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc := &ArchiveDocument{Format: ArchiveFormatZip, CompressedSize: int64(len(data))}
+	for _, f := range zr.File {
+		entry := ArchiveEntry{
+			Path:           f.Name,
+			Size:           int64(f.UncompressedSize64),
+			CompressedSize: int64(f.CompressedSize64),
+			ModTime:        f.Modified,
+			IsDir:          f.FileInfo().IsDir(),
+			Unsafe:         unsafeArchivePath(f.Name),
+		}
+		doc.addEntry(entry)
+
+		// A single entry that expands far beyond its compressed size is a bomb
+		// even when the archive as a whole looks harmless
+		if entry.Size > minBombSize && entry.CompressedSize > 0 &&
+			float64(entry.Size)/float64(entry.CompressedSize) > limits.maxRatio {
+			doc.SuspectedBomb = true
+		}
+	}
+	doc.finish(limits)
+
+	// The sizes in the central directory are checked before anything is
+	// decompressed; the reads below are limited as well since they can lie
+	if !extract || doc.SkipReason != "" {
+		return doc, nil, nil
+	}
+
+	var files []DerivedFile
+	var total int64
+	for i, f := range zr.File {
+		if i >= len(doc.Entries) {
+			break // Left out of the listing
+		}
+		entry := &doc.Entries[i]
+		if entry.IsDir || entry.Unsafe {
+			continue
+		}
+		if len(files) >= limits.maxEntries {
+			doc.SkipReason = fmt.Sprintf("more than %d files", limits.maxEntries)
+			break
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			entry.Error = err.Error()
+			continue
+		}
+		content, err := readLimited(rc, limits.maxSize-total)
+		rc.Close()
+		if err != nil {
+			doc.SkipReason = err.Error()
+			doc.SuspectedBomb = true
+			break
+		}
+
+		total += int64(len(content))
+		files = append(files, extractedFile(entry.Path, content))
+	}
+
+	return doc, files, nil
+}
+
+// readTarArchive lists the entries of a tar stream, returning the contents of
+// safe files when extract is set. archiveSize is the size of the file the
+// stream was read from, used to compute the compression ratio.
+func readTarArchive(r io.Reader, format string, archiveSize int64, limits archiveLimits, extract bool) (*ArchiveDocument, []DerivedFile, error) {
+	doc := &ArchiveDocument{Format: format, CompressedSize: archiveSize}
+	tr := tar.NewReader(r)
+
+	var files []DerivedFile
+	var total int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		entry := ArchiveEntry{
+			Path:           hdr.Name,
+			Size:           hdr.Size,
+			CompressedSize: hdr.Size,
+			ModTime:        hdr.ModTime,
+			IsDir:          hdr.Typeflag == tar.TypeDir,
+			Unsafe:         unsafeArchivePath(hdr.Name) || hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeLink,
+		}
+		if format == ArchiveFormatTarGz {
+			// Entries of a compressed tar don't have their own compressed size
+			entry.CompressedSize = 0
+		}
+		doc.addEntry(entry)
+
+		// A gzip stream can't be checked up front, so stop reading as soon as
+		// the data seen so far expands too far, without inflating the rest
+		if doc.TotalSize > minBombSize && float64(doc.TotalSize) > limits.maxRatio*float64(archiveSize) {
+			doc.SuspectedBomb = true
+			doc.SkipReason = fmt.Sprintf("compression ratio above %.0f", limits.maxRatio)
+			break
+		}
+		if doc.Truncated {
+			if doc.SkipReason == "" {
+				doc.SkipReason = fmt.Sprintf("more than %d entries", maxListedArchiveEntries)
+			}
+			break
+		}
+
+		if !extract || doc.SkipReason != "" || hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if entry.Unsafe {
+			continue
+		}
+		if len(files) >= limits.maxEntries {
+			doc.SkipReason = fmt.Sprintf("more than %d files", limits.maxEntries)
+			continue
+		}
+
+		content, err := readLimited(tr, limits.maxSize-total)
+		if err != nil {
+			doc.SkipReason = err.Error()
+			continue
+		}
+		total += int64(len(content))
+		files = append(files, extractedFile(hdr.Name, content))
+	}
+	doc.finish(limits)
+
+	// Nothing is kept from an archive found to be a bomb part way through
+	if doc.SuspectedBomb {
+		files = nil
+	}
+	return doc, files, nil
+}
+
+// readGzipFile describes a gzip file that doesn't hold a tar archive as an
+// archive of one entry, returning its content when extract is set. The
+// stream is only inflated up to the compression ratio limit.
+func readGzipFile(r io.Reader, name string, modTime time.Time, archiveSize int64, limits archiveLimits, extract bool) (*ArchiveDocument, []DerivedFile, error) {
+	doc := &ArchiveDocument{Format: ArchiveFormatGzip, CompressedSize: archiveSize}
+
+	maxSize := int64(limits.maxRatio * float64(archiveSize))
+	if maxSize < minBombSize {
+		maxSize = minBombSize
+	}
+	content := &headBuffer{}
+	if extract {
+		content.max = limits.maxSize
+	}
+	size, err := io.CopyN(content, r, maxSize+1)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+
+	doc.addEntry(ArchiveEntry{
+		Path:    name,
+		Size:    size,
+		ModTime: modTime,
+		Unsafe:  unsafeArchivePath(name),
+	})
+	if size > maxSize {
+		// The size is only known to be at least this much
+		doc.SuspectedBomb = true
+		doc.SkipReason = fmt.Sprintf("compression ratio above %.0f", limits.maxRatio)
+	}
+	doc.finish(limits)
+
+	if !extract || doc.SkipReason != "" || doc.UnsafeEntries > 0 {
+		return doc, nil, nil
+	}
+	return doc, []DerivedFile{extractedFile(name, content.data)}, nil
+}
+
+// gzipEntryName returns the name of the file a gzip stream compresses: the
+// name in its header, or the gzip file's name without its extension
+func gzipEntryName(header gzip.Header, filename string) string {
+	if header.Name != "" {
+		return header.Name
+	}
+	name := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	if name == "" || name == "." {
+		return "data"
+	}
+	return name
+}
+
+// addEntry adds an entry to the document's totals, and to its listing unless
+// the listing is full
+func (d *ArchiveDocument) addEntry(entry ArchiveEntry) {
+	if len(d.Entries) < maxListedArchiveEntries {
+		d.Entries = append(d.Entries, entry)
+	} else {
+		d.Truncated = true
+	}
+	d.TotalSize += entry.Size
+	if entry.Unsafe {
+		d.UnsafeEntries++
+	}
+}
+
+// finish computes the compression ratio and decides whether the archive may be extracted
+func (d *ArchiveDocument) finish(limits archiveLimits) {
+	if d.CompressedSize > 0 {
+		d.Ratio = float64(d.TotalSize) / float64(d.CompressedSize)
+	}
+	if d.TotalSize > minBombSize && d.Ratio > limits.maxRatio {
+		d.SuspectedBomb = true
+	}
+
+	switch {
+	case d.SkipReason != "":
+	case d.SuspectedBomb:
+		d.SkipReason = fmt.Sprintf("compression ratio above %.0f", limits.maxRatio)
+	case d.TotalSize > limits.maxSize:
+		d.SkipReason = fmt.Sprintf("uncompressed size above %d bytes", limits.maxSize)
+	}
+}
+
+// unsafeArchivePath reports whether extracting an entry to its path would
+// write outside the extraction directory
+func unsafeArchivePath(name string) bool {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || filepath.VolumeName(name) != "" || (len(name) > 1 && name[1] == ':') {
+		return true
+	}
+	cleaned := path.Clean(name)
+	return cleaned == ".." || strings.HasPrefix(cleaned, "../")
+}
+
+// readLimited reads all of r, failing if it holds more than limit bytes
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	if limit < 0 {
+		limit = 0
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > limit {
+		return nil, fmt.Errorf("extracted data exceeds the size limit")
+	}
+	return content, nil
+}
+
+// extractedFile creates the derived file for an archive entry
+func extractedFile(entryPath string, content []byte) DerivedFile {
+	return DerivedFile{
+		Name:        path.Base(entryPath),
+		Role:        "entry:" + entryPath,
+		ContentType: GetContentTypeByExt(entryPath),
+		Data:        content,
+		Metadata:    map[string]string{"archivePath": entryPath},
+	}
+}
+
+// processExtracted runs the matching processor over each extracted file,
+// recording its results on the entry and on the derived file. Files derived
+// from extracted files (including the contents of nested archives) are
+// returned along with the extracted files themselves, with the temporary
+// directories holding the content of any of them.
+func processExtracted(ctx context.Context, doc *ArchiveDocument, files []DerivedFile, options ProcessOptions, depth int) ([]DerivedFile, []string) {
+	entries := make(map[string]*ArchiveEntry, len(doc.Entries))
+	for i := range doc.Entries {
+		entries[doc.Entries[i].Path] = &doc.Entries[i]
+	}
+
+	// Nested archives are processed one level deeper, with the same settings
+	// and what is left of the extraction budget
+	childOptions := options
+	childOptions.Processor = ""
+	childOptions.archiveDepth = depth + 1
+
+	derived := make([]DerivedFile, 0, len(files))
+	var tempDirs []string
+	for _, file := range files {
+		doc.Extracted++
+		entryPath := file.Metadata["archivePath"]
+		entry := entries[entryPath]
+
+		processor := GetProcessor(file.ContentType, path.Ext(entryPath))
+		if processor == nil {
+			derived = append(derived, file)
+			continue
+		}
+
+		result, err := processor.Process(ctx, bytes.NewReader(file.Data), file.Name, childOptions)
+		if entry != nil {
+			entry.Processor = processor.Name()
+		}
+		if err != nil {
+			if entry != nil {
+				entry.Error = err.Error()
+			}
+			derived = append(derived, file)
+			continue
+		}
+
+		if entry != nil {
+			entry.Summary = result.Summary
+			entry.Metadata = result.Metadata
+		}
+		for k, v := range result.Metadata {
+			if _, exists := file.Metadata[k]; !exists {
+				file.Metadata[k] = v
+			}
+		}
+		file.Metadata["processor"] = processor.Name()
+		file.Metadata["summary"] = result.Summary
+		derived = append(derived, file)
+
+		// Keep what the entry's processor derived, scoped under the entry
+		for _, child := range result.Derived {
+			child.Role = file.Role + "/" + strings.TrimPrefix(child.Role, "entry:")
+			derived = append(derived, child)
+		}
+		tempDirs = append(tempDirs, result.tempDirs...)
+	}
+
+	sort.SliceStable(derived, func(i, j int) bool { return derived[i].Role < derived[j].Role })
+	return derived, tempDirs
+}
+
+// archiveListing renders the entries of an archive like "tar -tv"
+func archiveListing(doc *ArchiveDocument) string {
+	var b strings.Builder
+	for _, entry := range doc.Entries {
+		flag := " "
+		if entry.Unsafe {
+			flag = "!"
+		}
+		fmt.Fprintf(&b, "%s %10d %s %s\n", flag, entry.Size, entry.ModTime.Format("2006-01-02 15:04"), entry.Path)
+	}
+	return b.String()
+}
+
+// Name returns the processor name
+func (p *ArchiveProcessor) Name() string {
+	return "archive"
+}
+
+// CanProcess returns true if this processor can process the given content type
+func (p *ArchiveProcessor) CanProcess(contentType, ext string) bool {
+	switch contentType {
+	case "application/zip", "application/x-zip-compressed", "application/x-tar",
+		"application/gzip", "application/x-gzip", "application/x-compressed-tar":
+		return true
+	}
+
+	switch strings.ToLower(ext) {
+	case ".zip", ".tar", ".tgz", ".gz":
+		return true
+	}
+	return false
+}
+
+// init registers the processor with the registry
+func init() {
+	Register(NewArchiveProcessor(), "application/zip", "application/x-zip-compressed", "application/x-tar",
+		"application/gzip", "application/x-gzip", "application/x-compressed-tar")
+}
@@ -0,0 +1,324 @@
+package processors
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// archiveFile is a file to put in a test archive
+type archiveFile struct {
+	name    string
+	content []byte
+}
+
+// makeZip builds a zip archive holding files
+func makeZip(t testing.TB, files ...archiveFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(f.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// makeTarGz builds a gzip-compressed tar archive holding files
+func makeTarGz(t testing.TB, files ...archiveFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(f.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// processArchive runs the archive processor over data with options
+func processArchive(t testing.TB, data []byte, options map[string]interface{}) (*ProcessResult, *ArchiveDocument) {
+	t.Helper()
+	result, err := NewArchiveProcessor().Process(context.Background(), bytes.NewReader(data), "test.zip",
+		ProcessOptions{ExtractMetadata: true, Options: options})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(result.Cleanup)
+	return result, result.Data.(*ArchiveDocument)
+}
+
+// derivedRoles returns the roles of a result's derived files
+func derivedRoles(result *ProcessResult) []string {
+	roles := make([]string, 0, len(result.Derived))
+	for _, derived := range result.Derived {
+		roles = append(roles, derived.Role)
+	}
+	return roles
+}
+
+func TestUnsafeArchivePath(t *testing.T) {
+	tests := []struct {
+		name   string
+		unsafe bool
+	}{
+		{"file.txt", false},
+		{"dir/file.txt", false},
+		{"dir/../file.txt", false},
+		{"./file.txt", false},
+		{"..file.txt", false},
+		{"../file.txt", true},
+		{"..", true},
+		{"dir/../../file.txt", true},
+		{"/etc/passwd", true},
+		{"..\\windows\\file.txt", true},
+		{"\\absolute.txt", true},
+		{"C:\\file.txt", true},
+		{"c:file.txt", true},
+	}
+	for _, tt := range tests {
+		if got := unsafeArchivePath(tt.name); got != tt.unsafe {
+			t.Errorf("unsafeArchivePath(%q) = %t, want %t", tt.name, got, tt.unsafe)
+		}
+	}
+}
+
+func TestArchiveSkipsUnsafeEntries(t *testing.T) {
+	data := makeZip(t,
+		archiveFile{"ok.txt", []byte("fine")},
+		archiveFile{"../escape.txt", []byte("zip-slip")},
+		archiveFile{"/etc/cron.d/job", []byte("absolute")},
+	)
+	result, doc := processArchive(t, data, map[string]interface{}{"extract": true})
+
+	if doc.UnsafeEntries != 2 {
+		t.Errorf("UnsafeEntries = %d, want 2", doc.UnsafeEntries)
+	}
+	if roles := derivedRoles(result); len(roles) != 1 || roles[0] != "entry:ok.txt" {
+		t.Errorf("derived roles = %v, want only entry:ok.txt", roles)
+	}
+	if !strings.Contains(result.Summary, "2 unsafe paths") {
+		t.Errorf("Summary = %q, want it to mention the unsafe paths", result.Summary)
+	}
+}
+
+func TestArchiveRatioBomb(t *testing.T) {
+	zeros := make([]byte, 4*minBombSize)
+	tests := []struct {
+		name    string
+		data    []byte
+		options map[string]interface{}
+	}{
+		{"zip", makeZip(t, archiveFile{"zeros.bin", zeros}), nil},
+		{"tar.gz", makeTarGz(t, archiveFile{"zeros.bin", zeros}), nil},
+		{"gzip", func() []byte {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			gz.Write(zeros)
+			gz.Close()
+			return buf.Bytes()
+		}(), nil},
+		// Requests can't raise the ratio limit above the server's default
+		{"zip with raised limit", makeZip(t, archiveFile{"zeros.bin", zeros}),
+			map[string]interface{}{"maxRatio": 1e9, "maxExtractSize": 1e12}},
+		{"zip with NaN limit", makeZip(t, archiveFile{"zeros.bin", zeros}),
+			map[string]interface{}{"maxRatio": "NaN"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := map[string]interface{}{"extract": true}
+			for k, v := range tt.options {
+				options[k] = v
+			}
+			result, doc := processArchive(t, tt.data, options)
+			if !doc.SuspectedBomb {
+				t.Errorf("SuspectedBomb = false for ratio %.0f", doc.Ratio)
+			}
+			if doc.SkipReason == "" {
+				t.Error("extraction wasn't skipped")
+			}
+			if len(result.Derived) != 0 {
+				t.Errorf("extracted %v from a bomb", derivedRoles(result))
+			}
+		})
+	}
+}
+
+func TestArchiveSizeAndEntryLimits(t *testing.T) {
+	files := []archiveFile{
+		{"a.txt", []byte("first file")},
+		{"b.txt", []byte("second file")},
+		{"c.txt", []byte("third file")},
+	}
+	tests := []struct {
+		name    string
+		options map[string]interface{}
+		derived map[string]int
+		skipped bool
+	}{
+		{"defaults", nil, map[string]int{ArchiveFormatZip: 3, ArchiveFormatTarGz: 3}, false},
+		// A zip's sizes are known up front; a tar stream is extracted until the limit is hit
+		{"lowered size", map[string]interface{}{"maxExtractSize": 15},
+			map[string]int{ArchiveFormatZip: 0, ArchiveFormatTarGz: 1}, true},
+		{"lowered entries", map[string]interface{}{"maxEntries": 2},
+			map[string]int{ArchiveFormatZip: 2, ArchiveFormatTarGz: 2}, true},
+		{"negative entries", map[string]interface{}{"maxEntries": -5},
+			map[string]int{ArchiveFormatZip: 0, ArchiveFormatTarGz: 0}, true},
+	}
+	for _, format := range []string{ArchiveFormatZip, ArchiveFormatTarGz} {
+		data := makeZip(t, files...)
+		if format == ArchiveFormatTarGz {
+			data = makeTarGz(t, files...)
+		}
+		for _, tt := range tests {
+			t.Run(format+"/"+tt.name, func(t *testing.T) {
+				options := map[string]interface{}{"extract": true}
+				for k, v := range tt.options {
+					options[k] = v
+				}
+				result, doc := processArchive(t, data, options)
+				if len(result.Derived) != tt.derived[format] {
+					t.Errorf("derived %v, want %d files", derivedRoles(result), tt.derived[format])
+				}
+				if (doc.SkipReason != "") != tt.skipped {
+					t.Errorf("SkipReason = %q, want skipped %t", doc.SkipReason, tt.skipped)
+				}
+			})
+		}
+	}
+}
+
+func TestArchiveLimitCannotBeRaised(t *testing.T) {
+	tests := []struct {
+		requested, want float64
+	}{
+		{50, 50},
+		{100, 100},
+		{1e9, 100},
+		{-1, 0},
+	}
+	for _, tt := range tests {
+		if got := archiveLimit(tt.requested, 100); got != tt.want {
+			t.Errorf("archiveLimit(%v, 100) = %v, want %v", tt.requested, got, tt.want)
+		}
+	}
+}
+
+func TestArchiveNestedDepth(t *testing.T) {
+	// Five levels of archives, each holding a text file and the next archive
+	data := makeZip(t, archiveFile{"leaf.txt", []byte("bottom")})
+	for level := 4; level >= 1; level-- {
+		data = makeZip(t,
+			archiveFile{"note.txt", []byte("level")},
+			archiveFile{"inner.zip", data},
+		)
+	}
+
+	deepest := func(result *ProcessResult) int {
+		max := 0
+		for _, role := range derivedRoles(result) {
+			if n := strings.Count(role, "/") + 1; n > max {
+				max = n
+			}
+		}
+		return max
+	}
+
+	tests := []struct {
+		name    string
+		options map[string]interface{}
+		depth   int
+	}{
+		{"default", map[string]interface{}{"extract": true}, defaultMaxArchiveDepth},
+		{"lowered", map[string]interface{}{"extract": true, "maxDepth": 1}, 1},
+		{"raised", map[string]interface{}{"extract": true, "maxDepth": 100}, defaultMaxArchiveDepth},
+		// The depth reached so far isn't an option a request can reset
+		{"depth option", map[string]interface{}{"extract": true, "archiveDepth": -1000}, defaultMaxArchiveDepth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, _ := processArchive(t, data, tt.options)
+			if got := deepest(result); got != tt.depth {
+				t.Errorf("extracted %d levels deep, want %d: %v", got, tt.depth, derivedRoles(result))
+			}
+		})
+	}
+}
+
+func TestArchiveNestedBudget(t *testing.T) {
+	// Each nested archive holds a file of 4000 bytes, so both fit the size
+	// limit on their own but not together
+	inner := makeZip(t, archiveFile{"data.txt", bytes.Repeat([]byte("x"), 4000)})
+	data := makeZip(t, archiveFile{"inner1.zip", inner}, archiveFile{"inner2.zip", inner})
+
+	tests := []struct {
+		name    string
+		options map[string]interface{}
+		skipped string
+	}{
+		{"size", map[string]interface{}{"extract": true, "maxExtractSize": 5000}, "uncompressed size above"},
+		{"entries", map[string]interface{}{"extract": true, "maxEntries": 3}, "more than 0 files"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, doc := processArchive(t, data, tt.options)
+
+			// The second nested archive gets what the first one left
+			want := []string{"entry:inner1.zip", "entry:inner1.zip/data.txt", "entry:inner2.zip"}
+			if roles := derivedRoles(result); !reflect.DeepEqual(roles, want) {
+				t.Errorf("derived %v, want %v", roles, want)
+			}
+			if skipped := doc.Entries[1].Metadata["extractionSkipped"]; !strings.Contains(skipped, tt.skipped) {
+				t.Errorf("inner2.zip extractionSkipped = %q, want %q", skipped, tt.skipped)
+			}
+
+			total := 0
+			for _, file := range result.Derived {
+				total += len(file.Data)
+			}
+			if total > 5000 {
+				t.Errorf("extracted %d bytes in all, want at most 5000", total)
+			}
+		})
+	}
+}
+
+func TestArchiveListingPreview(t *testing.T) {
+	data := makeZip(t, archiveFile{"été.txt", []byte("summer")})
+	result, err := NewArchiveProcessor().Process(context.Background(), bytes.NewReader(data), "test.zip",
+		ProcessOptions{GeneratePreview: true, MaxPreviewSize: 31})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The limit falls inside the é, so the listing stops before it
+	if preview := string(result.Preview); len(preview) != 30 || !utf8.ValidString(preview) {
+		t.Errorf("preview = %q, want the 30 bytes before the path", preview)
+	}
+}
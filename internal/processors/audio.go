@@ -6,8 +6,8 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -21,64 +21,84 @@ func NewAudioProcessor() *AudioProcessor {
 
 // Process processes an audio file
 func (p *AudioProcessor) Process(ctx context.Context, reader io.Reader, filename string, options ProcessOptions) (*ProcessResult, error) {
-	// Read the entire audio into a temporary file since we can't process audio streams directly
-	data, err := ioutil.ReadAll(reader)
+	// Spool the audio to a temporary file for ffmpeg, without holding it in memory
+	audioPath, _, err := spoolToTempFile(reader, "audio-*"+filepath.Ext(filename))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read audio: %w", err)
+		return nil, err
 	}
+	defer os.Remove(audioPath)
 
 	result := &ProcessResult{
 		Metadata: make(map[string]string),
 	}
 
-	// Create a temporary file to store the audio
-	tempFile, err := ioutil.TempFile("", "audio-*"+filepath.Ext(filename))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create temporary file: %w", err)
-	}
-	defer os.Remove(tempFile.Name())
-	defer tempFile.Close()
-
-	if _, err = tempFile.Write(data); err != nil {
-		return nil, fmt.Errorf("failed to write to temporary file: %w", err)
-	}
-	tempFile.Close() // Close to ensure data is flushed
-
 	// Extract metadata using ffprobe if enabled and available
 	if options.ExtractMetadata {
-		cmd := exec.Command("ffprobe", "-v", "quiet", "-print_format", "json", "-show_format", "-show_streams", tempFile.Name())
-		metadataOutput, err := cmd.Output()
-
-		if err == nil {
-			// Store the JSON output as metadata
-			result.Metadata["format"] = strings.ToLower(filepath.Ext(filename))
-			result.Metadata["details"] = string(metadataOutput)
+		if !DefaultTools.Available(ToolFFprobe) {
+			noteMissingTools(result.Metadata, ToolFFprobe)
+		} else if info, err := probeMedia(ctx, audioPath); err == nil {
+			result.Data = info
+			info.addMetadata(result.Metadata)
+		}
+		result.Metadata["format"] = strings.ToLower(filepath.Ext(filename))
+	}
 
-			// Try to extract duration using a more direct ffprobe command
-			durationCmd := exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", tempFile.Name())
-			durationOutput, err := durationCmd.Output()
-			if err == nil {
-				result.Metadata["duration"] = strings.TrimSpace(string(durationOutput))
-			}
+	// Read the embedded tags and cover art in Go, so they are available
+	// without ffmpeg; they only fill in what ffprobe didn't report
+	tags, tagsErr := readAudioTagsFile(audioPath)
+	if tagsErr == nil && options.ExtractMetadata {
+		info, ok := result.Data.(*MediaInfo)
+		if !ok {
+			info = &MediaInfo{}
+			result.Data = info
+		}
+		info.AudioTags = tags
+		tags.addMetadata(result.Metadata)
+	}
 
-			// Try to extract bitrate
-			bitrateCmd := exec.Command("ffprobe", "-v", "error", "-select_streams", "a:0", "-show_entries", "stream=bit_rate", "-of", "default=noprint_wrappers=1:nokey=1", tempFile.Name())
-			bitrateOutput, err := bitrateCmd.Output()
-			if err == nil {
-				result.Metadata["bitrate"] = strings.TrimSpace(string(bitrateOutput))
-			}
+	// Measure loudness and find silences, and encode normalized copies, if
+	// requested; normalizing needs the measurement
+	formats, err := normalizeFormats(options)
+	if err != nil {
+		return nil, err
+	}
+	if options.Bool("loudness") || len(formats) > 0 {
+		target, silenceThreshold, silenceDuration, err := loudnessOptions(options)
+		if err != nil {
+			return nil, err
+		}
+		if err := DefaultTools.Require(ToolFFmpeg); err != nil {
+			return nil, err
+		}
 
-			// Try to extract sample rate
-			sampleRateCmd := exec.Command("ffprobe", "-v", "error", "-select_streams", "a:0", "-show_entries", "stream=sample_rate", "-of", "default=noprint_wrappers=1:nokey=1", tempFile.Name())
-			sampleRateOutput, err := sampleRateCmd.Output()
-			if err == nil {
-				result.Metadata["sample_rate"] = strings.TrimSpace(string(sampleRateOutput))
+		info, ok := result.Data.(*MediaInfo)
+		if !ok {
+			info = &MediaInfo{}
+			result.Data = info
+		}
+		loudness, silences, err := analyzeLoudness(ctx, audioPath, info.Format.Duration, silenceThreshold, silenceDuration)
+		if err != nil {
+			return nil, err
+		}
+		info.Loudness = loudness
+		info.Silences = silences
+		loudness.addMetadata(result.Metadata, silences)
+
+		if len(formats) > 0 {
+			files, err := normalizeAudio(ctx, audioPath, filename, loudness, target, formats)
+			if err != nil {
+				return nil, err
 			}
+			result.Derived = append(result.Derived, files...)
+			result.Metadata["normalized"] = strings.Join(formats, ",")
+			result.Metadata["loudnessTarget"] = strconv.FormatFloat(target, 'f', -1, 64)
 		}
 	}
 
-	// Generate a waveform preview if requested and ffmpeg is available
-	if options.GeneratePreview {
+	// Use the cover art as the preview, or generate a waveform if ffmpeg is available
+	if options.GeneratePreview && tagsErr == nil && len(tags.Cover) > 0 {
+		result.Preview = tags.Cover
+	} else if options.GeneratePreview {
 		// Create a temporary file for the waveform image
 		waveformFile, err := ioutil.TempFile("", "waveform-*.png")
 		if err == nil {
@@ -86,13 +106,18 @@ func (p *AudioProcessor) Process(ctx context.Context, reader io.Reader, filename
 			waveformFile.Close()
 
 			// Generate a waveform image using ffmpeg
-			cmd := exec.Command(
-				"ffmpeg", "-i", tempFile.Name(),
-				"-filter_complex", "showwavespic=s=640x120:colors=#3498db",
-				"-frames:v", "1",
-				waveformFile.Name(),
-			)
-			err = cmd.Run()
+			err = DefaultTools.Require(ToolFFmpeg)
+			if err == nil {
+				cmd := DefaultTools.Command(ctx, ToolFFmpeg,
+					"-i", audioPath,
+					"-filter_complex", "showwavespic=s=640x120:colors=#3498db",
+					"-frames:v", "1",
+					waveformFile.Name(),
+				)
+				err = cmd.Run()
+			} else {
+				noteMissingTools(result.Metadata, ToolFFmpeg)
+			}
 
 			if err == nil {
 				waveformData, err := ioutil.ReadFile(waveformFile.Name())
@@ -100,26 +125,23 @@ func (p *AudioProcessor) Process(ctx context.Context, reader io.Reader, filename
 					result.Preview = waveformData
 				}
 			} else {
-				// If waveform generation fails, store a small portion of the audio file itself
-				// Up to maxPreviewSize bytes (for streaming purposes)
-				if options.MaxPreviewSize > 0 && len(data) > options.MaxPreviewSize {
-					result.Preview = data[:options.MaxPreviewSize]
-				} else {
-					result.Preview = data
-				}
+				// If waveform generation fails, store a portion of the audio file itself
+				result.Preview = audioPreview(audioPath, options)
 			}
 		} else {
 			// If we can't create a waveform, store a portion of the audio file itself
-			if options.MaxPreviewSize > 0 && len(data) > options.MaxPreviewSize {
-				result.Preview = data[:options.MaxPreviewSize]
-			} else {
-				result.Preview = data
-			}
+			result.Preview = audioPreview(audioPath, options)
 		}
 	}
 
 	// Generate summary
 	result.Summary = fmt.Sprintf("Audio file: %s", filename)
+	if result.Metadata["title"] != "" {
+		result.Summary += fmt.Sprintf(", Title: %s", result.Metadata["title"])
+		if result.Metadata["artist"] != "" {
+			result.Summary += fmt.Sprintf(" by %s", result.Metadata["artist"])
+		}
+	}
 	if result.Metadata["duration"] != "" {
 		result.Summary += fmt.Sprintf(", Duration: %s seconds", result.Metadata["duration"])
 	}
@@ -130,10 +152,56 @@ func (p *AudioProcessor) Process(ctx context.Context, reader io.Reader, filename
 	if result.Metadata["sample_rate"] != "" {
 		result.Summary += fmt.Sprintf(", Sample rate: %s Hz", result.Metadata["sample_rate"])
 	}
+	if result.Metadata["loudnessIntegrated"] != "" {
+		result.Summary += fmt.Sprintf(", Loudness: %s LUFS", result.Metadata["loudnessIntegrated"])
+	}
 
 	return result, nil
 }
 
+// Features lists the features of the processor that need ffmpeg or ffprobe
+func (p *AudioProcessor) Features() []Feature {
+	return []Feature{
+		{Name: "tags", Description: "ID3, Vorbis comment, FLAC and MP4 tags and cover art"},
+		{Name: "metadata", Description: "Codec, duration, bitrate and stream metadata", Tools: []string{ToolFFprobe}},
+		{Name: "waveform", Description: "Waveform previews of files without cover art", Tools: []string{ToolFFmpeg}},
+		{Name: "loudness", Description: "EBU R128 loudness and silence detection", Tools: []string{ToolFFmpeg}},
+		{Name: "normalize", Description: "Loudness-normalized MP3, Opus and AAC transcodes", Tools: []string{ToolFFmpeg}},
+	}
+}
+
+// audioPreview reads the start of an audio file as its preview, up to
+// MaxPreviewSize bytes (for streaming purposes) or the memory limit
+func audioPreview(path string, options ProcessOptions) []byte {
+	limit := options.memoryLimit()
+	if options.MaxPreviewSize > 0 && int64(options.MaxPreviewSize) < limit {
+		limit = int64(options.MaxPreviewSize)
+	}
+	preview, err := readFileHead(path, limit)
+	if err != nil {
+		return nil
+	}
+	return preview
+}
+
+// loudnessOptions reads the loudnessTarget (LUFS), silenceThreshold (dB) and
+// silenceDuration (seconds) options
+func loudnessOptions(options ProcessOptions) (float64, float64, float64, error) {
+	target := options.Float("loudnessTarget", DefaultLoudnessTarget)
+	if target < -70 || target > -5 {
+		return 0, 0, 0, fmt.Errorf("loudness target must be between -70 and -5 LUFS")
+	}
+	threshold := options.Float("silenceThreshold", defaultSilenceThreshold)
+	if threshold < -90 || threshold >= 0 {
+		return 0, 0, 0, fmt.Errorf("silence threshold must be between -90 and 0 dB")
+	}
+	duration := options.Float("silenceDuration", defaultSilenceDuration)
+	if duration < 0.1 || duration > 60 {
+		return 0, 0, 0, fmt.Errorf("silence duration must be between 0.1 and 60 seconds")
+	}
+	return target, threshold, duration, nil
+}
+
 // Helper function to safely parse integers
 func parseIntSafe(s string, defaultVal int) int {
 	var val int
@@ -144,6 +212,11 @@ func parseIntSafe(s string, defaultVal int) int {
 	return val
 }
 
+// Name returns the processor name
+func (p *AudioProcessor) Name() string {
+	return "audio"
+}
+
 // CanProcess returns true if this processor can process the given content type
 func (p *AudioProcessor) CanProcess(contentType, ext string) bool {
 	// Check content type
@@ -0,0 +1,930 @@
+package processors
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Tag formats read by ReadAudioTags
+const (
+	TagFormatID3v1  = "id3v1"
+	TagFormatID3v2  = "id3v2"
+	TagFormatVorbis = "vorbis" // Vorbis comments in Ogg Vorbis, Opus or FLAC
+	TagFormatMP4    = "mp4"
+)
+
+// frontCoverType is the picture type of a front cover in ID3v2 and FLAC
+const frontCoverType = 3
+
+// AudioTags are the tags and cover art embedded in an audio file, read
+// without ffmpeg
+type AudioTags struct {
+	Formats     []string `json:"formats"` // Tag formats found, e.g. id3v2.4 and id3v1
+	Title       string   `json:"title,omitempty"`
+	Artist      string   `json:"artist,omitempty"`
+	Album       string   `json:"album,omitempty"`
+	AlbumArtist string   `json:"albumArtist,omitempty"`
+	Track       int      `json:"track,omitempty"`
+	TrackTotal  int      `json:"trackTotal,omitempty"`
+	Year        int      `json:"year,omitempty"`
+	Genre       string   `json:"genre,omitempty"`
+
+	// Stream properties some containers record next to their tags
+	Duration   float64 `json:"duration,omitempty"` // In seconds
+	SampleRate int     `json:"sampleRate,omitempty"`
+	Channels   int     `json:"channels,omitempty"`
+
+	Cover     []byte `json:"-"`
+	CoverType string `json:"coverType,omitempty"` // MIME type of the cover art
+
+	coverIsFront bool
+}
+
+// maxTagSectionSize bounds each section read to find tags: an ID3v2 tag,
+// FLAC metadata blocks, Ogg header pages or an MP4 movie box
+const maxTagSectionSize = 64 << 20
+
+// oggTailSize covers the last page of an Ogg stream, whose granule position
+// gives the duration; a page is at most 65307 bytes
+const oggTailSize = 65536
+
+// ReadAudioTags reads the ID3v1/v2 tags of MP3 files, the Vorbis comments and
+// pictures of FLAC and Ogg (Vorbis or Opus) files, and the iTunes metadata of
+// MP4 audio. It returns an error if the data holds none of them.
+func ReadAudioTags(data []byte) (*AudioTags, error) {
+	return ReadAudioTagsAt(bytes.NewReader(data), int64(len(data)))
+}
+
+// ReadAudioTagsAt reads the tags of an audio file of the given size, such as
+// a spooled temporary file, reading only the sections that hold them
+func ReadAudioTagsAt(r io.ReaderAt, size int64) (*AudioTags, error) {
+	file := tagReader{r: r, size: size}
+	tags := &AudioTags{}
+	offset := int64(0)
+
+	// An ID3v2 tag may precede any format, though it is mostly found in MP3s
+	if header := file.section(0, 10); len(header) == 10 && string(header[:3]) == "ID3" {
+		total := int64(10 + syncsafe(header[6:10]))
+		if header[5]&0x10 != 0 {
+			total += 10 // Footer
+		}
+		if total > maxTagSectionSize {
+			return nil, fmt.Errorf("ID3v2 tag is too large")
+		}
+		n, err := tags.readID3v2(file.section(0, total))
+		if err != nil {
+			return nil, err
+		}
+		offset = int64(n)
+	}
+
+	var err error
+	magic := file.section(offset, 8)
+	switch {
+	case len(magic) >= 4 && string(magic[:4]) == "fLaC":
+		var blocks []byte
+		if blocks, err = file.flacBlocks(offset + 4); err == nil {
+			err = tags.readFLAC(blocks)
+		}
+	case len(magic) >= 4 && string(magic[:4]) == "OggS":
+		// The comment header may hold cover art, so read more of the
+		// stream until its header packets are complete
+		tail := file.section(size-oggTailSize, oggTailSize)
+		for n := int64(1 << 20); ; n *= 4 {
+			head := file.section(offset, n)
+			err = tags.readOgg(head, tail)
+			if err == nil || int64(len(head)) < n || n >= maxTagSectionSize {
+				break
+			}
+		}
+	case len(magic) >= 8 && string(magic[4:8]) == "ftyp":
+		var moov []byte
+		if moov, err = file.mp4Box(offset, "moov"); err == nil && moov != nil {
+			err = tags.readMP4(moov)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// ID3v1 sits in the last 128 bytes and only fills in what newer tags lack
+	if tag := file.section(size-128, 128); len(tag) == 128 && string(tag[:3]) == "TAG" {
+		tags.readID3v1(tag)
+	}
+
+	if len(tags.Formats) == 0 {
+		return nil, fmt.Errorf("no audio tags found")
+	}
+	return tags, nil
+}
+
+// readAudioTagsFile reads the tags of an audio file on disk
+func readAudioTagsFile(path string) (*AudioTags, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return ReadAudioTagsAt(file, stat.Size())
+}
+
+// tagReader reads the sections of an audio file that hold its tags
+type tagReader struct {
+	r    io.ReaderAt
+	size int64
+}
+
+// section reads up to n bytes at offset; it returns fewer at the end of the
+// file or on a read error, which the tag parsers report as truncation
+func (f tagReader) section(offset, n int64) []byte {
+	if offset < 0 {
+		n += offset
+		offset = 0
+	}
+	if offset+n > f.size {
+		n = f.size - offset
+	}
+	if n <= 0 {
+		return nil
+	}
+	buf := make([]byte, n)
+	read, _ := f.r.ReadAt(buf, offset)
+	return buf[:read]
+}
+
+// flacBlocks reads the FLAC metadata blocks starting at offset, up to and
+// including the one flagged as the last
+func (f tagReader) flacBlocks(offset int64) ([]byte, error) {
+	end := offset
+	for {
+		header := f.section(end, 4)
+		if len(header) < 4 {
+			break
+		}
+		end += 4 + (int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3]))
+		if end-offset > maxTagSectionSize {
+			return nil, fmt.Errorf("FLAC metadata is too large")
+		}
+		if header[0]&0x80 != 0 {
+			break
+		}
+	}
+	return f.section(offset, end-offset), nil
+}
+
+// mp4Box returns the contents of the first top-level box named name at or
+// after offset, or nil. Only box headers are read on the way, so a movie box
+// after a large media data box is found without reading the media.
+func (f tagReader) mp4Box(offset int64, name string) ([]byte, error) {
+	for offset+8 <= f.size {
+		header := f.section(offset, 16)
+		if len(header) < 8 {
+			return nil, nil
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		headerSize := int64(8)
+		switch size {
+		case 0: // Extends to the end
+			size = f.size - offset
+		case 1: // 64-bit size
+			if len(header) < 16 {
+				return nil, nil
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if size < headerSize {
+			return nil, nil
+		}
+		if string(header[4:8]) == name {
+			if size-headerSize > maxTagSectionSize {
+				return nil, fmt.Errorf("MP4 %s box is too large", name)
+			}
+			return f.section(offset+headerSize, size-headerSize), nil
+		}
+		offset += size
+	}
+	return nil, nil
+}
+
+// addMetadata flattens the tags into metadata, without overwriting values
+// already read by ffprobe
+func (t *AudioTags) addMetadata(metadata map[string]string) {
+	set := func(key, value string) {
+		if _, exists := metadata[key]; !exists && value != "" {
+			metadata[key] = value
+		}
+	}
+	set("tagFormats", strings.Join(t.Formats, ","))
+	set("title", t.Title)
+	set("artist", t.Artist)
+	set("album", t.Album)
+	set("albumArtist", t.AlbumArtist)
+	if t.Track > 0 {
+		set("track", strconv.Itoa(t.Track))
+	}
+	if t.TrackTotal > 0 {
+		set("trackTotal", strconv.Itoa(t.TrackTotal))
+	}
+	if t.Year > 0 {
+		set("year", strconv.Itoa(t.Year))
+	}
+	set("genre", t.Genre)
+	if t.Duration > 0 {
+		set("duration", strconv.FormatFloat(t.Duration, 'f', 3, 64))
+	}
+	if t.SampleRate > 0 {
+		set("sample_rate", strconv.Itoa(t.SampleRate))
+	}
+	if t.Channels > 0 {
+		set("channels", strconv.Itoa(t.Channels))
+	}
+	if len(t.Cover) > 0 {
+		set("coverArt", t.CoverType)
+	}
+}
+
+// setText sets a field from a tag value unless an earlier tag already set it
+func setText(field *string, value string) {
+	value = strings.TrimSpace(strings.TrimRight(value, "\x00"))
+	if *field == "" && value != "" {
+		*field = value
+	}
+}
+
+// setTrack parses a track number written as "3" or "3/12"
+func (t *AudioTags) setTrack(value string) {
+	number, total, _ := strings.Cut(strings.TrimSpace(value), "/")
+	if n, err := strconv.Atoi(strings.TrimSpace(number)); err == nil && t.Track == 0 {
+		t.Track = n
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(total)); err == nil && t.TrackTotal == 0 {
+		t.TrackTotal = n
+	}
+}
+
+// setYear takes the year from a date such as "1999" or "1999-04-01"
+func (t *AudioTags) setYear(value string) {
+	value = strings.TrimSpace(value)
+	if len(value) >= 4 && t.Year == 0 {
+		if year, err := strconv.Atoi(value[:4]); err == nil {
+			t.Year = year
+		}
+	}
+}
+
+// setCover keeps the first picture, replaced by a later one only if that is
+// the front cover and the first isn't
+func (t *AudioTags) setCover(data []byte, mimeType string, front bool) {
+	if len(data) == 0 || (len(t.Cover) > 0 && (t.coverIsFront || !front)) {
+		return
+	}
+	if mimeType == "" || !strings.Contains(mimeType, "/") {
+		mimeType = detectImageType(data)
+	}
+	t.Cover = data
+	t.CoverType = mimeType
+	t.coverIsFront = front
+}
+
+// detectImageType returns the MIME type of JPEG and PNG data
+func detectImageType(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return "image/jpeg"
+	case bytes.HasPrefix(data, []byte("\x89PNG")):
+		return "image/png"
+	}
+	return "application/octet-stream"
+}
+
+// readID3v2 reads an ID3v2.2, v2.3 or v2.4 tag and returns its size,
+// including the header and any footer
+func (t *AudioTags) readID3v2(data []byte) (int, error) {
+	version := data[3]
+	flags := data[5]
+	size := syncsafe(data[6:10])
+	total := 10 + size
+	if flags&0x10 != 0 {
+		total += 10 // Footer
+	}
+	if version < 2 || version > 4 || 10+size > len(data) {
+		return 0, fmt.Errorf("invalid ID3v2 tag")
+	}
+	t.Formats = append(t.Formats, fmt.Sprintf("%s.%d", TagFormatID3v2, version))
+
+	tag := data[10 : 10+size]
+	if version < 4 && flags&0x80 != 0 {
+		tag = removeUnsync(tag)
+	}
+	if flags&0x40 != 0 && version > 2 && len(tag) >= 4 {
+		// Skip the extended header, whose size includes itself in v2.4 only
+		extended := int(binary.BigEndian.Uint32(tag[:4]))
+		if version == 4 {
+			extended = syncsafe(tag[:4])
+		} else {
+			extended += 4
+		}
+		if extended > len(tag) {
+			return total, nil
+		}
+		tag = tag[extended:]
+	}
+
+	idSize, headerSize := 4, 10
+	if version == 2 {
+		idSize, headerSize = 3, 6
+	}
+	for len(tag) >= headerSize && tag[0] != 0 {
+		id := string(tag[:idSize])
+		var frameSize int
+		var frameFlags uint16
+		switch version {
+		case 2:
+			frameSize = int(tag[3])<<16 | int(tag[4])<<8 | int(tag[5])
+		case 3:
+			frameSize = int(binary.BigEndian.Uint32(tag[4:8]))
+			frameFlags = binary.BigEndian.Uint16(tag[8:10])
+		case 4:
+			frameSize = syncsafe(tag[4:8])
+			frameFlags = binary.BigEndian.Uint16(tag[8:10])
+		}
+		if frameSize <= 0 || headerSize+frameSize > len(tag) {
+			break
+		}
+		frame := tag[headerSize : headerSize+frameSize]
+		tag = tag[headerSize+frameSize:]
+
+		// Compressed and encrypted frames are skipped
+		if version == 3 && frameFlags&0x00C0 != 0 || version == 4 && frameFlags&0x000C != 0 {
+			continue
+		}
+		if version == 4 {
+			if frameFlags&0x0001 != 0 && len(frame) >= 4 {
+				frame = frame[4:] // Data length indicator
+			}
+			if frameFlags&0x0002 != 0 {
+				frame = removeUnsync(frame)
+			}
+		}
+		t.readID3Frame(id, frame)
+	}
+
+	return total, nil
+}
+
+// readID3Frame reads one ID3v2 frame; v2.2 frames have three-letter IDs
+func (t *AudioTags) readID3Frame(id string, frame []byte) {
+	switch id {
+	case "TIT2", "TT2":
+		setText(&t.Title, id3Text(frame))
+	case "TPE1", "TP1":
+		setText(&t.Artist, id3Text(frame))
+	case "TALB", "TAL":
+		setText(&t.Album, id3Text(frame))
+	case "TPE2", "TP2":
+		setText(&t.AlbumArtist, id3Text(frame))
+	case "TRCK", "TRK":
+		t.setTrack(id3Text(frame))
+	case "TYER", "TYE", "TDRC", "TDOR":
+		t.setYear(id3Text(frame))
+	case "TCON", "TCO":
+		setText(&t.Genre, id3Genre(id3Text(frame)))
+	case "APIC":
+		// Encoding, MIME type, picture type, description, data
+		if len(frame) < 4 {
+			return
+		}
+		mimeEnd := bytes.IndexByte(frame[1:], 0)
+		if mimeEnd < 0 || 1+mimeEnd+2 > len(frame) {
+			return
+		}
+		mimeType := string(frame[1 : 1+mimeEnd])
+		pictureType := frame[1+mimeEnd+1]
+		rest := frame[1+mimeEnd+2:]
+		if end := id3TextEnd(frame[0], rest); end >= 0 {
+			t.setCover(rest[end:], strings.ToLower(mimeType), pictureType == frontCoverType)
+		}
+	case "PIC":
+		// Encoding, three-letter format, picture type, description, data
+		if len(frame) < 6 {
+			return
+		}
+		mimeType := "image/" + strings.ToLower(string(frame[1:4]))
+		if mimeType == "image/jpg" {
+			mimeType = "image/jpeg"
+		}
+		rest := frame[5:]
+		if end := id3TextEnd(frame[0], rest); end >= 0 {
+			t.setCover(rest[end:], mimeType, frame[4] == frontCoverType)
+		}
+	}
+}
+
+// id3Text decodes a text frame: an encoding byte followed by the text. Frames
+// with several values separate them with NULs; the first one is kept.
+func id3Text(frame []byte) string {
+	if len(frame) < 2 {
+		return ""
+	}
+	text := decodeID3String(frame[0], frame[1:])
+	if i := strings.IndexByte(text, 0); i >= 0 {
+		text = text[:i]
+	}
+	return text
+}
+
+// decodeID3String decodes text in an ID3v2 encoding: 0 ISO-8859-1, 1 UTF-16
+// with a byte order mark, 2 UTF-16BE, 3 UTF-8
+func decodeID3String(encoding byte, data []byte) string {
+	switch encoding {
+	case 1, 2:
+		bigEndian := encoding == 2
+		if len(data) >= 2 {
+			if data[0] == 0xFF && data[1] == 0xFE {
+				bigEndian, data = false, data[2:]
+			} else if data[0] == 0xFE && data[1] == 0xFF {
+				bigEndian, data = true, data[2:]
+			}
+		}
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			if bigEndian {
+				units[i] = binary.BigEndian.Uint16(data[2*i:])
+			} else {
+				units[i] = binary.LittleEndian.Uint16(data[2*i:])
+			}
+		}
+		return string(utf16.Decode(units))
+	case 3:
+		return string(data)
+	default:
+		return latin1(data)
+	}
+}
+
+// id3TextEnd returns the offset just past the NUL terminating a string in an
+// ID3v2 encoding, or -1 if it isn't terminated
+func id3TextEnd(encoding byte, data []byte) int {
+	if encoding == 1 || encoding == 2 {
+		for i := 0; i+1 < len(data); i += 2 {
+			if data[i] == 0 && data[i+1] == 0 {
+				return i + 2
+			}
+		}
+		return -1
+	}
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1
+	}
+	return -1
+}
+
+// id3Genre resolves genres written as ID3v1 numbers, such as "(17)", "17" or
+// "(17)Rock"
+func id3Genre(value string) string {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "(") {
+		if end := strings.IndexByte(value, ')'); end > 0 {
+			if refined := strings.TrimSpace(value[end+1:]); refined != "" {
+				return refined
+			}
+			value = value[1:end]
+		}
+	}
+	if n, err := strconv.Atoi(value); err == nil {
+		if n >= 0 && n < len(id3v1Genres) {
+			return id3v1Genres[n]
+		}
+		return ""
+	}
+	return value
+}
+
+// readID3v1 reads the fixed 128-byte ID3v1 tag at the end of a file
+func (t *AudioTags) readID3v1(tag []byte) {
+	t.Formats = append(t.Formats, TagFormatID3v1)
+	text := func(b []byte) string {
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		return latin1(b)
+	}
+	setText(&t.Title, text(tag[3:33]))
+	setText(&t.Artist, text(tag[33:63]))
+	setText(&t.Album, text(tag[63:93]))
+	t.setYear(text(tag[93:97]))
+
+	// ID3v1.1 keeps the track number in the last byte of the comment
+	if tag[125] == 0 && tag[126] != 0 && t.Track == 0 {
+		t.Track = int(tag[126])
+	}
+	if int(tag[127]) < len(id3v1Genres) {
+		setText(&t.Genre, id3v1Genres[tag[127]])
+	}
+}
+
+// syncsafe decodes a 28-bit integer stored in the low seven bits of four bytes
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7F)<<21 | int(b[1]&0x7F)<<14 | int(b[2]&0x7F)<<7 | int(b[3]&0x7F)
+}
+
+// removeUnsync undoes ID3v2 unsynchronisation, which inserts a zero byte after
+// every 0xFF so tags can't be mistaken for MPEG frame headers
+func removeUnsync(data []byte) []byte {
+	return bytes.ReplaceAll(data, []byte{0xFF, 0x00}, []byte{0xFF})
+}
+
+// latin1 decodes ISO-8859-1 text
+func latin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// readFLAC reads the STREAMINFO, VORBIS_COMMENT and PICTURE metadata blocks
+// that follow the "fLaC" marker
+func (t *AudioTags) readFLAC(data []byte) error {
+	found := false
+	for len(data) >= 4 {
+		last := data[0]&0x80 != 0
+		blockType := data[0] & 0x7F
+		size := int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+		if 4+size > len(data) {
+			return fmt.Errorf("truncated FLAC metadata block")
+		}
+		block := data[4 : 4+size]
+		data = data[4+size:]
+
+		switch blockType {
+		case 0: // STREAMINFO
+			if len(block) >= 18 {
+				// 20 bits of sample rate, 3 of channels - 1, 5 of bits per
+				// sample - 1 and 36 of total samples
+				t.SampleRate = int(block[10])<<12 | int(block[11])<<4 | int(block[12])>>4
+				t.Channels = int(block[12]>>1&0x07) + 1
+				samples := uint64(block[13]&0x0F)<<32 | uint64(binary.BigEndian.Uint32(block[14:18]))
+				if t.SampleRate > 0 {
+					t.Duration = float64(samples) / float64(t.SampleRate)
+				}
+			}
+		case 4: // VORBIS_COMMENT
+			if t.readVorbisComments(block) {
+				found = true
+			}
+		case 6: // PICTURE
+			if t.readFLACPicture(block) {
+				found = true
+			}
+		}
+		if last {
+			break
+		}
+	}
+	if found {
+		t.Formats = append(t.Formats, TagFormatVorbis)
+	}
+	return nil
+}
+
+// readFLACPicture reads a FLAC picture block, which Ogg files also embed as
+// base64 in a METADATA_BLOCK_PICTURE comment
+func (t *AudioTags) readFLACPicture(block []byte) bool {
+	field := func() ([]byte, bool) {
+		if len(block) < 4 {
+			return nil, false
+		}
+		n := int(binary.BigEndian.Uint32(block[:4]))
+		if n < 0 || 4+n > len(block) {
+			return nil, false
+		}
+		value := block[4 : 4+n]
+		block = block[4+n:]
+		return value, true
+	}
+
+	if len(block) < 4 {
+		return false
+	}
+	pictureType := binary.BigEndian.Uint32(block[:4])
+	block = block[4:]
+	mimeType, ok := field()
+	if !ok {
+		return false
+	}
+	if _, ok := field(); !ok { // Description
+		return false
+	}
+	if len(block) < 16 {
+		return false
+	}
+	block = block[16:] // Width, height, depth and palette size
+	data, ok := field()
+	if !ok {
+		return false
+	}
+	t.setCover(data, strings.ToLower(string(mimeType)), pictureType == frontCoverType)
+	return true
+}
+
+// readVorbisComments reads a Vorbis comment block: a vendor string and a list
+// of KEY=value comments, all lengths little-endian. It reports whether the
+// block was valid.
+func (t *AudioTags) readVorbisComments(block []byte) bool {
+	next := func() (string, bool) {
+		if len(block) < 4 {
+			return "", false
+		}
+		n := int(binary.LittleEndian.Uint32(block[:4]))
+		if n < 0 || 4+n > len(block) {
+			return "", false
+		}
+		value := string(block[4 : 4+n])
+		block = block[4+n:]
+		return value, true
+	}
+
+	if _, ok := next(); !ok { // Vendor
+		return false
+	}
+	if len(block) < 4 {
+		return false
+	}
+	count := int(binary.LittleEndian.Uint32(block[:4]))
+	block = block[4:]
+
+	for i := 0; i < count; i++ {
+		comment, ok := next()
+		if !ok {
+			break
+		}
+		key, value, ok := strings.Cut(comment, "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToUpper(key) {
+		case "TITLE":
+			setText(&t.Title, value)
+		case "ARTIST":
+			setText(&t.Artist, value)
+		case "ALBUM":
+			setText(&t.Album, value)
+		case "ALBUMARTIST", "ALBUM ARTIST":
+			setText(&t.AlbumArtist, value)
+		case "TRACKNUMBER":
+			t.setTrack(value)
+		case "TRACKTOTAL", "TOTALTRACKS":
+			if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && t.TrackTotal == 0 {
+				t.TrackTotal = n
+			}
+		case "DATE", "YEAR":
+			t.setYear(value)
+		case "GENRE":
+			setText(&t.Genre, value)
+		case "METADATA_BLOCK_PICTURE":
+			if picture, err := base64.StdEncoding.DecodeString(value); err == nil {
+				t.readFLACPicture(picture)
+			}
+		case "COVERART":
+			// Older files store the image alone
+			if picture, err := base64.StdEncoding.DecodeString(value); err == nil {
+				t.setCover(picture, "", false)
+			}
+		}
+	}
+	return true
+}
+
+// maxOggPages bounds the pages read looking for the comment header, which may
+// span many pages when it carries cover art
+const maxOggPages = 4096
+
+// readOgg reads the identification and comment headers of the first logical
+// stream of an Ogg Vorbis or Opus file from the start of its data, and its
+// duration from the last page found in the tail of the file
+func (t *AudioTags) readOgg(data, tail []byte) error {
+	var serial uint32
+	var packets [][]byte
+	var packet []byte
+	offset := 0
+
+	for pages := 0; len(packets) < 2 && pages < maxOggPages; pages++ {
+		if offset+27 > len(data) || string(data[offset:offset+4]) != "OggS" {
+			break
+		}
+		page := data[offset:]
+		pageSerial := binary.LittleEndian.Uint32(page[14:18])
+		segments := int(page[26])
+		if 27+segments > len(page) {
+			break
+		}
+		table := page[27 : 27+segments]
+		body := 27 + segments
+		size := 0
+		for _, lacing := range table {
+			size += int(lacing)
+		}
+		if body+size > len(page) {
+			break
+		}
+		offset += body + size
+
+		if pages == 0 {
+			serial = pageSerial
+		}
+		if pageSerial != serial {
+			continue
+		}
+
+		// A lacing value below 255 ends a packet
+		at := body
+		for _, lacing := range table {
+			packet = append(packet, page[at:at+int(lacing)]...)
+			at += int(lacing)
+			if lacing < 255 {
+				packets = append(packets, packet)
+				packet = nil
+			}
+		}
+	}
+	if len(packets) < 2 {
+		return fmt.Errorf("truncated Ogg headers")
+	}
+
+	ident, comments := packets[0], packets[1]
+	preSkip := 0
+	switch {
+	case bytes.HasPrefix(ident, []byte("\x01vorbis")) && len(ident) >= 16:
+		t.Channels = int(ident[11])
+		t.SampleRate = int(binary.LittleEndian.Uint32(ident[12:16]))
+		if bytes.HasPrefix(comments, []byte("\x03vorbis")) && t.readVorbisComments(comments[7:]) {
+			t.Formats = append(t.Formats, TagFormatVorbis)
+		}
+	case bytes.HasPrefix(ident, []byte("OpusHead")) && len(ident) >= 12:
+		// Opus always runs at 48 kHz; the header's rate is the input's
+		t.Channels = int(ident[9])
+		t.SampleRate = 48000
+		preSkip = int(binary.LittleEndian.Uint16(ident[10:12]))
+		if bytes.HasPrefix(comments, []byte("OpusTags")) && t.readVorbisComments(comments[8:]) {
+			t.Formats = append(t.Formats, TagFormatVorbis)
+		}
+	default:
+		return nil
+	}
+
+	// The granule position of the last page counts the samples of the stream
+	if last := bytes.LastIndex(tail, []byte("OggS")); last >= 0 && last+14 <= len(tail) && t.SampleRate > 0 {
+		granule := int64(binary.LittleEndian.Uint64(tail[last+6 : last+14]))
+		if samples := granule - int64(preSkip); samples > 0 {
+			t.Duration = float64(samples) / float64(t.SampleRate)
+		}
+	}
+	return nil
+}
+
+// readMP4 reads the iTunes metadata list (moov/udta/meta/ilst) of the movie
+// box of an MP4 file, and its duration from the movie header
+func (t *AudioTags) readMP4(moov []byte) error {
+	if mvhd := mp4Child(moov, "mvhd"); len(mvhd) >= 20 {
+		var timescale, duration uint64
+		if mvhd[0] == 1 && len(mvhd) >= 32 {
+			timescale = uint64(binary.BigEndian.Uint32(mvhd[20:24]))
+			duration = binary.BigEndian.Uint64(mvhd[24:32])
+		} else {
+			timescale = uint64(binary.BigEndian.Uint32(mvhd[12:16]))
+			duration = uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+		}
+		if timescale > 0 {
+			t.Duration = float64(duration) / float64(timescale)
+		}
+	}
+
+	meta := mp4Child(mp4Child(moov, "udta"), "meta")
+	if len(meta) < 4 {
+		return nil
+	}
+	ilst := mp4Child(meta[4:], "ilst") // meta is a full box: skip version and flags
+	if ilst == nil {
+		return nil
+	}
+	t.Formats = append(t.Formats, TagFormatMP4)
+
+	forEachMP4Box(ilst, func(name string, item []byte) {
+		// Each item holds a data box: type, locale, then the value
+		value := mp4Child(item, "data")
+		if len(value) < 8 {
+			return
+		}
+		dataType := binary.BigEndian.Uint32(value[:4]) & 0xFFFFFF
+		value = value[8:]
+
+		switch name {
+		case "\xa9nam":
+			setText(&t.Title, string(value))
+		case "\xa9ART":
+			setText(&t.Artist, string(value))
+		case "\xa9alb":
+			setText(&t.Album, string(value))
+		case "aART":
+			setText(&t.AlbumArtist, string(value))
+		case "\xa9day":
+			t.setYear(string(value))
+		case "\xa9gen":
+			setText(&t.Genre, string(value))
+		case "gnre":
+			// ID3v1 genre number plus one
+			if len(value) >= 2 {
+				if n := int(binary.BigEndian.Uint16(value)) - 1; n >= 0 && n < len(id3v1Genres) {
+					setText(&t.Genre, id3v1Genres[n])
+				}
+			}
+		case "trkn":
+			if len(value) >= 6 && t.Track == 0 {
+				t.Track = int(binary.BigEndian.Uint16(value[2:4]))
+				t.TrackTotal = int(binary.BigEndian.Uint16(value[4:6]))
+			}
+		case "covr":
+			mimeType := ""
+			switch dataType {
+			case 13:
+				mimeType = "image/jpeg"
+			case 14:
+				mimeType = "image/png"
+			}
+			t.setCover(value, mimeType, true)
+		}
+	})
+	return nil
+}
+
+// forEachMP4Box calls fn with the name and contents of each box in data
+func forEachMP4Box(data []byte, fn func(name string, contents []byte)) {
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[:4]))
+		name := string(data[4:8])
+		header := uint64(8)
+		switch size {
+		case 0: // Extends to the end
+			size = uint64(len(data))
+		case 1: // 64-bit size
+			if len(data) < 16 {
+				return
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return
+		}
+		fn(name, data[header:size])
+		data = data[size:]
+	}
+}
+
+// mp4Child returns the contents of the first box named name in data, or nil
+func mp4Child(data []byte, name string) []byte {
+	var found []byte
+	forEachMP4Box(data, func(boxName string, contents []byte) {
+		if found == nil && boxName == name {
+			found = contents
+		}
+	})
+	return found
+}
+
+// id3v1Genres are the genres numbered by ID3v1, including the Winamp extensions
+var id3v1Genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge", "Hip-Hop",
+	"Jazz", "Metal", "New Age", "Oldies", "Other", "Pop", "R&B", "Rap",
+	"Reggae", "Rock", "Techno", "Industrial", "Alternative", "Ska", "Death Metal", "Pranks",
+	"Soundtrack", "Euro-Techno", "Ambient", "Trip-Hop", "Vocal", "Jazz+Funk", "Fusion", "Trance",
+	"Classical", "Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"Alternative Rock", "Bass", "Soul", "Punk", "Space", "Meditative", "Instrumental Pop", "Instrumental Rock",
+	"Ethnic", "Gothic", "Darkwave", "Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream",
+	"Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap", "Pop/Funk", "Jungle",
+	"Native American", "Cabaret", "New Wave", "Psychedelic", "Rave", "Showtunes", "Trailer", "Lo-Fi",
+	"Tribal", "Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll", "Hard Rock",
+	"Folk", "Folk-Rock", "National Folk", "Swing", "Fast Fusion", "Bebop", "Latin", "Revival",
+	"Celtic", "Bluegrass", "Avantgarde", "Gothic Rock", "Progressive Rock", "Psychedelic Rock", "Symphonic Rock", "Slow Rock",
+	"Big Band", "Chorus", "Easy Listening", "Acoustic", "Humour", "Speech", "Chanson", "Opera",
+	"Chamber Music", "Sonata", "Symphony", "Booty Bass", "Primus", "Porn Groove", "Satire", "Slow Jam",
+	"Club", "Tango", "Samba", "Folklore", "Ballad", "Power Ballad", "Rhythmic Soul", "Freestyle",
+	"Duet", "Punk Rock", "Drum Solo", "A Cappella", "Euro-House", "Dance Hall", "Goa", "Drum & Bass",
+	"Club-House", "Hardcore Techno", "Terror", "Indie", "BritPop", "Negerpunk", "Polsk Punk", "Beat",
+	"Christian Gangsta Rap", "Heavy Metal", "Black Metal", "Crossover", "Contemporary Christian", "Christian Rock", "Merengue", "Salsa",
+	"Thrash Metal", "Anime", "Jpop", "Synthpop",
+}
@@ -0,0 +1,461 @@
+package processors
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+// fakeJPEG and fakePNG are the start of cover art images, enough for
+// detectImageType
+var (
+	fakeJPEG = []byte{0xFF, 0xD8, 0xFF, 0xE0, 'c', 'o', 'v', 'e', 'r'}
+	fakePNG  = []byte("\x89PNG\r\n\x1a\nback")
+)
+
+// syncsafeBytes encodes n in the low seven bits of four bytes
+func syncsafeBytes(n int) []byte {
+	return []byte{byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F), byte(n >> 7 & 0x7F), byte(n & 0x7F)}
+}
+
+// id3v2Tag builds an ID3v2 tag of the given version from frames
+func id3v2Tag(version byte, frames ...[]byte) []byte {
+	body := bytes.Join(frames, nil)
+	tag := append([]byte{'I', 'D', '3', version, 0, 0}, syncsafeBytes(len(body))...)
+	return append(tag, body...)
+}
+
+// id3Frame builds a v2.3 or v2.4 frame
+func id3Frame(version byte, id string, data []byte) []byte {
+	frame := []byte(id)
+	if version == 4 {
+		frame = append(frame, syncsafeBytes(len(data))...)
+	} else {
+		frame = binary.BigEndian.AppendUint32(frame, uint32(len(data)))
+	}
+	frame = append(frame, 0, 0) // Flags
+	return append(frame, data...)
+}
+
+// id3v22Frame builds a v2.2 frame, with a three-letter ID and size
+func id3v22Frame(id string, data []byte) []byte {
+	frame := append([]byte(id), byte(len(data)>>16), byte(len(data)>>8), byte(len(data)))
+	return append(frame, data...)
+}
+
+// utf16Text encodes a text frame as UTF-16 with a little-endian byte order mark
+func utf16Text(s string) []byte {
+	data := []byte{1, 0xFF, 0xFE}
+	for _, unit := range utf16.Encode([]rune(s)) {
+		data = binary.LittleEndian.AppendUint16(data, unit)
+	}
+	return data
+}
+
+// id3v1Tag builds a 128-byte ID3v1.1 tag
+func id3v1Tag(title, artist, album, year string, track, genre byte) []byte {
+	tag := make([]byte, 128)
+	copy(tag, "TAG")
+	copy(tag[3:33], title)
+	copy(tag[33:63], artist)
+	copy(tag[63:93], album)
+	copy(tag[93:97], year)
+	tag[126] = track
+	tag[127] = genre
+	return tag
+}
+
+// vorbisComments builds a Vorbis comment block
+func vorbisComments(comments ...string) []byte {
+	block := binary.LittleEndian.AppendUint32(nil, 6)
+	block = append(block, "vendor"...)
+	block = binary.LittleEndian.AppendUint32(block, uint32(len(comments)))
+	for _, comment := range comments {
+		block = binary.LittleEndian.AppendUint32(block, uint32(len(comment)))
+		block = append(block, comment...)
+	}
+	return block
+}
+
+// flacPicture builds a FLAC picture block
+func flacPicture(pictureType uint32, mimeType string, data []byte) []byte {
+	block := binary.BigEndian.AppendUint32(nil, pictureType)
+	block = binary.BigEndian.AppendUint32(block, uint32(len(mimeType)))
+	block = append(block, mimeType...)
+	block = binary.BigEndian.AppendUint32(block, 0) // Description
+	block = append(block, make([]byte, 16)...)
+	block = binary.BigEndian.AppendUint32(block, uint32(len(data)))
+	return append(block, data...)
+}
+
+// flacBlock builds a FLAC metadata block header and body
+func flacBlock(blockType byte, last bool, body []byte) []byte {
+	if last {
+		blockType |= 0x80
+	}
+	return append([]byte{blockType, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}, body...)
+}
+
+// flacStreamInfo builds a STREAMINFO block body
+func flacStreamInfo(sampleRate, channels int, samples uint64) []byte {
+	info := make([]byte, 34)
+	info[10] = byte(sampleRate >> 12)
+	info[11] = byte(sampleRate >> 4)
+	info[12] = byte(sampleRate<<4) | byte(channels-1)<<1
+	info[13] = byte(samples >> 32 & 0x0F)
+	binary.BigEndian.PutUint32(info[14:18], uint32(samples))
+	return info
+}
+
+// oggPage builds an Ogg page holding whole packets
+func oggPage(serial uint32, granule int64, packets ...[]byte) []byte {
+	var table, body []byte
+	for _, packet := range packets {
+		n := len(packet)
+		for ; n >= 255; n -= 255 {
+			table = append(table, 255)
+		}
+		table = append(table, byte(n))
+		body = append(body, packet...)
+	}
+	page := []byte("OggS\x00\x00")
+	page = binary.LittleEndian.AppendUint64(page, uint64(granule))
+	page = binary.LittleEndian.AppendUint32(page, serial)
+	page = append(page, make([]byte, 8)...) // Sequence number and checksum
+	page = append(page, byte(len(table)))
+	page = append(page, table...)
+	return append(page, body...)
+}
+
+// mp4Box builds an MP4 box
+func mp4Box(name string, contents ...[]byte) []byte {
+	body := bytes.Join(contents, nil)
+	box := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	box = append(box, name...)
+	return append(box, body...)
+}
+
+// mp4Item builds an iTunes metadata item with a data box of the given type
+func mp4Item(name string, dataType uint32, value []byte) []byte {
+	data := binary.BigEndian.AppendUint32(nil, dataType)
+	data = append(data, 0, 0, 0, 0) // Locale
+	return mp4Box(name, mp4Box("data", data, value))
+}
+
+// mp3Fixture is an MP3 with an ID3v2.3 tag, two fake frames and an ID3v1.1 tag
+func mp3Fixture() []byte {
+	apic := append([]byte{0}, "image/jpeg\x00"...)
+	apic = append(apic, frontCoverType)
+	apic = append(apic, "front\x00"...)
+	apic = append(apic, fakeJPEG...)
+
+	tag := id3v2Tag(3,
+		id3Frame(3, "TIT2", []byte("\x00Caf\xe9")),
+		id3Frame(3, "TPE1", utf16Text("Artiste")),
+		id3Frame(3, "TRCK", []byte("\x003/12")),
+		id3Frame(3, "TYER", []byte("\x001999")),
+		id3Frame(3, "TCON", []byte("\x00(17)")),
+		id3Frame(3, "APIC", apic),
+	)
+	audio := bytes.Repeat([]byte{0xFF, 0xFB, 0x90, 0x00}, 64)
+	v1 := id3v1Tag("Ignored title", "Ignored artist", "Album from v1", "2001", 7, 8)
+	return append(append(tag, audio...), v1...)
+}
+
+// flacFixture is a FLAC file with stream info, comments and two pictures
+func flacFixture() []byte {
+	file := []byte("fLaC")
+	file = append(file, flacBlock(0, false, flacStreamInfo(44100, 2, 441000))...)
+	file = append(file, flacBlock(4, false, vorbisComments(
+		"TITLE=Song",
+		"artist=Band",
+		"ALBUM=Record",
+		"ALBUMARTIST=Various",
+		"TRACKNUMBER=4",
+		"TRACKTOTAL=10",
+		"DATE=2010-05-01",
+		"GENRE=Jazz",
+		"NOEQUALS",
+	))...)
+	file = append(file, flacBlock(6, false, flacPicture(4, "image/png", fakePNG))...)
+	file = append(file, flacBlock(6, true, flacPicture(frontCoverType, "image/jpeg", fakeJPEG))...)
+	return append(file, 0xFF, 0xF8, 0x00, 0x00)
+}
+
+// oggVorbisFixture is an Ogg Vorbis stream with a comment header spanning pages
+func oggVorbisFixture() []byte {
+	ident := append([]byte("\x01vorbis"), 0, 0, 0, 0, 2)
+	ident = binary.LittleEndian.AppendUint32(ident, 48000)
+	ident = append(ident, make([]byte, 14)...)
+
+	picture := base64.StdEncoding.EncodeToString(flacPicture(frontCoverType, "image/jpeg", fakeJPEG))
+	comments := append([]byte("\x03vorbis"), vorbisComments(
+		"TITLE=Ogg Song",
+		"ARTIST=Ogg Band",
+		"TRACKNUMBER=2/9",
+		"METADATA_BLOCK_PICTURE="+picture,
+		"PADDING="+string(bytes.Repeat([]byte{'x'}, 600)),
+	)...)
+
+	// Split the comment packet across two pages, as large headers are
+	split := 255 * 2
+	file := oggPage(1, 0, ident)
+	first := oggPage(1, 0, comments[:split])
+	// Drop the final zero lacing value so the packet continues on the next page
+	segments := int(first[26])
+	first[26]--
+	first = append(first[:27+segments-1:27+segments-1], first[27+segments:]...)
+	file = append(file, first...)
+	// A page of another stream in between is skipped
+	file = append(file, oggPage(2, 0, []byte("other"))...)
+	file = append(file, oggPage(1, 0, comments[split:])...)
+	file = append(file, oggPage(1, 96000, []byte("audio"))...)
+	return file
+}
+
+// opusFixture is an Ogg Opus stream
+func opusFixture() []byte {
+	ident := append([]byte("OpusHead"), 1, 1)
+	ident = binary.LittleEndian.AppendUint16(ident, 312) // Pre-skip
+	ident = binary.LittleEndian.AppendUint32(ident, 44100)
+	ident = append(ident, 0, 0, 0)
+
+	file := oggPage(7, 0, ident)
+	file = append(file, oggPage(7, 0, append([]byte("OpusTags"), vorbisComments("TITLE=Opus Song", "GENRE=Speech")...))...)
+	return append(file, oggPage(7, 48000*3+312, []byte("audio"))...)
+}
+
+// mp4Fixture is an M4A file whose movie box follows its media data
+func mp4Fixture() []byte {
+	mvhd := make([]byte, 20)
+	binary.BigEndian.PutUint32(mvhd[12:16], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:20], 12500)
+
+	trkn := []byte{0, 0, 0, 5, 0, 11, 0, 0}
+	ilst := mp4Box("ilst",
+		mp4Item("\xa9nam", 1, []byte("M4A Song")),
+		mp4Item("\xa9ART", 1, []byte("M4A Band")),
+		mp4Item("\xa9alb", 1, []byte("M4A Album")),
+		mp4Item("aART", 1, []byte("M4A Artists")),
+		mp4Item("\xa9day", 1, []byte("2015-01-01T00:00:00Z")),
+		mp4Item("gnre", 0, []byte{0, 19}),
+		mp4Item("trkn", 0, trkn),
+		mp4Item("covr", 14, fakePNG),
+	)
+	meta := mp4Box("meta", []byte{0, 0, 0, 0}, mp4Box("hdlr", make([]byte, 24)), ilst)
+	moov := mp4Box("moov", mp4Box("mvhd", mvhd), mp4Box("udta", meta))
+
+	file := mp4Box("ftyp", []byte("M4A \x00\x00\x00\x00"))
+	file = append(file, mp4Box("mdat", bytes.Repeat([]byte{0xAA}, 4096))...)
+	return append(file, moov...)
+}
+
+func TestReadAudioTags(t *testing.T) {
+	v24 := id3v2Tag(4,
+		id3Frame(4, "TIT2", []byte("\x03Ünïcode")),
+		id3Frame(4, "TDRC", []byte("\x032020-02-02")),
+		id3Frame(4, "TCON", []byte("\x03(13)Indie Pop")),
+		id3Frame(4, "TPE2", append([]byte{2, 0xFE, 0xFF}, 0, 'B', 0, 'E')),
+	)
+	pic := append([]byte{0}, "PNG"...)
+	pic = append(pic, frontCoverType, 0)
+	pic = append(pic, fakePNG...)
+	v22 := id3v2Tag(2,
+		id3v22Frame("TT2", []byte("\x00Old Tag")),
+		id3v22Frame("TCO", []byte("\x0032")),
+		id3v22Frame("PIC", pic),
+	)
+
+	tests := []struct {
+		name string
+		data []byte
+		want AudioTags
+	}{
+		{
+			name: "mp3 with id3v2.3 and id3v1.1",
+			data: mp3Fixture(),
+			want: AudioTags{
+				Formats:    []string{"id3v2.3", TagFormatID3v1},
+				Title:      "Café",
+				Artist:     "Artiste",
+				Album:      "Album from v1",
+				Track:      3,
+				TrackTotal: 12,
+				Year:       1999,
+				Genre:      "Rock",
+				Cover:      fakeJPEG,
+				CoverType:  "image/jpeg",
+			},
+		},
+		{
+			name: "id3v2.4 with utf-8 and utf-16be text",
+			data: append(v24, 0xFF, 0xFB),
+			want: AudioTags{
+				Formats:     []string{"id3v2.4"},
+				Title:       "Ünïcode",
+				AlbumArtist: "BE",
+				Year:        2020,
+				Genre:       "Indie Pop",
+			},
+		},
+		{
+			name: "id3v2.2",
+			data: append(v22, 0xFF, 0xFB),
+			want: AudioTags{
+				Formats:   []string{"id3v2.2"},
+				Title:     "Old Tag",
+				Genre:     "Classical",
+				Cover:     fakePNG,
+				CoverType: "image/png",
+			},
+		},
+		{
+			name: "flac",
+			data: flacFixture(),
+			want: AudioTags{
+				Formats:     []string{TagFormatVorbis},
+				Title:       "Song",
+				Artist:      "Band",
+				Album:       "Record",
+				AlbumArtist: "Various",
+				Track:       4,
+				TrackTotal:  10,
+				Year:        2010,
+				Genre:       "Jazz",
+				Duration:    10,
+				SampleRate:  44100,
+				Channels:    2,
+				Cover:       fakeJPEG,
+				CoverType:   "image/jpeg",
+			},
+		},
+		{
+			name: "ogg vorbis",
+			data: oggVorbisFixture(),
+			want: AudioTags{
+				Formats:    []string{TagFormatVorbis},
+				Title:      "Ogg Song",
+				Artist:     "Ogg Band",
+				Track:      2,
+				TrackTotal: 9,
+				Duration:   2,
+				SampleRate: 48000,
+				Channels:   2,
+				Cover:      fakeJPEG,
+				CoverType:  "image/jpeg",
+			},
+		},
+		{
+			name: "ogg opus",
+			data: opusFixture(),
+			want: AudioTags{
+				Formats:    []string{TagFormatVorbis},
+				Title:      "Opus Song",
+				Genre:      "Speech",
+				Duration:   3,
+				SampleRate: 48000,
+				Channels:   1,
+			},
+		},
+		{
+			name: "mp4",
+			data: mp4Fixture(),
+			want: AudioTags{
+				Formats:     []string{TagFormatMP4},
+				Title:       "M4A Song",
+				Artist:      "M4A Band",
+				Album:       "M4A Album",
+				AlbumArtist: "M4A Artists",
+				Track:       5,
+				TrackTotal:  11,
+				Year:        2015,
+				Genre:       "Techno",
+				Duration:    12.5,
+				Cover:       fakePNG,
+				CoverType:   "image/png",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadAudioTags(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got.coverIsFront = false
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("got  %+v\nwant %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadAudioTagsErrors(t *testing.T) {
+	truncatedID3 := id3v2Tag(3, id3Frame(3, "TIT2", []byte("\x00Title")))
+	truncatedID3 = truncatedID3[:len(truncatedID3)-3]
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"no tags", bytes.Repeat([]byte{0xFF, 0xFB, 0x90, 0x00}, 100)},
+		{"truncated id3v2", truncatedID3},
+		{"unknown id3v2 version", append(id3v2Tag(5), 0xFF, 0xFB)},
+		{"truncated flac block", append([]byte("fLaC"), 0x84, 0, 1, 0, 'x')},
+		{"truncated ogg headers", oggVorbisFixture()[:60]},
+		{"mp4 without metadata", append(mp4Box("ftyp", []byte("M4A ")), mp4Box("moov", mp4Box("mvhd", make([]byte, 20)))...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tags, err := ReadAudioTags(tt.data); err == nil {
+				t.Errorf("expected an error, got %+v", tags)
+			}
+		})
+	}
+}
+
+func TestAudioTagsAddMetadata(t *testing.T) {
+	tags, err := ReadAudioTags(flacFixture())
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := map[string]string{"title": "From ffprobe"}
+	tags.addMetadata(metadata)
+
+	want := map[string]string{
+		"title":       "From ffprobe",
+		"tagFormats":  TagFormatVorbis,
+		"artist":      "Band",
+		"album":       "Record",
+		"albumArtist": "Various",
+		"track":       "4",
+		"trackTotal":  "10",
+		"year":        "2010",
+		"genre":       "Jazz",
+		"duration":    "10.000",
+		"sample_rate": "44100",
+		"channels":    "2",
+		"coverArt":    "image/jpeg",
+	}
+	if !reflect.DeepEqual(metadata, want) {
+		t.Errorf("got  %v\nwant %v", metadata, want)
+	}
+}
+
+func FuzzReadAudioTags(f *testing.F) {
+	for _, seed := range [][]byte{mp3Fixture(), flacFixture(), oggVorbisFixture(), opusFixture(), mp4Fixture()} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tags, err := ReadAudioTags(data)
+		if err == nil && len(tags.Formats) == 0 {
+			t.Errorf("tags without a format: %+v", tags)
+		}
+	})
+}
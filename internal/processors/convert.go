@@ -0,0 +1,436 @@
+package processors
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Data formats files can be converted between
+const (
+	FormatCSV     = "csv"
+	FormatJSONL   = "jsonl" // JSON Lines: one object per line
+	FormatJSON    = "json"  // An array of objects
+	FormatParquet = "parquet"
+)
+
+// dataFormats maps data formats to the extension and content type of files
+// written in them
+var dataFormats = map[string][2]string{
+	FormatCSV:     {".csv", "text/csv"},
+	FormatJSONL:   {".jsonl", "application/x-ndjson"},
+	FormatJSON:    {".json", "application/json"},
+	FormatParquet: {".parquet", "application/vnd.apache.parquet"},
+}
+
+// conversions lists the formats each format can be converted to
+var conversions = map[string][]string{
+	FormatCSV:   {FormatJSONL, FormatJSON, FormatParquet},
+	FormatJSONL: {FormatCSV},
+}
+
+// ConvertSource opens the file being converted. Conversions read it twice,
+// first to infer its columns and then to write them, so it is never held in
+// memory.
+type ConvertSource func() (io.ReadCloser, error)
+
+// Conversion describes a converted file
+type Conversion struct {
+	From    string            `json:"from"`
+	To      string            `json:"to"`
+	Rows    int               `json:"rows"`
+	Columns []ConvertedColumn `json:"columns"`
+}
+
+// ConvertedColumn is a column of a converted file
+type ConvertedColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"` // Inferred type of CSV columns
+}
+
+// rowWriter writes rows of typed values in an output format
+type rowWriter interface {
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+// DataFormat returns the data format of a file from its content type or
+// extension, or "" if it isn't one that can be converted
+func DataFormat(contentType, filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv", ".tsv":
+		return FormatCSV
+	case ".jsonl", ".ndjson":
+		return FormatJSONL
+	}
+	switch contentType {
+	case "text/csv", "application/csv", "text/tab-separated-values":
+		return FormatCSV
+	case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+		return FormatJSONL
+	}
+	return ""
+}
+
+// FormatFile returns the extension and content type of files in a data format
+func FormatFile(format string) (string, string, bool) {
+	file, ok := dataFormats[format]
+	return file[0], file[1], ok
+}
+
+// CanConvert reports whether files in one format can be converted to another
+func CanConvert(from, to string) bool {
+	for _, format := range conversions[from] {
+		if format == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Convert converts a file from one data format to another, writing the result
+// to output. CSV files are read in their detected dialect (or the delimiter,
+// quote and header options), and their values are written with the inferred
+// column types: JSON numbers, booleans and nulls, and Parquet INT64, DOUBLE,
+// BOOLEAN, TIMESTAMP_MILLIS and UTF8 columns. JSON Lines files become CSV
+// files with a column for every key, in the order keys first appear.
+func Convert(ctx context.Context, open ConvertSource, from, to string, options ProcessOptions, output io.Writer) (*Conversion, error) {
+	if !CanConvert(from, to) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrUnsupportedConversion, from, to)
+	}
+	if from == FormatJSONL {
+		return convertJSONL(ctx, open, output)
+	}
+	return convertCSV(ctx, open, to, options, output)
+}
+
+// convertCSV profiles a CSV file, then converts its rows to JSON Lines, a
+// JSON array or Parquet
+func convertCSV(ctx context.Context, open ConvertSource, to string, options ProcessOptions, output io.Writer) (*Conversion, error) {
+	input, err := open()
+	if err != nil {
+		return nil, err
+	}
+	result, err := NewCSVProcessor().Process(ctx, input, "", options)
+	input.Close()
+	if err != nil {
+		return nil, err
+	}
+	profile := result.Data.(*CSVProfile)
+
+	conversion := &Conversion{From: FormatCSV, To: to}
+	names := uniqueColumnNames(profile.Columns)
+	types := make([]string, len(profile.Columns))
+	for i, column := range profile.Columns {
+		types[i] = column.Type
+		conversion.Columns = append(conversion.Columns, ConvertedColumn{Name: names[i], Type: column.Type})
+	}
+
+	var writer rowWriter
+	switch to {
+	case FormatParquet:
+		writer, err = newParquetWriter(output, names, types)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		// JSON has no date type, so dates are written as they appear
+		jsonTypes := make([]string, len(types))
+		for i, columnType := range types {
+			jsonTypes[i] = columnType
+			if columnType == ColumnTypeDate {
+				jsonTypes[i] = ColumnTypeString
+			}
+		}
+		types = jsonTypes
+		writer = newJSONRowWriter(output, names, to == FormatJSON)
+	}
+
+	// Read the rows again in the dialect the profile found
+	input, err = open()
+	if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+	dialect := profile.Dialect
+	reader, err := NewCSVRecordReader(input, ProcessOptions{Options: map[string]interface{}{
+		"delimiter": dialect.Delimiter,
+		"quote":     dialect.Quote,
+		"header":    dialect.Header,
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	decimalComma := dialect.Delimiter != ","
+	values := make([]interface{}, len(types))
+	skipHeader := dialect.Header
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV data: %w", err)
+		}
+		if skipHeader {
+			skipHeader = false
+			continue
+		}
+
+		for i, columnType := range types {
+			values[i] = nil
+			if i < len(record) {
+				values[i] = typedCSVValue(record[i], columnType, decimalComma)
+			}
+		}
+		if err := writer.WriteRow(values); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", to, err)
+		}
+		conversion.Rows++
+
+		if conversion.Rows%10000 == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", to, err)
+	}
+	return conversion, nil
+}
+
+// typedCSVValue converts a CSV value to its column's type: nil for nulls,
+// int64, float64, bool, time.Time for dates, or the value as written
+func typedCSVValue(value, columnType string, decimalComma bool) interface{} {
+	trimmed := strings.TrimSpace(value)
+	if csvNullValues[strings.ToLower(trimmed)] {
+		return nil
+	}
+	switch columnType {
+	case ColumnTypeEmpty:
+		return nil
+	case ColumnTypeInt:
+		if n, err := strconv.ParseInt(trimmed, 10, 64); err == nil {
+			return n
+		}
+	case ColumnTypeFloat:
+		if f, ok := parseCSVFloat(trimmed, decimalComma); ok {
+			return f
+		}
+	case ColumnTypeBoolean:
+		lower := strings.ToLower(trimmed)
+		return lower == "true" || lower == "yes"
+	case ColumnTypeDate:
+		if t, ok := parseCSVDate(trimmed); ok {
+			return t
+		}
+	}
+	return value
+}
+
+// uniqueColumnNames returns the column names, numbering repeated ones
+// ("name", "name_2") so they can be used as keys
+func uniqueColumnNames(columns []ColumnProfile) []string {
+	names := make([]string, len(columns))
+	used := make(map[string]bool)
+	for i, column := range columns {
+		name := column.Name
+		for n := 2; used[name]; n++ {
+			name = fmt.Sprintf("%s_%d", column.Name, n)
+		}
+		used[name] = true
+		names[i] = name
+	}
+	return names
+}
+
+// jsonRowWriter writes rows as JSON objects with keys in column order, one
+// per line or as the elements of an array
+type jsonRowWriter struct {
+	w     *bufio.Writer
+	keys  [][]byte // Encoded keys, with the colon
+	array bool
+	rows  int
+	value bytes.Buffer
+	enc   *json.Encoder
+}
+
+// newJSONRowWriter starts writing JSON Lines, or a JSON array if array is set
+func newJSONRowWriter(w io.Writer, names []string, array bool) *jsonRowWriter {
+	writer := &jsonRowWriter{w: bufio.NewWriter(w), array: array}
+	writer.enc = json.NewEncoder(&writer.value)
+	writer.enc.SetEscapeHTML(false)
+	for _, name := range names {
+		writer.value.Reset()
+		writer.enc.Encode(name)
+		key := bytes.TrimSuffix(writer.value.Bytes(), []byte("\n"))
+		writer.keys = append(writer.keys, append(append([]byte(nil), key...), ':'))
+	}
+	return writer
+}
+
+// WriteRow writes a row as an object
+func (j *jsonRowWriter) WriteRow(values []interface{}) error {
+	switch {
+	case j.array && j.rows == 0:
+		j.w.WriteString("[\n")
+	case j.array:
+		j.w.WriteString(",\n")
+	}
+	j.rows++
+
+	j.w.WriteByte('{')
+	for i, key := range j.keys {
+		if i > 0 {
+			j.w.WriteByte(',')
+		}
+		j.w.Write(key)
+		j.value.Reset()
+		if err := j.enc.Encode(values[i]); err != nil {
+			return err
+		}
+		j.w.Write(bytes.TrimSuffix(j.value.Bytes(), []byte("\n")))
+	}
+	j.w.WriteByte('}')
+	if !j.array {
+		j.w.WriteByte('\n')
+	}
+	return nil
+}
+
+// Close ends the array, if any, and flushes the output
+func (j *jsonRowWriter) Close() error {
+	switch {
+	case j.array && j.rows == 0:
+		j.w.WriteString("[]\n")
+	case j.array:
+		j.w.WriteString("\n]\n")
+	}
+	return j.w.Flush()
+}
+
+// convertJSONL converts JSON Lines to CSV. The columns are the keys of all
+// objects, found in a first pass; values that are objects or arrays are
+// written as JSON, and nulls and missing keys as empty fields.
+func convertJSONL(ctx context.Context, open ConvertSource, output io.Writer) (*Conversion, error) {
+	conversion := &Conversion{From: FormatJSONL, To: FormatCSV}
+	columns := make(map[string]int)
+	err := readJSONL(ctx, open, func(keys []string, values []json.RawMessage) error {
+		for _, key := range keys {
+			if _, ok := columns[key]; !ok {
+				columns[key] = len(conversion.Columns)
+				conversion.Columns = append(conversion.Columns, ConvertedColumn{Name: key})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	writer := csv.NewWriter(output)
+	record := make([]string, len(conversion.Columns))
+	for i, column := range conversion.Columns {
+		record[i] = column.Name
+	}
+	if err := writer.Write(record); err != nil {
+		return nil, fmt.Errorf("failed to write CSV: %w", err)
+	}
+
+	err = readJSONL(ctx, open, func(keys []string, values []json.RawMessage) error {
+		for i := range record {
+			record[i] = ""
+		}
+		for i, key := range keys {
+			record[columns[key]] = jsonCSVField(values[i])
+		}
+		conversion.Rows++
+		return writer.Write(record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return conversion, nil
+}
+
+// readJSONL calls fn with the keys and values, in order, of each object of a
+// JSON Lines file
+func readJSONL(ctx context.Context, open ConvertSource, fn func(keys []string, values []json.RawMessage) error) error {
+	input, err := open()
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(input))
+	for line := 1; ; line++ {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid JSON in object %d: %w", line, err)
+		}
+		if delim, ok := token.(json.Delim); !ok || delim != '{' {
+			return fmt.Errorf("object %d of the JSON Lines file is not a JSON object", line)
+		}
+
+		var keys []string
+		var values []json.RawMessage
+		for decoder.More() {
+			token, err := decoder.Token()
+			if err != nil {
+				return fmt.Errorf("invalid JSON in object %d: %w", line, err)
+			}
+			var value json.RawMessage
+			if err := decoder.Decode(&value); err != nil {
+				return fmt.Errorf("invalid JSON in object %d: %w", line, err)
+			}
+			keys = append(keys, token.(string))
+			values = append(values, value)
+		}
+		if _, err := decoder.Token(); err != nil {
+			return fmt.Errorf("invalid JSON in object %d: %w", line, err)
+		}
+
+		if err := fn(keys, values); err != nil {
+			return err
+		}
+		if line%10000 == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// jsonCSVField writes a JSON value as a CSV field: strings unquoted, null
+// empty, and numbers, booleans, objects and arrays as JSON
+func jsonCSVField(value json.RawMessage) string {
+	value = bytes.TrimSpace(value)
+	switch {
+	case string(value) == "null":
+		return ""
+	case len(value) > 0 && value[0] == '"':
+		var s string
+		if err := json.Unmarshal(value, &s); err == nil {
+			return s
+		}
+	case len(value) > 0 && (value[0] == '{' || value[0] == '['):
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, value); err == nil {
+			return compact.String()
+		}
+	}
+	return string(value)
+}
@@ -0,0 +1,171 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stringSource opens a string as the file being converted
+func stringSource(s string) ConvertSource {
+	return func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(s)), nil
+	}
+}
+
+func TestConvertGolden(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		input    string
+		want     string
+		rows     int
+		columns  []ConvertedColumn
+	}{
+		{
+			name:  "csv to jsonl with semicolons, decimal commas, repeated names and nulls",
+			from:  FormatCSV,
+			to:    FormatJSONL,
+			input: "id;name;price;name;note\n1;Alice;3,50;A;\n2;Bob;NULL;B;x\n",
+			want: `{"id":1,"name":"Alice","price":3.5,"name_2":"A","note":null}` + "\n" +
+				`{"id":2,"name":"Bob","price":null,"name_2":"B","note":"x"}` + "\n",
+			rows: 2,
+			columns: []ConvertedColumn{
+				{Name: "id", Type: ColumnTypeInt},
+				{Name: "name", Type: ColumnTypeString},
+				{Name: "price", Type: ColumnTypeFloat},
+				{Name: "name_2", Type: ColumnTypeString},
+				{Name: "note", Type: ColumnTypeString},
+			},
+		},
+		{
+			name:  "csv to json array with dates as written",
+			from:  FormatCSV,
+			to:    FormatJSON,
+			input: "id,when,ok\n1,2024-03-06,true\n2,,false\n",
+			want:  "[\n" + `{"id":1,"when":"2024-03-06","ok":true},` + "\n" + `{"id":2,"when":null,"ok":false}` + "\n]\n",
+			rows:  2,
+			columns: []ConvertedColumn{
+				{Name: "id", Type: ColumnTypeInt},
+				{Name: "when", Type: ColumnTypeDate},
+				{Name: "ok", Type: ColumnTypeBoolean},
+			},
+		},
+		{
+			name:    "csv with only a header to an empty json array",
+			from:    FormatCSV,
+			to:      FormatJSON,
+			input:   "id\n",
+			want:    "[]\n",
+			columns: []ConvertedColumn{{Name: "id", Type: ColumnTypeEmpty}},
+		},
+		{
+			name:  "jsonl to csv with keys in order of appearance",
+			from:  FormatJSONL,
+			to:    FormatCSV,
+			input: `{"a":1,"b":"x, y"}` + "\n" + `{"c":{"d": [1, 2]},"a":null}` + "\n" + `{"b":true}` + "\n",
+			want:  "a,b,c\n1,\"x, y\",\n,,\"{\"\"d\"\":[1,2]}\"\n,true,\n",
+			rows:  3,
+			columns: []ConvertedColumn{
+				{Name: "a"},
+				{Name: "b"},
+				{Name: "c"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			conversion, err := Convert(context.Background(), stringSource(tt.input), tt.from, tt.to, ProcessOptions{}, &out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("output:\n%s\nwant:\n%s", out.String(), tt.want)
+			}
+			if conversion.Rows != tt.rows {
+				t.Errorf("Rows = %d, want %d", conversion.Rows, tt.rows)
+			}
+			if !reflect.DeepEqual(conversion.Columns, tt.columns) {
+				t.Errorf("Columns = %+v, want %+v", conversion.Columns, tt.columns)
+			}
+		})
+	}
+}
+
+func TestConvertCSVToParquet(t *testing.T) {
+	input := "id,price,ok,when,name\n1,2.5,yes,2024-03-06,a\n2,,no,,\n"
+
+	var out bytes.Buffer
+	conversion, err := Convert(context.Background(), stringSource(input), FormatCSV, FormatParquet, ProcessOptions{}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conversion.Rows != 2 {
+		t.Errorf("Rows = %d, want 2", conversion.Rows)
+	}
+
+	file := readParquet(t, out.Bytes())
+	when := time.Date(2024, time.March, 6, 0, 0, 0, 0, time.UTC).UnixMilli()
+	want := [][]interface{}{
+		{int64(1), int64(2)},
+		{2.5, nil},
+		{true, false},
+		{when, nil},
+		{"a", nil},
+	}
+	if !reflect.DeepEqual(file.columns, want) {
+		t.Errorf("columns %v, want %v", file.columns, want)
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		input    string
+		wantErr  error
+	}{
+		{"unsupported conversion", FormatJSONL, FormatParquet, `{"a":1}`, ErrUnsupportedConversion},
+		{"unknown format", "xml", FormatCSV, "<a/>", ErrUnsupportedConversion},
+		{"line that isn't an object", FormatJSONL, FormatCSV, `{"a":1}` + "\n[1,2]\n", nil},
+		{"invalid json", FormatJSONL, FormatCSV, `{"a":}`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Convert(context.Background(), stringSource(tt.input), tt.from, tt.to, ProcessOptions{}, io.Discard)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDataFormat(t *testing.T) {
+	tests := []struct {
+		contentType, filename, want string
+	}{
+		{"", "data.csv", FormatCSV},
+		{"", "data.TSV", FormatCSV},
+		{"", "events.ndjson", FormatJSONL},
+		{"text/csv", "export", FormatCSV},
+		{"application/x-ndjson", "stream", FormatJSONL},
+		{"application/json", "data.json", ""},
+	}
+
+	for _, tt := range tests {
+		if got := DataFormat(tt.contentType, tt.filename); got != tt.want {
+			t.Errorf("DataFormat(%q, %q) = %q, want %q", tt.contentType, tt.filename, got, tt.want)
+		}
+	}
+}
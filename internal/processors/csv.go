@@ -2,7 +2,6 @@ package processors
 
 import (
 	"context"
-	"encoding/csv"
 	"fmt"
 	"io"
 	"strings"
@@ -16,62 +15,128 @@ func NewCSVProcessor() *CSVProcessor {
 	return &CSVProcessor{}
 }
 
-// Process processes a CSV file
+// csvPreviewRows is the number of rows in a CSV preview
+const csvPreviewRows = 10
+
+// Process profiles a CSV file row by row, so files larger than memory can be
+// described: the dialect it is written in and, per column, the inferred type,
+// null and distinct counts, numeric statistics and most common values
 func (p *CSVProcessor) Process(ctx context.Context, reader io.Reader, filename string, options ProcessOptions) (*ProcessResult, error) {
-	// Parse CSV data
-	csvReader := csv.NewReader(reader)
-	
-	// Read all records
-	records, err := csvReader.ReadAll()
+	// Detect the encoding, delimiter and quotes, then parse the CSV data
+	csvReader, err := NewCSVRecordReader(reader, options)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read CSV data: %w", err)
+		return nil, err
 	}
-	
+
+	var columns []*csvColumn
+	var header []string
+	var preview [][]string
+	profile := &CSVProfile{Dialect: csvReader.Dialect}
+	records := 0
+
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV data: %w", err)
+		}
+		if records < csvPreviewRows {
+			preview = append(preview, append([]string(nil), record...))
+		}
+		records++
+
+		if records == 1 {
+			for i := range record {
+				name := fmt.Sprintf("column%d", i+1)
+				if profile.Dialect.Header && strings.TrimSpace(record[i]) != "" {
+					name = strings.TrimSpace(record[i])
+				}
+				columns = append(columns, newCSVColumn(name, profile.Dialect))
+			}
+			if profile.Dialect.Header {
+				header = append([]string(nil), record...)
+				continue
+			}
+		}
+
+		// Columns missing from short rows are null; long rows add columns,
+		// which are null in the rows before
+		profile.Rows++
+		if len(record) != len(columns) {
+			profile.RaggedRows++
+		}
+		for len(columns) < len(record) {
+			column := newCSVColumn(fmt.Sprintf("column%d", len(columns)+1), profile.Dialect)
+			column.nulls = profile.Rows - 1
+			columns = append(columns, column)
+		}
+		for i, column := range columns {
+			if i < len(record) {
+				column.add(record[i])
+			} else {
+				column.nulls++
+			}
+		}
+
+		if profile.Rows%10000 == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	topN := options.Int("topValues", DefaultTopValues)
+	if topN < 0 {
+		topN = 0
+	}
+	types := make([]string, len(columns))
+	for i, column := range columns {
+		profile.Columns = append(profile.Columns, column.profile(topN))
+		types[i] = profile.Columns[i].Type
+	}
+
 	result := &ProcessResult{
 		Metadata: make(map[string]string),
-		Data:     records,
+		Data:     profile,
 	}
-	
+
 	// Generate summary
-	rowCount := len(records)
-	var colCount int
-	if rowCount > 0 {
-		colCount = len(records[0])
-	}
-	
-	result.Summary = fmt.Sprintf("CSV file with %d rows and %d columns", rowCount, colCount)
-	
+	result.Summary = fmt.Sprintf("CSV file with %d rows and %d columns", profile.Rows, len(columns))
+
 	// Extract metadata
 	if options.ExtractMetadata {
-		result.Metadata["rows"] = fmt.Sprintf("%d", rowCount)
-		result.Metadata["columns"] = fmt.Sprintf("%d", colCount)
-		
-		if rowCount > 0 {
+		result.Metadata["rows"] = fmt.Sprintf("%d", profile.Rows)
+		result.Metadata["columns"] = fmt.Sprintf("%d", len(columns))
+		result.Metadata["delimiter"] = profile.Dialect.Delimiter
+		result.Metadata["encoding"] = profile.Dialect.Encoding
+		result.Metadata["columnTypes"] = strings.Join(types, ",")
+
+		if header != nil {
 			// Store header row in metadata
-			result.Metadata["headers"] = strings.Join(records[0], ",")
+			result.Metadata["headers"] = strings.Join(header, ",")
 		}
 	}
-	
+
 	// Generate preview
-	if options.GeneratePreview && rowCount > 0 {
+	if options.GeneratePreview && len(preview) > 0 {
 		// For CSV preview, we'll just take the first few rows as a string
-		maxPreviewRows := 10
-		if maxPreviewRows > rowCount {
-			maxPreviewRows = rowCount
-		}
-		
 		var previewBuilder strings.Builder
-		for i := 0; i < maxPreviewRows; i++ {
-			previewBuilder.WriteString(strings.Join(records[i], ","))
+		for _, record := range preview {
+			previewBuilder.WriteString(strings.Join(record, ","))
 			previewBuilder.WriteString("\n")
 		}
-		
+
 		result.Preview = []byte(previewBuilder.String())
 	}
-	
+
 	return result, nil
 }
 
+// Name returns the processor name
+func (p *CSVProcessor) Name() string {
+	return "csv"
+}
+
 // CanProcess returns true if this processor can process the given content type
 func (p *CSVProcessor) CanProcess(contentType, ext string) bool {
 	if (contentType == "text/csv" || strings.HasSuffix(contentType, "/csv")) {
@@ -0,0 +1,259 @@
+package processors
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// Text encodings detected in CSV files
+const (
+	EncodingUTF8        = "UTF-8"
+	EncodingUTF16LE     = "UTF-16LE"
+	EncodingUTF16BE     = "UTF-16BE"
+	EncodingWindows1252 = "windows-1252" // Assumed for text that isn't UTF-8
+)
+
+// csvSniffSize is how much of a CSV file is sampled to detect its dialect
+const csvSniffSize = 64 * 1024
+
+// csvDelimiters are the delimiters tried, in order of preference on ties
+var csvDelimiters = []rune{',', ';', '\t', '|'}
+
+// csvQuotes are the quote characters tried, in order of preference on ties
+var csvQuotes = []rune{'"', '\''}
+
+// CSVDialect describes how a CSV file is written
+type CSVDialect struct {
+	Delimiter string `json:"delimiter"`
+	Quote     string `json:"quote"`
+	Encoding  string `json:"encoding"`
+	BOM       bool   `json:"bom,omitempty"`
+	Header    bool   `json:"header"` // Whether the first row names the columns
+}
+
+// CSVRecordReader reads the records of a CSV file in its detected dialect,
+// decoded to UTF-8
+type CSVRecordReader struct {
+	Dialect CSVDialect
+	reader  *csv.Reader
+}
+
+// NewCSVRecordReader detects the encoding, delimiter and quote character of a
+// CSV file from its start and returns a reader for its records. The delimiter,
+// quote and header options override detection; header defaults to true.
+func NewCSVRecordReader(input io.Reader, options ProcessOptions) (*CSVRecordReader, error) {
+	dialect := CSVDialect{Header: true}
+	if _, ok := options.Options["header"]; ok {
+		dialect.Header = options.Bool("header")
+	}
+
+	text, err := decodeCSV(input, &dialect)
+	if err != nil {
+		return nil, err
+	}
+	buffered := bufio.NewReaderSize(text, csvSniffSize)
+	sample, err := buffered.Peek(csvSniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, fmt.Errorf("failed to read CSV data: %w", err)
+	}
+
+	delimiter, quote := sniffCSVDialect(sample, err == io.EOF)
+	if value := options.String("delimiter", ""); value != "" {
+		if delimiter, err = parseCSVDelimiter(value); err != nil {
+			return nil, err
+		}
+	}
+	if value := options.String("quote", ""); value != "" {
+		if value != `"` && value != "'" {
+			return nil, fmt.Errorf("CSV quote must be \" or '")
+		}
+		quote = rune(value[0])
+	}
+	dialect.Delimiter = string(delimiter)
+	dialect.Quote = string(quote)
+
+	return &CSVRecordReader{
+		Dialect: dialect,
+		reader:  newCSVReader(buffered, delimiter, quote),
+	}, nil
+}
+
+// Read returns the next record, or io.EOF. Rows may have more or fewer
+// fields than the header. The record is reused by the next call.
+func (r *CSVRecordReader) Read() ([]string, error) {
+	record, err := r.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	if r.Dialect.Quote == "'" {
+		for i, field := range record {
+			record[i] = swapQuotes(field)
+		}
+	}
+	return record, nil
+}
+
+// newCSVReader returns a lenient reader for a delimiter and quote character.
+// encoding/csv only knows double quotes, so single quotes are swapped with
+// double quotes on the way in and back in each field.
+func newCSVReader(text io.Reader, delimiter, quote rune) *csv.Reader {
+	if quote == '\'' {
+		text = &quoteSwapReader{r: text}
+	}
+	reader := csv.NewReader(text)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.ReuseRecord = true
+	return reader
+}
+
+// parseCSVDelimiter parses the delimiter option, a single character or "tab"
+func parseCSVDelimiter(value string) (rune, error) {
+	if value == "tab" || value == `\t` {
+		return '\t', nil
+	}
+	delimiter, size := utf8.DecodeRuneInString(value)
+	if size != len(value) || delimiter == '\n' || delimiter == '\r' || delimiter == '"' || delimiter == utf8.RuneError {
+		return 0, fmt.Errorf("invalid CSV delimiter %q", value)
+	}
+	return delimiter, nil
+}
+
+// decodeCSV detects the encoding of a CSV file from a byte order mark, or
+// from whether its start is valid UTF-8, and returns it decoded to UTF-8
+func decodeCSV(input io.Reader, dialect *CSVDialect) (io.Reader, error) {
+	buffered := bufio.NewReaderSize(input, csvSniffSize)
+	sample, err := buffered.Peek(csvSniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, fmt.Errorf("failed to read CSV data: %w", err)
+	}
+
+	dialect.Encoding = EncodingUTF8
+	switch {
+	case bytes.HasPrefix(sample, []byte{0xEF, 0xBB, 0xBF}):
+		dialect.BOM = true
+		buffered.Discard(3)
+		return buffered, nil
+	case bytes.HasPrefix(sample, []byte{0xFF, 0xFE}):
+		dialect.Encoding, dialect.BOM = EncodingUTF16LE, true
+		return transform.NewReader(buffered, unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM).NewDecoder()), nil
+	case bytes.HasPrefix(sample, []byte{0xFE, 0xFF}):
+		dialect.Encoding, dialect.BOM = EncodingUTF16BE, true
+		return transform.NewReader(buffered, unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM).NewDecoder()), nil
+	}
+
+	// The sample may end in the middle of a character
+	if len(sample) == csvSniffSize {
+		for i := 1; i < utf8.UTFMax && i <= len(sample); i++ {
+			if start := len(sample) - i; utf8.RuneStart(sample[start]) {
+				if !utf8.FullRune(sample[start:]) {
+					sample = sample[:start]
+				}
+				break
+			}
+		}
+	}
+	if !utf8.Valid(sample) {
+		dialect.Encoding = EncodingWindows1252
+		return transform.NewReader(buffered, charmap.Windows1252.NewDecoder()), nil
+	}
+	return buffered, nil
+}
+
+// sniffCSVDialect picks the delimiter and quote character that split the
+// sample into the most rows of the same width, preferring wider rows and
+// then the order of csvDelimiters and csvQuotes
+func sniffCSVDialect(sample []byte, complete bool) (rune, rune) {
+	// Leave out a last line cut off by the end of the sample
+	if !complete {
+		if end := bytes.LastIndexByte(sample, '\n'); end >= 0 {
+			sample = sample[:end+1]
+		}
+	}
+
+	bestDelimiter, bestQuote := csvDelimiters[0], csvQuotes[0]
+	bestRows, bestWidth := -1, 0
+	for _, delimiter := range csvDelimiters {
+		for _, quote := range csvQuotes {
+			rows, width := csvConsistency(sample, delimiter, quote)
+			if rows > bestRows || rows == bestRows && width > bestWidth {
+				bestDelimiter, bestQuote = delimiter, quote
+				bestRows, bestWidth = rows, width
+			}
+		}
+	}
+	return bestDelimiter, bestQuote
+}
+
+// csvConsistency parses a sample and returns how many of its rows have the
+// most common width, and that width. Single-field rows don't count, as any
+// delimiter that doesn't occur gives them.
+func csvConsistency(sample []byte, delimiter, quote rune) (int, int) {
+	reader := newCSVReader(bytes.NewReader(sample), delimiter, quote)
+	widths := make(map[int]int)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, 0
+		}
+		if len(record) > 1 {
+			widths[len(record)]++
+		}
+	}
+
+	rows, width := 0, 0
+	for w, count := range widths {
+		if count > rows || count == rows && w > width {
+			rows, width = count, w
+		}
+	}
+	return rows, width
+}
+
+// quoteSwapReader swaps single and double quotes in the text it reads
+type quoteSwapReader struct {
+	r io.Reader
+}
+
+// Read reads and swaps the quotes of a chunk of text
+func (q *quoteSwapReader) Read(p []byte) (int, error) {
+	n, err := q.r.Read(p)
+	for i := range p[:n] {
+		switch p[i] {
+		case '\'':
+			p[i] = '"'
+		case '"':
+			p[i] = '\''
+		}
+	}
+	return n, err
+}
+
+// swapQuotes swaps single and double quotes back in a field
+func swapQuotes(field string) string {
+	if !strings.ContainsAny(field, `'"`) {
+		return field
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '\'':
+			return '"'
+		case '"':
+			return '\''
+		}
+		return r
+	}, field)
+}
@@ -0,0 +1,198 @@
+package processors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// utf16CSV encodes text as UTF-16 with a byte order mark
+func utf16CSV(text string, order binary.AppendByteOrder) []byte {
+	data := order.AppendUint16(nil, 0xFEFF)
+	for _, unit := range utf16.Encode([]rune(text)) {
+		data = order.AppendUint16(data, unit)
+	}
+	return data
+}
+
+// readCSVRecords reads every record of a CSV file
+func readCSVRecords(t *testing.T, reader *CSVRecordReader) [][]string {
+	t.Helper()
+	var records [][]string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return records
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, append([]string(nil), record...))
+	}
+}
+
+func TestCSVRecordReaderDialect(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		options map[string]interface{}
+		dialect CSVDialect
+		records [][]string
+	}{
+		{
+			name:    "comma",
+			input:   []byte("a,b,c\n1,\"x, y\",3\n"),
+			dialect: CSVDialect{Delimiter: ",", Quote: `"`, Encoding: EncodingUTF8, Header: true},
+			records: [][]string{{"a", "b", "c"}, {"1", "x, y", "3"}},
+		},
+		{
+			name:    "semicolon with decimal commas",
+			input:   []byte("name;price\nwidget;1,50\ngadget;2,75\n"),
+			dialect: CSVDialect{Delimiter: ";", Quote: `"`, Encoding: EncodingUTF8, Header: true},
+			records: [][]string{{"name", "price"}, {"widget", "1,50"}, {"gadget", "2,75"}},
+		},
+		{
+			name:    "tab",
+			input:   []byte("a\tb\n1\t2\n3\t4\n"),
+			dialect: CSVDialect{Delimiter: "\t", Quote: `"`, Encoding: EncodingUTF8, Header: true},
+			records: [][]string{{"a", "b"}, {"1", "2"}, {"3", "4"}},
+		},
+		{
+			name:    "pipe",
+			input:   []byte("a|b|c\n1|2,5|3\n4|5|6\n"),
+			dialect: CSVDialect{Delimiter: "|", Quote: `"`, Encoding: EncodingUTF8, Header: true},
+			records: [][]string{{"a", "b", "c"}, {"1", "2,5", "3"}, {"4", "5", "6"}},
+		},
+		{
+			name:    "single quotes",
+			input:   []byte("'a,b',c\n'say \"hi\"',d\n'it''s',e\n"),
+			dialect: CSVDialect{Delimiter: ",", Quote: "'", Encoding: EncodingUTF8, Header: true},
+			records: [][]string{{"a,b", "c"}, {`say "hi"`, "d"}, {"it's", "e"}},
+		},
+		{
+			name:    "utf-8 byte order mark",
+			input:   []byte("\xEF\xBB\xBFname,city\nJosé,Zürich\n"),
+			dialect: CSVDialect{Delimiter: ",", Quote: `"`, Encoding: EncodingUTF8, BOM: true, Header: true},
+			records: [][]string{{"name", "city"}, {"José", "Zürich"}},
+		},
+		{
+			name:    "utf-16le",
+			input:   utf16CSV("name;city\nJosé;Zürich\n", binary.LittleEndian),
+			dialect: CSVDialect{Delimiter: ";", Quote: `"`, Encoding: EncodingUTF16LE, BOM: true, Header: true},
+			records: [][]string{{"name", "city"}, {"José", "Zürich"}},
+		},
+		{
+			name:    "utf-16be",
+			input:   utf16CSV("name\tcity\nJosé\tZürich\n", binary.BigEndian),
+			dialect: CSVDialect{Delimiter: "\t", Quote: `"`, Encoding: EncodingUTF16BE, BOM: true, Header: true},
+			records: [][]string{{"name", "city"}, {"José", "Zürich"}},
+		},
+		{
+			name:    "windows-1252",
+			input:   []byte("name,price\ncaf\xe9,\x805\n"),
+			dialect: CSVDialect{Delimiter: ",", Quote: `"`, Encoding: EncodingWindows1252, Header: true},
+			records: [][]string{{"name", "price"}, {"café", "€5"}},
+		},
+		{
+			name:    "options override detection",
+			input:   []byte("a;b,c\n1;2,3\n"),
+			options: map[string]interface{}{"delimiter": "tab", "quote": "'", "header": "false"},
+			dialect: CSVDialect{Delimiter: "\t", Quote: "'", Encoding: EncodingUTF8},
+			records: [][]string{{"a;b,c"}, {"1;2,3"}},
+		},
+		{
+			name:    "delimiter option",
+			input:   []byte("a,b;c\n1,2;3\n"),
+			options: map[string]interface{}{"delimiter": ";"},
+			dialect: CSVDialect{Delimiter: ";", Quote: `"`, Encoding: EncodingUTF8, Header: true},
+			records: [][]string{{"a,b", "c"}, {"1,2", "3"}},
+		},
+		{
+			name:    "single column",
+			input:   []byte("name\nalpha\nbeta\n"),
+			dialect: CSVDialect{Delimiter: ",", Quote: `"`, Encoding: EncodingUTF8, Header: true},
+			records: [][]string{{"name"}, {"alpha"}, {"beta"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := NewCSVRecordReader(bytes.NewReader(tt.input), ProcessOptions{Options: tt.options})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reader.Dialect != tt.dialect {
+				t.Errorf("dialect %+v, want %+v", reader.Dialect, tt.dialect)
+			}
+			if records := readCSVRecords(t, reader); !reflect.DeepEqual(records, tt.records) {
+				t.Errorf("records %q, want %q", records, tt.records)
+			}
+		})
+	}
+}
+
+func TestCSVRecordReaderInvalidOptions(t *testing.T) {
+	tests := []map[string]interface{}{
+		{"delimiter": `"`},
+		{"delimiter": "ab"},
+		{"delimiter": "\n"},
+		{"delimiter": "\xff"},
+		{"quote": "`"},
+		{"quote": `""`},
+	}
+
+	for _, options := range tests {
+		if _, err := NewCSVRecordReader(strings.NewReader("a,b\n"), ProcessOptions{Options: options}); err == nil {
+			t.Errorf("options %v: expected an error", options)
+		}
+	}
+}
+
+func TestCSVRecordReaderLargeSample(t *testing.T) {
+	// A sample that ends in the middle of a line and of a UTF-8 character
+	var input bytes.Buffer
+	input.WriteString("name;note\n")
+	for input.Len() < csvSniffSize-20 {
+		input.WriteString("row;a, b, c\n")
+	}
+	input.WriteString(strings.Repeat("x", csvSniffSize-1-input.Len()))
+	input.WriteString("é;cut, off\n")
+
+	reader, err := NewCSVRecordReader(bytes.NewReader(input.Bytes()), ProcessOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := CSVDialect{Delimiter: ";", Quote: `"`, Encoding: EncodingUTF8, Header: true}
+	if reader.Dialect != want {
+		t.Errorf("dialect %+v, want %+v", reader.Dialect, want)
+	}
+	records := readCSVRecords(t, reader)
+	if last := records[len(records)-1]; !strings.HasSuffix(last[0], "xé") || last[1] != "cut, off" {
+		t.Errorf("last record %q", last)
+	}
+}
+
+func FuzzCSVRecordReader(f *testing.F) {
+	f.Add([]byte("a,b,c\n1,\"x, y\",3\n"))
+	f.Add([]byte("'a;b';c\n'd';e\n"))
+	f.Add(utf16CSV("name\tcity\nJosé\tZürich\n", binary.LittleEndian))
+	f.Add([]byte("name,price\ncaf\xe9,\x805\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		reader, err := NewCSVRecordReader(bytes.NewReader(data), ProcessOptions{})
+		if err != nil {
+			return
+		}
+		if strings.IndexAny(reader.Dialect.Delimiter, ",;\t|") != 0 || len(reader.Dialect.Delimiter) != 1 {
+			t.Errorf("unexpected delimiter %q", reader.Dialect.Delimiter)
+		}
+		for {
+			if _, err := reader.Read(); err != nil {
+				break
+			}
+		}
+	})
+}
@@ -0,0 +1,305 @@
+package processors
+
+import (
+	"hash/maphash"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Column types inferred for CSV columns, besides ColumnTypeEmpty,
+// ColumnTypeBoolean and ColumnTypeString
+const (
+	ColumnTypeInt   = "int"
+	ColumnTypeFloat = "float"
+	ColumnTypeDate  = "date"
+)
+
+// DefaultTopValues is the number of most common values reported for
+// categorical columns
+const DefaultTopValues = 5
+
+// csvMaxTrackedValues bounds the distinct values counted exactly per column;
+// beyond it the distinct count is estimated and no top values are reported
+const csvMaxTrackedValues = 10000
+
+// csvNullValues are the values, in lower case, treated as missing
+var csvNullValues = map[string]bool{"": true, "null": true, "na": true, "n/a": true, "nan": true, "none": true}
+
+// csvDateLayouts are the date formats recognized in date columns
+var csvDateLayouts = []string{
+	"2006-01-02",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006/01/02",
+	"01/02/2006",
+	"02.01.2006",
+}
+
+// CSVProfile is the structured data produced by the CSV processor
+type CSVProfile struct {
+	Dialect    CSVDialect      `json:"dialect"`
+	Rows       int             `json:"rows"`                 // Data rows, not counting the header
+	RaggedRows int             `json:"raggedRows,omitempty"` // Rows with more or fewer fields than the header
+	Columns    []ColumnProfile `json:"columns"`
+}
+
+// ColumnProfile describes the values of one CSV column
+type ColumnProfile struct {
+	Name              string       `json:"name"`
+	Type              string       `json:"type"`
+	Count             int          `json:"count"` // Non-null values
+	Nulls             int          `json:"nulls"`
+	Distinct          int          `json:"distinct"`
+	DistinctEstimated bool         `json:"distinctEstimated,omitempty"`
+	Min               interface{}  `json:"min,omitempty"` // Numbers, or dates as written
+	Max               interface{}  `json:"max,omitempty"`
+	Mean              *float64     `json:"mean,omitempty"`
+	StdDev            *float64     `json:"stddev,omitempty"` // Sample standard deviation
+	TopValues         []ValueCount `json:"topValues,omitempty"`
+}
+
+// ValueCount is a value of a column and how often it occurs
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// IsNumeric reports whether the column holds integers or decimals
+func (c ColumnProfile) IsNumeric() bool {
+	return c.Type == ColumnTypeInt || c.Type == ColumnTypeFloat
+}
+
+// csvColumn accumulates the profile of a column one value at a time
+type csvColumn struct {
+	name         string
+	count        int
+	nulls        int
+	decimalComma bool // Decimals may be written with a comma, as in "1,5"
+
+	// Whether every value so far parses as each type
+	isInt, isFloat, isBool, isDate bool
+
+	intMin, intMax int64
+	floatMin       float64
+	floatMax       float64
+	mean, m2       float64 // Welford's running mean and sum of squared deviations
+	dateMin        time.Time
+	dateMax        time.Time
+	dateMinText    string
+	dateMaxText    string
+
+	values   map[string]int // Exact counts until there are too many
+	distinct hyperLogLog
+}
+
+// newCSVColumn starts the profile of a column of a file with the given dialect
+func newCSVColumn(name string, dialect CSVDialect) *csvColumn {
+	return &csvColumn{
+		name:         name,
+		decimalComma: dialect.Delimiter != ",",
+		isInt:        true,
+		isFloat:      true,
+		isBool:       true,
+		isDate:       true,
+		values:       make(map[string]int),
+	}
+}
+
+// add profiles one value
+func (c *csvColumn) add(value string) {
+	value = strings.TrimSpace(value)
+	if csvNullValues[strings.ToLower(value)] {
+		c.nulls++
+		return
+	}
+	c.count++
+
+	if c.values != nil {
+		if _, ok := c.values[value]; !ok && len(c.values) == csvMaxTrackedValues {
+			c.values = nil
+		} else {
+			c.values[value]++
+		}
+	}
+	c.distinct.add(value)
+
+	if c.isInt {
+		if n, err := strconv.ParseInt(value, 10, 64); err != nil {
+			c.isInt = false
+		} else if c.count == 1 {
+			c.intMin, c.intMax = n, n
+		} else {
+			c.intMin, c.intMax = min(c.intMin, n), max(c.intMax, n)
+		}
+	}
+	if c.isFloat {
+		if f, ok := parseCSVFloat(value, c.decimalComma); !ok {
+			c.isFloat = false
+		} else {
+			if c.count == 1 {
+				c.floatMin, c.floatMax = f, f
+			} else {
+				c.floatMin, c.floatMax = math.Min(c.floatMin, f), math.Max(c.floatMax, f)
+			}
+			delta := f - c.mean
+			c.mean += delta / float64(c.count)
+			c.m2 += delta * (f - c.mean)
+		}
+	}
+	if c.isBool {
+		switch strings.ToLower(value) {
+		case "true", "false", "yes", "no":
+		default:
+			c.isBool = false
+		}
+	}
+	if c.isDate {
+		if t, ok := parseCSVDate(value); !ok {
+			c.isDate = false
+		} else {
+			if c.dateMinText == "" || t.Before(c.dateMin) {
+				c.dateMin, c.dateMinText = t, value
+			}
+			if c.dateMaxText == "" || t.After(c.dateMax) {
+				c.dateMax, c.dateMaxText = t, value
+			}
+		}
+	}
+}
+
+// profile returns the column's profile with up to topN common values
+func (c *csvColumn) profile(topN int) ColumnProfile {
+	profile := ColumnProfile{Name: c.name, Count: c.count, Nulls: c.nulls}
+	switch {
+	case c.count == 0:
+		profile.Type = ColumnTypeEmpty
+	case c.isInt:
+		profile.Type = ColumnTypeInt
+		profile.Min, profile.Max = c.intMin, c.intMax
+	case c.isFloat:
+		profile.Type = ColumnTypeFloat
+		profile.Min, profile.Max = c.floatMin, c.floatMax
+	case c.isBool:
+		profile.Type = ColumnTypeBoolean
+	case c.isDate:
+		profile.Type = ColumnTypeDate
+		profile.Min, profile.Max = c.dateMinText, c.dateMaxText
+	default:
+		profile.Type = ColumnTypeString
+	}
+
+	if profile.IsNumeric() {
+		mean := c.mean
+		profile.Mean = &mean
+		if c.count > 1 {
+			stddev := math.Sqrt(c.m2 / float64(c.count-1))
+			profile.StdDev = &stddev
+		}
+	}
+
+	if c.values != nil {
+		profile.Distinct = len(c.values)
+	} else {
+		profile.Distinct = c.distinct.estimate()
+		profile.DistinctEstimated = true
+	}
+
+	// Top values describe categorical columns, whose values can be counted
+	if c.values != nil && (profile.Type == ColumnTypeString || profile.Type == ColumnTypeBoolean) {
+		top := make([]ValueCount, 0, len(c.values))
+		for value, count := range c.values {
+			top = append(top, ValueCount{Value: value, Count: count})
+		}
+		sort.Slice(top, func(i, j int) bool {
+			if top[i].Count != top[j].Count {
+				return top[i].Count > top[j].Count
+			}
+			return top[i].Value < top[j].Value
+		})
+		if len(top) > topN {
+			top = top[:topN]
+		}
+		profile.TopValues = top
+	}
+	return profile
+}
+
+// parseCSVFloat parses a finite number, with a comma as the decimal
+// separator if decimalComma is set and the value has no point
+func parseCSVFloat(value string, decimalComma bool) (float64, bool) {
+	if decimalComma && strings.Count(value, ",") == 1 && !strings.Contains(value, ".") {
+		value = strings.Replace(value, ",", ".", 1)
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, false
+	}
+	return f, true
+}
+
+// parseCSVDate parses a value written in one of csvDateLayouts
+func parseCSVDate(value string) (time.Time, bool) {
+	// Every layout starts with a digit; this skips most text quickly
+	if value == "" || value[0] < '0' || value[0] > '9' {
+		return time.Time{}, false
+	}
+	for _, layout := range csvDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// hllPrecision is the number of hash bits that select a HyperLogLog
+// register; 2^12 registers give a standard error of about 1.6%
+const hllPrecision = 12
+
+// hllSeed seeds the hash of distinct-count estimates
+var hllSeed = maphash.MakeSeed()
+
+// hyperLogLog estimates the number of distinct values added to it in
+// constant memory
+type hyperLogLog struct {
+	registers []uint8
+}
+
+// add adds a value to the estimate
+func (h *hyperLogLog) add(value string) {
+	if h.registers == nil {
+		h.registers = make([]uint8, 1<<hllPrecision)
+	}
+	hash := maphash.String(hllSeed, value)
+	index := hash >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(hash<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+// estimate returns the estimated number of distinct values
+func (h *hyperLogLog) estimate() int {
+	if h.registers == nil {
+		return 0
+	}
+	m := float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, rank := range h.registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+
+	// Small cardinalities are estimated better by counting empty registers
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int(math.Round(estimate))
+}
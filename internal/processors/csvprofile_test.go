@@ -0,0 +1,219 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// profileCSV profiles CSV data with the given options
+func profileCSV(t testing.TB, input string, options map[string]interface{}) (*ProcessResult, *CSVProfile) {
+	t.Helper()
+	result, err := NewCSVProcessor().Process(context.Background(), strings.NewReader(input), "data.csv",
+		ProcessOptions{ExtractMetadata: true, Options: options})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result, result.Data.(*CSVProfile)
+}
+
+// float64Ptr returns a pointer to f, as the profile's optional statistics are
+func float64Ptr(f float64) *float64 {
+	return &f
+}
+
+func TestCSVProfileColumns(t *testing.T) {
+	input := "id;price;ok;when;city;;empty\n" +
+		"1;1,5;yes;2024-03-06;Lisbon;x;\n" +
+		"2;2,5;no;2023-12-31;Porto;y;NA\n" +
+		"3;NA;yes;06.01.2025;Lisbon;z\n" +
+		"4;null;true;2024-01-01;Faro;w;;extra\n"
+	result, profile := profileCSV(t, input, map[string]interface{}{"topValues": 2})
+
+	if profile.Rows != 4 || profile.RaggedRows != 2 {
+		t.Errorf("Rows = %d, RaggedRows = %d, want 4 and 2", profile.Rows, profile.RaggedRows)
+	}
+
+	want := []ColumnProfile{
+		{Name: "id", Type: ColumnTypeInt, Count: 4, Distinct: 4, Min: int64(1), Max: int64(4),
+			Mean: float64Ptr(2.5), StdDev: float64Ptr(math.Sqrt(5.0 / 3))},
+		{Name: "price", Type: ColumnTypeFloat, Count: 2, Nulls: 2, Distinct: 2, Min: 1.5, Max: 2.5,
+			Mean: float64Ptr(2), StdDev: float64Ptr(math.Sqrt(0.5))},
+		{Name: "ok", Type: ColumnTypeBoolean, Count: 4, Distinct: 3,
+			TopValues: []ValueCount{{"yes", 2}, {"no", 1}}},
+		{Name: "when", Type: ColumnTypeDate, Count: 4, Distinct: 4, Min: "2023-12-31", Max: "06.01.2025"},
+		{Name: "city", Type: ColumnTypeString, Count: 4, Distinct: 3,
+			TopValues: []ValueCount{{"Lisbon", 2}, {"Faro", 1}}},
+		// Unnamed and late columns are numbered; ties are ordered by value
+		{Name: "column6", Type: ColumnTypeString, Count: 4, Distinct: 4,
+			TopValues: []ValueCount{{"w", 1}, {"x", 1}}},
+		{Name: "empty", Type: ColumnTypeEmpty, Nulls: 4},
+		{Name: "column8", Type: ColumnTypeString, Count: 1, Nulls: 3, Distinct: 1,
+			TopValues: []ValueCount{{"extra", 1}}},
+	}
+	if len(profile.Columns) != len(want) {
+		t.Fatalf("%d columns, want %d", len(profile.Columns), len(want))
+	}
+	for i, column := range profile.Columns {
+		// Compare the statistics with a tolerance, and the rest exactly
+		for _, stat := range []struct {
+			got, want *float64
+		}{{column.Mean, want[i].Mean}, {column.StdDev, want[i].StdDev}} {
+			if (stat.got == nil) != (stat.want == nil) || stat.got != nil && math.Abs(*stat.got-*stat.want) > 1e-9 {
+				t.Errorf("column %s: statistics %v/%v, want %v/%v", column.Name, column.Mean, column.StdDev, want[i].Mean, want[i].StdDev)
+			}
+		}
+		column.Mean, column.StdDev = want[i].Mean, want[i].StdDev
+		if !reflect.DeepEqual(column, want[i]) {
+			t.Errorf("column %d:\ngot  %+v\nwant %+v", i, column, want[i])
+		}
+	}
+
+	wantMetadata := map[string]string{
+		"rows":        "4",
+		"columns":     "8",
+		"delimiter":   ";",
+		"encoding":    EncodingUTF8,
+		"columnTypes": "int,float,boolean,date,string,string,empty,string",
+		"headers":     "id,price,ok,when,city,,empty",
+	}
+	if !reflect.DeepEqual(result.Metadata, wantMetadata) {
+		t.Errorf("metadata %v, want %v", result.Metadata, wantMetadata)
+	}
+}
+
+func TestCSVProfileWithoutHeader(t *testing.T) {
+	_, profile := profileCSV(t, "1,a\n2,b\n3,a\n", map[string]interface{}{"header": false})
+
+	if profile.Dialect.Header || profile.Rows != 3 {
+		t.Errorf("Header = %v, Rows = %d, want false and 3", profile.Dialect.Header, profile.Rows)
+	}
+	names := []string{profile.Columns[0].Name, profile.Columns[1].Name}
+	if !reflect.DeepEqual(names, []string{"column1", "column2"}) {
+		t.Errorf("column names %v", names)
+	}
+	if profile.Columns[0].Type != ColumnTypeInt || profile.Columns[0].Count != 3 {
+		t.Errorf("first column %+v", profile.Columns[0])
+	}
+}
+
+func TestCSVProfileTypeInference(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   string
+	}{
+		{"integers", []string{"1", "-20", "300"}, ColumnTypeInt},
+		{"integers and decimals", []string{"1", "2.5", "-3e2"}, ColumnTypeFloat},
+		{"infinity isn't a number", []string{"1", "Inf"}, ColumnTypeString},
+		{"booleans", []string{"true", "No", "YES", "false"}, ColumnTypeBoolean},
+		{"numbers aren't booleans", []string{"1", "0", "true"}, ColumnTypeString},
+		{"dates in several layouts", []string{"2024-03-06", "2024/03/07", "2024-03-08T10:00:00Z", "2024-03-09 10:00:00"}, ColumnTypeDate},
+		{"dates and text", []string{"2024-03-06", "soon"}, ColumnTypeString},
+		{"nulls only", []string{"", "N/A", "None", "NaN"}, ColumnTypeEmpty},
+		{"nulls are skipped", []string{"NULL", "5", ""}, ColumnTypeInt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, profile := profileCSV(t, "value,other\n"+strings.Join(tt.values, ",x\n")+",x\n", nil)
+			if got := profile.Columns[0].Type; got != tt.want {
+				t.Errorf("type %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCSVFloat(t *testing.T) {
+	tests := []struct {
+		value        string
+		decimalComma bool
+		want         float64
+		ok           bool
+	}{
+		{"1.5", false, 1.5, true},
+		{"1,5", false, 0, false},
+		{"1,5", true, 1.5, true},
+		{"1.5", true, 1.5, true},
+		{"1,000.5", true, 0, false},
+		{"1,2,3", true, 0, false},
+		{"-2e3", false, -2000, true},
+		{"NaN", false, 0, false},
+		{"1e400", false, 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseCSVFloat(tt.value, tt.decimalComma)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseCSVFloat(%q, %v) = %v, %v, want %v, %v", tt.value, tt.decimalComma, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCSVProfileDistinctEstimate(t *testing.T) {
+	const rows = csvMaxTrackedValues + 5000
+	var input strings.Builder
+	input.WriteString("id,group\n")
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(&input, "user-%d,g%d\n", i, i%3)
+	}
+	_, profile := profileCSV(t, input.String(), nil)
+
+	id := profile.Columns[0]
+	if !id.DistinctEstimated || id.TopValues != nil {
+		t.Errorf("id: DistinctEstimated = %v, TopValues = %v; want an estimate and no top values", id.DistinctEstimated, id.TopValues)
+	}
+	if errorRate := math.Abs(float64(id.Distinct-rows)) / rows; errorRate > 0.05 {
+		t.Errorf("id: estimated %d distinct values, want about %d", id.Distinct, rows)
+	}
+
+	group := profile.Columns[1]
+	if group.DistinctEstimated || group.Distinct != 3 || len(group.TopValues) != 3 {
+		t.Errorf("group: %+v, want 3 exactly counted values", group)
+	}
+}
+
+func TestHyperLogLog(t *testing.T) {
+	var empty hyperLogLog
+	if empty.estimate() != 0 {
+		t.Errorf("empty estimate %d", empty.estimate())
+	}
+
+	for _, n := range []int{1, 100, 1000, 50000, 200000} {
+		var h hyperLogLog
+		for i := 0; i < n; i++ {
+			value := fmt.Sprintf("value-%d", i)
+			h.add(value)
+			h.add(value) // Repeats don't count
+		}
+		// Three standard errors of 1.6%, and at least one for tiny counts
+		if got := h.estimate(); math.Abs(float64(got-n)) > math.Max(1, 0.05*float64(n)) {
+			t.Errorf("estimate for %d distinct values: %d", n, got)
+		}
+	}
+}
+
+func FuzzCSVProcessor(f *testing.F) {
+	f.Add([]byte("id;price;ok\n1;1,5;yes\n2;NA;no;extra\n3\n"))
+	f.Add([]byte("'a,b',c\n'd',e\n"))
+	f.Add([]byte("\xFF\xFEa\x00,\x00b\x00\n\x00"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		result, err := NewCSVProcessor().Process(context.Background(), bytes.NewReader(data), "", ProcessOptions{})
+		if err != nil {
+			return
+		}
+		profile := result.Data.(*CSVProfile)
+		for _, column := range profile.Columns {
+			if column.Count+column.Nulls != profile.Rows {
+				t.Errorf("column %s: %d values and %d nulls in %d rows", column.Name, column.Count, column.Nulls, profile.Rows)
+			}
+			if !column.DistinctEstimated && column.Distinct > column.Count {
+				t.Errorf("column %s: %d distinct of %d values", column.Name, column.Distinct, column.Count)
+			}
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package processors
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// DerivedFile is a file produced while processing another file, such as audio
+// extracted from a video. Derived files are stored next to the original and
+// linked to it so they can be found again later.
+type DerivedFile struct {
+	// Name is the file name to store the derived file under (e.g. "clip.mp3")
+	Name string
+
+	// Role identifies what the file is relative to the original (e.g. "audio")
+	Role string
+
+	// ContentType is the MIME type of the derived file
+	ContentType string
+
+	// Data is the content of the derived file
+	Data []byte
+
+	// Path, if set, is a temporary file holding the content instead of Data,
+	// for outputs too large to keep in memory such as stream segments. It is
+	// removed by the result's Cleanup.
+	Path string
+
+	// Metadata is extra metadata stored with the derived file (may be nil)
+	Metadata map[string]string
+}
+
+// FindDerived returns the derived file with the given role, if the result has one
+func (r *ProcessResult) FindDerived(role string) (DerivedFile, bool) {
+	for _, derived := range r.Derived {
+		if derived.Role == role {
+			return derived, true
+		}
+	}
+	return DerivedFile{}, false
+}
+
+// Open returns a reader for the content of the derived file and its size
+func (d DerivedFile) Open() (io.ReadCloser, int64, error) {
+	if d.Path == "" {
+		return ioutil.NopCloser(bytes.NewReader(d.Data)), int64(len(d.Data)), nil
+	}
+	file, err := os.Open(d.Path)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
+
+// ReadAll returns the content of the derived file
+func (d DerivedFile) ReadAll() ([]byte, error) {
+	if d.Path == "" {
+		return d.Data, nil
+	}
+	return ioutil.ReadFile(d.Path)
+}
+
+// Cleanup removes the temporary files holding the content of derived files.
+// Callers call it once the derived files are stored.
+func (r *ProcessResult) Cleanup() {
+	for _, derived := range r.Derived {
+		if derived.Path != "" {
+			os.Remove(derived.Path)
+		}
+	}
+	for _, dir := range r.tempDirs {
+		os.RemoveAll(dir)
+	}
+	r.tempDirs = nil
+}
@@ -8,4 +8,11 @@ var (
 	ErrQueueFull    = errors.New("task queue is full")
 	ErrTaskNotFound = errors.New("task not found")
 	ErrUnsupportedFileType = errors.New("unsupported file type")
+	ErrProcessorNotFound   = errors.New("processor not found or disabled")
+	ErrLeaseNotFound = errors.New("lease not found or expired")
+	ErrLeaseExpired  = errors.New("remote worker lease expired")
+	ErrToolMissing   = errors.New("required external tool is not available")
+	ErrFileTooLarge  = errors.New("file is too large to process in memory")
+	ErrUnsupportedConversion = errors.New("unsupported conversion")
+	ErrImageTooLarge = errors.New("image dimensions are too large")
 )
\ No newline at end of file
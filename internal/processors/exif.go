@@ -0,0 +1,355 @@
+package processors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// EXIF tags read by the image processor
+const (
+	// IFD0
+	exifTagDescription = 0x010E
+	exifTagMake        = 0x010F
+	exifTagModel       = 0x0110
+	exifTagOrientation = 0x0112
+	exifTagSoftware    = 0x0131
+	exifTagDateTime    = 0x0132
+	exifTagArtist      = 0x013B
+	exifTagCopyright   = 0x8298
+	exifTagExifIFD     = 0x8769
+	exifTagGPSIFD      = 0x8825
+
+	// Exif IFD
+	exifTagExposureTime     = 0x829A
+	exifTagFNumber          = 0x829D
+	exifTagISO              = 0x8827
+	exifTagDateTimeOriginal = 0x9003
+	exifTagOffsetOriginal   = 0x9011
+	exifTagFocalLength      = 0x920A
+	exifTagLensMake         = 0xA433
+	exifTagLensModel        = 0xA434
+
+	// GPS IFD
+	gpsTagLatitudeRef  = 0x0001
+	gpsTagLatitude     = 0x0002
+	gpsTagLongitudeRef = 0x0003
+	gpsTagLongitude    = 0x0004
+	gpsTagAltitudeRef  = 0x0005
+	gpsTagAltitude     = 0x0006
+)
+
+// EXIF value types and limits
+const (
+	exifTypeASCII     = 2
+	exifTypeShort     = 3
+	exifTypeLong      = 4
+	exifTypeRational  = 5
+	exifTypeSRational = 10
+	exifMaxIFDEntries = 1000
+	exifHeader        = "Exif\x00\x00"
+	exifDateLayout    = "2006:01:02 15:04:05"
+)
+
+// exifTag is the raw value of one EXIF tag
+type exifTag struct {
+	Type  uint16
+	Count uint32
+	Value []byte
+}
+
+// exifIFD is one image file directory, keyed by tag
+type exifIFD map[uint16]exifTag
+
+// exifData holds the directories of an EXIF block
+type exifData struct {
+	tiff  []byte // The TIFF structure; tag values are slices of it
+	order binary.ByteOrder
+	IFD0  exifIFD
+	Exif  exifIFD
+	GPS   exifIFD
+}
+
+// readEXIF finds and parses the EXIF block of a JPEG or PNG file, or the header of a TIFF file
+func readEXIF(data []byte) (*exifData, error) {
+	if len(data) > 4 && (bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*"))) {
+		return parseTIFFHeader(data)
+	}
+
+	var block []byte
+	if bytes.HasPrefix(data, []byte(pngSignature)) {
+		pngChunks(data, func(chunkType string, chunk []byte) bool {
+			if chunkType == "eXIf" {
+				block = chunk
+				return false
+			}
+			return true
+		})
+	} else {
+		jpegSegments(data, func(marker byte, segment []byte) bool {
+			if marker == jpegMarkerAPP1 && bytes.HasPrefix(segment, []byte(exifHeader)) {
+				block = segment[len(exifHeader):]
+				return false
+			}
+			return true
+		})
+	}
+
+	if block == nil {
+		return nil, fmt.Errorf("no EXIF data")
+	}
+	return parseTIFFHeader(block)
+}
+
+// parseTIFFHeader parses the TIFF structure EXIF data is stored in
+func parseTIFFHeader(tiff []byte) (*exifData, error) {
+	if len(tiff) < 8 {
+		return nil, fmt.Errorf("EXIF data too short")
+	}
+
+	x := &exifData{tiff: tiff}
+	switch string(tiff[:2]) {
+	case "II":
+		x.order = binary.LittleEndian
+	case "MM":
+		x.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid EXIF byte order")
+	}
+
+	var err error
+	if x.IFD0, err = x.readIFD(tiff, x.order.Uint32(tiff[4:])); err != nil {
+		return nil, err
+	}
+	// The Exif and GPS directories are optional; ignore them if they're damaged
+	if offset, ok := x.IFD0.uint(x.order, exifTagExifIFD); ok {
+		x.Exif, _ = x.readIFD(tiff, offset)
+	}
+	if offset, ok := x.IFD0.uint(x.order, exifTagGPSIFD); ok {
+		x.GPS, _ = x.readIFD(tiff, offset)
+	}
+	return x, nil
+}
+
+// readIFD reads the directory at offset
+func (x *exifData) readIFD(tiff []byte, offset uint32) (exifIFD, error) {
+	if int64(offset)+2 > int64(len(tiff)) {
+		return nil, fmt.Errorf("EXIF directory out of range")
+	}
+	count := int(x.order.Uint16(tiff[offset:]))
+	if count > exifMaxIFDEntries {
+		return nil, fmt.Errorf("EXIF directory too large")
+	}
+
+	ifd := make(exifIFD, count)
+	for i := 0; i < count; i++ {
+		entry := int(offset) + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		tag := exifTag{
+			Type:  x.order.Uint16(tiff[entry+2:]),
+			Count: x.order.Uint32(tiff[entry+4:]),
+		}
+
+		size := int64(exifTypeSize(tag.Type)) * int64(tag.Count)
+		if size == 0 {
+			continue
+		}
+		// Values of up to four bytes are stored in the entry itself
+		if size <= 4 {
+			tag.Value = tiff[entry+8 : entry+8+int(size)]
+		} else {
+			valueOffset := int64(x.order.Uint32(tiff[entry+8:]))
+			if valueOffset+size > int64(len(tiff)) {
+				continue
+			}
+			tag.Value = tiff[valueOffset : valueOffset+size]
+		}
+		ifd[x.order.Uint16(tiff[entry:])] = tag
+	}
+	return ifd, nil
+}
+
+// uint returns the value of a SHORT or LONG tag
+func (ifd exifIFD) uint(order binary.ByteOrder, id uint16) (uint32, bool) {
+	tag, ok := ifd[id]
+	if !ok {
+		return 0, false
+	}
+	switch tag.Type {
+	case exifTypeShort:
+		return uint32(order.Uint16(tag.Value)), true
+	case exifTypeLong:
+		return order.Uint32(tag.Value), true
+	}
+	return 0, false
+}
+
+// string returns the value of an ASCII tag
+func (ifd exifIFD) string(id uint16) string {
+	tag, ok := ifd[id]
+	if !ok || tag.Type != exifTypeASCII {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(tag.Value), "\x00"))
+}
+
+// rational returns the i-th value of a RATIONAL or SRATIONAL tag
+func (ifd exifIFD) rational(order binary.ByteOrder, id uint16, i int) (float64, bool) {
+	tag, ok := ifd[id]
+	if !ok || (tag.Type != exifTypeRational && tag.Type != exifTypeSRational) || len(tag.Value) < (i+1)*8 {
+		return 0, false
+	}
+	num, den := order.Uint32(tag.Value[i*8:]), order.Uint32(tag.Value[i*8+4:])
+	if den == 0 {
+		return 0, false
+	}
+	if tag.Type == exifTypeSRational {
+		return float64(int32(num)) / float64(int32(den)), true
+	}
+	return float64(num) / float64(den), true
+}
+
+// addMetadata adds the camera, exposure and location details to metadata.
+// Location is left out when withLocation is false.
+func (x *exifData) addMetadata(metadata map[string]string, withLocation bool) {
+	setMetadata(metadata, "cameraMake", x.IFD0.string(exifTagMake))
+	setMetadata(metadata, "cameraModel", x.IFD0.string(exifTagModel))
+	setMetadata(metadata, "software", x.IFD0.string(exifTagSoftware))
+	setMetadata(metadata, "description", x.IFD0.string(exifTagDescription))
+	setMetadata(metadata, "creator", x.IFD0.string(exifTagArtist))
+	setMetadata(metadata, "copyright", x.IFD0.string(exifTagCopyright))
+	setMetadata(metadata, "lensMake", x.Exif.string(exifTagLensMake))
+	setMetadata(metadata, "lensModel", x.Exif.string(exifTagLensModel))
+
+	if o := x.Orientation(); o != 1 {
+		metadata["orientation"] = fmt.Sprintf("%d", o)
+	}
+
+	if v, ok := x.Exif.rational(x.order, exifTagExposureTime, 0); ok && v > 0 {
+		if v < 1 {
+			metadata["exposureTime"] = fmt.Sprintf("1/%.0f", 1/v)
+		} else {
+			metadata["exposureTime"] = fmt.Sprintf("%gs", v)
+		}
+	}
+	if v, ok := x.Exif.rational(x.order, exifTagFNumber, 0); ok && v > 0 {
+		metadata["fNumber"] = fmt.Sprintf("f/%.1f", v)
+	}
+	if v, ok := x.Exif.rational(x.order, exifTagFocalLength, 0); ok && v > 0 {
+		metadata["focalLength"] = fmt.Sprintf("%gmm", math.Round(v*10)/10)
+	}
+	if v, ok := x.Exif.uint(x.order, exifTagISO); ok {
+		metadata["iso"] = fmt.Sprintf("%d", v)
+	}
+
+	// Prefer the time the photo was taken over the time the file was last changed
+	captured := x.Exif.string(exifTagDateTimeOriginal)
+	if captured == "" {
+		captured = x.IFD0.string(exifTagDateTime)
+	}
+	if t, err := time.Parse(exifDateLayout, captured); err == nil {
+		if offset := x.Exif.string(exifTagOffsetOriginal); offset != "" {
+			if withZone, err := time.Parse(exifDateLayout+"-07:00", captured+offset); err == nil {
+				t = withZone
+			}
+		}
+		metadata["captureTime"] = t.Format(time.RFC3339)
+	}
+
+	if !withLocation {
+		return
+	}
+	if lat, ok := x.gpsCoordinate(gpsTagLatitude, gpsTagLatitudeRef, "S"); ok {
+		if lon, ok := x.gpsCoordinate(gpsTagLongitude, gpsTagLongitudeRef, "W"); ok {
+			metadata["gpsLatitude"] = fmt.Sprintf("%.6f", lat)
+			metadata["gpsLongitude"] = fmt.Sprintf("%.6f", lon)
+		}
+	}
+	if alt, ok := x.GPS.rational(x.order, gpsTagAltitude, 0); ok {
+		// An altitude reference of 1 means below sea level
+		if ref, ok := x.GPS[gpsTagAltitudeRef]; ok && len(ref.Value) > 0 && ref.Value[0] == 1 {
+			alt = -alt
+		}
+		metadata["gpsAltitude"] = fmt.Sprintf("%.1f", alt)
+	}
+}
+
+// gpsCoordinate converts a degrees/minutes/seconds GPS tag to decimal degrees,
+// negative when the reference tag equals negativeRef
+func (x *exifData) gpsCoordinate(id, refID uint16, negativeRef string) (float64, bool) {
+	degrees, ok := x.GPS.rational(x.order, id, 0)
+	if !ok {
+		return 0, false
+	}
+	minutes, _ := x.GPS.rational(x.order, id, 1)
+	seconds, _ := x.GPS.rational(x.order, id, 2)
+
+	value := degrees + minutes/60 + seconds/3600
+	if x.GPS.string(refID) == negativeRef {
+		value = -value
+	}
+	return value, true
+}
+
+// HasLocation reports whether the EXIF data holds GPS information
+func (x *exifData) HasLocation() bool {
+	return x != nil && len(x.GPS) > 0
+}
+
+// stripLocation blanks the GPS directory in place, leaving the rest of the
+// EXIF data and all offsets untouched
+func (x *exifData) stripLocation() bool {
+	offset, ok := x.IFD0.uint(x.order, exifTagGPSIFD)
+	if !ok || int64(offset)+2 > int64(len(x.tiff)) {
+		return false
+	}
+
+	for _, tag := range x.GPS {
+		for i := range tag.Value {
+			tag.Value[i] = 0
+		}
+	}
+
+	// Zero the entries too and leave an empty directory behind
+	count := int(x.order.Uint16(x.tiff[offset:]))
+	end := int(offset) + 2 + count*12
+	if end > len(x.tiff) {
+		end = len(x.tiff)
+	}
+	for i := int(offset); i < end; i++ {
+		x.tiff[i] = 0
+	}
+	x.GPS = nil
+	return true
+}
+
+// Orientation returns the EXIF orientation (1-8), or 1 if it isn't set
+func (x *exifData) Orientation() int {
+	if x == nil {
+		return 1
+	}
+	if v, ok := x.IFD0.uint(x.order, exifTagOrientation); ok && v >= 1 && v <= 8 {
+		return int(v)
+	}
+	return 1
+}
+
+// exifTypeSize returns the size in bytes of one value of an EXIF type
+func exifTypeSize(t uint16) int {
+	switch t {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		return 1
+	case 3, 8: // SHORT, SSHORT
+		return 2
+	case 4, 9, 11: // LONG, SLONG, FLOAT
+		return 4
+	case 5, 10, 12: // RATIONAL, SRATIONAL, DOUBLE
+		return 8
+	}
+	return 0
+}
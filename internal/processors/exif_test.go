@@ -0,0 +1,267 @@
+package processors
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// testByteOrder is a byte order that can also append, as both TIFF byte
+// orders can
+type testByteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// testEXIFEntry is a tag written by buildTIFF
+type testEXIFEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// exifASCII builds an ASCII tag
+func exifASCII(tag uint16, s string) testEXIFEntry {
+	return testEXIFEntry{tag, exifTypeASCII, uint32(len(s) + 1), append([]byte(s), 0)}
+}
+
+// exifShort builds a SHORT tag
+func exifShort(order testByteOrder, tag uint16, n uint16) testEXIFEntry {
+	return testEXIFEntry{tag, exifTypeShort, 1, order.AppendUint16(nil, n)}
+}
+
+// exifRationals builds a RATIONAL tag from numerator, denominator pairs
+func exifRationals(order testByteOrder, tag uint16, pairs ...uint32) testEXIFEntry {
+	var value []byte
+	for _, n := range pairs {
+		value = order.AppendUint32(value, n)
+	}
+	return testEXIFEntry{tag, exifTypeRational, uint32(len(pairs) / 2), value}
+}
+
+// ifdSize is the size of a directory and the values stored after it
+func ifdSize(entries []testEXIFEntry) int {
+	size := 2 + 12*len(entries) + 4
+	for _, entry := range entries {
+		if len(entry.value) > 4 {
+			size += len(entry.value)
+		}
+	}
+	return size
+}
+
+// appendIFD writes a directory at the end of tiff, followed by its values
+func appendIFD(order testByteOrder, tiff []byte, entries []testEXIFEntry) []byte {
+	valueOffset := len(tiff) + 2 + 12*len(entries) + 4
+	var values []byte
+	tiff = order.AppendUint16(tiff, uint16(len(entries)))
+	for _, entry := range entries {
+		tiff = order.AppendUint16(tiff, entry.tag)
+		tiff = order.AppendUint16(tiff, entry.typ)
+		tiff = order.AppendUint32(tiff, entry.count)
+		if len(entry.value) <= 4 {
+			var inline [4]byte
+			copy(inline[:], entry.value)
+			tiff = append(tiff, inline[:]...)
+		} else {
+			tiff = order.AppendUint32(tiff, uint32(valueOffset+len(values)))
+			values = append(values, entry.value...)
+		}
+	}
+	tiff = order.AppendUint32(tiff, 0) // No next directory
+	return append(tiff, values...)
+}
+
+// buildTIFF builds the TIFF structure of an EXIF block with IFD0 and, if
+// they have entries, the Exif and GPS directories
+func buildTIFF(order testByteOrder, ifd0, exif, gps []testEXIFEntry) []byte {
+	if exif != nil {
+		ifd0 = append(ifd0, testEXIFEntry{exifTagExifIFD, exifTypeLong, 1, nil})
+	}
+	if gps != nil {
+		ifd0 = append(ifd0, testEXIFEntry{exifTagGPSIFD, exifTypeLong, 1, nil})
+	}
+	offset := 8 + ifdSize(ifd0)
+	for i := range ifd0 {
+		switch ifd0[i].tag {
+		case exifTagExifIFD:
+			ifd0[i].value = order.AppendUint32(nil, uint32(offset))
+			offset += ifdSize(exif)
+		case exifTagGPSIFD:
+			ifd0[i].value = order.AppendUint32(nil, uint32(offset))
+		}
+	}
+
+	tiff := []byte("II*\x00")
+	if order == binary.BigEndian {
+		tiff = []byte("MM\x00*")
+	}
+	tiff = order.AppendUint32(tiff, 8)
+	tiff = appendIFD(order, tiff, ifd0)
+	if exif != nil {
+		tiff = appendIFD(order, tiff, exif)
+	}
+	if gps != nil {
+		tiff = appendIFD(order, tiff, gps)
+	}
+	return tiff
+}
+
+// cameraTIFF is the EXIF data of a photo taken with a located camera
+func cameraTIFF(order testByteOrder) []byte {
+	return buildTIFF(order,
+		[]testEXIFEntry{
+			exifASCII(exifTagMake, "Canon"),
+			exifASCII(exifTagModel, "EOS 5D"),
+			exifShort(order, exifTagOrientation, 6),
+			exifASCII(exifTagDateTime, "2020:01:01 00:00:00"),
+			exifASCII(exifTagCopyright, "Photographer"),
+		},
+		[]testEXIFEntry{
+			exifRationals(order, exifTagExposureTime, 1, 250),
+			exifRationals(order, exifTagFNumber, 28, 10),
+			exifShort(order, exifTagISO, 200),
+			exifASCII(exifTagDateTimeOriginal, "2019:06:15 14:30:00"),
+			exifASCII(exifTagOffsetOriginal, "+02:00"),
+			exifRationals(order, exifTagFocalLength, 35, 1),
+			exifASCII(exifTagLensModel, "EF 35mm"),
+		},
+		[]testEXIFEntry{
+			exifASCII(gpsTagLatitudeRef, "N"),
+			exifRationals(order, gpsTagLatitude, 40, 1, 26, 1, 4644, 100),
+			exifASCII(gpsTagLongitudeRef, "W"),
+			exifRationals(order, gpsTagLongitude, 79, 1, 58, 1, 5616, 100),
+			{gpsTagAltitudeRef, 1, 1, []byte{1}},
+			exifRationals(order, gpsTagAltitude, 105, 2),
+		},
+	)
+}
+
+func TestReadEXIF(t *testing.T) {
+	want := map[string]string{
+		"cameraMake":   "Canon",
+		"cameraModel":  "EOS 5D",
+		"copyright":    "Photographer",
+		"lensModel":    "EF 35mm",
+		"orientation":  "6",
+		"exposureTime": "1/250",
+		"fNumber":      "f/2.8",
+		"focalLength":  "35mm",
+		"iso":          "200",
+		"captureTime":  "2019-06-15T14:30:00+02:00",
+		"gpsLatitude":  "40.446233",
+		"gpsLongitude": "-79.982267",
+		"gpsAltitude":  "-52.5",
+	}
+
+	for _, order := range []testByteOrder{binary.LittleEndian, binary.BigEndian} {
+		t.Run(order.String(), func(t *testing.T) {
+			exif, err := readEXIF(cameraTIFF(order))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exif.Orientation() != 6 || !exif.HasLocation() {
+				t.Errorf("Orientation() = %d, HasLocation() = %v", exif.Orientation(), exif.HasLocation())
+			}
+
+			metadata := make(map[string]string)
+			exif.addMetadata(metadata, true)
+			if !reflect.DeepEqual(metadata, want) {
+				t.Errorf("got  %v\nwant %v", metadata, want)
+			}
+
+			metadata = make(map[string]string)
+			exif.addMetadata(metadata, false)
+			for _, key := range []string{"gpsLatitude", "gpsLongitude", "gpsAltitude"} {
+				if _, ok := metadata[key]; ok {
+					t.Errorf("%s set without location", key)
+				}
+			}
+		})
+	}
+}
+
+func TestReadEXIFFallbacks(t *testing.T) {
+	order := binary.LittleEndian
+	exif, err := readEXIF(buildTIFF(order, []testEXIFEntry{
+		exifShort(order, exifTagOrientation, 9), // Out of range
+		exifASCII(exifTagDateTime, "2020:01:02 03:04:05"),
+	}, []testEXIFEntry{
+		exifRationals(order, exifTagExposureTime, 2, 1),
+		exifRationals(order, exifTagFNumber, 1, 0), // Zero denominator
+	}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata := make(map[string]string)
+	exif.addMetadata(metadata, true)
+	want := map[string]string{
+		"captureTime":  "2020-01-02T03:04:05Z",
+		"exposureTime": "2s",
+	}
+	if !reflect.DeepEqual(metadata, want) {
+		t.Errorf("got  %v\nwant %v", metadata, want)
+	}
+	if exif.Orientation() != 1 || exif.HasLocation() {
+		t.Errorf("Orientation() = %d, HasLocation() = %v", exif.Orientation(), exif.HasLocation())
+	}
+
+	var none *exifData
+	if none.Orientation() != 1 || none.HasLocation() {
+		t.Error("a nil exifData should have the default orientation and no location")
+	}
+}
+
+func TestReadEXIFErrors(t *testing.T) {
+	tiff := cameraTIFF(binary.LittleEndian)
+	tooLarge := append([]byte("II*\x00\x08\x00\x00\x00"), 0xFF, 0xFF)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"jpeg without exif", []byte{0xFF, 0xD8, 0xFF, 0xDA, 0, 2}},
+		{"png without exif", []byte(pngSignature)},
+		{"short tiff", []byte("II*\x00\x08")},
+		{"bad byte order", jpegWithSegments(nil, jpegSegment(jpegMarkerAPP1, []byte(exifHeader), []byte("XX"), tiff[2:]))},
+		{"directory out of range", []byte("II*\x00\xFF\x00\x00\x00")},
+		{"directory too large", tooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readEXIF(tt.data); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestReadEXIFSkipsBadValues(t *testing.T) {
+	order := binary.LittleEndian
+	tiff := buildTIFF(order, []testEXIFEntry{
+		exifASCII(exifTagMake, "Canon"),
+		exifASCII(exifTagModel, "Model name"),
+		{exifTagArtist, 99, 4, []byte("Nope")}, // Unknown type
+	}, nil, nil)
+	// Point the model's value past the end of the data
+	entry := 8 + 2 + 12
+	order.PutUint32(tiff[entry+8:], uint32(len(tiff)))
+
+	exif, err := readEXIF(tiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := exif.IFD0[exifTagModel]; ok {
+		t.Error("kept a value out of range")
+	}
+	if _, ok := exif.IFD0[exifTagArtist]; ok {
+		t.Error("kept a value of an unknown type")
+	}
+	if exif.IFD0.string(exifTagMake) != "Canon" {
+		t.Errorf("make = %q", exif.IFD0.string(exifTagMake))
+	}
+}
@@ -0,0 +1,343 @@
+package processors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MediaInfo is the structured data produced for audio and video files, read
+// from ffprobe
+type MediaInfo struct {
+	Format   MediaFormat    `json:"format"`
+	Streams  []MediaStream  `json:"streams"`
+	Chapters []MediaChapter `json:"chapters,omitempty"`
+	Tracks   []MediaTrack   `json:"tracks,omitempty"`   // Set when tracks are extracted
+	Loudness *Loudness      `json:"loudness,omitempty"` // Set when loudness is measured
+	Silences []Silence      `json:"silences,omitempty"`
+
+	// Tags read from the file itself, which don't need ffprobe
+	AudioTags *AudioTags `json:"audioTags,omitempty"`
+}
+
+// MediaFormat describes the container of a media file
+type MediaFormat struct {
+	Name     string            `json:"name"` // Comma-separated ffmpeg demuxer names, e.g. "mov,mp4,m4a,3gp,3g2,mj2"
+	LongName string            `json:"longName,omitempty"`
+	Duration float64           `json:"duration"` // In seconds
+	Size     int64             `json:"size"`
+	BitRate  int64             `json:"bitRate"` // In bit/s
+	Tags     map[string]string `json:"tags,omitempty"`
+}
+
+// MediaStream describes one stream of a media file
+type MediaStream struct {
+	Index         int     `json:"index"`
+	Type          string  `json:"type"` // video, audio, subtitle, data or attachment
+	Codec         string  `json:"codec"`
+	CodecLongName string  `json:"codecLongName,omitempty"`
+	Profile       string  `json:"profile,omitempty"`
+	BitRate       int64   `json:"bitRate,omitempty"`
+	Duration      float64 `json:"duration,omitempty"`
+	Language      string  `json:"language,omitempty"`
+	Title         string  `json:"title,omitempty"`
+	Default       bool    `json:"default"`
+
+	// Video streams
+	Width       int     `json:"width,omitempty"`  // As displayed, after rotation
+	Height      int     `json:"height,omitempty"` // As displayed, after rotation
+	FrameRate   float64 `json:"frameRate,omitempty"`
+	PixelFormat string  `json:"pixelFormat,omitempty"`
+	Rotation    int     `json:"rotation,omitempty"`    // Clockwise degrees: 0, 90, 180 or 270
+	AttachedPic bool    `json:"attachedPic,omitempty"` // Cover art rather than moving pictures
+
+	// Audio streams
+	SampleRate    int    `json:"sampleRate,omitempty"`
+	Channels      int    `json:"channels,omitempty"`
+	ChannelLayout string `json:"channelLayout,omitempty"`
+
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// MediaChapter is a chapter marker of a media file
+type MediaChapter struct {
+	Start float64 `json:"start"` // In seconds
+	End   float64 `json:"end"`   // In seconds
+	Title string  `json:"title,omitempty"`
+}
+
+// probeOutput mirrors the JSON written by ffprobe, whose numbers are mostly strings
+type probeOutput struct {
+	Format struct {
+		FormatName     string            `json:"format_name"`
+		FormatLongName string            `json:"format_long_name"`
+		Duration       string            `json:"duration"`
+		Size           string            `json:"size"`
+		BitRate        string            `json:"bit_rate"`
+		Tags           map[string]string `json:"tags"`
+	} `json:"format"`
+	Streams []struct {
+		Index         int               `json:"index"`
+		CodecType     string            `json:"codec_type"`
+		CodecName     string            `json:"codec_name"`
+		CodecLongName string            `json:"codec_long_name"`
+		Profile       string            `json:"profile"`
+		BitRate       string            `json:"bit_rate"`
+		Duration      string            `json:"duration"`
+		Width         int               `json:"width"`
+		Height        int               `json:"height"`
+		AvgFrameRate  string            `json:"avg_frame_rate"`
+		RFrameRate    string            `json:"r_frame_rate"`
+		PixFmt        string            `json:"pix_fmt"`
+		SampleRate    string            `json:"sample_rate"`
+		Channels      int               `json:"channels"`
+		ChannelLayout string            `json:"channel_layout"`
+		Disposition   map[string]int    `json:"disposition"`
+		Tags          map[string]string `json:"tags"`
+		SideDataList  []struct {
+			Rotation float64 `json:"rotation"`
+		} `json:"side_data_list"`
+	} `json:"streams"`
+	Chapters []struct {
+		StartTime string            `json:"start_time"`
+		EndTime   string            `json:"end_time"`
+		Tags      map[string]string `json:"tags"`
+	} `json:"chapters"`
+}
+
+// probeMedia runs ffprobe once over a media file and parses everything the
+// audio and video processors need
+func probeMedia(ctx context.Context, path string) (*MediaInfo, error) {
+	output, err := DefaultTools.Command(ctx, ToolFFprobe, "-v", "quiet", "-print_format", "json",
+		"-show_format", "-show_streams", "-show_chapters", path).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	return parseProbeOutput(output)
+}
+
+// parseProbeOutput converts ffprobe's JSON output into a MediaInfo
+func parseProbeOutput(output []byte) (*MediaInfo, error) {
+	var probe probeOutput
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+
+	info := &MediaInfo{
+		Format: MediaFormat{
+			Name:     probe.Format.FormatName,
+			LongName: probe.Format.FormatLongName,
+			Duration: parseFloat(probe.Format.Duration),
+			Size:     parseInt64(probe.Format.Size),
+			BitRate:  parseInt64(probe.Format.BitRate),
+			Tags:     lowerKeys(probe.Format.Tags),
+		},
+		Streams: make([]MediaStream, 0, len(probe.Streams)),
+	}
+
+	for _, s := range probe.Streams {
+		tags := lowerKeys(s.Tags)
+		stream := MediaStream{
+			Index:         s.Index,
+			Type:          s.CodecType,
+			Codec:         s.CodecName,
+			CodecLongName: s.CodecLongName,
+			Profile:       s.Profile,
+			BitRate:       parseInt64(s.BitRate),
+			Duration:      parseFloat(s.Duration),
+			Language:      tags["language"],
+			Title:         tags["title"],
+			Default:       s.Disposition["default"] == 1,
+			AttachedPic:   s.Disposition["attached_pic"] == 1,
+			Width:         s.Width,
+			Height:        s.Height,
+			PixelFormat:   s.PixFmt,
+			SampleRate:    int(parseInt64(s.SampleRate)),
+			Channels:      s.Channels,
+			ChannelLayout: s.ChannelLayout,
+			Tags:          tags,
+		}
+		if stream.Language == "und" {
+			stream.Language = ""
+		}
+
+		if s.CodecType == "video" {
+			stream.FrameRate = parseFrameRate(s.AvgFrameRate)
+			if stream.FrameRate == 0 {
+				stream.FrameRate = parseFrameRate(s.RFrameRate)
+			}
+
+			// Older files carry a clockwise rotate tag; newer ones a display
+			// matrix whose rotation is counterclockwise
+			rotation := int(parseInt64(tags["rotate"]))
+			for _, side := range s.SideDataList {
+				if side.Rotation != 0 {
+					rotation = -int(side.Rotation)
+				}
+			}
+			stream.Rotation = ((rotation % 360) + 360) % 360
+			if stream.Rotation == 90 || stream.Rotation == 270 {
+				stream.Width, stream.Height = stream.Height, stream.Width
+			}
+		}
+
+		info.Streams = append(info.Streams, stream)
+	}
+
+	for _, c := range probe.Chapters {
+		info.Chapters = append(info.Chapters, MediaChapter{
+			Start: parseFloat(c.StartTime),
+			End:   parseFloat(c.EndTime),
+			Title: lowerKeys(c.Tags)["title"],
+		})
+	}
+
+	return info, nil
+}
+
+// Stream returns the first stream of a type (video, audio or subtitle), preferring
+// one marked as default. Cover art doesn't count as video.
+func (m *MediaInfo) Stream(streamType string) (MediaStream, bool) {
+	var first *MediaStream
+	for i := range m.Streams {
+		stream := &m.Streams[i]
+		if stream.Type != streamType || stream.AttachedPic {
+			continue
+		}
+		if stream.Default {
+			return *stream, true
+		}
+		if first == nil {
+			first = stream
+		}
+	}
+	if first == nil {
+		return MediaStream{}, false
+	}
+	return *first, true
+}
+
+// StreamsOf returns all the streams of a type, leaving out cover art
+func (m *MediaInfo) StreamsOf(streamType string) []MediaStream {
+	var streams []MediaStream
+	for _, stream := range m.Streams {
+		if stream.Type == streamType && !stream.AttachedPic {
+			streams = append(streams, stream)
+		}
+	}
+	return streams
+}
+
+// addMetadata flattens the probe into metadata. Container tags are added as
+// "tag.<name>".
+func (m *MediaInfo) addMetadata(metadata map[string]string) {
+	metadata["container"] = m.Format.Name
+	if m.Format.Duration > 0 {
+		metadata["duration"] = strconv.FormatFloat(m.Format.Duration, 'f', 3, 64)
+	}
+	if m.Format.BitRate > 0 {
+		metadata["bitrate"] = strconv.FormatInt(m.Format.BitRate, 10)
+	}
+
+	if video, ok := m.Stream("video"); ok {
+		metadata["videoCodec"] = video.Codec
+		metadata["width"] = strconv.Itoa(video.Width)
+		metadata["height"] = strconv.Itoa(video.Height)
+		metadata["resolution"] = fmt.Sprintf("%dx%d", video.Width, video.Height)
+		if video.FrameRate > 0 {
+			metadata["frameRate"] = strconv.FormatFloat(video.FrameRate, 'f', -1, 64)
+		}
+		setMetadata(metadata, "pixelFormat", video.PixelFormat)
+		if video.Rotation != 0 {
+			metadata["rotation"] = strconv.Itoa(video.Rotation)
+		}
+	}
+
+	if audio, ok := m.Stream("audio"); ok {
+		metadata["audioCodec"] = audio.Codec
+		if audio.SampleRate > 0 {
+			metadata["sample_rate"] = strconv.Itoa(audio.SampleRate)
+		}
+		if audio.Channels > 0 {
+			metadata["channels"] = strconv.Itoa(audio.Channels)
+		}
+		setMetadata(metadata, "channelLayout", audio.ChannelLayout)
+		if audio.BitRate > 0 {
+			metadata["audioBitrate"] = strconv.FormatInt(audio.BitRate, 10)
+		}
+	}
+
+	for _, streamType := range []string{"video", "audio", "subtitle"} {
+		streams := m.StreamsOf(streamType)
+		if len(streams) == 0 {
+			continue
+		}
+		metadata[streamType+"Tracks"] = strconv.Itoa(len(streams))
+		if languages := streamLanguages(streams); languages != "" && streamType != "video" {
+			metadata[streamType+"Languages"] = languages
+		}
+	}
+
+	if len(m.Chapters) > 0 {
+		metadata["chapters"] = strconv.Itoa(len(m.Chapters))
+	}
+	for key, value := range m.Format.Tags {
+		metadata["tag."+key] = value
+	}
+}
+
+// streamLanguages lists the distinct languages of streams, comma-separated
+func streamLanguages(streams []MediaStream) string {
+	seen := make(map[string]bool)
+	var languages []string
+	for _, stream := range streams {
+		if stream.Language != "" && !seen[stream.Language] {
+			seen[stream.Language] = true
+			languages = append(languages, stream.Language)
+		}
+	}
+	sort.Strings(languages)
+	return strings.Join(languages, ",")
+}
+
+// parseFrameRate parses an ffprobe rate such as "30000/1001"
+func parseFrameRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	if !ok {
+		return parseFloat(rate)
+	}
+	d := parseFloat(den)
+	if d == 0 {
+		return 0
+	}
+	// Round to what people write: 29.97, 23.976, 25
+	r, _ := strconv.ParseFloat(strconv.FormatFloat(parseFloat(num)/d, 'f', 3, 64), 64)
+	return r
+}
+
+// parseFloat parses a number written by ffprobe, 0 if it is missing or "N/A"
+func parseFloat(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+// parseInt64 parses an integer written by ffprobe, 0 if it is missing or "N/A"
+func parseInt64(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
+
+// lowerKeys returns tags with lower-case keys, as containers disagree on case
+func lowerKeys(tags map[string]string) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	lowered := make(map[string]string, len(tags))
+	for key, value := range tags {
+		lowered[strings.ToLower(key)] = value
+	}
+	return lowered
+}
@@ -0,0 +1,171 @@
+package processors
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// probeFixture parses the ffprobe output of a video with a rotated picture,
+// two audio tracks, subtitles, cover art and chapters
+func probeFixture(t *testing.T) *MediaInfo {
+	t.Helper()
+	output, err := os.ReadFile(filepath.Join("testdata", "ffprobe_video.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := parseProbeOutput(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func TestParseProbeOutput(t *testing.T) {
+	info := probeFixture(t)
+
+	wantFormat := MediaFormat{
+		Name:     "mov,mp4,m4a,3gp,3g2,mj2",
+		LongName: "QuickTime / MOV",
+		Duration: 125.125,
+		Size:     73461504,
+		BitRate:  4696934,
+		Tags:     map[string]string{"major_brand": "isom", "title": "Onboarding", "encoder": "Lavf60.3.100"},
+	}
+	if !reflect.DeepEqual(info.Format, wantFormat) {
+		t.Errorf("Format = %+v, want %+v", info.Format, wantFormat)
+	}
+
+	if len(info.Streams) != 5 {
+		t.Fatalf("got %d streams, want 5", len(info.Streams))
+	}
+	video := info.Streams[0]
+	// The display matrix turns the picture a quarter counterclockwise, so it
+	// is shown rotated 90 degrees clockwise, in portrait
+	if video.Type != "video" || video.Codec != "h264" || video.Profile != "High" || video.Width != 1080 || video.Height != 1920 ||
+		video.Rotation != 90 || video.FrameRate != 29.97 || video.PixelFormat != "yuv420p" || video.BitRate != 4500000 ||
+		!video.Default || video.Language != "" {
+		t.Errorf("video stream = %+v", video)
+	}
+
+	stereo, surround := info.Streams[1], info.Streams[2]
+	if stereo.Type != "audio" || stereo.SampleRate != 48000 || stereo.Channels != 2 || stereo.ChannelLayout != "stereo" ||
+		stereo.Language != "eng" || stereo.Title != "Stereo" || stereo.Default {
+		t.Errorf("stereo stream = %+v", stereo)
+	}
+	// Tag names are matched whatever their case
+	if surround.Language != "fre" || surround.Channels != 6 || !surround.Default {
+		t.Errorf("surround stream = %+v", surround)
+	}
+
+	subtitle := info.Streams[3]
+	if subtitle.Type != "subtitle" || subtitle.Codec != "mov_text" || subtitle.Language != "spa" || subtitle.Duration != 0 {
+		t.Errorf("subtitle stream = %+v", subtitle)
+	}
+	// A 0/0 average rate falls back to the real base rate
+	if cover := info.Streams[4]; !cover.AttachedPic || cover.FrameRate != 90000 {
+		t.Errorf("cover stream = %+v", cover)
+	}
+
+	wantChapters := []MediaChapter{{Start: 0, End: 60, Title: "Introduction"}, {Start: 60, End: 125.125, Title: "Demo"}}
+	if !reflect.DeepEqual(info.Chapters, wantChapters) {
+		t.Errorf("Chapters = %+v, want %+v", info.Chapters, wantChapters)
+	}
+
+	if _, err := parseProbeOutput([]byte("ffprobe: not json")); err == nil {
+		t.Error("expected an error for output that isn't JSON")
+	}
+}
+
+func TestMediaInfoStreams(t *testing.T) {
+	info := probeFixture(t)
+
+	// The stream marked as default wins over the first one
+	if audio, ok := info.Stream("audio"); !ok || audio.Index != 2 {
+		t.Errorf("Stream(audio) = %+v, want the default surround track", audio)
+	}
+	// Without a default, the first one is taken; cover art is never the video
+	if subtitle, ok := info.Stream("subtitle"); !ok || subtitle.Index != 3 {
+		t.Errorf("Stream(subtitle) = %+v", subtitle)
+	}
+	if videos := info.StreamsOf("video"); len(videos) != 1 || videos[0].Index != 0 {
+		t.Errorf("StreamsOf(video) = %+v, want only the moving picture", videos)
+	}
+	if _, ok := info.Stream("data"); ok {
+		t.Error("Stream(data) found a stream")
+	}
+
+	coverOnly := &MediaInfo{Streams: []MediaStream{{Type: "video", AttachedPic: true, Default: true}}}
+	if _, ok := coverOnly.Stream("video"); ok {
+		t.Error("cover art was taken as the video stream")
+	}
+}
+
+func TestMediaInfoMetadata(t *testing.T) {
+	metadata := make(map[string]string)
+	probeFixture(t).addMetadata(metadata)
+
+	want := map[string]string{
+		"container":         "mov,mp4,m4a,3gp,3g2,mj2",
+		"duration":          "125.125",
+		"bitrate":           "4696934",
+		"videoCodec":        "h264",
+		"width":             "1080",
+		"height":            "1920",
+		"resolution":        "1080x1920",
+		"frameRate":         "29.97",
+		"pixelFormat":       "yuv420p",
+		"rotation":          "90",
+		"audioCodec":        "ac3",
+		"sample_rate":       "48000",
+		"channels":          "6",
+		"channelLayout":     "5.1(side)",
+		"audioBitrate":      "384000",
+		"videoTracks":       "1",
+		"audioTracks":       "2",
+		"audioLanguages":    "eng,fre",
+		"subtitleTracks":    "1",
+		"subtitleLanguages": "spa",
+		"chapters":          "2",
+		"tag.major_brand":   "isom",
+		"tag.title":         "Onboarding",
+		"tag.encoder":       "Lavf60.3.100",
+	}
+	if !reflect.DeepEqual(metadata, want) {
+		t.Errorf("metadata = %v, want %v", metadata, want)
+	}
+}
+
+func TestParseFrameRate(t *testing.T) {
+	tests := map[string]float64{
+		"30000/1001": 29.97,
+		"24000/1001": 23.976,
+		"25/1":       25,
+		"0/0":        0,
+		"12.5":       12.5,
+		"":           0,
+		"N/A":        0,
+	}
+	for rate, want := range tests {
+		if got := parseFrameRate(rate); got != want {
+			t.Errorf("parseFrameRate(%q) = %v, want %v", rate, got, want)
+		}
+	}
+}
+
+func TestProbeRotationTag(t *testing.T) {
+	// Older files carry a clockwise rotate tag instead of a display matrix
+	info, err := parseProbeOutput([]byte(`{"streams": [{"codec_type": "video", "width": 640, "height": 480,
+		"tags": {"rotate": "270"}}, {"codec_type": "video", "width": 640, "height": 480,
+		"tags": {"rotate": "180"}}], "format": {}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := info.Streams[0]; s.Rotation != 270 || s.Width != 480 || s.Height != 640 {
+		t.Errorf("stream rotated 270 = %+v, want 480x640", s)
+	}
+	if s := info.Streams[1]; s.Rotation != 180 || s.Width != 640 || s.Height != 480 {
+		t.Errorf("stream rotated 180 = %+v, want 640x480", s)
+	}
+}
@@ -10,11 +10,19 @@ import (
 	_ "image/jpeg"
 	_ "image/png"
 	"io"
-	"io/ioutil"
 	"path/filepath"
 	"strings"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
 )
 
+// DefaultMaxImagePixels is the largest image, in pixels, that is decoded.
+// Decoding allocates about 4 bytes per pixel, and a small compressed file
+// can declare enormous dimensions.
+var DefaultMaxImagePixels int64 = 100 * 1000 * 1000
+
 // ImageProcessor processes image files
 type ImageProcessor struct{}
 
@@ -25,16 +33,21 @@ func NewImageProcessor() *ImageProcessor {
 
 // Process processes an image file
 func (p *ImageProcessor) Process(ctx context.Context, reader io.Reader, filename string, options ProcessOptions) (*ProcessResult, error) {
-	// Read the entire image into memory
-	data, err := ioutil.ReadAll(reader)
+	// Read the entire image into memory, up to the memory limit
+	data, err := readAllLimited(reader, options.memoryLimit())
 	if (err != nil) {
 		return nil, fmt.Errorf("failed to read image: %w", err)
 	}
 
+	// SVG images are vector markup, described without rasterizing them
+	if isSVG(data) {
+		return processSVG(data, filename, options)
+	}
+
 	// Decode the image
-	img, format, err := image.Decode(bytes.NewReader(data))
+	img, format, err := decodeImage(data)
 	if (err != nil) {
-		return nil, fmt.Errorf("failed to decode image: %w", err)
+		return nil, err
 	}
 
 	result := &ProcessResult{
@@ -42,6 +55,10 @@ func (p *ImageProcessor) Process(ctx context.Context, reader io.Reader, filename
 		Data:     img,
 	}
 
+	// EXIF data is optional; a nil value reports no orientation or fields
+	exif, _ := readEXIF(data)
+	upright := applyOrientation(img, exif.Orientation())
+
 	// Get image dimensions
 	bounds := img.Bounds()
 	width := bounds.Max.X - bounds.Min.X
@@ -59,18 +76,63 @@ func (p *ImageProcessor) Process(ctx context.Context, reader io.Reader, filename
 		
 		// Add file extension
 		result.Metadata["extension"] = strings.ToLower(filepath.Ext(filename))
+
+		// Camera, exposure, location and rights from the EXIF, IPTC and XMP blocks
+		addImageMetadata(result.Metadata, data, exif, !options.Bool("stripLocation"))
+
+		// Perceptual hashes of the upright image, for finding near-duplicates
+		result.Metadata[MetadataPHash] = FormatImageHash(PerceptualHash(upright))
+		result.Metadata[MetadataDHash] = FormatImageHash(DifferenceHash(upright))
 	}
 
-	// Generate preview
+	// Generate thumbnails, turned upright according to the EXIF orientation
 	if options.GeneratePreview {
-		// For preview, we'll use the original image data
-		// In a real application, you might want to resize or compress it
-		result.Preview = data
+		format := options.String("thumbnailFormat", "")
+		quality := options.Int("thumbnailQuality", defaultThumbnailQuality)
+		base := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+
+		for _, size := range thumbnailSizes(options) {
+			thumb, contentType, err := encodeImage(resizeToFit(upright, size, size), format, quality)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create thumbnail: %w", err)
+			}
+			result.Derived = append(result.Derived, DerivedFile{
+				Name:        fmt.Sprintf("%s_%d%s", base, size, thumbnailExt(contentType)),
+				Role:        ThumbnailRole(size),
+				ContentType: contentType,
+				Data:        thumb,
+			})
+		}
+
+		// The preview is a thumbnail made small enough to fit in MaxPreviewSize
+		maxSize := options.MaxPreviewSize
+		if maxSize <= 0 {
+			maxSize = 64 * 1024 // Default to 64KB; images don't fit in the usual 1KB
+		}
+		previewSize := options.Int("previewSize", DefaultThumbnailSizes[0])
+		preview, _, err := encodeWithin(resizeToFit(upright, previewSize, previewSize), format, maxSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create preview: %w", err)
+		}
+		result.Preview = preview
 	}
 
 	return result, nil
 }
 
+// thumbnailExt returns the file extension for a thumbnail content type
+func thumbnailExt(contentType string) string {
+	if contentType == "image/png" {
+		return ".png"
+	}
+	return ".jpg"
+}
+
+// Name returns the processor name
+func (p *ImageProcessor) Name() string {
+	return "image"
+}
+
 // CanProcess returns true if this processor can process the given content type
 func (p *ImageProcessor) CanProcess(contentType, ext string) bool {
 	// Check content type
@@ -80,7 +142,7 @@ func (p *ImageProcessor) CanProcess(contentType, ext string) bool {
 
 	// Check file extension
 	normalizedExt := strings.ToLower(ext)
-	imageExts := []string{".jpg", ".jpeg", ".png", ".gif", ".bmp", ".webp"}
+	imageExts := []string{".jpg", ".jpeg", ".png", ".gif", ".bmp", ".webp", ".tif", ".tiff", ".svg"}
 	for _, imgExt := range imageExts {
 		if normalizedExt == imgExt {
 			return true
@@ -92,5 +154,24 @@ func (p *ImageProcessor) CanProcess(contentType, ext string) bool {
 
 // init registers the processor with the registry
 func init() {
-	Register(NewImageProcessor(), "image/jpeg", "image/png", "image/gif", "image/bmp", "image/webp")
-}
\ No newline at end of file
+	Register(NewImageProcessor(), "image/jpeg", "image/png", "image/gif", "image/bmp", "image/webp",
+		"image/tiff", "image/svg+xml")
+}
+// decodeImage decodes an image, checking the dimensions in its header first
+// so that images above DefaultMaxImagePixels fail with ErrImageTooLarge
+// before any pixels are allocated
+func decodeImage(data []byte) (image.Image, string, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	if pixels := int64(config.Width) * int64(config.Height); pixels > DefaultMaxImagePixels {
+		return nil, "", fmt.Errorf("%w: %dx%d pixels, at most %d allowed", ErrImageTooLarge, config.Width, config.Height, DefaultMaxImagePixels)
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, format, nil
+}
@@ -0,0 +1,102 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+// encodedBMP and encodedTIFF encode testImage
+func encodedBMP(t testing.TB) []byte {
+	var buf bytes.Buffer
+	if err := bmp.Encode(&buf, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodedTIFF(t testing.TB) []byte {
+	var buf bytes.Buffer
+	if err := tiff.Encode(&buf, testImage(), &tiff.Options{Compression: tiff.Deflate}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImageProcessorFormats(t *testing.T) {
+	// Go has no WebP encoder, so the WebP image is a fixture
+	webp, err := os.ReadFile(filepath.Join("testdata", "gopher.lossless.webp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		filename string
+		data     []byte
+		format   string
+		width    string
+		height   string
+	}{
+		{"gradient.jpg", encodedJPEG(t), "jpeg", "16", "16"},
+		{"gradient.png", encodedPNG(t), "png", "16", "16"},
+		{"gradient.bmp", encodedBMP(t), "bmp", "16", "16"},
+		{"gradient.tiff", encodedTIFF(t), "tiff", "16", "16"},
+		{"gopher.webp", webp, "webp", "75", "100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			options := ProcessOptions{ExtractMetadata: true, GeneratePreview: true, Options: map[string]interface{}{"thumbnailSizes": "8"}}
+			result, err := NewImageProcessor().Process(context.Background(), bytes.NewReader(tt.data), tt.filename, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Metadata["format"] != tt.format || result.Metadata["width"] != tt.width || result.Metadata["height"] != tt.height {
+				t.Errorf("metadata = %v, want a %sx%s %s image", result.Metadata, tt.width, tt.height, tt.format)
+			}
+			if result.Metadata[MetadataPHash] == "" {
+				t.Error("no perceptual hash")
+			}
+			if len(result.Derived) != 1 || len(result.Preview) == 0 {
+				t.Errorf("got %d thumbnails and a %d byte preview", len(result.Derived), len(result.Preview))
+			}
+		})
+	}
+}
+
+func TestImageProcessorCanProcess(t *testing.T) {
+	p := NewImageProcessor()
+	for _, ext := range []string{".jpg", ".PNG", ".bmp", ".webp", ".tif", ".tiff", ".svg"} {
+		if !p.CanProcess("", ext) {
+			t.Errorf("CanProcess(%q) = false", ext)
+		}
+	}
+	if !p.CanProcess("image/webp", "") || p.CanProcess("text/plain", ".txt") {
+		t.Error("CanProcess doesn't go by the content type")
+	}
+}
+
+func TestDecodeImageTooLarge(t *testing.T) {
+	previous := DefaultMaxImagePixels
+	DefaultMaxImagePixels = 100
+	t.Cleanup(func() { DefaultMaxImagePixels = previous })
+
+	// The header alone gives the image away
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 11, 10))); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := decodeImage(buf.Bytes()); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("err = %v, want ErrImageTooLarge", err)
+	}
+	if _, _, err := decodeImage(encodedBMP(t)[:20]); err == nil || errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("truncated header: err = %v, want a decoding error", err)
+	}
+}
@@ -0,0 +1,330 @@
+package processors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"hash/crc32"
+	"regexp"
+	"strings"
+)
+
+// Markers and signatures of the image containers metadata is read from
+const (
+	jpegMarkerAPP1      = 0xE1
+	jpegMarkerAPP13     = 0xED
+	jpegMarkerStartScan = 0xDA
+	pngSignature        = "\x89PNG\r\n\x1a\n"
+	xmpHeader           = "http://ns.adobe.com/xap/1.0/\x00"
+	xmpPNGKeyword       = "XML:com.adobe.xmp"
+	photoshopHeader     = "Photoshop 3.0\x00"
+	iptcResourceID      = 0x0404
+)
+
+// iptcFields maps IPTC IIM application record (2:xx) datasets to metadata keys
+var iptcFields = map[byte]string{
+	5:   "title",
+	25:  "keywords",
+	80:  "creator",
+	90:  "city",
+	101: "country",
+	105: "headline",
+	116: "copyright",
+	120: "description",
+}
+
+// xmpFields maps XMP properties (namespace URI + local name) to metadata keys
+var xmpFields = map[string]string{
+	"http://purl.org/dc/elements/1.1/title":         "title",
+	"http://purl.org/dc/elements/1.1/creator":       "creator",
+	"http://purl.org/dc/elements/1.1/rights":        "copyright",
+	"http://purl.org/dc/elements/1.1/description":   "description",
+	"http://purl.org/dc/elements/1.1/subject":       "keywords",
+	"http://ns.adobe.com/xap/1.0/Rating":            "rating",
+	"http://ns.adobe.com/xap/1.0/CreatorTool":       "software",
+	"http://ns.adobe.com/photoshop/1.0/City":        "city",
+	"http://ns.adobe.com/photoshop/1.0/Country":     "country",
+	"http://ns.adobe.com/photoshop/1.0/Headline":    "headline",
+	"http://ns.adobe.com/exif/1.0/aux/Lens":         "lensModel",
+	"http://ns.adobe.com/exif/1.0/aux/SerialNumber": "cameraSerial",
+}
+
+// xmpLocation matches GPS properties in an XMP packet, as attributes or elements
+var xmpLocation = regexp.MustCompile(`(exif:GPS\w+=")([^"]*)(")|(<exif:GPS\w+>)([^<]*)(</exif:GPS\w+>)`)
+
+// addImageMetadata adds the EXIF, IPTC and XMP metadata of an image to
+// metadata. When the same field is in several blocks, EXIF wins over IPTC,
+// and IPTC over XMP. Location is left out when withLocation is false.
+func addImageMetadata(metadata map[string]string, data []byte, exif *exifData, withLocation bool) {
+	if exif != nil {
+		exif.addMetadata(metadata, withLocation)
+		if exif.HasLocation() && withLocation {
+			metadata["hasLocation"] = "true"
+		}
+	}
+
+	for key, value := range readIPTC(data) {
+		setMetadata(metadata, key, value)
+	}
+	for key, value := range readXMP(data) {
+		setMetadata(metadata, key, value)
+	}
+}
+
+// setMetadata sets a metadata value unless it is empty or the key is already set
+func setMetadata(metadata map[string]string, key, value string) {
+	if value == "" {
+		return
+	}
+	if _, exists := metadata[key]; !exists {
+		metadata[key] = value
+	}
+}
+
+// jpegSegments calls fn with the marker and payload of each JPEG segment
+// before the image data, until fn returns false
+func jpegSegments(data []byte, fn func(marker byte, segment []byte) bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return
+	}
+
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return
+		}
+		marker := data[pos+1]
+		if marker == jpegMarkerStartScan {
+			return
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return
+		}
+		if !fn(marker, data[pos+4:pos+2+length]) {
+			return
+		}
+		pos += 2 + length
+	}
+}
+
+// pngChunks calls fn with the type and data of each PNG chunk, until fn returns false
+func pngChunks(data []byte, fn func(chunkType string, chunk []byte) bool) {
+	if !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return
+	}
+
+	pos := len(pngSignature)
+	for pos+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		if length < 0 || pos+12+length > len(data) {
+			return
+		}
+		chunkType := string(data[pos+4 : pos+8])
+		if !fn(chunkType, data[pos+8:pos+8+length]) || chunkType == "IEND" {
+			return
+		}
+		pos += 12 + length
+	}
+}
+
+// readIPTC reads the IPTC fields stored in the Photoshop segment of a JPEG
+func readIPTC(data []byte) map[string]string {
+	fields := make(map[string]string)
+	jpegSegments(data, func(marker byte, segment []byte) bool {
+		if marker != jpegMarkerAPP13 || !bytes.HasPrefix(segment, []byte(photoshopHeader)) {
+			return true
+		}
+		if iim := photoshopResource(segment[len(photoshopHeader):], iptcResourceID); iim != nil {
+			parseIIM(iim, fields)
+		}
+		return false
+	})
+	return fields
+}
+
+// photoshopResource returns the data of the image resource block with the given ID
+func photoshopResource(data []byte, id uint16) []byte {
+	pos := 0
+	for pos+12 <= len(data) {
+		if string(data[pos:pos+4]) != "8BIM" {
+			return nil
+		}
+		resourceID := binary.BigEndian.Uint16(data[pos+4:])
+
+		// The name is a Pascal string padded to an even length
+		nameLength := int(data[pos+6]) + 1
+		if nameLength%2 != 0 {
+			nameLength++
+		}
+		sizePos := pos + 6 + nameLength
+		if sizePos+4 > len(data) {
+			return nil
+		}
+		size := int(binary.BigEndian.Uint32(data[sizePos:]))
+		start := sizePos + 4
+		if size < 0 || start+size > len(data) {
+			return nil
+		}
+		if resourceID == id {
+			return data[start : start+size]
+		}
+
+		pos = start + size
+		if size%2 != 0 {
+			pos++
+		}
+	}
+	return nil
+}
+
+// parseIIM reads the application record datasets of IPTC IIM data into fields.
+// Repeated datasets such as keywords are joined with commas.
+func parseIIM(data []byte, fields map[string]string) {
+	pos := 0
+	for pos+5 <= len(data) && data[pos] == 0x1C {
+		record, dataset := data[pos+1], data[pos+2]
+		size := int(binary.BigEndian.Uint16(data[pos+3:]))
+		// Extended datasets (high bit set) aren't used for text fields
+		if size&0x8000 != 0 || pos+5+size > len(data) {
+			return
+		}
+		value := strings.TrimSpace(string(data[pos+5 : pos+5+size]))
+
+		if key, ok := iptcFields[dataset]; ok && record == 2 && value != "" {
+			if existing := fields[key]; existing != "" {
+				value = existing + ", " + value
+			}
+			fields[key] = value
+		}
+		pos += 5 + size
+	}
+}
+
+// xmpPacket returns the XMP packet of a JPEG or PNG file
+func xmpPacket(data []byte) []byte {
+	var packet []byte
+	jpegSegments(data, func(marker byte, segment []byte) bool {
+		if marker == jpegMarkerAPP1 && bytes.HasPrefix(segment, []byte(xmpHeader)) {
+			packet = segment[len(xmpHeader):]
+			return false
+		}
+		return true
+	})
+	pngChunks(data, func(chunkType string, chunk []byte) bool {
+		if chunkType == "iTXt" && bytes.HasPrefix(chunk, []byte(xmpPNGKeyword+"\x00")) {
+			packet = pngXMPText(chunk)
+			return false
+		}
+		return true
+	})
+	return packet
+}
+
+// pngXMPText returns the text of an uncompressed iTXt chunk
+func pngXMPText(chunk []byte) []byte {
+	// keyword\0 compressionFlag compressionMethod language\0 translatedKeyword\0 text
+	rest := chunk[len(xmpPNGKeyword)+1:]
+	if len(rest) < 2 || rest[0] != 0 {
+		return nil
+	}
+	rest = rest[2:]
+	for i := 0; i < 2; i++ {
+		end := bytes.IndexByte(rest, 0)
+		if end < 0 {
+			return nil
+		}
+		rest = rest[end+1:]
+	}
+	return rest
+}
+
+// readXMP reads the fields of an image's XMP packet. Properties may be
+// attributes of rdf:Description or elements; list values are joined with commas.
+func readXMP(data []byte) map[string]string {
+	fields := make(map[string]string)
+	packet := xmpPacket(data)
+	if packet == nil {
+		return fields
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+	var current string
+	var parts []string
+	depth := 0
+
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			for _, attr := range t.Attr {
+				if key, ok := xmpFields[attr.Name.Space+attr.Name.Local]; ok {
+					setMetadata(fields, key, strings.TrimSpace(attr.Value))
+				}
+			}
+			if current != "" {
+				depth++
+			} else if key, ok := xmpFields[t.Name.Space+t.Name.Local]; ok {
+				current, parts, depth = key, nil, 1
+			}
+		case xml.CharData:
+			if value := strings.TrimSpace(string(t)); current != "" && value != "" {
+				parts = append(parts, value)
+			}
+		case xml.EndElement:
+			if current == "" {
+				continue
+			}
+			if depth--; depth == 0 {
+				setMetadata(fields, current, strings.Join(parts, ", "))
+				current = ""
+			}
+		}
+	}
+	return fields
+}
+
+// StripLocation removes GPS coordinates from the EXIF and XMP metadata of a
+// JPEG, PNG or TIFF image. The data is changed in place without moving
+// anything, so the image is otherwise byte-for-byte identical. It reports
+// whether any location metadata was found.
+func StripLocation(data []byte) bool {
+	stripped := false
+
+	if exif, err := readEXIF(data); err == nil && exif.HasLocation() {
+		stripped = exif.stripLocation()
+	}
+
+	if packet := xmpPacket(data); packet != nil && xmpLocation.Match(packet) {
+		blanked := xmpLocation.ReplaceAllFunc(packet, func(match []byte) []byte {
+			sub := xmpLocation.FindSubmatch(match)
+			prefix, value, suffix := sub[1], sub[2], sub[3]
+			if prefix == nil {
+				prefix, value, suffix = sub[4], sub[5], sub[6]
+			}
+			// Keep the length so the offsets of everything after the packet stay valid
+			blank := append([]byte{}, prefix...)
+			blank = append(blank, bytes.Repeat([]byte(" "), len(value))...)
+			return append(blank, suffix...)
+		})
+		copy(packet, blanked)
+		stripped = true
+	}
+
+	// PNG chunks are checksummed, so fix the checksums of the chunks changed above
+	if stripped {
+		pngChunks(data, func(chunkType string, chunk []byte) bool {
+			if chunkType == "eXIf" || chunkType == "iTXt" {
+				start := cap(data) - cap(chunk) // Offset of the chunk data in data
+				crc := crc32.ChecksumIEEE(data[start-4 : start+len(chunk)])
+				binary.BigEndian.PutUint32(data[start+len(chunk):], crc)
+			}
+			return true
+		})
+	}
+
+	return stripped
+}
@@ -0,0 +1,322 @@
+package processors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"reflect"
+	"testing"
+)
+
+// jpegSegment builds a JPEG marker segment from the parts of its payload
+func jpegSegment(marker byte, parts ...[]byte) []byte {
+	payload := bytes.Join(parts, nil)
+	segment := []byte{0xFF, marker}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(2+len(payload)))
+	return append(segment, payload...)
+}
+
+// jpegWithSegments inserts segments after the start of a JPEG image, or of
+// an empty one if img is nil
+func jpegWithSegments(img []byte, segments ...[]byte) []byte {
+	if img == nil {
+		img = []byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9}
+	}
+	data := append([]byte{}, img[:2]...)
+	for _, segment := range segments {
+		data = append(data, segment...)
+	}
+	return append(data, img[2:]...)
+}
+
+// pngChunk builds a PNG chunk with its checksum
+func pngChunk(chunkType string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// pngWithChunks inserts chunks after the IHDR chunk of a PNG image
+func pngWithChunks(img []byte, chunks ...[]byte) []byte {
+	ihdrEnd := len(pngSignature) + 12 + int(binary.BigEndian.Uint32(img[len(pngSignature):]))
+	data := append([]byte{}, img[:ihdrEnd]...)
+	for _, chunk := range chunks {
+		data = append(data, chunk...)
+	}
+	return append(data, img[ihdrEnd:]...)
+}
+
+// testImage is a small gradient to encode
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 16), uint8(y * 16), 128, 255})
+		}
+	}
+	return img
+}
+
+// encodedJPEG and encodedPNG encode testImage
+func encodedJPEG(t testing.TB) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodedPNG(t testing.TB) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// iptcSegment builds a Photoshop APP13 segment holding IPTC datasets, after
+// another resource with an odd-length name that has to be padded
+func iptcSegment(datasets ...[]byte) []byte {
+	resource := func(id uint16, name string, data []byte) []byte {
+		block := append([]byte("8BIM"), byte(id>>8), byte(id), byte(len(name)))
+		block = append(block, name...)
+		if (len(name)+1)%2 != 0 {
+			block = append(block, 0)
+		}
+		block = binary.BigEndian.AppendUint32(block, uint32(len(data)))
+		block = append(block, data...)
+		if len(data)%2 != 0 {
+			block = append(block, 0)
+		}
+		return block
+	}
+	return jpegSegment(jpegMarkerAPP13, []byte(photoshopHeader),
+		resource(0x03ED, "ab", []byte{1, 2, 3}),
+		resource(iptcResourceID, "", bytes.Join(datasets, nil)),
+	)
+}
+
+// iimDataset builds an IPTC IIM dataset
+func iimDataset(record, dataset byte, value string) []byte {
+	data := []byte{0x1C, record, dataset}
+	data = binary.BigEndian.AppendUint16(data, uint16(len(value)))
+	return append(data, value...)
+}
+
+// testXMP is an XMP packet with properties as attributes and elements, and
+// GPS coordinates in both forms
+const testXMP = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/"
+  xmlns:exif="http://ns.adobe.com/exif/1.0/" xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/"
+  xmp:Rating="4" xmp:CreatorTool="Editor 2.0" exif:GPSLatitude="40,26.774N">
+<dc:title><rdf:Alt><rdf:li xml:lang="x-default">XMP title</rdf:li></rdf:Alt></dc:title>
+<dc:subject><rdf:Bag><rdf:li>beach</rdf:li><rdf:li>sunset</rdf:li></rdf:Bag></dc:subject>
+<photoshop:Country>Portugal</photoshop:Country>
+<exif:GPSLongitude>79,58.936W</exif:GPSLongitude>
+</rdf:Description>
+</rdf:RDF>
+</x:xmpmeta>`
+
+// pngXMPChunk builds an uncompressed iTXt chunk holding an XMP packet
+func pngXMPChunk(packet string) []byte {
+	return pngChunk("iTXt", []byte(xmpPNGKeyword+"\x00\x00\x00\x00\x00"+packet))
+}
+
+// locatedJPEG is a JPEG with EXIF, IPTC and XMP metadata, all with a location
+func locatedJPEG(t testing.TB) []byte {
+	return jpegWithSegments(encodedJPEG(t),
+		jpegSegment(jpegMarkerAPP1, []byte(exifHeader), cameraTIFF(binary.BigEndian)),
+		iptcSegment(
+			iimDataset(1, 90, "\x1b%G"), // Envelope record, ignored
+			iimDataset(2, 5, "IPTC title"),
+			iimDataset(2, 25, "holiday"),
+			iimDataset(2, 25, "family"),
+			iimDataset(2, 90, "Lisbon"),
+			iimDataset(2, 116, "IPTC copyright"),
+		),
+		jpegSegment(jpegMarkerAPP1, []byte(xmpHeader), []byte(testXMP)),
+	)
+}
+
+func TestAddImageMetadata(t *testing.T) {
+	data := locatedJPEG(t)
+	exif, err := readEXIF(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata := make(map[string]string)
+	addImageMetadata(metadata, data, exif, true)
+	want := map[string]string{
+		// EXIF
+		"cameraMake":   "Canon",
+		"cameraModel":  "EOS 5D",
+		"copyright":    "Photographer",
+		"lensModel":    "EF 35mm",
+		"orientation":  "6",
+		"exposureTime": "1/250",
+		"fNumber":      "f/2.8",
+		"focalLength":  "35mm",
+		"iso":          "200",
+		"captureTime":  "2019-06-15T14:30:00+02:00",
+		"gpsLatitude":  "40.446233",
+		"gpsLongitude": "-79.982267",
+		"gpsAltitude":  "-52.5",
+		"hasLocation":  "true",
+		// IPTC, over XMP
+		"title":    "IPTC title",
+		"keywords": "holiday, family",
+		"city":     "Lisbon",
+		// XMP
+		"rating":   "4",
+		"software": "Editor 2.0",
+		"country":  "Portugal",
+	}
+	if !reflect.DeepEqual(metadata, want) {
+		t.Errorf("got  %v\nwant %v", metadata, want)
+	}
+
+	metadata = make(map[string]string)
+	addImageMetadata(metadata, data, exif, false)
+	for _, key := range []string{"gpsLatitude", "gpsLongitude", "gpsAltitude", "hasLocation"} {
+		if _, ok := metadata[key]; ok {
+			t.Errorf("%s set without location", key)
+		}
+	}
+}
+
+func TestReadXMPPNG(t *testing.T) {
+	data := pngWithChunks(encodedPNG(t), pngXMPChunk(testXMP))
+	want := map[string]string{
+		"title":    "XMP title",
+		"keywords": "beach, sunset",
+		"rating":   "4",
+		"software": "Editor 2.0",
+		"country":  "Portugal",
+	}
+	if got := readXMP(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %v\nwant %v", got, want)
+	}
+	if got := readIPTC(data); len(got) != 0 {
+		t.Errorf("read IPTC %v from a PNG", got)
+	}
+}
+
+// checkStripped checks that an image lost its location and nothing else
+func checkStripped(t *testing.T, original, stripped []byte) {
+	t.Helper()
+	if len(stripped) != len(original) {
+		t.Fatalf("size changed from %d to %d", len(original), len(stripped))
+	}
+
+	exif, err := readEXIF(stripped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exif.HasLocation() {
+		t.Errorf("GPS directory still has %d entries", len(exif.GPS))
+	}
+	metadata := make(map[string]string)
+	addImageMetadata(metadata, stripped, exif, true)
+	for _, key := range []string{"gpsLatitude", "gpsLongitude", "gpsAltitude", "hasLocation"} {
+		if value, ok := metadata[key]; ok {
+			t.Errorf("%s = %q after stripping", key, value)
+		}
+	}
+	if metadata["cameraMake"] != "Canon" || metadata["captureTime"] == "" {
+		t.Errorf("lost other metadata: %v", metadata)
+	}
+	for _, coordinate := range []string{"40,26.774N", "79,58.936W"} {
+		if bytes.Contains(stripped, []byte(coordinate)) {
+			t.Errorf("XMP still holds %s", coordinate)
+		}
+	}
+}
+
+func TestStripLocationJPEG(t *testing.T) {
+	original := locatedJPEG(t)
+	data := append([]byte{}, original...)
+	if !StripLocation(data) {
+		t.Fatal("no location found")
+	}
+	checkStripped(t, original, data)
+
+	if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("stripped JPEG doesn't decode: %v", err)
+	}
+	if got := readIPTC(data)["city"]; got != "Lisbon" {
+		t.Errorf("IPTC city = %q", got)
+	}
+}
+
+func TestStripLocationPNG(t *testing.T) {
+	original := pngWithChunks(encodedPNG(t),
+		pngChunk("eXIf", cameraTIFF(binary.LittleEndian)),
+		pngXMPChunk(testXMP),
+	)
+	data := append([]byte{}, original...)
+	if !StripLocation(data) {
+		t.Fatal("no location found")
+	}
+	checkStripped(t, original, data)
+
+	// The PNG decoder checks the chunk checksums
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("stripped PNG doesn't decode: %v", err)
+	}
+}
+
+func TestStripLocationTIFF(t *testing.T) {
+	original := cameraTIFF(binary.LittleEndian)
+	data := append([]byte{}, original...)
+	if !StripLocation(data) {
+		t.Fatal("no location found")
+	}
+	checkStripped(t, original, data)
+}
+
+func TestStripLocationWithoutLocation(t *testing.T) {
+	order := binary.LittleEndian
+	tests := map[string][]byte{
+		"plain jpeg": encodedJPEG(t),
+		"plain png":  encodedPNG(t),
+		"exif without gps": jpegWithSegments(encodedJPEG(t),
+			jpegSegment(jpegMarkerAPP1, []byte(exifHeader), buildTIFF(order, []testEXIFEntry{exifASCII(exifTagMake, "Canon")}, nil, nil))),
+		"not an image": []byte("hello"),
+	}
+
+	for name, original := range tests {
+		t.Run(name, func(t *testing.T) {
+			data := append([]byte{}, original...)
+			if StripLocation(data) {
+				t.Error("found a location")
+			}
+			if !bytes.Equal(data, original) {
+				t.Error("data changed")
+			}
+		})
+	}
+}
+
+func FuzzImageMetadata(f *testing.F) {
+	f.Add(locatedJPEG(f))
+	f.Add(pngWithChunks(encodedPNG(f), pngChunk("eXIf", cameraTIFF(binary.LittleEndian)), pngXMPChunk(testXMP)))
+	f.Add(cameraTIFF(binary.BigEndian))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		exif, _ := readEXIF(data)
+		addImageMetadata(make(map[string]string), data, exif, true)
+		exif.Orientation()
+
+		size := len(data)
+		StripLocation(data)
+		if len(data) != size {
+			t.Errorf("size changed from %d to %d", size, len(data))
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package processors
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// DefaultMaxMemorySize is the largest input, in bytes, a processor holds in
+// memory when ProcessOptions.MaxMemorySize isn't set. Larger inputs are
+// streamed or spooled to temporary files, and processors that need the
+// whole file in memory fail with ErrFileTooLarge.
+var DefaultMaxMemorySize int64 = 256 << 20
+
+// memoryLimit returns the largest input to hold in memory
+func (o ProcessOptions) memoryLimit() int64 {
+	if o.MaxMemorySize > 0 {
+		return o.MaxMemorySize
+	}
+	return DefaultMaxMemorySize
+}
+
+// readAllLimited reads an input that has to be held in memory as a whole,
+// failing with ErrFileTooLarge rather than reading more than limit bytes
+func readAllLimited(reader io.Reader, limit int64) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrFileTooLarge, limit)
+	}
+	return data, nil
+}
+
+// ReadAllLimited reads a stored file that has to be held in memory as a
+// whole, such as an image to transform, failing with ErrFileTooLarge if it is
+// larger than DefaultMaxMemorySize
+func ReadAllLimited(reader io.Reader) ([]byte, error) {
+	return readAllLimited(reader, DefaultMaxMemorySize)
+}
+
+// spoolToTempFile copies an input to a temporary file for tools that read
+// files, without holding it in memory. It returns the file's path and size;
+// the caller removes the file.
+func spoolToTempFile(reader io.Reader, pattern string) (string, int64, error) {
+	file, err := ioutil.TempFile("", pattern)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	size, err := io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", 0, fmt.Errorf("failed to write to temporary file: %w", err)
+	}
+	return file.Name(), size, nil
+}
+
+// readFileHead reads up to n bytes from the start of a file
+func readFileHead(path string, n int64) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ioutil.ReadAll(io.LimitReader(file, n))
+}
+
+// headBuffer keeps the first max bytes written to it, and whether more
+// were written, so the start of a streamed input can be kept
+type headBuffer struct {
+	max       int64
+	data      []byte
+	truncated bool
+}
+
+// Write keeps what fits of p and discards the rest
+func (b *headBuffer) Write(p []byte) (int, error) {
+	room := b.max - int64(len(b.data))
+	if int64(len(p)) > room {
+		if room > 0 {
+			b.data = append(b.data, p[:room]...)
+		}
+		b.truncated = true
+	} else {
+		b.data = append(b.data, p...)
+	}
+	return len(p), nil
+}
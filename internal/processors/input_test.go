@@ -0,0 +1,187 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReadAllLimited(t *testing.T) {
+	tests := []struct {
+		size, limit int
+		tooLarge    bool
+	}{
+		{0, 0, false},
+		{0, 10, false},
+		{9, 10, false},
+		{10, 10, false},
+		{11, 10, true},
+		{1, 0, true},
+		{1000, 10, true},
+	}
+	for _, tt := range tests {
+		input := bytes.Repeat([]byte("x"), tt.size)
+		// One byte at a time, so the limit holds across short reads
+		data, err := readAllLimited(iotest.OneByteReader(bytes.NewReader(input)), int64(tt.limit))
+		if tt.tooLarge {
+			if !errors.Is(err, ErrFileTooLarge) || data != nil {
+				t.Errorf("%d bytes, limit %d: got %d bytes, %v; want ErrFileTooLarge", tt.size, tt.limit, len(data), err)
+			}
+			continue
+		}
+		if err != nil || !bytes.Equal(data, input) {
+			t.Errorf("%d bytes, limit %d: got %d bytes, %v; want all of them", tt.size, tt.limit, len(data), err)
+		}
+	}
+
+	failing := iotest.ErrReader(errors.New("disk on fire"))
+	if _, err := readAllLimited(failing, 10); err == nil || errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("failing reader: err = %v, want the read error", err)
+	}
+}
+
+func TestReadAllLimitedDefault(t *testing.T) {
+	saved := DefaultMaxMemorySize
+	t.Cleanup(func() { DefaultMaxMemorySize = saved })
+	DefaultMaxMemorySize = 4
+
+	if data, err := ReadAllLimited(strings.NewReader("four")); err != nil || string(data) != "four" {
+		t.Errorf("ReadAllLimited(four) = %q, %v", data, err)
+	}
+	if _, err := ReadAllLimited(strings.NewReader("five!")); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("ReadAllLimited(five!) = %v, want ErrFileTooLarge", err)
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	if limit := (ProcessOptions{}).memoryLimit(); limit != DefaultMaxMemorySize {
+		t.Errorf("memoryLimit = %d, want the default %d", limit, DefaultMaxMemorySize)
+	}
+	if limit := (ProcessOptions{MaxMemorySize: 1024}).memoryLimit(); limit != 1024 {
+		t.Errorf("memoryLimit = %d, want 1024", limit)
+	}
+}
+
+func TestHeadBuffer(t *testing.T) {
+	tests := []struct {
+		name      string
+		max       int64
+		writes    []string
+		want      string
+		truncated bool
+	}{
+		{"nothing written", 4, nil, "", false},
+		{"exactly full", 4, []string{"ab", "cd"}, "abcd", false},
+		{"full, then an empty write", 4, []string{"abcd", ""}, "abcd", false},
+		{"one byte over", 4, []string{"abcde"}, "abcd", true},
+		{"over across writes", 4, []string{"abc", "de", "f"}, "abcd", true},
+		{"full, then more", 4, []string{"abcd", "e"}, "abcd", true},
+		{"no room", 0, []string{"a"}, "", true},
+	}
+	for _, tt := range tests {
+		b := &headBuffer{max: tt.max}
+		for _, p := range tt.writes {
+			// Writes always succeed so a MultiWriter keeps streaming
+			if n, err := b.Write([]byte(p)); n != len(p) || err != nil {
+				t.Errorf("%s: Write(%q) = %d, %v", tt.name, p, n, err)
+			}
+		}
+		if string(b.data) != tt.want || b.truncated != tt.truncated {
+			t.Errorf("%s: kept %q, truncated %v; want %q, %v", tt.name, b.data, b.truncated, tt.want, tt.truncated)
+		}
+	}
+}
+
+func TestSpoolToTempFile(t *testing.T) {
+	path, size, err := spoolToTempFile(strings.NewReader("spooled data"), "spool-*.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+	if size != 12 {
+		t.Errorf("size = %d, want 12", size)
+	}
+	if head, err := readFileHead(path, 7); err != nil || string(head) != "spooled" {
+		t.Errorf("readFileHead = %q, %v; want the first 7 bytes", head, err)
+	}
+	if head, err := readFileHead(path, 100); err != nil || string(head) != "spooled data" {
+		t.Errorf("readFileHead = %q, %v; want the whole file", head, err)
+	}
+
+	// A failed copy is reported, and its file removed
+	if path, _, err := spoolToTempFile(iotest.ErrReader(errors.New("gone")), "spool-*.bin"); err == nil {
+		os.Remove(path)
+		t.Error("expected an error for a failing reader")
+	}
+}
+
+// csvRows generates a CSV file of n rows as it is read, so it never has to
+// be held in memory
+type csvRows struct {
+	n, next int
+	pending []byte
+}
+
+func (r *csvRows) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		switch {
+		case r.next > r.n:
+			return 0, io.EOF
+		case r.next == 0:
+			r.pending = []byte("id,name,score\n")
+		default:
+			r.pending = []byte(fmt.Sprintf("%d,row %d,%d.5\n", r.next, r.next, r.next%100))
+		}
+		r.next++
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func TestCSVProcessorPastMemoryLimit(t *testing.T) {
+	// About 1 MB of rows profiled with a 4 KB memory limit
+	const rows = 50000
+	options := ProcessOptions{ExtractMetadata: true, GeneratePreview: true, MaxMemorySize: 4 << 10}
+	result, err := NewCSVProcessor().Process(context.Background(), &csvRows{n: rows}, "large.csv", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := result.Data.(*CSVProfile)
+	if profile.Rows != rows || len(profile.Columns) != 3 {
+		t.Fatalf("profiled %d rows and %d columns, want %d and 3", profile.Rows, len(profile.Columns), rows)
+	}
+	if id := profile.Columns[0]; id.Name != "id" || id.Min != int64(1) || id.Max != int64(rows) {
+		t.Errorf("id column = %+v, want 1 to %d", id, rows)
+	}
+	if got := result.Metadata["rows"]; got != fmt.Sprint(rows) {
+		t.Errorf("rows metadata = %q, want %d", got, rows)
+	}
+	// The preview still covers only the first rows
+	if lines := strings.Count(string(result.Preview), "\n"); lines != csvPreviewRows {
+		t.Errorf("preview has %d lines, want %d", lines, csvPreviewRows)
+	}
+}
+
+func TestTextProcessorPastMemoryLimit(t *testing.T) {
+	input := strings.Repeat("lorem ipsum\n", 1000)
+	options := ProcessOptions{ExtractMetadata: true, MaxMemorySize: 100}
+	result, err := NewTextProcessor().Process(context.Background(), strings.NewReader(input), "large.txt", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The text is left out, but the whole file is still counted
+	if result.Data != nil || result.Metadata["dataOmitted"] != "true" {
+		t.Errorf("Data = %v, metadata = %v; want the text omitted", result.Data, result.Metadata)
+	}
+	if !strings.Contains(result.Summary, "1000") {
+		t.Errorf("summary = %q, want the 1000 lines counted", result.Summary)
+	}
+}
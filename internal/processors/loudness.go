@@ -0,0 +1,258 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Audio formats normalized transcodes can be encoded to
+const (
+	NormalizeMP3  = "mp3"
+	NormalizeOpus = "opus"
+	NormalizeAAC  = "aac"
+)
+
+// Loudness defaults, following EBU R128
+const (
+	defaultSilenceThreshold = -50.0 // dBFS below which audio counts as silent
+	defaultSilenceDuration  = 2.0   // Seconds of quiet before it counts as silence
+	normalizeTruePeak       = -1.0  // dBTP ceiling of normalized transcodes
+	normalizeMinRange       = 7.0   // LU; quieter ranges are left as they are
+	loudnessFloor           = -70.0 // LUFS, the absolute gate; silent audio measures -inf
+)
+
+// DefaultLoudnessTarget is the integrated loudness, in LUFS, normalized
+// transcodes are brought to. EBU R128 broadcast loudness is -23 LUFS.
+var DefaultLoudnessTarget = -23.0
+
+// DefaultNormalizeFormats are the formats normalized transcodes are encoded to
+// when the normalize option doesn't name any
+var DefaultNormalizeFormats = []string{NormalizeMP3}
+
+// normalizeEncoders holds the encoder arguments, extension and content type
+// of each normalized transcode format. loudnorm works at 192 kHz, so every
+// format resamples to a common rate.
+var normalizeEncoders = map[string]struct {
+	args        []string
+	ext         string
+	contentType string
+}{
+	NormalizeMP3:  {[]string{"-c:a", "libmp3lame", "-b:a", "192k", "-ar", "44100"}, ".mp3", "audio/mpeg"},
+	NormalizeOpus: {[]string{"-c:a", "libopus", "-b:a", "128k", "-ar", "48000"}, ".opus", "audio/ogg"},
+	NormalizeAAC:  {[]string{"-c:a", "aac", "-b:a", "192k", "-ar", "44100"}, ".m4a", "audio/mp4"},
+}
+
+// Loudness is the EBU R128 measurement of an audio stream
+type Loudness struct {
+	Integrated float64 `json:"integrated"` // LUFS
+	TruePeak   float64 `json:"truePeak"`   // dBTP
+	Range      float64 `json:"range"`      // LU
+	Threshold  float64 `json:"threshold"`  // LUFS, the gating threshold
+}
+
+// Silence is a stretch of audio quieter than the silence threshold
+type Silence struct {
+	Start    float64 `json:"start"`    // In seconds
+	End      float64 `json:"end"`      // In seconds
+	Duration float64 `json:"duration"` // In seconds
+}
+
+// silenceStart and silenceEnd match the lines logged by ffmpeg's silencedetect filter
+var (
+	silenceStart = regexp.MustCompile(`silence_start:\s*(-?[0-9.]+)`)
+	silenceEnd   = regexp.MustCompile(`silence_end:\s*(-?[0-9.]+)\s*\|\s*silence_duration:\s*([0-9.]+)`)
+)
+
+// loudnormOutput mirrors the JSON summary printed by ffmpeg's loudnorm filter
+type loudnormOutput struct {
+	InputI      string `json:"input_i"`
+	InputTP     string `json:"input_tp"`
+	InputLRA    string `json:"input_lra"`
+	InputThresh string `json:"input_thresh"`
+}
+
+// ParseNormalizeFormats parses a comma-separated list of normalized transcode
+// formats (mp3, opus, aac)
+func ParseNormalizeFormats(value string) ([]string, error) {
+	var formats []string
+	seen := make(map[string]bool)
+	for _, format := range strings.Split(value, ",") {
+		format = strings.ToLower(strings.TrimSpace(format))
+		if format == "" || seen[format] {
+			continue
+		}
+		if _, ok := normalizeEncoders[format]; !ok {
+			return nil, fmt.Errorf("unsupported normalize format %q: use %s, %s or %s", format, NormalizeMP3, NormalizeOpus, NormalizeAAC)
+		}
+		seen[format] = true
+		formats = append(formats, format)
+	}
+	if len(formats) == 0 {
+		return nil, fmt.Errorf("no normalize formats given")
+	}
+	return formats, nil
+}
+
+// normalizeFormats reads the normalize option: true for the default formats,
+// or a list of formats
+func normalizeFormats(options ProcessOptions) ([]string, error) {
+	value := options.String("normalize", "")
+	if options.Bool("normalize") || value == "true" {
+		return DefaultNormalizeFormats, nil
+	}
+	if value == "" || value == "false" {
+		return nil, nil
+	}
+	return ParseNormalizeFormats(value)
+}
+
+// analyzeLoudness measures the loudness of an audio file and finds its
+// silences in a single decoding pass. silencedetect passes audio through
+// unchanged, so it runs before loudnorm in the chain. duration, if known,
+// closes a silence still running at the end of the file.
+func analyzeLoudness(ctx context.Context, input string, duration, silenceThreshold, silenceDuration float64) (*Loudness, []Silence, error) {
+	filter := fmt.Sprintf("silencedetect=noise=%gdB:d=%g,loudnorm=print_format=json", silenceThreshold, silenceDuration)
+	cmd := DefaultTools.Command(ctx, ToolFFmpeg, "-hide_banner", "-nostats", "-i", input,
+		"-vn", "-af", filter, "-f", "null", "-")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, nil, fmt.Errorf("ffmpeg failed to measure loudness: %w: %s", err, lastLines(stderr.String(), 5))
+	}
+	output := stderr.String()
+
+	loudness, err := parseLoudnorm(output)
+	if err != nil {
+		return nil, nil, err
+	}
+	return loudness, parseSilences(output, duration), nil
+}
+
+// parseLoudnorm reads the measurement from the log of ffmpeg's loudnorm
+// filter, whose summary is the last JSON object of the log
+func parseLoudnorm(output string) (*Loudness, error) {
+	start := strings.LastIndex(output, "{")
+	end := strings.LastIndex(output, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("ffmpeg printed no loudness summary")
+	}
+	var summary loudnormOutput
+	if err := json.Unmarshal([]byte(output[start:end+1]), &summary); err != nil {
+		return nil, fmt.Errorf("failed to parse loudness summary: %w", err)
+	}
+	return &Loudness{
+		Integrated: loudnessValue(summary.InputI),
+		TruePeak:   loudnessValue(summary.InputTP),
+		Range:      math.Max(parseFloat(summary.InputLRA), 0),
+		Threshold:  loudnessValue(summary.InputThresh),
+	}, nil
+}
+
+// loudnessValue parses a level printed by loudnorm, which is "-inf" for
+// silence, holding it at loudnessFloor so it can be encoded as JSON
+func loudnessValue(s string) float64 {
+	value := parseFloat(s)
+	if math.IsInf(value, 0) || math.IsNaN(value) || value < loudnessFloor {
+		return loudnessFloor
+	}
+	return value
+}
+
+// parseSilences pairs the silence starts and ends logged by silencedetect. A
+// silence still running at the end of the file has no end line; it ends at
+// duration, or is left out if the duration isn't known.
+func parseSilences(output string, duration float64) []Silence {
+	var silences []Silence
+	started := math.NaN()
+	for _, line := range strings.Split(output, "\n") {
+		if match := silenceStart.FindStringSubmatch(line); match != nil {
+			started = parseFloat(match[1])
+			continue
+		}
+		if match := silenceEnd.FindStringSubmatch(line); match != nil && !math.IsNaN(started) {
+			silences = append(silences, Silence{
+				Start:    math.Max(started, 0),
+				End:      parseFloat(match[1]),
+				Duration: parseFloat(match[2]),
+			})
+			started = math.NaN()
+		}
+	}
+	if !math.IsNaN(started) && duration > started {
+		started = math.Max(started, 0)
+		silences = append(silences, Silence{Start: started, End: duration, Duration: duration - started})
+	}
+	return silences
+}
+
+// normalizeAudio encodes an audio file to each format at the target loudness.
+// The measurement from analyzeLoudness makes it the second pass of loudnorm,
+// which can then apply a single linear gain instead of compressing dynamics.
+func normalizeAudio(ctx context.Context, input, filename string, loudness *Loudness, target float64, formats []string) ([]DerivedFile, error) {
+	dir, err := ioutil.TempDir("", "normalize-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if loudness.Integrated <= loudnessFloor {
+		return nil, fmt.Errorf("audio is silent and can't be normalized")
+	}
+
+	// loudnorm only stays linear when the target range covers the measured one
+	loudnessRange := math.Min(math.Max(loudness.Range, normalizeMinRange), 50)
+	filter := fmt.Sprintf("loudnorm=I=%g:TP=%g:LRA=%g:measured_I=%g:measured_TP=%g:measured_LRA=%g:measured_thresh=%g:linear=true",
+		target, normalizeTruePeak, loudnessRange,
+		loudness.Integrated, loudness.TruePeak, loudness.Range, loudness.Threshold)
+
+	base := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	files := make([]DerivedFile, 0, len(formats))
+	for _, format := range formats {
+		encoder := normalizeEncoders[format]
+		output := filepath.Join(dir, "normalized"+encoder.ext)
+
+		args := []string{"-y", "-v", "error", "-i", input, "-vn", "-af", filter}
+		args = append(append(args, encoder.args...), output)
+		if out, err := DefaultTools.Command(ctx, ToolFFmpeg, args...).CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("ffmpeg failed to encode normalized %s: %w: %s", format, err, lastLines(string(out), 5))
+		}
+
+		data, err := ioutil.ReadFile(output)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read normalized %s: %w", format, err)
+		}
+		files = append(files, DerivedFile{
+			Name:        base + "_normalized" + encoder.ext,
+			Role:        "normalized:" + format,
+			ContentType: encoder.contentType,
+			Data:        data,
+			Metadata: map[string]string{
+				"loudnessTarget": strconv.FormatFloat(target, 'f', -1, 64),
+			},
+		})
+	}
+	return files, nil
+}
+
+// addMetadata flattens the loudness measurement and silences into metadata
+func (l *Loudness) addMetadata(metadata map[string]string, silences []Silence) {
+	metadata["loudnessIntegrated"] = strconv.FormatFloat(l.Integrated, 'f', 1, 64)
+	metadata["loudnessTruePeak"] = strconv.FormatFloat(l.TruePeak, 'f', 1, 64)
+	metadata["loudnessRange"] = strconv.FormatFloat(l.Range, 'f', 1, 64)
+
+	total := 0.0
+	for _, silence := range silences {
+		total += silence.Duration
+	}
+	metadata["silences"] = strconv.Itoa(len(silences))
+	metadata["silenceDuration"] = strconv.FormatFloat(total, 'f', 3, 64)
+}
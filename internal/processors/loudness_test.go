@@ -0,0 +1,166 @@
+package processors
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// loudnessLog is the stderr of an ffmpeg analysis pass running silencedetect
+// and loudnorm, with the loudnorm summary printed last
+const loudnessLog = `Input #0, wav, from 'talk.wav':
+  Duration: 00:00:30.00, bitrate: 1536 kb/s
+[silencedetect @ 0x1] silence_start: -0.0213
+[silencedetect @ 0x1] silence_end: 2.5 | silence_duration: 2.5213
+[silencedetect @ 0x1] silence_start: 12.25
+[silencedetect @ 0x1] silence_end: 15 | silence_duration: 2.75
+[silencedetect @ 0x1] silence_start: 27.5
+[Parsed_loudnorm_1 @ 0x2]
+{
+	"input_i" : "-27.61",
+	"input_tp" : "-4.47",
+	"input_lra" : "18.06",
+	"input_thresh" : "-39.20",
+	"output_i" : "-24.58",
+	"output_tp" : "-2.00",
+	"output_lra" : "7.00",
+	"output_thresh" : "-34.99",
+	"normalization_type" : "dynamic",
+	"target_offset" : "0.58"
+}
+`
+
+func TestParseLoudnorm(t *testing.T) {
+	loudness, err := parseLoudnorm(loudnessLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Loudness{Integrated: -27.61, TruePeak: -4.47, Range: 18.06, Threshold: -39.2}
+	if *loudness != want {
+		t.Errorf("loudness = %+v, want %+v", *loudness, want)
+	}
+
+	// Silent audio measures -inf, held at the absolute gate
+	silent, err := parseLoudnorm(`{"input_i": "-inf", "input_tp": "-inf", "input_lra": "0.00", "input_thresh": "-inf"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Loudness{Integrated: loudnessFloor, TruePeak: loudnessFloor, Threshold: loudnessFloor}); *silent != want {
+		t.Errorf("silent loudness = %+v, want %+v", *silent, want)
+	}
+
+	for _, output := range []string{"", "no summary", "{ not json }", "} {"} {
+		if _, err := parseLoudnorm(output); err == nil {
+			t.Errorf("parseLoudnorm(%q) succeeded, want an error", output)
+		}
+	}
+}
+
+func TestLoudnessValue(t *testing.T) {
+	tests := map[string]float64{
+		"-23.00": -23,
+		"0.5":    0.5,
+		"-inf":   loudnessFloor,
+		"inf":    loudnessFloor,
+		"nan":    loudnessFloor,
+		"-91.3":  loudnessFloor,
+		"-70.00": loudnessFloor,
+	}
+	for s, want := range tests {
+		if got := loudnessValue(s); got != want {
+			t.Errorf("loudnessValue(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestParseSilences(t *testing.T) {
+	// A silence running at the end of the file closes at the duration, and a
+	// start logged just before zero is held at zero
+	want := []Silence{
+		{Start: 0, End: 2.5, Duration: 2.5213},
+		{Start: 12.25, End: 15, Duration: 2.75},
+		{Start: 27.5, End: 30, Duration: 2.5},
+	}
+	if got := parseSilences(loudnessLog, 30); !reflect.DeepEqual(got, want) {
+		t.Errorf("silences = %+v, want %+v", got, want)
+	}
+
+	// Without a duration the running silence is left out
+	if got := parseSilences(loudnessLog, 0); !reflect.DeepEqual(got, want[:2]) {
+		t.Errorf("silences without a duration = %+v, want %+v", got, want[:2])
+	}
+
+	// An end without a start is ignored
+	if got := parseSilences("silence_end: 4 | silence_duration: 2\n", 10); got != nil {
+		t.Errorf("silences = %+v, want none", got)
+	}
+}
+
+func TestParseNormalizeFormats(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr string
+	}{
+		{"mp3", []string{NormalizeMP3}, ""},
+		{" Opus, aac,,opus ", []string{NormalizeOpus, NormalizeAAC}, ""},
+		{"", nil, "no normalize formats"},
+		{" , ", nil, "no normalize formats"},
+		{"mp3,flac", nil, `"flac"`},
+	}
+	for _, tt := range tests {
+		formats, err := ParseNormalizeFormats(tt.value)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseNormalizeFormats(%q) = %v, %v; want an error mentioning %s", tt.value, formats, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(formats, tt.want) {
+			t.Errorf("ParseNormalizeFormats(%q) = %v, %v; want %v", tt.value, formats, err, tt.want)
+		}
+	}
+}
+
+func TestNormalizeFormats(t *testing.T) {
+	tests := []struct {
+		value   interface{}
+		want    []string
+		wantErr bool
+	}{
+		{nil, nil, false},
+		{false, nil, false},
+		{"false", nil, false},
+		{true, DefaultNormalizeFormats, false},
+		{"true", DefaultNormalizeFormats, false},
+		{"aac,mp3", []string{NormalizeAAC, NormalizeMP3}, false},
+		{"wav", nil, true},
+	}
+	for _, tt := range tests {
+		options := ProcessOptions{Options: map[string]interface{}{}}
+		if tt.value != nil {
+			options.Options["normalize"] = tt.value
+		}
+		formats, err := normalizeFormats(options)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(formats, tt.want) {
+			t.Errorf("normalizeFormats(%v) = %v, %v; want %v", tt.value, formats, err, tt.want)
+		}
+	}
+}
+
+func TestLoudnessMetadata(t *testing.T) {
+	metadata := make(map[string]string)
+	loudness := &Loudness{Integrated: -27.61, TruePeak: -4.47, Range: 18.06, Threshold: -39.2}
+	loudness.addMetadata(metadata, parseSilences(loudnessLog, 30))
+
+	want := map[string]string{
+		"loudnessIntegrated": "-27.6",
+		"loudnessTruePeak":   "-4.5",
+		"loudnessRange":      "18.1",
+		"silences":           "3",
+		"silenceDuration":    "7.771",
+	}
+	if !reflect.DeepEqual(metadata, want) {
+		t.Errorf("metadata = %v, want %v", metadata, want)
+	}
+}
@@ -0,0 +1,153 @@
+package processors
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// officePackage is an Office Open XML file (.xlsx, .pptx), a zip of XML parts
+// linked by relationships
+type officePackage struct {
+	files map[string]*zip.File
+}
+
+// openOfficePackage opens an Office Open XML file held in memory
+func openOfficePackage(data []byte) (*officePackage, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	pkg := &officePackage{files: make(map[string]*zip.File, len(zr.File))}
+	for _, f := range zr.File {
+		pkg.files[f.Name] = f
+	}
+	return pkg, nil
+}
+
+// packageRelationships is the content of a .rels part
+type packageRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Type   string `xml:"Type,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// relationshipTargets maps relationship IDs of a part to the absolute paths of their targets
+func relationshipTargets(files map[string]*zip.File, part string) map[string]string {
+	targets := make(map[string]string)
+	var rels packageRelationships
+	if err := readZipXML(files[relsPath(part)], &rels); err != nil {
+		return targets
+	}
+	for _, rel := range rels.Relationships {
+		targets[rel.ID] = resolveTarget(part, rel.Target)
+	}
+	return targets
+}
+
+// relationshipTargetsByType returns the targets of a part's relationships whose type ends with suffix
+func relationshipTargetsByType(files map[string]*zip.File, part, suffix string) []string {
+	var rels packageRelationships
+	if err := readZipXML(files[relsPath(part)], &rels); err != nil {
+		return nil
+	}
+	var targets []string
+	for _, rel := range rels.Relationships {
+		if strings.HasSuffix(rel.Type, suffix) {
+			targets = append(targets, resolveTarget(part, rel.Target))
+		}
+	}
+	return targets
+}
+
+// resolveTarget returns the package path of a relationship target. Targets
+// starting with "/" are relative to the package root, others to the part's
+// directory.
+func resolveTarget(part, target string) string {
+	if strings.HasPrefix(target, "/") {
+		return path.Clean(strings.TrimPrefix(target, "/"))
+	}
+	return path.Join(path.Dir(part), target)
+}
+
+// relsPath returns the path of the relationships part for a part; the
+// package's own relationships are those of the root part ""
+func relsPath(part string) string {
+	if part == "" {
+		return "_rels/.rels"
+	}
+	return path.Join(path.Dir(part), "_rels", path.Base(part)+".rels")
+}
+
+// readZipXML decodes an XML part of a zip package
+func readZipXML(f *zip.File, v interface{}) error {
+	if f == nil {
+		return fmt.Errorf("part not found")
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
+
+// mainPart returns the path of the package's main document, such as
+// xl/workbook.xml, falling back to fallback if the package relationships
+// don't name one
+func (p *officePackage) mainPart(fallback string) string {
+	if targets := relationshipTargetsByType(p.files, "", "/officeDocument"); len(targets) > 0 {
+		return targets[0]
+	}
+	return fallback
+}
+
+// coreProperties is the content of the core properties part, docProps/core.xml
+type coreProperties struct {
+	Title          string `xml:"title"`
+	Creator        string `xml:"creator"`
+	Description    string `xml:"description"`
+	Category       string `xml:"category"`
+	LastModifiedBy string `xml:"lastModifiedBy"`
+	Created        string `xml:"created"`
+	Modified       string `xml:"modified"`
+}
+
+// addCoreProperties copies the core document properties of an Office file into metadata
+func (p *officePackage) addCoreProperties(metadata map[string]string) {
+	part := "docProps/core.xml"
+	if targets := relationshipTargetsByType(p.files, "", "/core-properties"); len(targets) > 0 {
+		part = targets[0]
+	}
+	var cp coreProperties
+	if err := readZipXML(p.files[part], &cp); err != nil {
+		return
+	}
+
+	properties := map[string]string{
+		"title":          cp.Title,
+		"author":         cp.Creator,
+		"description":    cp.Description,
+		"category":       cp.Category,
+		"lastModifiedBy": cp.LastModifiedBy,
+	}
+	for k, v := range properties {
+		if v = strings.TrimSpace(v); v != "" {
+			metadata[k] = v
+		}
+	}
+
+	// Dates are W3CDTF, which RFC 3339 covers when a time is given
+	if created, err := time.Parse(time.RFC3339, strings.TrimSpace(cp.Created)); err == nil {
+		metadata["created"] = created.Format(time.RFC3339)
+	}
+	if modified, err := time.Parse(time.RFC3339, strings.TrimSpace(cp.Modified)); err == nil {
+		metadata["modified"] = modified.Format(time.RFC3339)
+	}
+}
@@ -0,0 +1,385 @@
+package processors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Parquet physical types, repetition types, converted types, encodings and
+// page types from the format's Thrift definitions
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetOptional = 1
+
+	parquetNoConvertedType = -1
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetDataPage = 0
+)
+
+// parquetMagic starts and ends a Parquet file
+const parquetMagic = "PAR1"
+
+// parquetRowGroupSize is roughly how many bytes of values are buffered
+// before they are written out as a row group
+const parquetRowGroupSize = 64 << 20
+
+// parquetColumn buffers the values of one column of the current row group
+type parquetColumn struct {
+	name      string
+	physical  int32
+	converted int32
+
+	defined []bool // Definition level of each row: whether it has a value
+	values  bytes.Buffer
+	bools   []bool // Boolean values are bit-packed when the page is written
+}
+
+// parquetChunk is where a column chunk of a row group was written
+type parquetChunk struct {
+	offset    int64
+	size      int64
+	numValues int64
+}
+
+// parquetRowGroup records a written row group for the file footer
+type parquetRowGroup struct {
+	rows   int64
+	size   int64
+	chunks []parquetChunk
+}
+
+// parquetWriter writes rows of typed values to an uncompressed Parquet file
+// with a flat schema of optional columns. Rows are buffered into row groups
+// of about parquetRowGroupSize bytes, each written as one data page per column.
+type parquetWriter struct {
+	w         io.Writer
+	offset    int64
+	columns   []*parquetColumn
+	rowGroups []parquetRowGroup
+	rows      int64 // Rows in the current row group
+	buffered  int64
+	err       error
+}
+
+// newParquetWriter starts a Parquet file with a column for each name, of the
+// Parquet type matching the inferred CSV column type
+func newParquetWriter(w io.Writer, names, types []string) (*parquetWriter, error) {
+	p := &parquetWriter{w: w}
+	for i, name := range names {
+		column := &parquetColumn{name: name, physical: parquetByteArray, converted: parquetUTF8}
+		switch types[i] {
+		case ColumnTypeInt:
+			column.physical, column.converted = parquetInt64, parquetNoConvertedType
+		case ColumnTypeFloat:
+			column.physical, column.converted = parquetDouble, parquetNoConvertedType
+		case ColumnTypeBoolean:
+			column.physical, column.converted = parquetBoolean, parquetNoConvertedType
+		case ColumnTypeDate:
+			column.physical, column.converted = parquetInt64, parquetTimestampMillis
+		}
+		p.columns = append(p.columns, column)
+	}
+	p.write([]byte(parquetMagic))
+	return p, p.err
+}
+
+// WriteRow buffers a row of values: nil, int64, float64, bool, time.Time or
+// string, matching the column types
+func (p *parquetWriter) WriteRow(values []interface{}) error {
+	for i, column := range p.columns {
+		value := values[i]
+		column.defined = append(column.defined, value != nil)
+		if value == nil {
+			continue
+		}
+		switch column.physical {
+		case parquetBoolean:
+			column.bools = append(column.bools, value.(bool))
+			p.buffered++
+		case parquetInt64:
+			n, ok := value.(int64)
+			if t, isTime := value.(time.Time); isTime {
+				n, ok = t.UnixMilli(), true
+			}
+			if !ok {
+				return fmt.Errorf("column %s: expected an integer, got %T", column.name, value)
+			}
+			binary.Write(&column.values, binary.LittleEndian, n)
+			p.buffered += 8
+		case parquetDouble:
+			binary.Write(&column.values, binary.LittleEndian, math.Float64bits(value.(float64)))
+			p.buffered += 8
+		case parquetByteArray:
+			s := fmt.Sprint(value)
+			binary.Write(&column.values, binary.LittleEndian, uint32(len(s)))
+			column.values.WriteString(s)
+			p.buffered += 4 + int64(len(s))
+		}
+	}
+	p.rows++
+
+	if p.buffered >= parquetRowGroupSize {
+		p.flush()
+	}
+	return p.err
+}
+
+// Close writes the buffered rows and the file footer
+func (p *parquetWriter) Close() error {
+	if p.rows > 0 {
+		p.flush()
+	}
+	footer := p.footer()
+	p.write(footer)
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(footer)))
+	p.write(length[:])
+	p.write([]byte(parquetMagic))
+	return p.err
+}
+
+// write writes to the file, keeping the offset and the first error
+func (p *parquetWriter) write(data []byte) {
+	if p.err != nil {
+		return
+	}
+	n, err := p.w.Write(data)
+	p.offset += int64(n)
+	p.err = err
+}
+
+// flush writes the buffered rows as a row group
+func (p *parquetWriter) flush() {
+	group := parquetRowGroup{rows: p.rows}
+	for _, column := range p.columns {
+		page := column.page()
+		header := parquetPageHeader(len(page), len(column.defined))
+
+		chunk := parquetChunk{offset: p.offset, size: int64(len(header) + len(page)), numValues: int64(len(column.defined))}
+		p.write(header)
+		p.write(page)
+		group.chunks = append(group.chunks, chunk)
+		group.size += chunk.size
+
+		column.defined = column.defined[:0]
+		column.values.Reset()
+		column.bools = column.bools[:0]
+	}
+	p.rowGroups = append(p.rowGroups, group)
+	p.rows, p.buffered = 0, 0
+}
+
+// page encodes the column's buffered rows as the body of a data page: the
+// definition levels, then the values of the rows that have one
+func (c *parquetColumn) page() []byte {
+	levels := parquetBitPacked(c.defined)
+	var page bytes.Buffer
+	binary.Write(&page, binary.LittleEndian, uint32(len(levels)))
+	page.Write(levels)
+	if c.physical == parquetBoolean {
+		page.Write(packBits(c.bools))
+	} else {
+		page.Write(c.values.Bytes())
+	}
+	return page.Bytes()
+}
+
+// parquetBitPacked encodes bits (definition levels of bit width 1) as a
+// single bit-packed run of the RLE/bit-packing hybrid encoding
+func parquetBitPacked(bits []bool) []byte {
+	groups := (len(bits) + 7) / 8
+	encoded := binary.AppendUvarint(nil, uint64(groups)<<1|1)
+	return append(encoded, packBits(bits)...)
+}
+
+// packBits packs bits into bytes, least significant bit first
+func packBits(bits []bool) []byte {
+	packed := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		if bit {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return packed
+}
+
+// parquetPageHeader encodes the header of an uncompressed data page
+func parquetPageHeader(size, numValues int) []byte {
+	t := newThriftWriter()
+	t.i32(1, parquetDataPage)
+	t.i32(2, int32(size)) // Uncompressed size
+	t.i32(3, int32(size)) // Compressed size
+	t.structField(5, func() {
+		t.i32(1, int32(numValues))
+		t.i32(2, parquetPlain)
+		t.i32(3, parquetRLE) // Definition levels
+		t.i32(4, parquetRLE) // Repetition levels
+	})
+	return t.bytes()
+}
+
+// footer encodes the file metadata: the schema and the row groups
+func (p *parquetWriter) footer() []byte {
+	var rows int64
+	for _, group := range p.rowGroups {
+		rows += group.rows
+	}
+
+	t := newThriftWriter()
+	t.i32(1, 1) // Version
+	t.listField(2, thriftStruct, len(p.columns)+1)
+	t.structElement(func() {
+		t.str(4, "schema")
+		t.i32(5, int32(len(p.columns)))
+	})
+	for _, column := range p.columns {
+		t.structElement(func() {
+			t.i32(1, column.physical)
+			t.i32(3, parquetOptional)
+			t.str(4, column.name)
+			if column.converted != parquetNoConvertedType {
+				t.i32(6, column.converted)
+			}
+		})
+	}
+	t.i64(3, rows)
+	t.listField(4, thriftStruct, len(p.rowGroups))
+	for _, group := range p.rowGroups {
+		t.structElement(func() {
+			t.listField(1, thriftStruct, len(group.chunks))
+			for i, chunk := range group.chunks {
+				column := p.columns[i]
+				t.structElement(func() {
+					t.i64(2, chunk.offset)
+					t.structField(3, func() {
+						t.i32(1, column.physical)
+						t.listField(2, thriftI32, 2)
+						t.varint(parquetPlain)
+						t.varint(parquetRLE)
+						t.listField(3, thriftBinary, 1)
+						t.binary(column.name)
+						t.i32(4, 0) // Uncompressed
+						t.i64(5, chunk.numValues)
+						t.i64(6, chunk.size)
+						t.i64(7, chunk.size)
+						t.i64(9, chunk.offset)
+					})
+				})
+			}
+			t.i64(2, group.size)
+			t.i64(3, group.rows)
+		})
+	}
+	t.str(6, "fileprocessor")
+	return t.bytes()
+}
+
+// Thrift compact protocol types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes a struct in the Thrift compact protocol, as Parquet
+// page headers and file metadata are written
+type thriftWriter struct {
+	buf  bytes.Buffer
+	last []int16 // ID of the last field written in each open struct
+}
+
+// newThriftWriter starts encoding a struct
+func newThriftWriter() *thriftWriter {
+	return &thriftWriter{last: []int16{0}}
+}
+
+// bytes ends the struct and returns its encoding
+func (t *thriftWriter) bytes() []byte {
+	t.buf.WriteByte(0) // Stop
+	return t.buf.Bytes()
+}
+
+// field writes a field header, as a delta from the previous field ID if it's small
+func (t *thriftWriter) field(id int16, fieldType byte) {
+	last := &t.last[len(t.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | fieldType)
+	} else {
+		t.buf.WriteByte(fieldType)
+		t.varint(int64(id))
+	}
+	*last = id
+}
+
+// varint writes a zigzag-encoded integer
+func (t *thriftWriter) varint(n int64) {
+	var buf [binary.MaxVarintLen64]byte
+	t.buf.Write(buf[:binary.PutUvarint(buf[:], uint64(n<<1^n>>63))])
+}
+
+// binary writes a length-prefixed string
+func (t *thriftWriter) binary(s string) {
+	var buf [binary.MaxVarintLen64]byte
+	t.buf.Write(buf[:binary.PutUvarint(buf[:], uint64(len(s)))])
+	t.buf.WriteString(s)
+}
+
+// i32 writes a 32-bit integer field
+func (t *thriftWriter) i32(id int16, n int32) {
+	t.field(id, thriftI32)
+	t.varint(int64(n))
+}
+
+// i64 writes a 64-bit integer field
+func (t *thriftWriter) i64(id int16, n int64) {
+	t.field(id, thriftI64)
+	t.varint(n)
+}
+
+// str writes a string field
+func (t *thriftWriter) str(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.binary(s)
+}
+
+// structField writes a struct-valued field whose fields fn writes
+func (t *thriftWriter) structField(id int16, fn func()) {
+	t.field(id, thriftStruct)
+	t.structElement(fn)
+}
+
+// structElement writes a struct whose fields fn writes, as a list element
+// or the value of a struct field
+func (t *thriftWriter) structElement(fn func()) {
+	t.last = append(t.last, 0)
+	fn()
+	t.buf.WriteByte(0) // Stop
+	t.last = t.last[:len(t.last)-1]
+}
+
+// listField writes the header of a list field; its elements follow
+func (t *thriftWriter) listField(id int16, elementType byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elementType)
+	} else {
+		t.buf.WriteByte(0xF0 | elementType)
+		var buf [binary.MaxVarintLen64]byte
+		t.buf.Write(buf[:binary.PutUvarint(buf[:], uint64(size))])
+	}
+}
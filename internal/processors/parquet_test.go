@@ -0,0 +1,358 @@
+package processors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// updateParquetFixture rewrites testdata/types.parquet from parquetWriter's
+// output. The fixture was checked by opening it with parquet-go and reading
+// back every row; verify it again with a Parquet reader after updating it.
+var updateParquetFixture = flag.Bool("update-parquet", false, "rewrite the Parquet fixture")
+
+// thriftReader decodes the Thrift compact protocol into maps of field ID to
+// value, enough to read back the footers and page headers parquetWriter writes
+type thriftReader struct {
+	data []byte
+	pos  int
+}
+
+// uvarint reads an unsigned varint
+func (r *thriftReader) uvarint() uint64 {
+	n, size := binary.Uvarint(r.data[r.pos:])
+	if size <= 0 {
+		panic("invalid varint")
+	}
+	r.pos += size
+	return n
+}
+
+// zigzag reads a zigzag-encoded integer
+func (r *thriftReader) zigzag() int64 {
+	n := r.uvarint()
+	return int64(n>>1) ^ -int64(n&1)
+}
+
+// value reads a value of a compact protocol type
+func (r *thriftReader) value(fieldType byte) interface{} {
+	switch fieldType {
+	case 1, 2:
+		return fieldType == 1
+	case thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftBinary:
+		n := int(r.uvarint())
+		s := string(r.data[r.pos : r.pos+n])
+		r.pos += n
+		return s
+	case thriftList:
+		header := r.data[r.pos]
+		r.pos++
+		size, elementType := int(header>>4), header&0x0F
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i] = r.value(elementType)
+		}
+		return list
+	case thriftStruct:
+		return r.structValue()
+	}
+	panic(fmt.Sprintf("unexpected thrift type %d", fieldType))
+}
+
+// structValue reads a struct up to its stop byte
+func (r *thriftReader) structValue() map[int16]interface{} {
+	fields := make(map[int16]interface{})
+	var last int16
+	for {
+		header := r.data[r.pos]
+		r.pos++
+		if header == 0 {
+			return fields
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(r.zigzag())
+		}
+		last = id
+		fields[id] = r.value(header & 0x0F)
+	}
+}
+
+// parquetField returns a field of a decoded struct, failing the test if it's missing
+func parquetField(t *testing.T, s map[int16]interface{}, id int16) interface{} {
+	t.Helper()
+	value, ok := s[id]
+	if !ok {
+		t.Fatalf("field %d missing from %v", id, s)
+	}
+	return value
+}
+
+// parquetFile is a Parquet file read back from its footer and data pages
+type parquetFile struct {
+	rows    int64
+	groups  int
+	names   []string
+	types   []int64
+	columns [][]interface{} // Values of each column across the row groups
+}
+
+// readParquet decodes a file written by parquetWriter
+func readParquet(t *testing.T, data []byte) *parquetFile {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte(parquetMagic)) || !bytes.HasSuffix(data, []byte(parquetMagic)) {
+		t.Fatalf("file doesn't start and end with %s", parquetMagic)
+	}
+	footerLength := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := &thriftReader{data: data, pos: len(data) - 8 - footerLength}
+	meta := footer.structValue()
+	if footer.pos != len(data)-8 {
+		t.Fatalf("footer ends at %d, want %d", footer.pos, len(data)-8)
+	}
+
+	file := &parquetFile{rows: parquetField(t, meta, 3).(int64)}
+	schema := parquetField(t, meta, 2).([]interface{})
+	root := schema[0].(map[int16]interface{})
+	if n := parquetField(t, root, 5).(int64); n != int64(len(schema)-1) {
+		t.Fatalf("root has %d children, schema has %d columns", n, len(schema)-1)
+	}
+	for _, element := range schema[1:] {
+		column := element.(map[int16]interface{})
+		file.names = append(file.names, parquetField(t, column, 4).(string))
+		file.types = append(file.types, parquetField(t, column, 1).(int64))
+	}
+	file.columns = make([][]interface{}, len(file.names))
+
+	rowGroups := parquetField(t, meta, 4).([]interface{})
+	file.groups = len(rowGroups)
+	var rows int64
+	for _, element := range rowGroups {
+		group := element.(map[int16]interface{})
+		groupRows := parquetField(t, group, 3).(int64)
+		rows += groupRows
+		for i, element := range parquetField(t, group, 1).([]interface{}) {
+			chunk := parquetField(t, element.(map[int16]interface{}), 3).(map[int16]interface{})
+			values := readParquetPage(t, data, chunk, file.types[i])
+			if int64(len(values)) != groupRows {
+				t.Fatalf("column %s has %d values in a row group of %d rows", file.names[i], len(values), groupRows)
+			}
+			file.columns[i] = append(file.columns[i], values...)
+		}
+	}
+	if rows != file.rows {
+		t.Fatalf("row groups have %d rows, footer says %d", rows, file.rows)
+	}
+	return file
+}
+
+// readParquetPage decodes the data page of a column chunk: its definition
+// levels and PLAIN-encoded values, with nil for rows without one
+func readParquetPage(t *testing.T, data []byte, chunk map[int16]interface{}, physical int64) []interface{} {
+	t.Helper()
+	offset := int(parquetField(t, chunk, 9).(int64))
+	header := &thriftReader{data: data, pos: offset}
+	page := header.structValue()
+	if pageType := parquetField(t, page, 1).(int64); pageType != parquetDataPage {
+		t.Fatalf("page type %d, want a data page", pageType)
+	}
+	size := int(parquetField(t, page, 3).(int64))
+	if total := header.pos - offset + size; int64(total) != parquetField(t, chunk, 7).(int64) {
+		t.Fatalf("chunk is %d bytes, metadata says %d", total, chunk[7])
+	}
+	numValues := int(parquetField(t, parquetField(t, page, 5).(map[int16]interface{}), 1).(int64))
+	body := data[header.pos : header.pos+size]
+
+	// Definition levels: a length, then one bit-packed run
+	levelsLength := int(binary.LittleEndian.Uint32(body))
+	levels := body[4 : 4+levelsLength]
+	run, n := binary.Uvarint(levels)
+	if run&1 == 0 || int(run>>1) != (numValues+7)/8 {
+		t.Fatalf("definition levels run header %d for %d values", run, numValues)
+	}
+	levels = levels[n:]
+	values := body[4+levelsLength:]
+
+	var result []interface{}
+	defined := 0
+	for i := 0; i < numValues; i++ {
+		if levels[i/8]&(1<<(i%8)) == 0 {
+			result = append(result, nil)
+			continue
+		}
+		switch physical {
+		case parquetBoolean:
+			result = append(result, values[defined/8]&(1<<(defined%8)) != 0)
+		case parquetInt64:
+			result = append(result, int64(binary.LittleEndian.Uint64(values)))
+			values = values[8:]
+		case parquetDouble:
+			result = append(result, math.Float64frombits(binary.LittleEndian.Uint64(values)))
+			values = values[8:]
+		case parquetByteArray:
+			length := int(binary.LittleEndian.Uint32(values))
+			result = append(result, string(values[4:4+length]))
+			values = values[4+length:]
+		}
+		defined++
+	}
+	if physical == parquetBoolean {
+		values = values[(defined+7)/8:]
+	}
+	if len(values) != 0 {
+		t.Fatalf("%d bytes left over in the page", len(values))
+	}
+	return result
+}
+
+func TestParquetWriterRoundTrip(t *testing.T) {
+	names := []string{"id", "price", "active", "created", "name"}
+	types := []string{ColumnTypeInt, ColumnTypeFloat, ColumnTypeBoolean, ColumnTypeDate, ColumnTypeString}
+	created := time.Date(2024, time.March, 6, 12, 30, 0, 0, time.UTC)
+
+	rows := [][]interface{}{
+		{int64(1), 9.5, true, created, "widget"},
+		{int64(-2), nil, false, nil, "gadget, large"},
+		{nil, 0.25, nil, created.Add(time.Hour), nil},
+		{int64(math.MaxInt64), -1e10, true, created, ""},
+	}
+	// Enough rows for the bit-packed levels and booleans to span several bytes
+	for i := 0; i < 20; i++ {
+		rows = append(rows, []interface{}{int64(i), float64(i) / 2, i%3 == 0, nil, fmt.Sprintf("row %d", i)})
+	}
+
+	var buf bytes.Buffer
+	writer, err := newParquetWriter(&buf, names, types)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := writer.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file := readParquet(t, buf.Bytes())
+	if file.rows != int64(len(rows)) || file.groups != 1 {
+		t.Errorf("%d rows in %d row groups, want %d in 1", file.rows, file.groups, len(rows))
+	}
+	if !reflect.DeepEqual(file.names, names) {
+		t.Errorf("column names %v, want %v", file.names, names)
+	}
+	wantTypes := []int64{parquetInt64, parquetDouble, parquetBoolean, parquetInt64, parquetByteArray}
+	if !reflect.DeepEqual(file.types, wantTypes) {
+		t.Errorf("column types %v, want %v", file.types, wantTypes)
+	}
+
+	for i, row := range rows {
+		for j, value := range row {
+			if ts, ok := value.(time.Time); ok {
+				value = ts.UnixMilli()
+			}
+			if got := file.columns[j][i]; !reflect.DeepEqual(got, value) {
+				t.Errorf("row %d column %s = %#v, want %#v", i, names[j], got, value)
+			}
+		}
+	}
+}
+
+func TestParquetWriterEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := newParquetWriter(&buf, []string{"a"}, []string{ColumnTypeString})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file := readParquet(t, buf.Bytes())
+	if file.rows != 0 || file.groups != 0 {
+		t.Errorf("%d rows in %d row groups, want none", file.rows, file.groups)
+	}
+	if !reflect.DeepEqual(file.names, []string{"a"}) {
+		t.Errorf("column names %v, want [a]", file.names)
+	}
+}
+
+func TestParquetWriterTypeMismatch(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := newParquetWriter(&buf, []string{"n"}, []string{ColumnTypeInt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteRow([]interface{}{"not a number"}); err == nil {
+		t.Error("expected an error writing a string to an integer column")
+	}
+}
+
+func TestThriftWriterLongFields(t *testing.T) {
+	// Field ID jumps over 15 and lists of 15 or more elements use the long forms
+	w := newThriftWriter()
+	w.i32(1, -7)
+	w.i64(20, 1<<40)
+	w.listField(21, thriftI32, 20)
+	for i := 0; i < 20; i++ {
+		w.varint(int64(i))
+	}
+
+	got := (&thriftReader{data: w.bytes()}).structValue()
+	if got[1] != int64(-7) || got[20] != int64(1<<40) {
+		t.Errorf("decoded %v", got)
+	}
+	list := got[21].([]interface{})
+	if len(list) != 20 || list[19] != int64(19) {
+		t.Errorf("decoded list %v", list)
+	}
+}
+
+func TestParquetWriterFixture(t *testing.T) {
+	// Every column type, nulls in each, and enough rows for the bit-packed
+	// levels and booleans to span several bytes
+	names := []string{"id", "price", "active", "created", "name"}
+	types := []string{ColumnTypeInt, ColumnTypeFloat, ColumnTypeBoolean, ColumnTypeDate, ColumnTypeString}
+	created := time.Date(2024, time.March, 6, 12, 30, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	writer, err := newParquetWriter(&buf, names, types)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 12; i++ {
+		row := []interface{}{int64(i - 3), float64(i) * 1.25, i%3 == 0, created.Add(time.Duration(i) * time.Hour), fmt.Sprintf("name %d é", i)}
+		row[i%len(row)] = nil
+		if err := writer.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fixture := filepath.Join("testdata", "types.parquet")
+	if *updateParquetFixture {
+		if err := os.WriteFile(fixture, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("output (%d bytes) differs from %s (%d bytes), which a Parquet reader was checked to open", buf.Len(), fixture, len(want))
+	}
+}
@@ -0,0 +1,255 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// PDFPage holds the text extracted from one page
+type PDFPage struct {
+	Number int    `json:"number"`
+	Text   string `json:"text"`
+}
+
+// PDFDocument is the structured data produced by the PDF processor
+type PDFDocument struct {
+	Info      map[string]string `json:"info"`
+	PageCount int               `json:"pageCount"`
+	Encrypted bool              `json:"encrypted"`
+	Pages     []PDFPage         `json:"pages"`
+}
+
+// Text returns the text of all pages, separated by form feeds
+func (d *PDFDocument) Text() string {
+	texts := make([]string, len(d.Pages))
+	for i, page := range d.Pages {
+		texts[i] = page.Text
+	}
+	return strings.Join(texts, "\f")
+}
+
+// pdfInfoKeys maps document info dictionary keys to metadata keys
+var pdfInfoKeys = map[string]string{
+	"Title":        "title",
+	"Author":       "author",
+	"Subject":      "subject",
+	"Keywords":     "keywords",
+	"Creator":      "creator",
+	"Producer":     "producer",
+	"CreationDate": "created",
+	"ModDate":      "modified",
+}
+
+// PDFProcessor processes PDF documents
+type PDFProcessor struct{}
+
+// NewPDFProcessor creates a new PDF processor
+func NewPDFProcessor() *PDFProcessor {
+	return &PDFProcessor{}
+}
+
+// Process processes a PDF document
+func (p *PDFProcessor) Process(ctx context.Context, reader io.Reader, filename string, options ProcessOptions) (*ProcessResult, error) {
+	// The PDF reader needs random access, so read the document into memory,
+	// up to the memory limit
+	data, err := readAllLimited(reader, options.memoryLimit())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	result := &ProcessResult{
+		Metadata: make(map[string]string),
+	}
+
+	doc, err := readPDF(data)
+	if errors.Is(err, pdf.ErrInvalidPassword) {
+		// Documents protected by a user password can't be read, but are still valid PDFs
+		result.Summary = "Encrypted PDF document (password required)"
+		result.Metadata["encrypted"] = "true"
+		result.Data = &PDFDocument{Encrypted: true}
+		return result, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PDF: %w", err)
+	}
+	result.Data = doc
+
+	text := doc.Text()
+	numWords := len(strings.Fields(text))
+
+	// Generate summary
+	result.Summary = fmt.Sprintf("PDF document with %d pages, %d words, and %d characters",
+		doc.PageCount, numWords, len(text))
+	if title := doc.Info["title"]; title != "" {
+		result.Summary = fmt.Sprintf("%s: %s", result.Summary, title)
+	}
+
+	// Extract metadata
+	if options.ExtractMetadata {
+		for k, v := range doc.Info {
+			result.Metadata[k] = v
+		}
+		result.Metadata["pages"] = fmt.Sprintf("%d", doc.PageCount)
+		result.Metadata["encrypted"] = fmt.Sprintf("%t", doc.Encrypted)
+		result.Metadata["words"] = fmt.Sprintf("%d", numWords)
+		result.Metadata["characters"] = fmt.Sprintf("%d", len(text))
+	}
+
+	// Generate a first-page thumbnail, falling back to the text of the document
+	if options.GeneratePreview {
+		thumbnail, err := renderPDFThumbnail(ctx, data, options.Int("thumbnailSize", 256))
+		if err == nil {
+			result.Preview = thumbnail
+		} else {
+			result.Metadata["thumbnailError"] = err.Error()
+			if errors.Is(err, ErrToolMissing) {
+				noteMissingTools(result.Metadata, ToolPdftoppm)
+			}
+
+			maxSize := options.MaxPreviewSize
+			if maxSize <= 0 {
+				maxSize = 1024 // Default to 1KB
+			}
+			result.Preview = []byte(truncateText(text, maxSize))
+		}
+	}
+
+	return result, nil
+}
+
+// truncateText cuts text to at most maxSize bytes, backing off to the start
+// of a character so none is split
+func truncateText(text string, maxSize int) string {
+	if len(text) <= maxSize {
+		return text
+	}
+	end := maxSize
+	for end > 0 && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	return text[:end]
+}
+
+// readPDF parses a PDF and extracts its info dictionary and the text of each page
+func readPDF(data []byte) (doc *PDFDocument, err error) {
+	// The PDF library panics on some malformed documents
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("malformed PDF: %v", r)
+		}
+	}()
+
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	doc = &PDFDocument{
+		Info:      make(map[string]string),
+		PageCount: r.NumPage(),
+		Encrypted: !r.Trailer().Key("Encrypt").IsNull(),
+	}
+
+	info := r.Trailer().Key("Info")
+	for key, name := range pdfInfoKeys {
+		value := strings.TrimSpace(info.Key(key).Text())
+		if value == "" {
+			continue
+		}
+		if key == "CreationDate" || key == "ModDate" {
+			if t, ok := parsePDFDate(value); ok {
+				value = t.Format(time.RFC3339)
+			}
+		}
+		doc.Info[name] = value
+	}
+
+	for i := 1; i <= doc.PageCount; i++ {
+		page := r.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		text, err := page.GetPlainText(nil)
+		if err != nil {
+			text = ""
+		}
+		doc.Pages = append(doc.Pages, PDFPage{Number: i, Text: strings.TrimSpace(text)})
+	}
+
+	return doc, nil
+}
+
+// parsePDFDate parses a PDF date string such as "D:20230102150405+01'00'"
+func parsePDFDate(s string) (time.Time, bool) {
+	s = strings.TrimPrefix(s, "D:")
+	s = strings.ReplaceAll(s, "'", "")
+
+	layouts := []string{"20060102150405-0700", "20060102150405Z", "20060102150405", "200601021504", "20060102"}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// renderPDFThumbnail renders the first page as a PNG using pdftoppm (poppler-utils)
+func renderPDFThumbnail(ctx context.Context, data []byte, size int) ([]byte, error) {
+	if err := DefaultTools.Require(ToolPdftoppm); err != nil {
+		return nil, err
+	}
+
+	dir, err := ioutil.TempDir("", "pdf-thumbnail-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "input.pdf")
+	if err := ioutil.WriteFile(input, data, 0600); err != nil {
+		return nil, err
+	}
+
+	output := filepath.Join(dir, "page")
+	cmd := DefaultTools.Command(ctx, ToolPdftoppm, "-png", "-f", "1", "-l", "1", "-singlefile",
+		"-scale-to", fmt.Sprintf("%d", size), input, output)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("pdftoppm failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	return ioutil.ReadFile(output + ".png")
+}
+
+// Features lists the features of the processor that need external tools
+func (p *PDFProcessor) Features() []Feature {
+	return []Feature{
+		{Name: "text", Description: "Per-page text and document info"},
+		{Name: "thumbnail", Description: "First-page thumbnails", Tools: []string{ToolPdftoppm}},
+	}
+}
+
+// Name returns the processor name
+func (p *PDFProcessor) Name() string {
+	return "pdf"
+}
+
+// CanProcess returns true if this processor can process the given content type
+func (p *PDFProcessor) CanProcess(contentType, ext string) bool {
+	return contentType == "application/pdf" || strings.ToLower(ext) == ".pdf"
+}
+
+// init registers the processor with the registry
+func init() {
+	Register(NewPDFProcessor(), "application/pdf")
+}
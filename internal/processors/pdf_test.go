@@ -0,0 +1,189 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// processPDF runs the PDF processor over a document in testdata
+func processPDF(t *testing.T, name string, options ProcessOptions) (*ProcessResult, error) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewPDFProcessor().Process(context.Background(), bytes.NewReader(data), name, options)
+}
+
+// usePdftoppm points the default tools at a pdftoppm for the length of a test
+func usePdftoppm(t *testing.T, path string) {
+	t.Helper()
+	saved := DefaultTools.Path(ToolPdftoppm)
+	t.Cleanup(func() { DefaultTools.SetPath(ToolPdftoppm, saved) })
+	DefaultTools.SetPath(ToolPdftoppm, path)
+}
+
+func TestPDFProcessor(t *testing.T) {
+	result, err := processPDF(t, "document.pdf", ProcessOptions{ExtractMetadata: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := result.Data.(*PDFDocument)
+	wantPages := []PDFPage{
+		{Number: 1, Text: "Quarterly report: revenue grew in every region."},
+		{Number: 2, Text: "Appendix: figures by region follow."},
+	}
+	if doc.PageCount != 2 || doc.Encrypted || !reflect.DeepEqual(doc.Pages, wantPages) {
+		t.Errorf("document = %+v, want pages %+v", doc, wantPages)
+	}
+
+	// Info dates are converted to RFC 3339
+	want := map[string]string{
+		"title":      "Quarterly report",
+		"author":     "Ada Lovelace",
+		"producer":   "handmade",
+		"created":    "2023-01-02T15:04:05+01:00",
+		"modified":   "2024-03-15T00:00:00Z",
+		"pages":      "2",
+		"encrypted":  "false",
+		"words":      "12",
+		"characters": "83",
+	}
+	if !reflect.DeepEqual(result.Metadata, want) {
+		t.Errorf("metadata = %v, want %v", result.Metadata, want)
+	}
+	if want := "PDF document with 2 pages, 12 words, and 83 characters: Quarterly report"; result.Summary != want {
+		t.Errorf("summary = %q, want %q", result.Summary, want)
+	}
+}
+
+func TestPDFProcessorEncrypted(t *testing.T) {
+	// Without a user password the document is decrypted and read
+	result, err := processPDF(t, "encrypted.pdf", ProcessOptions{ExtractMetadata: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := result.Data.(*PDFDocument)
+	if !doc.Encrypted || doc.Text() != "Only the owner may edit this." || doc.Info["title"] != "Protected" {
+		t.Errorf("document = %+v, want it decrypted", doc)
+	}
+	if result.Metadata["encrypted"] != "true" {
+		t.Errorf("encrypted = %q, want true", result.Metadata["encrypted"])
+	}
+
+	// With one, only the encryption is reported
+	result, err = processPDF(t, "locked.pdf", ProcessOptions{ExtractMetadata: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc := result.Data.(*PDFDocument); !doc.Encrypted || doc.PageCount != 0 {
+		t.Errorf("document = %+v, want only the encryption reported", doc)
+	}
+	if result.Summary != "Encrypted PDF document (password required)" || result.Metadata["encrypted"] != "true" {
+		t.Errorf("summary = %q, metadata = %v", result.Summary, result.Metadata)
+	}
+}
+
+func TestPDFProcessorMalformed(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "document.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{
+		"not a PDF": []byte("just some text"),
+		"truncated": data[:len(data)/2],
+		"no xref":   bytes.Replace(data, []byte("startxref"), []byte("startxrfe"), 1),
+	} {
+		_, err := NewPDFProcessor().Process(context.Background(), bytes.NewReader(data), "bad.pdf", ProcessOptions{})
+		if err == nil || !strings.Contains(err.Error(), "failed to parse PDF") {
+			t.Errorf("%s: err = %v, want a parse error", name, err)
+		}
+	}
+}
+
+func TestPDFProcessorThumbnail(t *testing.T) {
+	// pdftoppm writes the page to the path given last, with a .png extension
+	usePdftoppm(t, fakeTool(t, `for last; do :; done; printf 'page one' > "$last.png"`))
+	result, err := processPDF(t, "document.pdf", ProcessOptions{GeneratePreview: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result.Preview) != "page one" || result.Metadata["thumbnailError"] != "" {
+		t.Errorf("preview = %q, metadata = %v; want the rendered page", result.Preview, result.Metadata)
+	}
+}
+
+func TestPDFProcessorThumbnailMissingTool(t *testing.T) {
+	// Without pdftoppm the preview falls back to the text
+	usePdftoppm(t, filepath.Join(t.TempDir(), "pdftoppm"))
+	result, err := processPDF(t, "document.pdf", ProcessOptions{GeneratePreview: true, MaxPreviewSize: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result.Preview) != "Quarterly report" {
+		t.Errorf("preview = %q, want the start of the text", result.Preview)
+	}
+	if result.Metadata["missingTools"] != ToolPdftoppm || result.Metadata["thumbnailError"] == "" {
+		t.Errorf("metadata = %v, want pdftoppm noted as missing", result.Metadata)
+	}
+}
+
+func TestParsePDFDate(t *testing.T) {
+	tests := map[string]string{
+		"D:20230102150405+01'00'": "2023-01-02T15:04:05+01:00",
+		"D:20230102150405-05'30'": "2023-01-02T15:04:05-05:30",
+		"D:20230102150405Z":       "2023-01-02T15:04:05Z",
+		"20230102150405":          "2023-01-02T15:04:05Z",
+		"D:202301021504":          "2023-01-02T15:04:00Z",
+		"D:20230102":              "2023-01-02T00:00:00Z",
+	}
+	for s, want := range tests {
+		got, ok := parsePDFDate(s)
+		if !ok || got.Format(time.RFC3339) != want {
+			t.Errorf("parsePDFDate(%q) = %v, %v; want %s", s, got, ok, want)
+		}
+	}
+	for _, s := range []string{"", "D:2023", "yesterday", "D:20231302"} {
+		if got, ok := parsePDFDate(s); ok {
+			t.Errorf("parsePDFDate(%q) = %v, want no date", s, got)
+		}
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		text    string
+		maxSize int
+		want    string
+	}{
+		{"short", 10, "short"},
+		{"exact", 5, "exact"},
+		{"truncated", 5, "trunc"},
+		// "é" is two bytes and "€" three; a cut inside either drops it
+		{"café", 4, "caf"},
+		{"café", 5, "café"},
+		{"a€b", 2, "a"},
+		{"a€b", 3, "a"},
+		{"a€b", 4, "a€"},
+		{"€", 1, ""},
+		{"𝄞x", 3, ""},
+		{"", 0, ""},
+	}
+	for _, tt := range tests {
+		got := truncateText(tt.text, tt.maxSize)
+		if got != tt.want {
+			t.Errorf("truncateText(%q, %d) = %q, want %q", tt.text, tt.maxSize, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncateText(%q, %d) split a character", tt.text, tt.maxSize)
+		}
+	}
+}
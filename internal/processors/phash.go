@@ -0,0 +1,113 @@
+package processors
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+
+	"golang.org/x/image/draw"
+)
+
+// Metadata keys of the perceptual hashes computed for images
+const (
+	MetadataPHash = "phash"
+	MetadataDHash = "dhash"
+)
+
+// pHashSize is the size of the grayscale image the DCT of a pHash is taken over
+const pHashSize = 32
+
+// PerceptualHash computes the 64-bit pHash of an image: the signs, relative to
+// their median, of the lowest frequencies of the DCT of a 32x32 grayscale copy.
+// Resizing, recompression and small edits change only a few bits.
+func PerceptualHash(img image.Image) uint64 {
+	pixels := grayscale(img, pHashSize, pHashSize)
+
+	// 2D DCT-II, keeping only the 8x8 lowest frequencies
+	var dct [8][8]float64
+	for u := 0; u < 8; u++ {
+		for v := 0; v < 8; v++ {
+			sum := 0.0
+			for y := 0; y < pHashSize; y++ {
+				for x := 0; x < pHashSize; x++ {
+					sum += pixels[y][x] *
+						math.Cos(float64(2*x+1)*float64(u)*math.Pi/(2*pHashSize)) *
+						math.Cos(float64(2*y+1)*float64(v)*math.Pi/(2*pHashSize))
+				}
+			}
+			dct[v][u] = sum
+		}
+	}
+
+	// The DC term is the average brightness, so it is left out of the median
+	coefficients := make([]float64, 0, 63)
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			if u != 0 || v != 0 {
+				coefficients = append(coefficients, dct[v][u])
+			}
+		}
+	}
+	sorted := append([]float64(nil), coefficients...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	var hash uint64
+	for i, c := range coefficients {
+		if c > median {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// DifferenceHash computes the 64-bit dHash of an image: whether each pixel of
+// a 9x8 grayscale copy is brighter than its right-hand neighbour
+func DifferenceHash(img image.Image) uint64 {
+	pixels := grayscale(img, 9, 8)
+
+	var hash uint64
+	bit := uint(0)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if pixels[y][x] > pixels[y][x+1] {
+				hash |= 1 << bit
+			}
+			bit++
+		}
+	}
+	return hash
+}
+
+// HammingDistance returns the number of bits that differ between two hashes
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// FormatImageHash formats a hash as 16 hex digits, as stored in metadata
+func FormatImageHash(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+// ParseImageHash parses a hash formatted by FormatImageHash
+func ParseImageHash(s string) (uint64, error) {
+	return strconv.ParseUint(s, 16, 64)
+}
+
+// grayscale scales an image to width x height and returns its luminance
+func grayscale(img image.Image, width, height int) [][]float64 {
+	small := image.NewGray(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(small, small.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	pixels := make([][]float64, height)
+	for y := 0; y < height; y++ {
+		pixels[y] = make([]float64, width)
+		for x := 0; x < width; x++ {
+			pixels[y][x] = float64(small.GrayAt(x, y).Y)
+		}
+	}
+	return pixels
+}
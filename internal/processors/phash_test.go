@@ -0,0 +1,116 @@
+package processors
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"testing"
+)
+
+// scene draws a smooth picture with a few bright and dark blobs, like a
+// photo seen from afar. Different seeds place the blobs differently.
+func scene(width, height int, seed float64) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			u, v := float64(x)/float64(width), float64(y)/float64(height)
+			l := 0.5 + 0.25*math.Sin(6*u+seed) + 0.25*math.Cos(5*v*seed+1) + 0.2*math.Sin(9*u*v+seed*2)
+			c := uint8(math.Max(0, math.Min(255, l*200)))
+			img.SetNRGBA(x, y, color.NRGBA{c, uint8(float64(c) * u), uint8(255 * v), 255})
+		}
+	}
+	return img
+}
+
+// recompressed encodes img as a low quality JPEG and decodes it again
+func recompressed(t *testing.T, img image.Image) image.Image {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 30}); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+// brightened adds delta to every channel of img
+func brightened(img *image.NRGBA, delta int) *image.NRGBA {
+	out := image.NewNRGBA(img.Bounds())
+	for i, v := range img.Pix {
+		if i%4 == 3 {
+			out.Pix[i] = v
+			continue
+		}
+		out.Pix[i] = uint8(max(0, min(255, int(v)+delta)))
+	}
+	return out
+}
+
+func TestImageHashStability(t *testing.T) {
+	original := scene(400, 300, 1)
+	edits := map[string]image.Image{
+		"same":         original,
+		"resized":      resizeToFit(original, 100, 100),
+		"upscaled":     resizeExact(original, 800, 600),
+		"recompressed": recompressed(t, original),
+		"brightened":   brightened(original, 20),
+	}
+
+	for name, hash := range map[string]func(image.Image) uint64{"pHash": PerceptualHash, "dHash": DifferenceHash} {
+		base := hash(original)
+		if hash(original) != base {
+			t.Errorf("%s isn't deterministic", name)
+		}
+		for edit, img := range edits {
+			if d := HammingDistance(base, hash(img)); d > 6 {
+				t.Errorf("%s of %s image is %d bits away, want at most 6", name, edit, d)
+			}
+		}
+
+		// Different pictures are far apart
+		for _, other := range []image.Image{scene(400, 300, 2.5), applyOrientation(original, 6)} {
+			if d := HammingDistance(base, hash(other)); d <= 10 {
+				t.Errorf("%s of a different image is only %d bits away", name, d)
+			}
+		}
+	}
+}
+
+func TestImageHashFormat(t *testing.T) {
+	for _, hash := range []uint64{0, 1, 0xdeadbeef, math.MaxUint64} {
+		s := FormatImageHash(hash)
+		if len(s) != 16 {
+			t.Errorf("FormatImageHash(%x) = %q, want 16 digits", hash, s)
+		}
+		if parsed, err := ParseImageHash(s); err != nil || parsed != hash {
+			t.Errorf("ParseImageHash(%q) = %x, %v; want %x", s, parsed, err, hash)
+		}
+	}
+	for _, bad := range []string{"", "xyz", "10000000000000000"} {
+		if _, err := ParseImageHash(bad); err == nil {
+			t.Errorf("ParseImageHash(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestHammingDistance(t *testing.T) {
+	tests := []struct {
+		a, b uint64
+		want int
+	}{
+		{0, 0, 0},
+		{0, 1, 1},
+		{0b1010, 0b0101, 4},
+		{0, math.MaxUint64, 64},
+	}
+	for _, tt := range tests {
+		if got := HammingDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("HammingDistance(%b, %b) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
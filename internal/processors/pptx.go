@@ -0,0 +1,325 @@
+package processors
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// SlideSummary holds the text extracted from one slide
+type SlideSummary struct {
+	Number int    `json:"number"`
+	Title  string `json:"title,omitempty"`
+	Text   string `json:"text"`
+	Notes  string `json:"notes,omitempty"`
+}
+
+// MediaItem describes a media file embedded in a document
+type MediaItem struct {
+	Name        string `json:"name"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+}
+
+// PresentationDocument is the structured data produced by the PPTX processor
+type PresentationDocument struct {
+	Slides []SlideSummary `json:"slides"`
+	Media  []MediaItem    `json:"media"`
+}
+
+// PPTXProcessor processes PowerPoint presentations (.pptx)
+type PPTXProcessor struct{}
+
+// NewPPTXProcessor creates a new presentation processor
+func NewPPTXProcessor() *PPTXProcessor {
+	return &PPTXProcessor{}
+}
+
+// Process processes a presentation
+func (p *PPTXProcessor) Process(ctx context.Context, reader io.Reader, filename string, options ProcessOptions) (*ProcessResult, error) {
+	// Read the entire presentation into memory, up to the memory limit
+	data, err := readAllLimited(reader, options.memoryLimit())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read presentation: %w", err)
+	}
+
+	pkg, err := openOfficePackage(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse presentation: %w", err)
+	}
+	slides, err := readSlides(pkg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse presentation: %w", err)
+	}
+	doc := &PresentationDocument{
+		Slides: slides,
+		Media:  mediaInventory(pkg),
+	}
+
+	result := &ProcessResult{
+		Metadata: make(map[string]string),
+		Data:     doc,
+	}
+
+	var allText strings.Builder
+	titles := make([]string, 0, len(doc.Slides))
+	slidesWithNotes := 0
+	for _, slide := range doc.Slides {
+		allText.WriteString(slide.Text)
+		allText.WriteString("\n")
+		if slide.Title != "" {
+			titles = append(titles, slide.Title)
+		}
+		if slide.Notes != "" {
+			slidesWithNotes++
+		}
+	}
+	numWords := len(strings.Fields(allText.String()))
+
+	// Generate summary
+	result.Summary = fmt.Sprintf("Presentation with %d slides, %d words, and %d media files",
+		len(doc.Slides), numWords, len(doc.Media))
+
+	// Extract metadata
+	if options.ExtractMetadata {
+		pkg.addCoreProperties(result.Metadata)
+
+		result.Metadata["slides"] = fmt.Sprintf("%d", len(doc.Slides))
+		result.Metadata["words"] = fmt.Sprintf("%d", numWords)
+		result.Metadata["slidesWithNotes"] = fmt.Sprintf("%d", slidesWithNotes)
+		result.Metadata["media"] = fmt.Sprintf("%d", len(doc.Media))
+		if len(titles) > 0 {
+			result.Metadata["slideTitles"] = strings.Join(titles, "; ")
+		}
+
+		mediaTypes := make(map[string]int)
+		for _, item := range doc.Media {
+			mediaTypes[item.ContentType]++
+		}
+		if len(mediaTypes) > 0 {
+			types := make([]string, 0, len(mediaTypes))
+			for t, n := range mediaTypes {
+				types = append(types, fmt.Sprintf("%s:%d", t, n))
+			}
+			sort.Strings(types)
+			result.Metadata["mediaTypes"] = strings.Join(types, ",")
+		}
+	}
+
+	// Generate an outline of the slides as the preview
+	if options.GeneratePreview {
+		maxSize := options.MaxPreviewSize
+		if maxSize <= 0 {
+			maxSize = 1024 // Default to 1KB
+		}
+
+		result.Preview = []byte(truncateText(presentationOutline(doc), maxSize))
+	}
+
+	return result, nil
+}
+
+// slideText returns the title of a slide and the text of its other shapes,
+// one paragraph per line. Titles are the shapes with a title placeholder.
+func slideText(f *zip.File) (string, string) {
+	if f == nil {
+		return "", ""
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return "", ""
+	}
+	defer rc.Close()
+
+	var title, body strings.Builder
+	target := &body
+	isTitle, inText, newParagraph := false, false, false
+	decoder := xml.NewDecoder(rc)
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "sp":
+				isTitle = false
+			case "ph":
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "type" && (attr.Value == "title" || attr.Value == "ctrTitle") {
+						isTitle = true
+					}
+				}
+			case "p":
+				target = &body
+				if isTitle {
+					target = &title
+				}
+				newParagraph = true
+			case "t":
+				inText = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "sp":
+				isTitle = false
+			case "t":
+				inText = false
+			}
+		case xml.CharData:
+			if !inText || len(t) == 0 {
+				continue
+			}
+			// Empty paragraphs don't add blank lines
+			if newParagraph && target.Len() > 0 {
+				target.WriteString("\n")
+			}
+			newParagraph = false
+			target.Write(t)
+		}
+	}
+
+	return strings.TrimSpace(strings.ReplaceAll(title.String(), "\n", " ")), strings.TrimSpace(body.String())
+}
+
+// presentationOutline renders slide titles with their text as an indented outline
+func presentationOutline(doc *PresentationDocument) string {
+	var b strings.Builder
+	for _, slide := range doc.Slides {
+		title := slide.Title
+		if title == "" {
+			title = "(untitled)"
+		}
+		fmt.Fprintf(&b, "%d. %s\n", slide.Number, title)
+		for _, line := range strings.Split(slide.Text, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				fmt.Fprintf(&b, "   - %s\n", line)
+			}
+		}
+	}
+	return b.String()
+}
+
+// readSlides returns the text and speaker notes of each slide, in presentation order
+func readSlides(pkg *officePackage) ([]SlideSummary, error) {
+	// The slide order comes from the slide ID list in presentation.xml
+	part := pkg.mainPart("ppt/presentation.xml")
+	var pres struct {
+		XMLName  xml.Name
+		SlideIDs []struct {
+			RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sldIdLst>sldId"`
+	}
+	if err := readZipXML(pkg.files[part], &pres); err != nil {
+		return nil, fmt.Errorf("failed to read presentation: %w", err)
+	}
+	if pres.XMLName.Local != "presentation" {
+		return nil, fmt.Errorf("main part is a %s, not a presentation", pres.XMLName.Local)
+	}
+	presRels := relationshipTargets(pkg.files, part)
+
+	slides := make([]SlideSummary, len(pres.SlideIDs))
+	for i, id := range pres.SlideIDs {
+		slides[i].Number = i + 1
+		slidePath := presRels[id.RelID]
+		if slidePath == "" {
+			continue
+		}
+		slides[i].Title, slides[i].Text = slideText(pkg.files[slidePath])
+		for _, target := range relationshipTargetsByType(pkg.files, slidePath, "/notesSlide") {
+			slides[i].Notes = notesText(pkg.files[target])
+		}
+	}
+	return slides, nil
+}
+
+// notesText extracts the text of the body placeholder of a notes slide
+func notesText(f *zip.File) string {
+	if f == nil {
+		return ""
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return ""
+	}
+	defer rc.Close()
+
+	var b strings.Builder
+	decoder := xml.NewDecoder(rc)
+	inBody, inText := false, false
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "sp":
+				inBody = false
+			case "ph":
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "type" && attr.Value == "body" {
+						inBody = true
+					}
+				}
+			case "p":
+				if inBody && b.Len() > 0 {
+					b.WriteString("\n")
+				}
+			case "t":
+				inText = inBody
+			}
+		case xml.EndElement:
+			if t.Name.Local == "t" {
+				inText = false
+			}
+		case xml.CharData:
+			if inText {
+				b.Write(t)
+			}
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// mediaInventory lists the media files embedded in a presentation, by name
+func mediaInventory(pkg *officePackage) []MediaItem {
+	var items []MediaItem
+	for name, f := range pkg.files {
+		if !strings.HasPrefix(name, "ppt/media/") || strings.HasSuffix(name, "/") {
+			continue
+		}
+		items = append(items, MediaItem{
+			Name:        path.Base(name),
+			ContentType: GetContentTypeByExt(name),
+			Size:        int64(f.UncompressedSize64),
+		})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return items
+}
+
+// Name returns the processor name
+func (p *PPTXProcessor) Name() string {
+	return "pptx"
+}
+
+// CanProcess returns true if this processor can process the given content type
+func (p *PPTXProcessor) CanProcess(contentType, ext string) bool {
+	if contentType == "application/vnd.openxmlformats-officedocument.presentationml.presentation" {
+		return true
+	}
+	return strings.ToLower(ext) == ".pptx"
+}
+
+// init registers the processor with the registry
+func init() {
+	Register(NewPPTXProcessor(), "application/vnd.openxmlformats-officedocument.presentationml.presentation")
+}
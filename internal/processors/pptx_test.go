@@ -0,0 +1,109 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// processPresentation runs the PPTX processor over the presentation
+// fixture: a title slide, a slide with speaker notes and an image that is
+// second in the slide list though stored third, and an untitled last slide
+func processPresentation(t *testing.T, options ProcessOptions) *ProcessResult {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "presentation.pptx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := NewPPTXProcessor().Process(context.Background(), bytes.NewReader(data), "presentation.pptx", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestPPTXProcessorSlides(t *testing.T) {
+	result := processPresentation(t, ProcessOptions{})
+	doc := result.Data.(*PresentationDocument)
+
+	// Title paragraphs are joined, empty body paragraphs dropped
+	want := []SlideSummary{
+		{Number: 1, Title: "Quarterly review 2024", Text: "Überblick für das Team"},
+		{Number: 2, Title: "Numbers", Text: "Revenue up 12%\nCosts flat", Notes: "Mention the café\nopening date"},
+		{Number: 3, Text: "Thanks — questions?"},
+	}
+	if !reflect.DeepEqual(doc.Slides, want) {
+		t.Errorf("slides = %+v, want %+v", doc.Slides, want)
+	}
+
+	wantMedia := []MediaItem{
+		{Name: "clip.mp4", ContentType: "video/mp4", Size: 100},
+		{Name: "image1.png", ContentType: "image/png", Size: 12},
+	}
+	if !reflect.DeepEqual(doc.Media, wantMedia) {
+		t.Errorf("media = %+v, want %+v", doc.Media, wantMedia)
+	}
+	if want := "Presentation with 3 slides, 12 words, and 2 media files"; result.Summary != want {
+		t.Errorf("summary = %q, want %q", result.Summary, want)
+	}
+}
+
+func TestPPTXProcessorMetadata(t *testing.T) {
+	result := processPresentation(t, ProcessOptions{ExtractMetadata: true})
+
+	want := map[string]string{
+		"title":           "Quarterly review",
+		"author":          "Ada Lovelace",
+		"created":         "2024-04-02T08:00:00Z",
+		"slides":          "3",
+		"words":           "12",
+		"slidesWithNotes": "1",
+		"media":           "2",
+		"slideTitles":     "Quarterly review 2024; Numbers",
+		"mediaTypes":      "image/png:1,video/mp4:1",
+	}
+	if !reflect.DeepEqual(result.Metadata, want) {
+		t.Errorf("metadata = %v, want %v", result.Metadata, want)
+	}
+}
+
+func TestPPTXProcessorOutline(t *testing.T) {
+	result := processPresentation(t, ProcessOptions{GeneratePreview: true})
+	want := "1. Quarterly review 2024\n" +
+		"   - Überblick für das Team\n" +
+		"2. Numbers\n" +
+		"   - Revenue up 12%\n" +
+		"   - Costs flat\n" +
+		"3. (untitled)\n" +
+		"   - Thanks — questions?\n"
+	if string(result.Preview) != want {
+		t.Errorf("preview =\n%s\nwant\n%s", result.Preview, want)
+	}
+
+	// A limit that falls inside the Ü backs off to the character's start
+	result = processPresentation(t, ProcessOptions{GeneratePreview: true, MaxPreviewSize: 31})
+	if preview := string(result.Preview); preview != want[:30] || !utf8.ValidString(preview) {
+		t.Errorf("truncated preview = %q, want %q", preview, want[:30])
+	}
+}
+
+func TestPPTXProcessorInvalid(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "workbook.xlsx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{
+		"not a zip":          []byte("slides"),
+		"not a presentation": data,
+	} {
+		_, err := NewPPTXProcessor().Process(context.Background(), bytes.NewReader(data), "bad.pptx", ProcessOptions{})
+		if err == nil || !strings.Contains(err.Error(), "failed to parse presentation") {
+			t.Errorf("%s: err = %v, want a parse error", name, err)
+		}
+	}
+}
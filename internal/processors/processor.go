@@ -3,9 +3,14 @@ package processors
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"mime"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 // ProcessResult contains the results of processing a file
@@ -21,6 +26,12 @@ type ProcessResult struct {
 	
 	// Processed data (type depends on processor)
 	Data interface{}
+	
+	// Files derived from the input (e.g. extracted audio) that should be stored alongside it
+	Derived []DerivedFile
+
+	// Temporary directories holding the content of derived files, removed by Cleanup
+	tempDirs []string
 }
 
 // ProcessOptions contains options for file processing
@@ -33,14 +44,88 @@ type ProcessOptions struct {
 	
 	// Whether to extract metadata
 	ExtractMetadata bool
+
+	// Largest input in bytes a processor holds in memory (0 for
+	// DefaultMaxMemorySize); larger inputs are streamed or rejected
+	MaxMemorySize int64
 	
 	// Additional processor-specific options
 	Options map[string]interface{}
+
+	// Processor forces the processor with this name instead of selecting one
+	// by content type (empty for automatic selection)
+	Processor string
+
+	// Levels of archives the input is nested in. Kept out of Options so a
+	// request can't reset it and extract archives without end.
+	archiveDepth int
+
+	// What is left of the extraction limits of the outermost archive, shared
+	// by the archives nested in it
+	extractBudget *extractBudget
+}
+
+// Bool returns a boolean processor-specific option
+func (o ProcessOptions) Bool(key string) bool {
+	switch v := o.Options[key].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true" || v == "1"
+	}
+	return false
+}
+
+// Int returns an integer processor-specific option, or defaultVal if it isn't set
+func (o ProcessOptions) Int(key string, defaultVal int) int {
+	switch v := o.Options[key].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		// Numbers decoded from JSON are float64
+		return int(v)
+	case string:
+		return parseIntSafe(v, defaultVal)
+	}
+	return defaultVal
+}
+
+// Float returns a number processor-specific option, or defaultVal if it isn't set
+func (o ProcessOptions) Float(key string, defaultVal float64) float64 {
+	switch v := o.Options[key].(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return defaultVal
+}
+
+// String returns a string processor-specific option, or defaultVal if it isn't set
+func (o ProcessOptions) String(key, defaultVal string) string {
+	if v, ok := o.Options[key].(string); ok && v != "" {
+		return v
+	}
+	return defaultVal
 }
 
 // FileProcessor is the interface that all file processors must implement
 type FileProcessor interface {
-	// Process processes a file and returns the result
+	// Name returns the short name used to select this processor (e.g. "image")
+	Name() string
+	
+	// Process processes a file and returns the result. The reader is read
+	// once, front to back, and may be larger than memory: processors stream
+	// it, spool it to a temporary file, or read at most
+	// options.MaxMemorySize bytes of it and fail with ErrFileTooLarge.
 	Process(ctx context.Context, reader io.Reader, filename string, options ProcessOptions) (*ProcessResult, error)
 	
 	// CanProcess returns true if this processor can process files with the given content type or extension
@@ -62,54 +147,234 @@ func GetContentTypeByExt(filename string) string {
 	return contentType
 }
 
+// Processor priorities. When several processors can handle a file the one with
+// the highest priority wins; ties are broken by name so selection is deterministic.
+const (
+	PriorityFallback = -100 // Generic processors used only when nothing more specific matches
+	PriorityDefault  = 0
+	PriorityHigh     = 100
+)
+
+// registration records a processor with its selection settings
+type registration struct {
+	processor    FileProcessor
+	priority     int
+	enabled      bool
+	contentTypes []string
+}
+
+// ProcessorInfo describes a registered processor
+type ProcessorInfo struct {
+	Name         string   `json:"name"`
+	Priority     int      `json:"priority"`
+	Enabled      bool     `json:"enabled"`
+	ContentTypes []string `json:"contentTypes"`
+
+	// Features that depend on external tools, and the tools that are missing
+	Features            []FeatureStatus `json:"features,omitempty"`
+	MissingDependencies []string        `json:"missingDependencies,omitempty"`
+}
+
 // ProcessorRegistry maintains a registry of processors by content type
 type ProcessorRegistry struct {
 	processors map[string][]FileProcessor
+	byName     map[string]*registration
+	mu         sync.RWMutex
 }
 
 // NewProcessorRegistry creates a new processor registry
 func NewProcessorRegistry() *ProcessorRegistry {
 	return &ProcessorRegistry{
 		processors: make(map[string][]FileProcessor),
+		byName:     make(map[string]*registration),
 	}
 }
 
-// Register registers a processor for a specific content type
+// Register registers a processor for specific content types with the default priority
 func (r *ProcessorRegistry) Register(processor FileProcessor, contentTypes ...string) {
+	r.RegisterWithPriority(processor, PriorityDefault, contentTypes...)
+}
+
+// RegisterWithPriority registers a processor for specific content types with the given priority
+func (r *ProcessorRegistry) RegisterWithPriority(processor FileProcessor, priority int, contentTypes ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.byName[processor.Name()] = &registration{
+		processor:    processor,
+		priority:     priority,
+		enabled:      true,
+		contentTypes: contentTypes,
+	}
 	for _, contentType := range contentTypes {
-		if _, ok := r.processors[contentType]; !ok {
-			r.processors[contentType] = []FileProcessor{}
-		}
 		r.processors[contentType] = append(r.processors[contentType], processor)
 	}
 }
 
-// GetProcessor returns a processor that can handle the given content type and extension
+// GetProcessor returns the highest priority enabled processor that can handle
+// the given content type and extension
 func (r *ProcessorRegistry) GetProcessor(contentType, ext string) FileProcessor {
-	// Try direct content type match
-	if processors, ok := r.processors[contentType]; ok && len(processors) > 0 {
-		return processors[0]
+	matches := r.GetProcessors(contentType, ext)
+	if len(matches) == 0 {
+		return nil
 	}
-	
-	// Try matching by extension
-	// Convert extension to content type and try again
-	extContentType := GetContentTypeByExt(ext)
-	if processors, ok := r.processors[extContentType]; ok && len(processors) > 0 {
-		return processors[0]
+	return matches[0]
+}
+
+// GetProcessors returns every enabled processor that can handle the given
+// content type and extension, ordered by priority
+func (r *ProcessorRegistry) GetProcessors(contentType, ext string) []FileProcessor {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// Processors registered for the content type, or for the type implied by
+	// the extension, match; so does any processor that claims the file itself
+	matched := make(map[string]*registration)
+	for _, ct := range []string{contentType, GetContentTypeByExt(ext)} {
+		// Registrations don't carry parameters such as "; charset=utf-8"
+		if i := strings.Index(ct, ";"); i >= 0 {
+			ct = strings.TrimSpace(ct[:i])
+		}
+		for _, processor := range r.processors[ct] {
+			matched[processor.Name()] = r.byName[processor.Name()]
+		}
 	}
-	
-	// Try finding a processor that can handle this type
-	for _, processors := range r.processors {
-		for _, processor := range processors {
-			if processor.CanProcess(contentType, ext) {
-				return processor
-			}
+	for name, reg := range r.byName {
+		if _, ok := matched[name]; !ok && reg.processor.CanProcess(contentType, ext) {
+			matched[name] = reg
+		}
+	}
+
+	regs := make([]*registration, 0, len(matched))
+	for _, reg := range matched {
+		if reg.enabled {
+			regs = append(regs, reg)
+		}
+	}
+	sortRegistrations(regs)
+
+	result := make([]FileProcessor, len(regs))
+	for i, reg := range regs {
+		result[i] = reg.processor
+	}
+	return result
+}
+
+// GetProcessorByName returns the registered processor with the given name, or
+// nil if there is none or it is disabled
+func (r *ProcessorRegistry) GetProcessorByName(name string) FileProcessor {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	reg, ok := r.byName[name]
+	if !ok || !reg.enabled {
+		return nil
+	}
+	return reg.processor
+}
+
+// SelectProcessor returns the processor named by override, or the best match
+// for the content type and extension when override is empty
+func (r *ProcessorRegistry) SelectProcessor(override, contentType, ext string) (FileProcessor, error) {
+	if override != "" {
+		processor := r.GetProcessorByName(override)
+		if processor == nil {
+			return nil, fmt.Errorf("%w: %s", ErrProcessorNotFound, override)
+		}
+		return processor, nil
+	}
+
+	processor := r.GetProcessor(contentType, ext)
+	if processor == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFileType, contentType)
+	}
+	return processor, nil
+}
+
+// SetEnabled enables or disables a processor by name
+func (r *ProcessorRegistry) SetEnabled(name string, enabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reg, ok := r.byName[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrProcessorNotFound, name)
+	}
+	reg.enabled = enabled
+	return nil
+}
+
+// SetPriority changes the priority of a processor by name
+func (r *ProcessorRegistry) SetPriority(name string, priority int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reg, ok := r.byName[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrProcessorNotFound, name)
+	}
+	reg.priority = priority
+	return nil
+}
+
+// List describes every registered processor, ordered by priority, with the
+// availability of the features that depend on DefaultTools
+func (r *ProcessorRegistry) List() []ProcessorInfo {
+	r.mu.RLock()
+	regs := make([]*registration, 0, len(r.byName))
+	for _, reg := range r.byName {
+		regs = append(regs, reg)
+	}
+	sortRegistrations(regs)
+
+	infos := make([]ProcessorInfo, len(regs))
+	for i, reg := range regs {
+		infos[i] = ProcessorInfo{
+			Name:         reg.processor.Name(),
+			Priority:     reg.priority,
+			Enabled:      reg.enabled,
+			ContentTypes: append([]string(nil), reg.contentTypes...),
+		}
+	}
+	r.mu.RUnlock()
+
+	// Detecting a tool may run it, so it happens outside the lock
+	for i, reg := range regs {
+		infos[i].Features, infos[i].MissingDependencies = featureStatuses(reg.processor, DefaultTools)
+	}
+	return infos
+}
+
+// Configure applies processor settings from the application configuration:
+// the names of processors to disable and priority overrides by name
+func (r *ProcessorRegistry) Configure(disabled []string, priorities map[string]int) error {
+	for _, name := range disabled {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if err := r.SetEnabled(name, false); err != nil {
+			return err
+		}
+	}
+	for name, priority := range priorities {
+		if err := r.SetPriority(name, priority); err != nil {
+			return err
 		}
 	}
-	
 	return nil
 }
 
+// sortRegistrations orders registrations by descending priority, then by name
+func sortRegistrations(regs []*registration) {
+	sort.Slice(regs, func(i, j int) bool {
+		if regs[i].priority != regs[j].priority {
+			return regs[i].priority > regs[j].priority
+		}
+		return regs[i].processor.Name() < regs[j].processor.Name()
+	})
+}
+
 // DefaultRegistry is the default processor registry
 var DefaultRegistry = NewProcessorRegistry()
 
@@ -121,4 +386,24 @@ func Register(processor FileProcessor, contentTypes ...string) {
 // GetProcessor returns a processor from the default registry
 func GetProcessor(contentType, ext string) FileProcessor {
 	return DefaultRegistry.GetProcessor(contentType, ext)
-}
\ No newline at end of file
+}
+
+// RegisterWithPriority registers a processor with the default registry using the given priority
+func RegisterWithPriority(processor FileProcessor, priority int, contentTypes ...string) {
+	DefaultRegistry.RegisterWithPriority(processor, priority, contentTypes...)
+}
+
+// GetProcessors returns every matching processor from the default registry
+func GetProcessors(contentType, ext string) []FileProcessor {
+	return DefaultRegistry.GetProcessors(contentType, ext)
+}
+
+// GetProcessorByName returns a processor by name from the default registry
+func GetProcessorByName(name string) FileProcessor {
+	return DefaultRegistry.GetProcessorByName(name)
+}
+
+// SelectProcessor selects a processor from the default registry, honoring a by-name override
+func SelectProcessor(override, contentType, ext string) (FileProcessor, error) {
+	return DefaultRegistry.SelectProcessor(override, contentType, ext)
+}
@@ -0,0 +1,180 @@
+package processors
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// fakeProcessor is a processor that claims the extensions it is given
+type fakeProcessor struct {
+	name string
+	exts []string
+}
+
+func (p *fakeProcessor) Name() string { return p.name }
+
+func (p *fakeProcessor) Process(ctx context.Context, reader io.Reader, filename string, options ProcessOptions) (*ProcessResult, error) {
+	return &ProcessResult{Summary: p.name}, nil
+}
+
+func (p *fakeProcessor) CanProcess(contentType, ext string) bool {
+	for _, e := range p.exts {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// processorNames returns the names of processors, in order
+func processorNames(processors []FileProcessor) []string {
+	names := make([]string, len(processors))
+	for i, processor := range processors {
+		names[i] = processor.Name()
+	}
+	return names
+}
+
+// newTestRegistry returns a registry with processors that overlap on .json and .csv
+func newTestRegistry() *ProcessorRegistry {
+	r := NewProcessorRegistry()
+	r.RegisterWithPriority(&fakeProcessor{name: "text", exts: []string{".txt", ".json", ".csv"}}, PriorityFallback, "text/plain")
+	r.Register(&fakeProcessor{name: "json"}, "application/json")
+	r.Register(&fakeProcessor{name: "csv"}, "text/csv")
+	r.Register(&fakeProcessor{name: "tabular", exts: []string{".csv"}})
+	return r
+}
+
+func TestRegistryOrdering(t *testing.T) {
+	r := newTestRegistry()
+	tests := []struct {
+		contentType, ext string
+		want             []string
+	}{
+		{"application/json", ".json", []string{"json", "text"}},
+		// Equal priorities are ordered by name
+		{"text/csv", ".csv", []string{"csv", "tabular", "text"}},
+		// The content type implied by the extension matches too
+		{"application/octet-stream", ".csv", []string{"csv", "tabular", "text"}},
+		{"text/plain", ".txt", []string{"text"}},
+		{"application/zip", ".zip", []string{}},
+	}
+	for _, tt := range tests {
+		got := processorNames(r.GetProcessors(tt.contentType, tt.ext))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GetProcessors(%q, %q) = %v, want %v", tt.contentType, tt.ext, got, tt.want)
+		}
+	}
+
+	// Raising a priority moves the processor ahead of its ties
+	if err := r.SetPriority("tabular", PriorityHigh); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.GetProcessor("text/csv", ".csv").Name(); got != "tabular" {
+		t.Errorf("GetProcessor after raising tabular = %s, want tabular", got)
+	}
+}
+
+func TestRegistryDisabled(t *testing.T) {
+	r := newTestRegistry()
+	if err := r.Configure([]string{" csv ", ""}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := processorNames(r.GetProcessors("text/csv", ".csv")); !reflect.DeepEqual(got, []string{"tabular", "text"}) {
+		t.Errorf("GetProcessors with csv disabled = %v, want [tabular text]", got)
+	}
+	if r.GetProcessorByName("csv") != nil {
+		t.Error("GetProcessorByName returned a disabled processor")
+	}
+	if _, err := r.SelectProcessor("csv", "text/csv", ".csv"); !errors.Is(err, ErrProcessorNotFound) {
+		t.Errorf("SelectProcessor of a disabled processor: err = %v, want ErrProcessorNotFound", err)
+	}
+
+	// Disabling every match leaves the file unsupported
+	if err := r.Configure([]string{"tabular", "text"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.SelectProcessor("", "text/csv", ".csv"); !errors.Is(err, ErrUnsupportedFileType) {
+		t.Errorf("SelectProcessor with all matches disabled: err = %v, want ErrUnsupportedFileType", err)
+	}
+
+	// The listing still includes disabled processors
+	for _, info := range r.List() {
+		if info.Name == "csv" && info.Enabled {
+			t.Error("List reports csv as enabled")
+		}
+	}
+
+	if err := r.SetEnabled("csv", true); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.GetProcessor("text/csv", ".csv"); got == nil || got.Name() != "csv" {
+		t.Errorf("GetProcessor after enabling csv = %v, want csv", got)
+	}
+}
+
+func TestRegistryOverride(t *testing.T) {
+	r := newTestRegistry()
+	tests := []struct {
+		override, contentType, ext string
+		want                       string
+		err                        error
+	}{
+		{"", "application/json", ".json", "json", nil},
+		// An override wins even over a better content type match
+		{"text", "application/json", ".json", "text", nil},
+		{"csv", "application/json", ".json", "csv", nil},
+		{"missing", "application/json", ".json", "", ErrProcessorNotFound},
+		{"", "application/zip", ".zip", "", ErrUnsupportedFileType},
+	}
+	for _, tt := range tests {
+		processor, err := r.SelectProcessor(tt.override, tt.contentType, tt.ext)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("SelectProcessor(%q, %q): err = %v, want %v", tt.override, tt.contentType, err, tt.err)
+			continue
+		}
+		if err == nil && processor.Name() != tt.want {
+			t.Errorf("SelectProcessor(%q, %q) = %s, want %s", tt.override, tt.contentType, processor.Name(), tt.want)
+		}
+	}
+}
+
+func TestRegistryConfigure(t *testing.T) {
+	r := newTestRegistry()
+	if err := r.Configure(nil, map[string]int{"text": PriorityHigh}); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.GetProcessor("application/json", ".json").Name(); got != "text" {
+		t.Errorf("GetProcessor with raised text priority = %s, want text", got)
+	}
+
+	if err := r.Configure([]string{"missing"}, nil); !errors.Is(err, ErrProcessorNotFound) {
+		t.Errorf("disabling an unknown processor: err = %v, want ErrProcessorNotFound", err)
+	}
+	if err := r.Configure(nil, map[string]int{"missing": 1}); !errors.Is(err, ErrProcessorNotFound) {
+		t.Errorf("prioritizing an unknown processor: err = %v, want ErrProcessorNotFound", err)
+	}
+}
+
+func TestDefaultRegistryOverlaps(t *testing.T) {
+	tests := []struct {
+		contentType, ext string
+		want             string
+	}{
+		// The specific processor beats the text fallback that also reads CSV
+		{"text/csv", ".csv", "csv"},
+		{"application/json", ".json", "text"},
+		{"text/plain", ".txt", "text"},
+		{"application/zip", ".zip", "archive"},
+	}
+	for _, tt := range tests {
+		processor := GetProcessor(tt.contentType, tt.ext)
+		if processor == nil || processor.Name() != tt.want {
+			t.Errorf("GetProcessor(%q, %q) = %v, want %s", tt.contentType, tt.ext, processor, tt.want)
+		}
+	}
+}
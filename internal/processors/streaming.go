@@ -0,0 +1,351 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Adaptive streaming formats
+const (
+	StreamHLS  = "hls"
+	StreamDASH = "dash"
+)
+
+// Entry points of the streams, relative to the stream root
+const (
+	HLSPlaylist  = "hls/master.m3u8"
+	DASHManifest = "dash/manifest.mpd"
+)
+
+// StreamRolePrefix prefixes the derived file role of stream playlists and
+// segments, followed by their path below the stream root (e.g.
+// "stream:hls/720p/index.m3u8")
+const StreamRolePrefix = "stream:"
+
+// defaultSegmentSeconds is the target duration of stream segments
+const defaultSegmentSeconds = 6
+
+// streamAudioBitrate is the audio bitrate of every rendition, in kbit/s
+const streamAudioBitrate = 128
+
+// Rendition is one rung of a bitrate ladder
+type Rendition struct {
+	Height  int // Frame height in pixels; the width follows the aspect ratio
+	Bitrate int // Video bitrate in kbit/s
+}
+
+// Name returns the rendition's name, such as "720p"
+func (r Rendition) Name() string {
+	return fmt.Sprintf("%dp", r.Height)
+}
+
+// DefaultBitrateLadder is the bitrate ladder streams are encoded with when
+// none is given. Rungs taller than the source video are skipped.
+var DefaultBitrateLadder = []Rendition{
+	{Height: 1080, Bitrate: 5000},
+	{Height: 720, Bitrate: 2800},
+	{Height: 480, Bitrate: 1400},
+	{Height: 360, Bitrate: 800},
+}
+
+// ParseBitrateLadder parses a ladder written as comma-separated
+// height:kbps pairs, such as "1080:5000,720:2800,480:1400"
+func ParseBitrateLadder(s string) ([]Rendition, error) {
+	var ladder []Rendition
+	for _, rung := range strings.Split(s, ",") {
+		rung = strings.TrimSpace(rung)
+		if rung == "" {
+			continue
+		}
+		parts := strings.SplitN(rung, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid rendition %q, expected height:kbps", rung)
+		}
+		height, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(parts[0]), "p"))
+		if err != nil || height <= 0 || height > 4320 {
+			return nil, fmt.Errorf("invalid rendition height %q", parts[0])
+		}
+		bitrate, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(parts[1]), "k"))
+		if err != nil || bitrate <= 0 {
+			return nil, fmt.Errorf("invalid rendition bitrate %q", parts[1])
+		}
+		ladder = append(ladder, Rendition{Height: height, Bitrate: bitrate})
+	}
+	if len(ladder) == 0 {
+		return nil, fmt.Errorf("bitrate ladder is empty")
+	}
+
+	sort.Slice(ladder, func(i, j int) bool { return ladder[i].Height > ladder[j].Height })
+	return ladder, nil
+}
+
+// streamFormats returns the streaming formats requested by the stream option:
+// "hls", "dash" or "hls,dash" (true means HLS)
+func streamFormats(options ProcessOptions) ([]string, error) {
+	if options.Bool("stream") {
+		return []string{StreamHLS}, nil
+	}
+	value := strings.ToLower(options.String("stream", ""))
+	if value == "" || value == "false" || value == "0" {
+		return nil, nil
+	}
+
+	var formats []string
+	for _, format := range strings.Split(value, ",") {
+		format = strings.TrimSpace(format)
+		if format != StreamHLS && format != StreamDASH {
+			return nil, fmt.Errorf("unknown streaming format %q", format)
+		}
+		formats = append(formats, format)
+	}
+	return formats, nil
+}
+
+// streamSource describes the video being transcoded
+type streamSource struct {
+	width, height int
+	duration      float64 // In seconds, 0 if unknown
+	hasAudio      bool
+}
+
+// streamSource describes the first video stream of a probed file, which is
+// the one transcoded
+func (m *MediaInfo) streamSource() (streamSource, error) {
+	videos := m.StreamsOf("video")
+	if len(videos) == 0 || videos[0].Height == 0 {
+		return streamSource{}, fmt.Errorf("no video stream found")
+	}
+	return streamSource{
+		width:    videos[0].Width,
+		height:   videos[0].Height,
+		duration: m.Format.Duration,
+		hasAudio: len(m.StreamsOf("audio")) > 0,
+	}, nil
+}
+
+// renditionsFor returns the rungs of the ladder that aren't taller than the
+// source. A source smaller than every rung gets one rendition at its own
+// height, at the lowest bitrate.
+func renditionsFor(ladder []Rendition, source streamSource) []Rendition {
+	var renditions []Rendition
+	for _, r := range ladder {
+		if r.Height <= source.height {
+			renditions = append(renditions, r)
+		}
+	}
+	if len(renditions) == 0 {
+		lowest := ladder[len(ladder)-1]
+		renditions = []Rendition{{Height: source.height - source.height%2, Bitrate: lowest.Bitrate}}
+	}
+	return renditions
+}
+
+// transcodeStreams encodes a video into adaptive streams with ffmpeg and
+// returns the playlists and segments as derived files, with their paths
+// below the stream root in their roles. The files are left on disk in the
+// returned temporary directory, which the caller removes once they're stored.
+func transcodeStreams(ctx context.Context, input, filename string, info *MediaInfo, formats []string, ladder []Rendition, segmentSeconds int) ([]DerivedFile, []Rendition, string, error) {
+	source, err := info.streamSource()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	renditions := renditionsFor(ladder, source)
+
+	outputDir, err := ioutil.TempDir("", "stream-*")
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	files, err := encodeStreams(ctx, input, filename, outputDir, source, formats, renditions, segmentSeconds)
+	if err != nil {
+		os.RemoveAll(outputDir)
+		return nil, nil, "", err
+	}
+	return files, renditions, outputDir, nil
+}
+
+// encodeStreams encodes the streams into outputDir and lists what ffmpeg wrote
+func encodeStreams(ctx context.Context, input, filename, outputDir string, source streamSource, formats []string, renditions []Rendition, segmentSeconds int) ([]DerivedFile, error) {
+	for _, format := range formats {
+		dir := filepath.Join(outputDir, format)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+
+		var err error
+		switch format {
+		case StreamHLS:
+			err = transcodeHLS(ctx, input, dir, source, renditions, segmentSeconds)
+		case StreamDASH:
+			err = transcodeDASH(ctx, input, dir, source, renditions, segmentSeconds)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Name the stored files after the video so they're easy to tell apart.
+	// Segments are stored from disk rather than read into memory.
+	base := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	var files []DerivedFile
+	err := filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(outputDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		files = append(files, DerivedFile{
+			Name:        base + "_" + strings.ReplaceAll(rel, "/", "_"),
+			Role:        StreamRolePrefix + rel,
+			ContentType: streamContentType(rel),
+			Path:        path,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stream output: %w", err)
+	}
+	return files, nil
+}
+
+// transcodeHLS encodes each rendition into its own media playlist, then writes
+// a master playlist listing them. Keyframes are forced at segment boundaries
+// so players can switch renditions between any two segments.
+func transcodeHLS(ctx context.Context, input, dir string, source streamSource, renditions []Rendition, segmentSeconds int) error {
+	var master strings.Builder
+	master.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+
+	for _, r := range renditions {
+		renditionDir := filepath.Join(dir, r.Name())
+		if err := os.MkdirAll(renditionDir, 0755); err != nil {
+			return fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+
+		args := []string{"-y", "-v", "error", "-i", input, "-map", "0:v:0", "-map", "0:a:0?"}
+		args = append(args, videoEncodeArgs("", r, segmentSeconds)...)
+		args = append(args, "-vf", fmt.Sprintf("scale=-2:%d", r.Height))
+		args = append(args, audioEncodeArgs()...)
+		args = append(args,
+			"-f", "hls",
+			"-hls_time", strconv.Itoa(segmentSeconds),
+			"-hls_playlist_type", "vod",
+			"-hls_segment_filename", filepath.Join(renditionDir, "seg_%05d.ts"),
+			filepath.Join(renditionDir, "index.m3u8"),
+		)
+		if output, err := DefaultTools.Command(ctx, ToolFFmpeg, args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("ffmpeg failed to encode %s HLS rendition: %w: %s", r.Name(), err, strings.TrimSpace(string(output)))
+		}
+
+		bandwidth := r.Bitrate * 1000
+		if source.hasAudio {
+			bandwidth += streamAudioBitrate * 1000
+		}
+		fmt.Fprintf(&master, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d\n%s/index.m3u8\n",
+			bandwidth, scaledWidth(source, r.Height), r.Height, r.Name())
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, "master.m3u8"), []byte(master.String()), 0644)
+}
+
+// transcodeDASH encodes every rendition in one pass into a DASH manifest with
+// fragmented MP4 segments
+func transcodeDASH(ctx context.Context, input, dir string, source streamSource, renditions []Rendition, segmentSeconds int) error {
+	// Split the video once per rendition and scale each copy
+	filter := fmt.Sprintf("[0:v]split=%d", len(renditions))
+	for i := range renditions {
+		filter += fmt.Sprintf("[s%d]", i)
+	}
+	for i, r := range renditions {
+		filter += fmt.Sprintf(";[s%d]scale=-2:%d[v%d]", i, r.Height, i)
+	}
+
+	args := []string{"-y", "-v", "error", "-i", input, "-filter_complex", filter}
+	for i, r := range renditions {
+		args = append(args, "-map", fmt.Sprintf("[v%d]", i))
+		args = append(args, videoEncodeArgs(strconv.Itoa(i), r, segmentSeconds)...)
+	}
+	adaptationSets := "id=0,streams=v"
+	if source.hasAudio {
+		args = append(args, "-map", "0:a:0")
+		args = append(args, audioEncodeArgs()...)
+		adaptationSets += " id=1,streams=a"
+	}
+	args = append(args,
+		"-f", "dash",
+		"-seg_duration", strconv.Itoa(segmentSeconds),
+		"-use_template", "1",
+		"-use_timeline", "1",
+		"-init_seg_name", "init-$RepresentationID$.m4s",
+		"-media_seg_name", "chunk-$RepresentationID$-$Number%05d$.m4s",
+		"-adaptation_sets", adaptationSets,
+		filepath.Join(dir, "manifest.mpd"),
+	)
+
+	if output, err := DefaultTools.Command(ctx, ToolFFmpeg, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("ffmpeg failed to encode DASH stream: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// videoEncodeArgs returns the H.264 encoding arguments of a rendition. The
+// stream specifier selects the output stream they apply to ("" for all).
+func videoEncodeArgs(stream string, r Rendition, segmentSeconds int) []string {
+	suffix := ":v"
+	if stream != "" {
+		suffix += ":" + stream
+	}
+	return []string{
+		"-c" + suffix, "libx264",
+		"-preset" + suffix, "veryfast",
+		"-profile" + suffix, "main",
+		"-b" + suffix, fmt.Sprintf("%dk", r.Bitrate),
+		"-maxrate" + suffix, fmt.Sprintf("%dk", r.Bitrate*107/100),
+		"-bufsize" + suffix, fmt.Sprintf("%dk", r.Bitrate*3/2),
+		"-sc_threshold", "0",
+		"-force_key_frames" + suffix, fmt.Sprintf("expr:gte(t,n_forced*%d)", segmentSeconds),
+	}
+}
+
+// audioEncodeArgs returns the AAC encoding arguments shared by all renditions
+func audioEncodeArgs() []string {
+	return []string{"-c:a", "aac", "-b:a", fmt.Sprintf("%dk", streamAudioBitrate), "-ac", "2"}
+}
+
+// scaledWidth returns the even width of the source scaled to height, as
+// ffmpeg's scale=-2 computes it
+func scaledWidth(source streamSource, height int) int {
+	width := int(float64(source.width)*float64(height)/float64(source.height)/2+0.5) * 2
+	if width < 2 {
+		width = 2
+	}
+	return width
+}
+
+// streamContentType returns the content type of a playlist or segment
+func streamContentType(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".ts":
+		return "video/mp2t"
+	case ".mpd":
+		return "application/dash+xml"
+	case ".m4s":
+		return "video/iso.segment"
+	case ".mp4":
+		return "video/mp4"
+	case ".jpg":
+		return "image/jpeg"
+	case ".vtt":
+		return "text/vtt"
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,143 @@
+package processors
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBitrateLadder(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []Rendition
+		wantErr string
+	}{
+		{"720:2800", []Rendition{{720, 2800}}, ""},
+		// Rungs are sorted tallest first, and may carry units
+		{"480p:1400k, 1080:5000,,720:2800 ", []Rendition{{1080, 5000}, {720, 2800}, {480, 1400}}, ""},
+		{"4320:40000", []Rendition{{4320, 40000}}, ""},
+		{"", nil, "empty"},
+		{" , ", nil, "empty"},
+		{"720", nil, "expected height:kbps"},
+		{"tall:2800", nil, "height"},
+		{"0:2800", nil, "height"},
+		{"8640:2800", nil, "height"},
+		{"720:fast", nil, "bitrate"},
+		{"720:-1", nil, "bitrate"},
+		{"720:2800,480", nil, "expected height:kbps"},
+	}
+	for _, tt := range tests {
+		ladder, err := ParseBitrateLadder(tt.value)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseBitrateLadder(%q) = %v, %v; want an error mentioning %q", tt.value, ladder, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(ladder, tt.want) {
+			t.Errorf("ParseBitrateLadder(%q) = %v, %v; want %v", tt.value, ladder, err, tt.want)
+		}
+	}
+}
+
+func TestRenditionsFor(t *testing.T) {
+	tests := []struct {
+		name   string
+		height int
+		want   []Rendition
+	}{
+		{"full ladder", 1080, DefaultBitrateLadder},
+		{"taller than the ladder", 2160, DefaultBitrateLadder},
+		{"between rungs", 800, []Rendition{{720, 2800}, {480, 1400}, {360, 800}}},
+		{"lowest rung", 360, []Rendition{{360, 800}}},
+		// A source below every rung keeps its own, even, height
+		{"below the ladder", 241, []Rendition{{240, 800}}},
+	}
+	for _, tt := range tests {
+		got := renditionsFor(DefaultBitrateLadder, streamSource{width: tt.height * 16 / 9, height: tt.height})
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: renditions = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStreamFormats(t *testing.T) {
+	tests := []struct {
+		value   interface{}
+		want    []string
+		wantErr bool
+	}{
+		{nil, nil, false},
+		{false, nil, false},
+		{"false", nil, false},
+		{true, []string{StreamHLS}, false},
+		{"dash", []string{StreamDASH}, false},
+		{"HLS, dash", []string{StreamHLS, StreamDASH}, false},
+		{"hls,smooth", nil, true},
+	}
+	for _, tt := range tests {
+		options := ProcessOptions{Options: map[string]interface{}{}}
+		if tt.value != nil {
+			options.Options["stream"] = tt.value
+		}
+		formats, err := streamFormats(options)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(formats, tt.want) {
+			t.Errorf("streamFormats(%v) = %v, %v; want %v", tt.value, formats, err, tt.want)
+		}
+	}
+}
+
+func TestStreamSource(t *testing.T) {
+	info := &MediaInfo{
+		Format: MediaFormat{Duration: 12.5},
+		Streams: []MediaStream{
+			{Type: "video", Width: 300, Height: 300, AttachedPic: true},
+			{Type: "video", Width: 1920, Height: 1080},
+			{Type: "audio"},
+		},
+	}
+	source, err := info.streamSource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (streamSource{width: 1920, height: 1080, duration: 12.5, hasAudio: true}); source != want {
+		t.Errorf("source = %+v, want %+v", source, want)
+	}
+
+	// Cover art alone isn't a video to stream
+	audioOnly := &MediaInfo{Streams: []MediaStream{{Type: "audio"}, {Type: "video", Width: 300, Height: 300, AttachedPic: true}}}
+	if _, err := audioOnly.streamSource(); err == nil {
+		t.Error("expected an error without a video stream")
+	}
+}
+
+func TestScaledWidth(t *testing.T) {
+	tests := []struct {
+		width, height, to int
+		want              int
+	}{
+		{1920, 1080, 720, 1280},
+		{1920, 1080, 480, 854}, // 853.3 rounded to even
+		{1080, 1920, 360, 202},
+		{4, 1000, 10, 2},
+	}
+	for _, tt := range tests {
+		if got := scaledWidth(streamSource{width: tt.width, height: tt.height}, tt.to); got != tt.want {
+			t.Errorf("scaledWidth(%dx%d, %d) = %d, want %d", tt.width, tt.height, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestStreamContentType(t *testing.T) {
+	tests := map[string]string{
+		"hls/master.m3u8":        "application/vnd.apple.mpegurl",
+		"hls/720p/seg_00001.ts":  "video/mp2t",
+		"dash/manifest.mpd":      "application/dash+xml",
+		"dash/chunk-0-00001.M4S": "video/iso.segment",
+	}
+	for path, want := range tests {
+		if got := streamContentType(path); got != want {
+			t.Errorf("streamContentType(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package processors
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SVGDocument is the structured data produced for SVG images, which are
+// parsed rather than rasterized
+type SVGDocument struct {
+	Width        float64        `json:"width"`  // In CSS pixels, 0 if unknown
+	Height       float64        `json:"height"` // In CSS pixels, 0 if unknown
+	ViewBox      string         `json:"viewBox,omitempty"`
+	Title        string         `json:"title,omitempty"`
+	Description  string         `json:"description,omitempty"`
+	Elements     map[string]int `json:"elements"` // Element counts by name
+	Scripts      int            `json:"scripts"`
+	ExternalRefs int            `json:"externalRefs"` // Links to resources outside the document
+}
+
+// svgUnits converts SVG length units to CSS pixels
+var svgUnits = map[string]float64{
+	"":   1,
+	"px": 1,
+	"pt": 96.0 / 72,
+	"pc": 16,
+	"mm": 96 / 25.4,
+	"cm": 96 / 2.54,
+	"in": 96,
+}
+
+// isSVG reports whether data looks like an SVG document. Markup starts with
+// '<', which no binary image format does.
+func isSVG(data []byte) bool {
+	head := bytes.TrimLeft(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), " \t\r\n")
+	if len(head) == 0 || head[0] != '<' {
+		return false
+	}
+	if len(head) > 4096 {
+		head = head[:4096]
+	}
+	return bytes.Contains(head, []byte("<svg"))
+}
+
+// processSVG describes an SVG image from its markup
+func processSVG(data []byte, filename string, options ProcessOptions) (*ProcessResult, error) {
+	doc, err := parseSVG(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SVG: %w", err)
+	}
+
+	result := &ProcessResult{
+		Metadata: make(map[string]string),
+		Data:     doc,
+	}
+
+	// Generate summary
+	numElements := 0
+	for _, n := range doc.Elements {
+		numElements += n
+	}
+	if doc.Width > 0 && doc.Height > 0 {
+		result.Summary = fmt.Sprintf("svg image, %.0fx%.0f pixels, %d elements", doc.Width, doc.Height, numElements)
+	} else {
+		result.Summary = fmt.Sprintf("svg image, %d elements", numElements)
+	}
+
+	// Extract metadata
+	if options.ExtractMetadata {
+		result.Metadata["format"] = "svg"
+		result.Metadata["extension"] = strings.ToLower(filepath.Ext(filename))
+		result.Metadata["elements"] = fmt.Sprintf("%d", numElements)
+		result.Metadata["scripts"] = fmt.Sprintf("%d", doc.Scripts)
+		result.Metadata["externalRefs"] = fmt.Sprintf("%d", doc.ExternalRefs)
+		if doc.Width > 0 && doc.Height > 0 {
+			result.Metadata["width"] = fmt.Sprintf("%.0f", doc.Width)
+			result.Metadata["height"] = fmt.Sprintf("%.0f", doc.Height)
+			result.Metadata["aspectRatio"] = fmt.Sprintf("%.2f", doc.Width/doc.Height)
+		}
+		setMetadata(result.Metadata, "viewBox", doc.ViewBox)
+		setMetadata(result.Metadata, "title", doc.Title)
+		setMetadata(result.Metadata, "description", doc.Description)
+	}
+
+	// The markup is its own preview when it fits; a truncated SVG wouldn't render
+	if options.GeneratePreview {
+		maxSize := options.MaxPreviewSize
+		if maxSize <= 0 {
+			maxSize = 1024 // Default to 1KB
+		}
+		if len(data) <= maxSize {
+			result.Preview = data
+		}
+	}
+
+	return result, nil
+}
+
+// parseSVG reads the dimensions, title and element counts of an SVG document
+func parseSVG(data []byte) (*SVGDocument, error) {
+	doc := &SVGDocument{Elements: make(map[string]int)}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+
+	foundRoot := false
+	var current string // Title or description element being read, directly under the root
+	depth := 0
+	var text strings.Builder
+
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			name := t.Name.Local
+			if !foundRoot {
+				if name != "svg" {
+					return nil, fmt.Errorf("root element is %s, not svg", name)
+				}
+				foundRoot = true
+				doc.readRoot(t)
+				continue
+			}
+
+			doc.Elements[name]++
+			if name == "script" {
+				doc.Scripts++
+			}
+			for _, attr := range t.Attr {
+				if attr.Name.Local == "href" && isExternalRef(attr.Value) {
+					doc.ExternalRefs++
+				}
+			}
+			if depth == 2 && (name == "title" || name == "desc") {
+				current = name
+				text.Reset()
+			}
+		case xml.CharData:
+			if current != "" {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			if depth == 2 && current == t.Name.Local {
+				value := strings.Join(strings.Fields(text.String()), " ")
+				if current == "title" && doc.Title == "" {
+					doc.Title = value
+				} else if current == "desc" && doc.Description == "" {
+					doc.Description = value
+				}
+				current = ""
+			}
+			depth--
+		}
+	}
+
+	if !foundRoot {
+		return nil, fmt.Errorf("no svg element found")
+	}
+	return doc, nil
+}
+
+// readRoot reads the size of the document from the root svg element, falling
+// back to the view box when the width or height is missing or relative
+func (d *SVGDocument) readRoot(root xml.StartElement) {
+	var width, height string
+	for _, attr := range root.Attr {
+		switch attr.Name.Local {
+		case "width":
+			width = attr.Value
+		case "height":
+			height = attr.Value
+		case "viewBox":
+			d.ViewBox = strings.TrimSpace(attr.Value)
+		}
+	}
+
+	d.Width, _ = svgLength(width)
+	d.Height, _ = svgLength(height)
+
+	fields := strings.FieldsFunc(d.ViewBox, func(r rune) bool { return r == ' ' || r == ',' })
+	if len(fields) != 4 {
+		return
+	}
+	vbWidth, errW := strconv.ParseFloat(fields[2], 64)
+	vbHeight, errH := strconv.ParseFloat(fields[3], 64)
+	if errW != nil || errH != nil || vbWidth <= 0 || vbHeight <= 0 {
+		return
+	}
+
+	// With one dimension given, the other follows from the view box's aspect ratio
+	switch {
+	case d.Width == 0 && d.Height == 0:
+		d.Width, d.Height = vbWidth, vbHeight
+	case d.Width == 0:
+		d.Width = d.Height * vbWidth / vbHeight
+	case d.Height == 0:
+		d.Height = d.Width * vbHeight / vbWidth
+	}
+}
+
+// svgLength converts an SVG length such as "12mm" to CSS pixels. Percentages
+// and unknown units are reported as not ok.
+func svgLength(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	end := len(value)
+	for end > 0 && (value[end-1] >= 'a' && value[end-1] <= 'z' || value[end-1] == '%') {
+		end--
+	}
+
+	factor, ok := svgUnits[value[end:]]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(value[:end], 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n * factor, true
+}
+
+// isExternalRef reports whether an href points outside the document
+func isExternalRef(href string) bool {
+	href = strings.TrimSpace(href)
+	return href != "" && !strings.HasPrefix(href, "#") && !strings.HasPrefix(href, "data:")
+}
@@ -0,0 +1,144 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestSVGLength(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+		ok    bool
+	}{
+		{"100", 100, true},
+		{" 100px ", 100, true},
+		{"12.5", 12.5, true},
+		{"1in", 96, true},
+		{"72pt", 96, true},
+		{"2.54cm", 96, true},
+		{"25.4mm", 96, true},
+		{"1pc", 16, true},
+		{"50%", 0, false},
+		{"10em", 0, false},
+		{"0", 0, false},
+		{"-5", 0, false},
+		{"", 0, false},
+		{"px", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := svgLength(tt.value)
+		if ok != tt.ok || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("svgLength(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseSVGDimensions(t *testing.T) {
+	tests := []struct {
+		name          string
+		root          string
+		width, height float64
+	}{
+		{"width and height", `<svg width="200" height="100">`, 200, 100},
+		{"units", `<svg width="1in" height="48pt">`, 96, 64},
+		{"view box only", `<svg viewBox="0 0 300 150">`, 300, 150},
+		{"view box with commas", `<svg viewBox="0,0,40,20">`, 40, 20},
+		{"width and view box", `<svg width="600" viewBox="0 0 300 150">`, 600, 300},
+		{"height and view box", `<svg height="50" viewBox="0 0 300 150">`, 100, 50},
+		{"percentages and view box", `<svg width="100%" height="100%" viewBox="0 0 64 32">`, 64, 32},
+		{"size given twice", `<svg width="10" height="10" viewBox="0 0 300 150">`, 10, 10},
+		{"bad view box", `<svg viewBox="0 0 -1 10">`, 0, 0},
+		{"unknown", `<svg>`, 0, 0},
+	}
+	for _, tt := range tests {
+		doc, err := parseSVG([]byte(tt.root + `</svg>`))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if math.Abs(doc.Width-tt.width) > 1e-9 || math.Abs(doc.Height-tt.height) > 1e-9 {
+			t.Errorf("%s: size = %vx%v, want %vx%v", tt.name, doc.Width, doc.Height, tt.width, tt.height)
+		}
+	}
+}
+
+func TestParseSVG(t *testing.T) {
+	data := []byte(`<?xml version="1.0"?>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="64" height="64">
+  <title>  Company
+    logo </title>
+  <desc>A circle</desc>
+  <g>
+    <title>Not the document title</title>
+    <circle r="10"/>
+    <use xlink:href="#dot"/>
+    <image href="https://example.com/photo.png"/>
+    <image href="data:image/png;base64,AAAA"/>
+  </g>
+  <script>alert(1)</script>
+</svg>`)
+
+	doc, err := parseSVG(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &SVGDocument{
+		Width:        64,
+		Height:       64,
+		Title:        "Company logo",
+		Description:  "A circle",
+		Elements:     map[string]int{"title": 2, "desc": 1, "g": 1, "circle": 1, "use": 1, "image": 2, "script": 1},
+		Scripts:      1,
+		ExternalRefs: 1,
+	}
+	if !reflect.DeepEqual(doc, want) {
+		t.Errorf("doc = %+v, want %+v", doc, want)
+	}
+
+	for _, bad := range []string{`<html><svg></svg></html>`, `not markup`, ``} {
+		if _, err := parseSVG([]byte(bad)); err == nil {
+			t.Errorf("parseSVG(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestIsSVG(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{`<svg width="1"/>`, true},
+		{"\xef\xbb\xbf\n  <?xml version=\"1.0\"?><svg>", true},
+		{`<!DOCTYPE html><html></html>`, false},
+		{"\x89PNG\r\n\x1a\n<svg>", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isSVG([]byte(tt.data)); got != tt.want {
+			t.Errorf("isSVG(%q) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestImageProcessorSVG(t *testing.T) {
+	data := []byte(`<svg width="120" height="60"><rect/></svg>`)
+	options := ProcessOptions{ExtractMetadata: true, GeneratePreview: true}
+	result, err := NewImageProcessor().Process(context.Background(), bytes.NewReader(data), "shape.svg", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Summary != "svg image, 120x60 pixels, 1 elements" {
+		t.Errorf("Summary = %q", result.Summary)
+	}
+	if result.Metadata["width"] != "120" || result.Metadata["height"] != "60" || result.Metadata["format"] != "svg" {
+		t.Errorf("metadata = %v", result.Metadata)
+	}
+	// SVGs aren't rasterized; small ones are their own preview
+	if !bytes.Equal(result.Preview, data) || len(result.Derived) != 0 {
+		t.Errorf("preview = %q with %d derived files, want the markup alone", result.Preview, len(result.Derived))
+	}
+}
@@ -1,12 +1,12 @@
 package processors
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"strings"
+	"unicode"
 	"unicode/utf8"
 )
 
@@ -18,60 +18,66 @@ func NewTextProcessor() *TextProcessor {
 	return &TextProcessor{}
 }
 
-// Process processes a text file
+// Process processes a text file, counting it as it streams so files larger
+// than memory can be described; the text itself is kept up to the memory limit
 func (p *TextProcessor) Process(ctx context.Context, reader io.Reader, filename string, options ProcessOptions) (*ProcessResult, error) {
-	// Read the file content
-	var buf bytes.Buffer
-	_, err := io.Copy(&buf, reader)
-	if err != nil {
+	var stats textStats
+	content := &headBuffer{max: options.memoryLimit()}
+	if _, err := io.Copy(io.MultiWriter(&stats, content), reader); err != nil {
 		return nil, fmt.Errorf("failed to read text file: %w", err)
 	}
+	stats.finish()
 
-	content := buf.String()
-	
 	result := &ProcessResult{
 		Metadata: make(map[string]string),
-		Data:     content,
 	}
-	
-	// Count lines, words, and characters
-	lineCount, wordCount, charCount := countTextStats(content)
-	
-	result.Summary = fmt.Sprintf("Text file with %d lines, %d words, and %d characters", lineCount, wordCount, charCount)
-	
+	if content.truncated {
+		// Too large to hand on as a string; the counts cover the whole file
+		result.Metadata["dataOmitted"] = "true"
+	} else {
+		result.Data = string(content.data)
+	}
+
+	result.Summary = fmt.Sprintf("Text file with %d lines, %d words, and %d characters", stats.lines, stats.words, stats.chars)
+
 	// Extract metadata
 	if options.ExtractMetadata {
-		result.Metadata["lines"] = fmt.Sprintf("%d", lineCount)
-		result.Metadata["words"] = fmt.Sprintf("%d", wordCount)
-		result.Metadata["characters"] = fmt.Sprintf("%d", charCount)
-		
+		result.Metadata["lines"] = fmt.Sprintf("%d", stats.lines)
+		result.Metadata["words"] = fmt.Sprintf("%d", stats.words)
+		result.Metadata["characters"] = fmt.Sprintf("%d", stats.chars)
+
 		// Detect encoding (simple check for UTF-8)
-		if utf8.ValidString(content) {
-			result.Metadata["encoding"] = "UTF-8"
-		} else {
+		if stats.invalid {
 			result.Metadata["encoding"] = "Unknown"
+		} else {
+			result.Metadata["encoding"] = "UTF-8"
 		}
 	}
-	
+
 	// Generate preview
 	if options.GeneratePreview {
 		maxSize := options.MaxPreviewSize
 		if maxSize <= 0 {
 			maxSize = 1024 // Default to 1KB
 		}
-		
-		// If content is smaller than max size, use it all
-		if len(content) <= maxSize {
-			result.Preview = []byte(content)
-		} else {
-			// Otherwise, take the first maxSize bytes
-			result.Preview = []byte(content[:maxSize])
+
+		// If content is smaller than max size, use it all, otherwise take
+		// the first maxSize bytes
+		preview := content.data
+		if len(preview) > maxSize {
+			preview = preview[:maxSize]
 		}
+		result.Preview = append([]byte(nil), preview...)
 	}
-	
+
 	return result, nil
 }
 
+// Name returns the processor name
+func (p *TextProcessor) Name() string {
+	return "text"
+}
+
 // CanProcess returns true if this processor can process the given content type
 func (p *TextProcessor) CanProcess(contentType, ext string) bool {
 	if strings.HasPrefix(contentType, "text/") {
@@ -89,27 +95,75 @@ func (p *TextProcessor) CanProcess(contentType, ext string) bool {
 	return false
 }
 
-// countTextStats counts lines, words, and characters in text
-func countTextStats(content string) (lines, words, chars int) {
-	scanner := bufio.NewScanner(strings.NewReader(content))
-	
-	// Count lines
-	for scanner.Scan() {
-		lines++
-		lineText := scanner.Text()
-		
-		// Count words in this line
-		wordCount := len(strings.Fields(lineText))
-		words += wordCount
+// textStats counts the lines, words and characters (runes) of text written
+// to it in chunks of any size, without holding the text
+type textStats struct {
+	lines, words, chars int
+	invalid             bool // Not valid UTF-8
+	inWord              bool
+	partial             []byte // Incomplete UTF-8 sequence ending the last write
+	written             int64
+	last                byte
+}
+
+// Write counts a chunk of text
+func (s *textStats) Write(p []byte) (int, error) {
+	n := len(p)
+	if n == 0 {
+		return 0, nil
+	}
+	s.written += int64(n)
+	s.lines += bytes.Count(p, []byte{'\n'})
+	s.last = p[n-1]
+
+	if len(s.partial) > 0 {
+		p = append(s.partial, p...)
+		s.partial = nil
+	}
+	for len(p) > 0 {
+		r, size := rune(p[0]), 1
+		if r >= utf8.RuneSelf {
+			if !utf8.FullRune(p) {
+				s.partial = append([]byte(nil), p...)
+				break
+			}
+			r, size = utf8.DecodeRune(p)
+			if r == utf8.RuneError && size == 1 {
+				s.invalid = true
+			}
+		}
+		s.count(r)
+		p = p[size:]
+	}
+	return n, nil
+}
+
+// count counts one character; words are separated by white space
+func (s *textStats) count(r rune) {
+	s.chars++
+	if unicode.IsSpace(r) {
+		s.inWord = false
+	} else if !s.inWord {
+		s.inWord = true
+		s.words++
+	}
+}
+
+// finish counts a sequence cut off by the end of the text, a byte per
+// character as utf8.RuneCount does, and a last line without a newline
+func (s *textStats) finish() {
+	for range s.partial {
+		s.invalid = true
+		s.count(utf8.RuneError)
+	}
+	s.partial = nil
+	if s.written > 0 && s.last != '\n' {
+		s.lines++
 	}
-	
-	// Count characters (runes)
-	chars = utf8.RuneCountInString(content)
-	
-	return
 }
 
 // init registers the processor with the registry
 func init() {
-	Register(NewTextProcessor(), "text/plain")
+	// Text handles anything text-like, so more specific processors take precedence
+	RegisterWithPriority(NewTextProcessor(), PriorityFallback, "text/plain")
 }
\ No newline at end of file
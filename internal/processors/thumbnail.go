@@ -0,0 +1,205 @@
+package processors
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// DefaultThumbnailSizes are the thumbnail sizes generated for images, as the
+// length in pixels of the longest side
+var DefaultThumbnailSizes = []int{128, 512, 1024}
+
+// Thumbnail output formats
+const (
+	ThumbnailFormatJPEG = "jpeg"
+	ThumbnailFormatPNG  = "png"
+)
+
+// defaultThumbnailQuality is the JPEG quality used for thumbnails
+const defaultThumbnailQuality = 85
+
+// ThumbnailRole returns the derived file role of the thumbnail of the given size
+func ThumbnailRole(size int) string {
+	return fmt.Sprintf("thumbnail-%d", size)
+}
+
+// ParseThumbnailRole returns the size of a thumbnail role, if role is one
+func ParseThumbnailRole(role string) (int, bool) {
+	if !strings.HasPrefix(role, "thumbnail-") {
+		return 0, false
+	}
+	size, err := strconv.Atoi(strings.TrimPrefix(role, "thumbnail-"))
+	return size, err == nil && size > 0
+}
+
+// MakeThumbnail decodes an image and encodes a thumbnail whose longest side is
+// at most size pixels, returning the thumbnail and its content type. An empty
+// format picks PNG for images with transparency and JPEG otherwise.
+func MakeThumbnail(data []byte, size int, format string, quality int) ([]byte, string, error) {
+	img, _, err := decodeImage(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	exif, _ := readEXIF(data)
+	thumb := resizeToFit(applyOrientation(img, exif.Orientation()), size, size)
+	return encodeImage(thumb, format, quality)
+}
+
+// resizeToFit scales an image down, preserving its aspect ratio, so that it
+// fits within maxWidth x maxHeight. Images that already fit are returned as is.
+func resizeToFit(img image.Image, maxWidth, maxHeight int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxWidth && height <= maxHeight {
+		return img
+	}
+
+	scale := float64(maxWidth) / float64(width)
+	if s := float64(maxHeight) / float64(height); s < scale {
+		scale = s
+	}
+	newWidth := int(float64(width)*scale + 0.5)
+	newHeight := int(float64(height)*scale + 0.5)
+	if newWidth < 1 {
+		newWidth = 1
+	}
+	if newHeight < 1 {
+		newHeight = 1
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, newWidth, newHeight))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// applyOrientation transforms an image so it displays upright, given its EXIF orientation
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	// Orientations 5-8 swap the width and height
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Mirrored horizontally
+				dx, dy = width-1-x, y
+			case 3: // Rotated 180
+				dx, dy = width-1-x, height-1-y
+			case 4: // Mirrored vertically
+				dx, dy = x, height-1-y
+			case 5: // Mirrored horizontally and rotated 270 clockwise
+				dx, dy = y, x
+			case 6: // Rotated 90 clockwise
+				dx, dy = height-1-y, x
+			case 7: // Mirrored horizontally and rotated 90 clockwise
+				dx, dy = height-1-y, width-1-x
+			case 8: // Rotated 270 clockwise
+				dx, dy = y, width-1-x
+			}
+			dst.Set(dx, dy, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// encodeImage encodes an image as JPEG or PNG, returning the data and its content type
+func encodeImage(img image.Image, format string, quality int) ([]byte, string, error) {
+	if format == "" {
+		format = ThumbnailFormatJPEG
+		if !isOpaque(img) {
+			format = ThumbnailFormatPNG
+		}
+	}
+	if quality <= 0 || quality > 100 {
+		quality = defaultThumbnailQuality
+	}
+
+	var buf bytes.Buffer
+	switch strings.ToLower(format) {
+	case ThumbnailFormatJPEG, "jpg":
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, "", fmt.Errorf("failed to encode JPEG: %w", err)
+		}
+		return buf.Bytes(), "image/jpeg", nil
+	case ThumbnailFormatPNG:
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", fmt.Errorf("failed to encode PNG: %w", err)
+		}
+		return buf.Bytes(), "image/png", nil
+	}
+	return nil, "", fmt.Errorf("unsupported image format: %s", format)
+}
+
+// encodeWithin encodes an image in at most maxBytes, lowering the JPEG quality
+// and then the dimensions until it fits. The smallest encoding is returned if
+// nothing fits.
+func encodeWithin(img image.Image, format string, maxBytes int) ([]byte, string, error) {
+	for {
+		var data []byte
+		var contentType string
+		for _, quality := range []int{defaultThumbnailQuality, 70, 55, 40} {
+			var err error
+			data, contentType, err = encodeImage(img, format, quality)
+			if err != nil {
+				return nil, "", err
+			}
+			if len(data) <= maxBytes {
+				return data, contentType, nil
+			}
+			// Only JPEG output gets smaller with a lower quality
+			if contentType != "image/jpeg" {
+				break
+			}
+		}
+
+		bounds := img.Bounds()
+		if bounds.Dx() <= 16 || bounds.Dy() <= 16 {
+			return data, contentType, nil
+		}
+		img = resizeToFit(img, bounds.Dx()/2, bounds.Dy()/2)
+	}
+}
+
+// isOpaque reports whether an image has no transparent pixels
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return true
+}
+
+// thumbnailSizes returns the thumbnail sizes requested by the options: a
+// comma-separated "thumbnailSizes" option, or the defaults
+func thumbnailSizes(options ProcessOptions) []int {
+	value := options.String("thumbnailSizes", "")
+	if value == "" {
+		return DefaultThumbnailSizes
+	}
+
+	var sizes []int
+	for _, part := range strings.Split(value, ",") {
+		if size, err := strconv.Atoi(strings.TrimSpace(part)); err == nil && size > 0 {
+			sizes = append(sizes, size)
+		}
+	}
+	return sizes
+}
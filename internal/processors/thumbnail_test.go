@@ -0,0 +1,198 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// labelledImage returns an image whose pixels are numbered row by row in
+// their red channel, starting at 1, so where each one ends up can be told
+func labelledImage(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(y*width + x + 1), A: 255})
+		}
+	}
+	return img
+}
+
+// pixelLabels returns the labels of labelledImage's pixels, row by row
+func pixelLabels(img image.Image) [][]uint8 {
+	bounds := img.Bounds()
+	rows := make([][]uint8, bounds.Dy())
+	for y := range rows {
+		for x := 0; x < bounds.Dx(); x++ {
+			rows[y] = append(rows[y], color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA).R)
+		}
+	}
+	return rows
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// The source is
+	//   1 2 3
+	//   4 5 6
+	tests := []struct {
+		orientation int
+		want        [][]uint8
+	}{
+		{1, [][]uint8{{1, 2, 3}, {4, 5, 6}}},
+		{2, [][]uint8{{3, 2, 1}, {6, 5, 4}}},
+		{3, [][]uint8{{6, 5, 4}, {3, 2, 1}}},
+		{4, [][]uint8{{4, 5, 6}, {1, 2, 3}}},
+		{5, [][]uint8{{1, 4}, {2, 5}, {3, 6}}},
+		{6, [][]uint8{{4, 1}, {5, 2}, {6, 3}}},
+		{7, [][]uint8{{6, 3}, {5, 2}, {4, 1}}},
+		{8, [][]uint8{{3, 6}, {2, 5}, {1, 4}}},
+		// Unknown orientations leave the image as it is
+		{0, [][]uint8{{1, 2, 3}, {4, 5, 6}}},
+		{9, [][]uint8{{1, 2, 3}, {4, 5, 6}}},
+	}
+	for _, tt := range tests {
+		if got := pixelLabels(applyOrientation(labelledImage(3, 2), tt.orientation)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("orientation %d: pixels = %v, want %v", tt.orientation, got, tt.want)
+		}
+	}
+
+	// Images whose bounds don't start at the origin are read from their bounds
+	sub := labelledImage(4, 3).SubImage(image.Rect(1, 1, 4, 3))
+	if got, want := pixelLabels(applyOrientation(sub, 3)), [][]uint8{{12, 11, 10}, {8, 7, 6}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sub-image: pixels = %v, want %v", got, want)
+	}
+}
+
+func TestResizeToFit(t *testing.T) {
+	tests := []struct {
+		name                string
+		width, height       int
+		maxWidth, maxHeight int
+		want                image.Point
+	}{
+		{"fits", 100, 50, 200, 200, image.Pt(100, 50)},
+		{"exact fit", 200, 100, 200, 100, image.Pt(200, 100)},
+		{"landscape", 1000, 500, 200, 200, image.Pt(200, 100)},
+		{"portrait", 500, 1000, 200, 200, image.Pt(100, 200)},
+		{"height bound", 1000, 500, 400, 100, image.Pt(200, 100)},
+		{"rounded", 1000, 333, 100, 100, image.Pt(100, 33)},
+		{"thin line keeps a pixel", 1000, 1, 10, 10, image.Pt(10, 1)},
+	}
+	for _, tt := range tests {
+		img := image.NewNRGBA(image.Rect(0, 0, tt.width, tt.height))
+		got := resizeToFit(img, tt.maxWidth, tt.maxHeight)
+		if size := got.Bounds().Size(); size != tt.want {
+			t.Errorf("%s: size = %v, want %v", tt.name, size, tt.want)
+		}
+		if fits := tt.width <= tt.maxWidth && tt.height <= tt.maxHeight; fits && got != image.Image(img) {
+			t.Errorf("%s: an image that fits was copied", tt.name)
+		}
+	}
+}
+
+func TestThumbnailRole(t *testing.T) {
+	if role := ThumbnailRole(512); role != "thumbnail-512" {
+		t.Errorf("ThumbnailRole(512) = %q", role)
+	}
+	for role, want := range map[string]int{"thumbnail-512": 512, "thumbnail-0": 0, "thumbnail-x": 0, "preview": 0} {
+		size, ok := ParseThumbnailRole(role)
+		if size != want || ok != (want > 0) {
+			t.Errorf("ParseThumbnailRole(%q) = %d, %v; want %d", role, size, ok, want)
+		}
+	}
+}
+
+func TestThumbnailSizes(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  []int
+	}{
+		{nil, DefaultThumbnailSizes},
+		{"64, 256", []int{64, 256}},
+		{"64,-1,x,0,32", []int{64, 32}},
+	}
+	for _, tt := range tests {
+		options := ProcessOptions{Options: map[string]interface{}{}}
+		if tt.value != nil {
+			options.Options["thumbnailSizes"] = tt.value
+		}
+		if got := thumbnailSizes(options); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("thumbnailSizes(%v) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+// rotatedJPEG is a 64x32 JPEG whose EXIF orientation turns it 90 degrees
+// clockwise, so it displays 32x64
+func rotatedJPEG(t testing.TB) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 64, 32)), nil); err != nil {
+		t.Fatal(err)
+	}
+	order := binary.LittleEndian
+	tiff := buildTIFF(order, []testEXIFEntry{exifShort(order, exifTagOrientation, 6)}, nil, nil)
+	return jpegWithSegments(buf.Bytes(), jpegSegment(jpegMarkerAPP1, []byte(exifHeader), tiff))
+}
+
+func TestMakeThumbnailOrientation(t *testing.T) {
+	thumb, contentType, err := MakeThumbnail(rotatedJPEG(t), 16, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(thumb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "image/jpeg" || img.Bounds().Size() != image.Pt(8, 16) {
+		t.Errorf("thumbnail is %s of %v, want an upright 8x16 JPEG", contentType, img.Bounds().Size())
+	}
+
+	if _, _, err := MakeThumbnail([]byte("not an image"), 16, "", 0); err == nil {
+		t.Error("expected an error for data that isn't an image")
+	}
+}
+
+func TestImageProcessorThumbnails(t *testing.T) {
+	options := ProcessOptions{
+		GeneratePreview: true,
+		MaxPreviewSize:  4096,
+		Options:         map[string]interface{}{"thumbnailSizes": "8,16,128", "thumbnailFormat": "png"},
+	}
+	result, err := NewImageProcessor().Process(context.Background(), bytes.NewReader(rotatedJPEG(t)), "photo.jpg", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]image.Point{
+		"photo_8.png":   image.Pt(4, 8),
+		"photo_16.png":  image.Pt(8, 16),
+		"photo_128.png": image.Pt(32, 64), // Never scaled up
+	}
+	if len(result.Derived) != len(want) {
+		t.Fatalf("derived %d files, want %d", len(result.Derived), len(want))
+	}
+	for _, file := range result.Derived {
+		img, _, err := image.Decode(bytes.NewReader(file.Data))
+		if err != nil {
+			t.Fatalf("%s: %v", file.Name, err)
+		}
+		size, ok := want[file.Name]
+		if !ok || img.Bounds().Size() != size || file.ContentType != "image/png" || !strings.HasPrefix(file.Role, "thumbnail-") {
+			t.Errorf("%s (%s, %s) is %v, want %v", file.Name, file.Role, file.ContentType, img.Bounds().Size(), size)
+		}
+	}
+
+	// The preview is a real thumbnail within MaxPreviewSize, not the original
+	if len(result.Preview) == 0 || len(result.Preview) > options.MaxPreviewSize {
+		t.Errorf("preview is %d bytes, want at most %d", len(result.Preview), options.MaxPreviewSize)
+	}
+	if _, _, err := image.Decode(bytes.NewReader(result.Preview)); err != nil {
+		t.Errorf("preview isn't an image: %v", err)
+	}
+}
@@ -0,0 +1,298 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// External tools used by processors
+const (
+	ToolFFmpeg   = "ffmpeg"
+	ToolFFprobe  = "ffprobe"
+	ToolPdftoppm = "pdftoppm" // From poppler-utils
+)
+
+// toolVersionArgs are the arguments that make each tool print its version
+var toolVersionArgs = map[string][]string{
+	ToolFFmpeg:   {"-version"},
+	ToolFFprobe:  {"-version"},
+	ToolPdftoppm: {"-v"},
+}
+
+// toolDetectTimeout bounds how long a tool may take to print its version
+const toolDetectTimeout = 5 * time.Second
+
+// ToolStatus describes whether an external tool can be run
+type ToolStatus struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`               // Configured path, or the name looked up on PATH
+	Resolved  string `json:"resolved,omitempty"` // Executable found
+	Available bool   `json:"available"`
+	Version   string `json:"version,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Tools keeps the paths of the external tools processors run and whether
+// they are available. Tools are detected once, at startup or on first use.
+type Tools struct {
+	paths  map[string]string
+	status map[string]ToolStatus
+	mu     sync.RWMutex
+}
+
+// NewTools creates a tool set that looks every tool up on PATH
+func NewTools() *Tools {
+	return &Tools{
+		paths:  make(map[string]string),
+		status: make(map[string]ToolStatus),
+	}
+}
+
+// DefaultTools are the tools used by the processors
+var DefaultTools = NewTools()
+
+// SetPath sets the executable to run for a tool, forgetting an earlier detection
+func (t *Tools) SetPath(name, path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if path == "" {
+		delete(t.paths, name)
+	} else {
+		t.paths[name] = path
+	}
+	delete(t.status, name)
+}
+
+// Path returns the executable to run for a tool
+func (t *Tools) Path(name string) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if path, ok := t.paths[name]; ok {
+		return path
+	}
+	return name
+}
+
+// Command returns a command running a tool from its configured path
+func (t *Tools) Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, t.Path(name), args...)
+}
+
+// Detect checks every known tool again, caching and returning the results
+// ordered by name
+func (t *Tools) Detect(ctx context.Context) []ToolStatus {
+	names := toolNames()
+	statuses := make([]ToolStatus, len(names))
+	for i, name := range names {
+		statuses[i] = t.detect(ctx, name)
+	}
+	return statuses
+}
+
+// Statuses returns the status of every known tool ordered by name, detecting
+// those that haven't been yet
+func (t *Tools) Statuses() []ToolStatus {
+	names := toolNames()
+	statuses := make([]ToolStatus, len(names))
+	for i, name := range names {
+		statuses[i] = t.Status(name)
+	}
+	return statuses
+}
+
+// toolNames returns the names of the known tools in order
+func toolNames() []string {
+	names := make([]string, 0, len(toolVersionArgs))
+	for name := range toolVersionArgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Status returns the status of a tool, detecting it if it hasn't been yet
+func (t *Tools) Status(name string) ToolStatus {
+	t.mu.RLock()
+	status, ok := t.status[name]
+	t.mu.RUnlock()
+	if ok {
+		return status
+	}
+	return t.detect(context.Background(), name)
+}
+
+// Available reports whether a tool can be run
+func (t *Tools) Available(name string) bool {
+	return t.Status(name).Available
+}
+
+// Missing returns the tools among names that can't be run
+func (t *Tools) Missing(names ...string) []string {
+	var missing []string
+	for _, name := range names {
+		if !t.Available(name) {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// Require returns an error wrapping ErrToolMissing if any of the tools can't be run
+func (t *Tools) Require(names ...string) error {
+	if missing := t.Missing(names...); len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrToolMissing, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// detect finds a tool's executable and asks it for its version
+func (t *Tools) detect(ctx context.Context, name string) ToolStatus {
+	status := ToolStatus{Name: name, Path: t.Path(name)}
+
+	resolved, err := exec.LookPath(status.Path)
+	if err != nil {
+		status.Error = err.Error()
+	} else {
+		status.Resolved = resolved
+		ctx, cancel := context.WithTimeout(ctx, toolDetectTimeout)
+		defer cancel()
+
+		// pdftoppm prints its version to stderr and, in older releases,
+		// exits with an error code while doing so
+		output, err := exec.CommandContext(ctx, resolved, toolVersionArgs[name]...).CombinedOutput()
+		status.Version = parseToolVersion(string(output))
+		if err != nil && status.Version == "" {
+			status.Error = fmt.Sprintf("failed to run %s: %v", resolved, err)
+		} else {
+			status.Available = true
+		}
+	}
+
+	t.mu.Lock()
+	t.status[name] = status
+	t.mu.Unlock()
+	return status
+}
+
+// parseToolVersion takes the version from output such as "ffmpeg version
+// 6.1.1-3ubuntu5 Copyright ..." or "pdftoppm version 24.02.0"
+func parseToolVersion(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		for i := 0; i+1 < len(fields); i++ {
+			if fields[i] == "version" {
+				return fields[i+1]
+			}
+		}
+	}
+	return ""
+}
+
+// noteMissingTools records in metadata the tools an optional step was
+// skipped for, so results don't silently differ between installations
+func noteMissingTools(metadata map[string]string, missing ...string) {
+	if len(missing) == 0 {
+		return
+	}
+	tools := make(map[string]bool)
+	if existing := metadata["missingTools"]; existing != "" {
+		for _, name := range strings.Split(existing, ",") {
+			tools[name] = true
+		}
+	}
+	for _, name := range missing {
+		tools[name] = true
+	}
+	names := make([]string, 0, len(tools))
+	for name := range tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	metadata["missingTools"] = strings.Join(names, ",")
+}
+
+// Feature is an optional capability of a processor and the external tools it needs
+type Feature struct {
+	Name        string   `json:"name"` // Usually the option that turns it on
+	Description string   `json:"description"`
+	Tools       []string `json:"tools,omitempty"`
+}
+
+// FeatureReporter is implemented by processors whose features depend on
+// external tools
+type FeatureReporter interface {
+	Features() []Feature
+}
+
+// FeatureStatus is a feature with whether its tools are available
+type FeatureStatus struct {
+	Feature
+	Available bool     `json:"available"`
+	Missing   []string `json:"missing,omitempty"`
+}
+
+// featureStatuses checks the tools of a processor's features
+func featureStatuses(processor FileProcessor, tools *Tools) ([]FeatureStatus, []string) {
+	reporter, ok := processor.(FeatureReporter)
+	if !ok {
+		return nil, nil
+	}
+
+	var statuses []FeatureStatus
+	missingTools := make(map[string]bool)
+	for _, feature := range reporter.Features() {
+		missing := tools.Missing(feature.Tools...)
+		for _, name := range missing {
+			missingTools[name] = true
+		}
+		statuses = append(statuses, FeatureStatus{Feature: feature, Available: len(missing) == 0, Missing: missing})
+	}
+
+	missing := make([]string, 0, len(missingTools))
+	for name := range missingTools {
+		missing = append(missing, name)
+	}
+	sort.Strings(missing)
+	return statuses, missing
+}
+
+// WriteCapabilityReport writes which tools were found and which processor
+// features they make available, for the --test-config output
+func WriteCapabilityReport(w io.Writer, tools []ToolStatus, processors []ProcessorInfo) {
+	fmt.Fprintln(w, "External tools:")
+	for _, tool := range tools {
+		if tool.Available {
+			version := tool.Version
+			if version == "" {
+				version = "unknown version"
+			}
+			fmt.Fprintf(w, "  %-10s %s (%s)\n", tool.Name, version, tool.Resolved)
+		} else {
+			fmt.Fprintf(w, "  %-10s MISSING: %s\n", tool.Name, tool.Error)
+		}
+	}
+
+	fmt.Fprintln(w, "Processors:")
+	for _, info := range processors {
+		state := "enabled"
+		if !info.Enabled {
+			state = "disabled"
+		}
+		fmt.Fprintf(w, "  %s (%s, priority %d)\n", info.Name, state, info.Priority)
+		for _, feature := range info.Features {
+			if feature.Available {
+				fmt.Fprintf(w, "    + %s: %s\n", feature.Name, feature.Description)
+			} else {
+				fmt.Fprintf(w, "    - %s: %s (needs %s)\n", feature.Name, feature.Description, strings.Join(feature.Missing, ", "))
+			}
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeTool writes a shell script standing in for an external tool and
+// returns its path
+func fakeTool(t *testing.T, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake tools are shell scripts")
+	}
+	path := filepath.Join(t.TempDir(), "tool")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestToolsDetect(t *testing.T) {
+	ffmpeg := fakeTool(t, `echo "ffmpeg version 6.1.1-3ubuntu5 Copyright (c) 2000-2023"`)
+	// Older pdftoppm prints its version to stderr and exits with an error
+	pdftoppm := fakeTool(t, `echo "pdftoppm version 0.86.1" >&2; exit 99`)
+	broken := fakeTool(t, `exit 1`)
+
+	tools := NewTools()
+	tools.SetPath(ToolFFmpeg, ffmpeg)
+	tools.SetPath(ToolPdftoppm, pdftoppm)
+	tools.SetPath(ToolFFprobe, broken)
+
+	statuses := tools.Detect(context.Background())
+	var names []string
+	for _, status := range statuses {
+		names = append(names, status.Name)
+	}
+	if want := []string{ToolFFmpeg, ToolFFprobe, ToolPdftoppm}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("detected %v, want %v", names, want)
+	}
+
+	if want := (ToolStatus{Name: ToolFFmpeg, Path: ffmpeg, Resolved: ffmpeg, Available: true, Version: "6.1.1-3ubuntu5"}); statuses[0] != want {
+		t.Errorf("ffmpeg = %+v, want %+v", statuses[0], want)
+	}
+	if status := statuses[1]; status.Available || status.Resolved != broken || !strings.Contains(status.Error, "failed to run") {
+		t.Errorf("ffprobe = %+v, want a tool that fails to run", status)
+	}
+	if status := statuses[2]; !status.Available || status.Version != "0.86.1" || status.Error != "" {
+		t.Errorf("pdftoppm = %+v, want it available", status)
+	}
+
+	if !reflect.DeepEqual(tools.Statuses(), statuses) {
+		t.Errorf("Statuses = %+v, want the detected ones", tools.Statuses())
+	}
+}
+
+func TestToolsMissing(t *testing.T) {
+	tools := NewTools()
+	tools.SetPath(ToolFFmpeg, fakeTool(t, `echo "ffmpeg version 7.0"`))
+	tools.SetPath(ToolFFprobe, filepath.Join(t.TempDir(), "ffprobe"))
+
+	status := tools.Status(ToolFFprobe)
+	if status.Available || status.Resolved != "" || status.Error == "" {
+		t.Errorf("ffprobe = %+v, want it not found", status)
+	}
+	if !tools.Available(ToolFFmpeg) {
+		t.Error("ffmpeg is not available")
+	}
+	if missing := tools.Missing(ToolFFmpeg, ToolFFprobe); !reflect.DeepEqual(missing, []string{ToolFFprobe}) {
+		t.Errorf("Missing = %v, want ffprobe", missing)
+	}
+
+	if err := tools.Require(ToolFFmpeg); err != nil {
+		t.Errorf("Require(ffmpeg) = %v", err)
+	}
+	err := tools.Require(ToolFFmpeg, ToolFFprobe)
+	if !errors.Is(err, ErrToolMissing) || !strings.HasSuffix(err.Error(), ": ffprobe") {
+		t.Errorf("Require(ffmpeg, ffprobe) = %v, want ErrToolMissing naming ffprobe", err)
+	}
+}
+
+func TestToolsSetPath(t *testing.T) {
+	tools := NewTools()
+	if path := tools.Path(ToolFFmpeg); path != ToolFFmpeg {
+		t.Errorf("Path = %q, want the name looked up on PATH", path)
+	}
+
+	missing := filepath.Join(t.TempDir(), "ffmpeg")
+	tools.SetPath(ToolFFmpeg, missing)
+	if tools.Available(ToolFFmpeg) {
+		t.Fatal("ffmpeg is available at a path that doesn't exist")
+	}
+
+	// Setting the path again forgets the cached detection
+	found := fakeTool(t, `echo "ffmpeg version 7.0"`)
+	tools.SetPath(ToolFFmpeg, found)
+	if status := tools.Status(ToolFFmpeg); !status.Available || status.Path != found {
+		t.Errorf("ffmpeg = %+v, want it found at %s", status, found)
+	}
+
+	var out bytes.Buffer
+	cmd := tools.Command(context.Background(), ToolFFmpeg)
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil || !strings.HasPrefix(out.String(), "ffmpeg version") {
+		t.Errorf("Command ran %s: %q, %v", cmd.Path, out.String(), err)
+	}
+
+	tools.SetPath(ToolFFmpeg, "")
+	if path := tools.Path(ToolFFmpeg); path != ToolFFmpeg {
+		t.Errorf("Path after clearing = %q, want %q", path, ToolFFmpeg)
+	}
+}
+
+func TestParseToolVersion(t *testing.T) {
+	tests := map[string]string{
+		"ffmpeg version 6.1.1-3ubuntu5 Copyright (c) 2000-2023 the FFmpeg developers\nbuilt with gcc 13": "6.1.1-3ubuntu5",
+		"pdftoppm version 24.02.0\nCopyright 2005-2024 The Poppler Developers":                           "24.02.0",
+		"ffprobe version":         "",
+		"usage: tool [options]\n": "",
+	}
+	for output, want := range tests {
+		if got := parseToolVersion(output); got != want {
+			t.Errorf("parseToolVersion(%q) = %q, want %q", output, got, want)
+		}
+	}
+}
+
+func TestNoteMissingTools(t *testing.T) {
+	metadata := map[string]string{}
+	noteMissingTools(metadata)
+	if _, ok := metadata["missingTools"]; ok {
+		t.Error("missingTools noted without missing tools")
+	}
+
+	// Later notes merge with earlier ones
+	noteMissingTools(metadata, ToolFFprobe)
+	noteMissingTools(metadata, ToolFFmpeg, ToolFFprobe)
+	if got := metadata["missingTools"]; got != "ffmpeg,ffprobe" {
+		t.Errorf("missingTools = %q, want ffmpeg,ffprobe", got)
+	}
+}
+
+func TestFeatureStatuses(t *testing.T) {
+	tools := NewTools()
+	tools.SetPath(ToolPdftoppm, filepath.Join(t.TempDir(), "pdftoppm"))
+
+	statuses, missing := featureStatuses(NewPDFProcessor(), tools)
+	want := []FeatureStatus{
+		{Feature: Feature{Name: "text", Description: "Per-page text and document info"}, Available: true},
+		{Feature: Feature{Name: "thumbnail", Description: "First-page thumbnails", Tools: []string{ToolPdftoppm}}, Missing: []string{ToolPdftoppm}},
+	}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("statuses = %+v, want %+v", statuses, want)
+	}
+	if !reflect.DeepEqual(missing, []string{ToolPdftoppm}) {
+		t.Errorf("missing = %v, want pdftoppm", missing)
+	}
+
+	// Processors without features that need tools report none
+	if statuses, missing := featureStatuses(&fakeProcessor{name: "fake"}, tools); statuses != nil || missing != nil {
+		t.Errorf("fake processor = %+v, %v; want nothing", statuses, missing)
+	}
+}
+
+func TestWriteCapabilityReport(t *testing.T) {
+	var out bytes.Buffer
+	WriteCapabilityReport(&out, []ToolStatus{
+		{Name: ToolFFmpeg, Resolved: "/usr/bin/ffmpeg", Available: true, Version: "6.1.1"},
+		{Name: ToolPdftoppm, Error: "not found"},
+	}, []ProcessorInfo{{Name: "pdf", Priority: 10, Enabled: true, Features: []FeatureStatus{
+		{Feature: Feature{Name: "text", Description: "Text"}, Available: true},
+		{Feature: Feature{Name: "thumbnail", Description: "Thumbnails"}, Missing: []string{ToolPdftoppm}},
+	}}})
+
+	want := `External tools:
+  ffmpeg     6.1.1 (/usr/bin/ffmpeg)
+  pdftoppm   MISSING: not found
+Processors:
+  pdf (enabled, priority 10)
+    + text: Text
+    - thumbnail: Thumbnails (needs pdftoppm)
+`
+	if out.String() != want {
+		t.Errorf("report =\n%s\nwant\n%s", out.String(), want)
+	}
+}
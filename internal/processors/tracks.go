@@ -0,0 +1,283 @@
+package processors
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MetadataSearchable marks derived files whose timed text is indexed for
+// search when they are recorded in the catalog. Its value is the kind of
+// text, such as "subtitles" or "chapters".
+const MetadataSearchable = "searchable"
+
+// textSubtitleCodecs are the subtitle codecs ffmpeg can convert to WebVTT and
+// SRT. Bitmap subtitles (PGS, VobSub, DVB) would need OCR.
+var textSubtitleCodecs = map[string]bool{
+	"subrip":   true,
+	"srt":      true,
+	"ass":      true,
+	"ssa":      true,
+	"webvtt":   true,
+	"mov_text": true,
+	"text":     true,
+}
+
+// audioTrackFormats maps audio codecs to the extension and content type of a
+// file they can be copied into without re-encoding
+var audioTrackFormats = map[string][2]string{
+	"aac":    {".m4a", "audio/mp4"},
+	"alac":   {".m4a", "audio/mp4"},
+	"mp3":    {".mp3", "audio/mpeg"},
+	"opus":   {".opus", "audio/ogg"},
+	"vorbis": {".ogg", "audio/ogg"},
+	"flac":   {".flac", "audio/flac"},
+	"ac3":    {".ac3", "audio/ac3"},
+	"eac3":   {".eac3", "audio/eac3"},
+}
+
+// MediaTrack is a track of a media container extracted into derived files
+type MediaTrack struct {
+	Index    int      `json:"index"` // Stream index, -1 for chapters
+	Type     string   `json:"type"`  // subtitle, audio or chapters
+	Codec    string   `json:"codec,omitempty"`
+	Language string   `json:"language,omitempty"`
+	Title    string   `json:"title,omitempty"`
+	Paths    []string `json:"paths,omitempty"` // Below the stream root
+	Cues     int      `json:"cues,omitempty"`
+	Skipped  string   `json:"skipped,omitempty"` // Why the track wasn't extracted
+}
+
+// Cue is a timed piece of text from a subtitle or chapter track
+type Cue struct {
+	Start float64 `json:"start"` // In seconds
+	End   float64 `json:"end"`   // In seconds
+	Text  string  `json:"text"`
+}
+
+// vttCueTiming matches the timing line of a WebVTT cue; hours are optional
+var vttCueTiming = regexp.MustCompile(`^((?:\d+:)?\d{2}:\d{2}\.\d{3})\s+-->\s+((?:\d+:)?\d{2}:\d{2}\.\d{3})`)
+
+// vttMarkup matches the formatting tags of cue text, such as <i> or <c.yellow>
+var vttMarkup = regexp.MustCompile(`<[^>]*>`)
+
+// extractTracks extracts the subtitle and audio tracks and the chapters of a
+// media file into derived files below the stream root:
+// tracks/subtitles-<index>-<language>.vtt and .srt, tracks/audio-<index>-<language>.<ext>,
+// and tracks/chapters.vtt and .json
+func extractTracks(ctx context.Context, input, filename string, info *MediaInfo) ([]DerivedFile, []MediaTrack, error) {
+	dir, err := ioutil.TempDir("", "tracks-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	base := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	var files []DerivedFile
+	var tracks []MediaTrack
+
+	for _, stream := range info.StreamsOf("subtitle") {
+		track := MediaTrack{Index: stream.Index, Type: "subtitle", Codec: stream.Codec, Language: stream.Language, Title: stream.Title}
+		if !textSubtitleCodecs[stream.Codec] {
+			track.Skipped = fmt.Sprintf("%s subtitles are images and can't be converted to text", stream.Codec)
+			tracks = append(tracks, track)
+			continue
+		}
+
+		name := trackName("subtitles", stream)
+		vttPath := filepath.Join(dir, name+".vtt")
+		srtPath := filepath.Join(dir, name+".srt")
+		streamMap := fmt.Sprintf("0:%d", stream.Index)
+		cmd := DefaultTools.Command(ctx, ToolFFmpeg, "-y", "-v", "error", "-i", input,
+			"-map", streamMap, "-c:s", "webvtt", vttPath,
+			"-map", streamMap, "-c:s", "srt", srtPath)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return nil, nil, fmt.Errorf("ffmpeg failed to extract subtitle track %d: %w: %s", stream.Index, err, lastLines(string(output), 5))
+		}
+
+		vtt, err := ioutil.ReadFile(vttPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read subtitle track: %w", err)
+		}
+		srt, err := ioutil.ReadFile(srtPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read subtitle track: %w", err)
+		}
+
+		metadata := trackMetadata(stream)
+		metadata[MetadataSearchable] = "subtitles"
+		files = append(files,
+			DerivedFile{
+				Name:        base + "_" + name + ".vtt",
+				Role:        StreamRolePrefix + "tracks/" + name + ".vtt",
+				ContentType: "text/vtt",
+				Data:        vtt,
+				Metadata:    metadata,
+			},
+			DerivedFile{
+				Name:        base + "_" + name + ".srt",
+				Role:        StreamRolePrefix + "tracks/" + name + ".srt",
+				ContentType: "application/x-subrip",
+				Data:        srt,
+				Metadata:    trackMetadata(stream),
+			},
+		)
+		track.Paths = []string{"tracks/" + name + ".vtt", "tracks/" + name + ".srt"}
+		track.Cues = len(ParseWebVTT(vtt))
+		tracks = append(tracks, track)
+	}
+
+	for _, stream := range info.StreamsOf("audio") {
+		track := MediaTrack{Index: stream.Index, Type: "audio", Codec: stream.Codec, Language: stream.Language, Title: stream.Title}
+
+		// Copy the track as is when its codec has a container of its own,
+		// otherwise re-encode it to AAC
+		format, ok := audioTrackFormats[stream.Codec]
+		codecArgs := []string{"-c:a", "copy"}
+		if !ok {
+			format = audioTrackFormats["aac"]
+			codecArgs = []string{"-c:a", "aac", "-b:a", "192k"}
+		}
+
+		name := trackName("audio", stream) + format[0]
+		trackPath := filepath.Join(dir, name)
+		args := append([]string{"-y", "-v", "error", "-i", input, "-map", fmt.Sprintf("0:%d", stream.Index), "-vn"}, codecArgs...)
+		if output, err := DefaultTools.Command(ctx, ToolFFmpeg, append(args, trackPath)...).CombinedOutput(); err != nil {
+			return nil, nil, fmt.Errorf("ffmpeg failed to extract audio track %d: %w: %s", stream.Index, err, lastLines(string(output), 5))
+		}
+
+		data, err := ioutil.ReadFile(trackPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read audio track: %w", err)
+		}
+		files = append(files, DerivedFile{
+			Name:        base + "_" + name,
+			Role:        StreamRolePrefix + "tracks/" + name,
+			ContentType: format[1],
+			Data:        data,
+			Metadata:    trackMetadata(stream),
+		})
+		track.Paths = []string{"tracks/" + name}
+		tracks = append(tracks, track)
+	}
+
+	if len(info.Chapters) > 0 {
+		chapters, err := json.MarshalIndent(info.Chapters, "", "  ")
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to encode chapters: %w", err)
+		}
+		files = append(files,
+			DerivedFile{
+				Name:        base + "_chapters.vtt",
+				Role:        StreamRolePrefix + "tracks/chapters.vtt",
+				ContentType: "text/vtt",
+				Data:        []byte(chaptersTrack(info.Chapters)),
+				Metadata:    map[string]string{MetadataSearchable: "chapters"},
+			},
+			DerivedFile{
+				Name:        base + "_chapters.json",
+				Role:        StreamRolePrefix + "tracks/chapters.json",
+				ContentType: "application/json",
+				Data:        chapters,
+			},
+		)
+		tracks = append(tracks, MediaTrack{
+			Index: -1,
+			Type:  "chapters",
+			Paths: []string{"tracks/chapters.vtt", "tracks/chapters.json"},
+			Cues:  len(info.Chapters),
+		})
+	}
+
+	return files, tracks, nil
+}
+
+// trackName names the files of a track after its kind, stream index and language
+func trackName(kind string, stream MediaStream) string {
+	language := stream.Language
+	if language == "" {
+		language = "und"
+	}
+	return fmt.Sprintf("%s-%d-%s", kind, stream.Index, strings.ToLower(language))
+}
+
+// trackMetadata returns the metadata stored with the files of a track
+func trackMetadata(stream MediaStream) map[string]string {
+	metadata := map[string]string{
+		"streamIndex": strconv.Itoa(stream.Index),
+		"codec":       stream.Codec,
+	}
+	setMetadata(metadata, "language", stream.Language)
+	setMetadata(metadata, "title", stream.Title)
+	return metadata
+}
+
+// chaptersTrack writes chapters as a WebVTT chapters track
+func chaptersTrack(chapters []MediaChapter) string {
+	var track strings.Builder
+	track.WriteString("WEBVTT\n")
+	for i, chapter := range chapters {
+		title := chapter.Title
+		if title == "" {
+			title = fmt.Sprintf("Chapter %d", i+1)
+		}
+		fmt.Fprintf(&track, "\n%s --> %s\n%s\n", vttTimestamp(chapter.Start), vttTimestamp(chapter.End), title)
+	}
+	return track.String()
+}
+
+// ParseWebVTT reads the cues of a WebVTT track, with formatting tags removed
+// and multi-line text joined by spaces
+func ParseWebVTT(data []byte) []Cue {
+	var cues []Cue
+	var current *Cue
+	var text []string
+
+	flush := func() {
+		if current != nil {
+			current.Text = strings.TrimSpace(vttMarkup.ReplaceAllString(strings.Join(text, " "), ""))
+			if current.Text != "" {
+				cues = append(cues, *current)
+			}
+		}
+		current, text = nil, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			flush()
+			continue
+		}
+		if match := vttCueTiming.FindStringSubmatch(line); match != nil {
+			flush()
+			current = &Cue{Start: parseVTTTimestamp(match[1]), End: parseVTTTimestamp(match[2])}
+			continue
+		}
+		if current != nil {
+			text = append(text, line)
+		}
+	}
+	flush()
+	return cues
+}
+
+// parseVTTTimestamp parses a WebVTT timestamp ([HH:]MM:SS.mmm) into seconds
+func parseVTTTimestamp(timestamp string) float64 {
+	parts := strings.Split(timestamp, ":")
+	seconds := 0.0
+	for _, part := range parts {
+		seconds = seconds*60 + parseFloat(part)
+	}
+	return seconds
+}
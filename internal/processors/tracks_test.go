@@ -0,0 +1,94 @@
+package processors
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseWebVTT(t *testing.T) {
+	track := "\ufeffWEBVTT - Training video\r\n" +
+		"Kind: captions\r\n" +
+		"\r\n" +
+		"NOTE Reviewed by the\r\n" +
+		"localization team\r\n" +
+		"\r\n" +
+		"intro\r\n" +
+		"00:01.000 --> 00:04.500 align:start position:10%\r\n" +
+		"<v Speaker>Welcome to the <b>onboarding</b></v>\r\n" +
+		"  course  \r\n" +
+		"\r\n" +
+		"01:02:03.250 --> 01:02:05.000\r\n" +
+		"Later on\r\n" +
+		"\r\n" +
+		"00:10.000 --> 00:11.000\r\n" +
+		"<i></i>\r\n" +
+		"\r\n" +
+		"00:12.000 --> 00:13.000\r\n" +
+		"No blank line at the end"
+
+	want := []Cue{
+		{Start: 1, End: 4.5, Text: "Welcome to the onboarding course"},
+		{Start: 3723.25, End: 3725, Text: "Later on"},
+		// The cue with only markup is dropped
+		{Start: 12, End: 13, Text: "No blank line at the end"},
+	}
+	if cues := ParseWebVTT([]byte(track)); !reflect.DeepEqual(cues, want) {
+		t.Errorf("cues = %+v, want %+v", cues, want)
+	}
+
+	for _, data := range []string{"", "WEBVTT\n", "00:01 --> 00:02\nno milliseconds", "just text"} {
+		if cues := ParseWebVTT([]byte(data)); len(cues) != 0 {
+			t.Errorf("ParseWebVTT(%q) = %+v, want no cues", data, cues)
+		}
+	}
+}
+
+func TestParseVTTTimestamp(t *testing.T) {
+	tests := map[string]float64{
+		"00:00.000":     0,
+		"00:01.500":     1.5,
+		"59:59.999":     3599.999,
+		"01:00:00.000":  3600,
+		"100:00:00.000": 360000,
+	}
+	for timestamp, want := range tests {
+		if got := parseVTTTimestamp(timestamp); got != want {
+			t.Errorf("parseVTTTimestamp(%q) = %v, want %v", timestamp, got, want)
+		}
+	}
+}
+
+func TestChaptersTrack(t *testing.T) {
+	track := chaptersTrack([]MediaChapter{{Start: 0, End: 60, Title: "Intro"}, {Start: 60, End: 125.125}})
+	if !strings.HasPrefix(track, "WEBVTT\n") {
+		t.Errorf("track = %q, want a WebVTT header", track)
+	}
+
+	// Chapters without a title are numbered, and the track reads back
+	want := []Cue{{Start: 0, End: 60, Text: "Intro"}, {Start: 60, End: 125.125, Text: "Chapter 2"}}
+	if cues := ParseWebVTT([]byte(track)); !reflect.DeepEqual(cues, want) {
+		t.Errorf("cues = %+v, want %+v", cues, want)
+	}
+}
+
+func TestTrackName(t *testing.T) {
+	tests := []struct {
+		kind   string
+		stream MediaStream
+		want   string
+	}{
+		{"subtitles", MediaStream{Index: 3, Language: "ENG"}, "subtitles-3-eng"},
+		{"audio", MediaStream{Index: 1}, "audio-1-und"},
+	}
+	for _, tt := range tests {
+		if got := trackName(tt.kind, tt.stream); got != tt.want {
+			t.Errorf("trackName(%s, %+v) = %q, want %q", tt.kind, tt.stream, got, tt.want)
+		}
+	}
+
+	metadata := trackMetadata(MediaStream{Index: 2, Codec: "subrip", Language: "fre"})
+	if want := map[string]string{"streamIndex": "2", "codec": "subrip", "language": "fre"}; !reflect.DeepEqual(metadata, want) {
+		t.Errorf("trackMetadata = %v, want %v", metadata, want)
+	}
+}
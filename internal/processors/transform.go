@@ -0,0 +1,170 @@
+package processors
+
+import (
+	"fmt"
+	"image"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// Ways an image can be fitted to the requested width and height
+const (
+	FitContain = "contain" // Scale down to fit inside the box, keeping the aspect ratio
+	FitCover   = "cover"   // Scale to cover the box, then crop the overflow from the center
+	FitFill    = "fill"    // Stretch to exactly the box
+)
+
+// MaxTransformDimension is the largest width or height a transform may produce
+const MaxTransformDimension = 4096
+
+// TransformOptions describes an image transformation
+type TransformOptions struct {
+	Width   int    // Target width in pixels (0 to follow the height)
+	Height  int    // Target height in pixels (0 to follow the width)
+	Fit     string // FitContain, FitCover or FitFill
+	Format  string // ThumbnailFormatJPEG or ThumbnailFormatPNG, empty for automatic
+	Quality int    // JPEG quality, 0 for the default
+	Rotate  int    // Clockwise rotation in degrees: 0, 90, 180 or 270
+}
+
+// Validate normalizes the options and checks they are in range
+func (o *TransformOptions) Validate() error {
+	if o.Width < 0 || o.Height < 0 || o.Width > MaxTransformDimension || o.Height > MaxTransformDimension {
+		return fmt.Errorf("width and height must be between 0 and %d", MaxTransformDimension)
+	}
+
+	o.Fit = strings.ToLower(o.Fit)
+	switch o.Fit {
+	case "":
+		o.Fit = FitContain
+	case FitContain, FitCover, FitFill:
+	default:
+		return fmt.Errorf("fit must be %s, %s or %s", FitContain, FitCover, FitFill)
+	}
+	if o.Fit != FitContain && (o.Width == 0 || o.Height == 0) {
+		return fmt.Errorf("fit %s needs both a width and a height", o.Fit)
+	}
+
+	o.Format = strings.ToLower(o.Format)
+	switch o.Format {
+	case "jpg":
+		o.Format = ThumbnailFormatJPEG
+	case "", ThumbnailFormatJPEG, ThumbnailFormatPNG:
+	default:
+		return fmt.Errorf("format must be %s or %s", ThumbnailFormatJPEG, ThumbnailFormatPNG)
+	}
+
+	if o.Quality < 0 || o.Quality > 100 {
+		return fmt.Errorf("quality must be between 1 and 100")
+	}
+	if o.Quality == 0 {
+		o.Quality = defaultThumbnailQuality
+	}
+
+	o.Rotate = ((o.Rotate % 360) + 360) % 360
+	if o.Rotate%90 != 0 {
+		return fmt.Errorf("rotate must be a multiple of 90")
+	}
+	return nil
+}
+
+// Key identifies the transformation, so variants produced with the same
+// options can be cached and found again. Call Validate first.
+func (o TransformOptions) Key() string {
+	return fmt.Sprintf("w%d-h%d-%s-%s-q%d-r%d", o.Width, o.Height, o.Fit, o.Format, o.Quality, o.Rotate)
+}
+
+// Transform produces a resized, cropped, rotated or re-encoded variant of an
+// image, turned upright according to its EXIF orientation first. It returns
+// the variant and its content type.
+func (p *ImageProcessor) Transform(data []byte, options TransformOptions) ([]byte, string, error) {
+	if err := options.Validate(); err != nil {
+		return nil, "", err
+	}
+	if isSVG(data) {
+		return nil, "", fmt.Errorf("SVG images can't be transformed")
+	}
+
+	img, format, err := decodeImage(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	exif, _ := readEXIF(data)
+	img = applyOrientation(img, exif.Orientation())
+	img = rotate(img, options.Rotate)
+
+	switch options.Fit {
+	case FitContain:
+		if options.Width > 0 || options.Height > 0 {
+			bounds := img.Bounds()
+			maxWidth, maxHeight := options.Width, options.Height
+			if maxWidth == 0 {
+				maxWidth = bounds.Dx()
+			}
+			if maxHeight == 0 {
+				maxHeight = bounds.Dy()
+			}
+			img = resizeToFit(img, maxWidth, maxHeight)
+		}
+	case FitCover:
+		img = resizeToCover(img, options.Width, options.Height)
+	case FitFill:
+		img = resizeExact(img, options.Width, options.Height)
+	}
+
+	// Keep the original format when it can be written, otherwise choose by transparency
+	outputFormat := options.Format
+	if outputFormat == "" && (format == ThumbnailFormatJPEG || format == ThumbnailFormatPNG) {
+		outputFormat = format
+	}
+	return encodeImage(img, outputFormat, options.Quality)
+}
+
+// rotate rotates an image clockwise by 90, 180 or 270 degrees
+func rotate(img image.Image, degrees int) image.Image {
+	// EXIF orientations 6, 3 and 8 are the clockwise rotations
+	switch degrees {
+	case 90:
+		return applyOrientation(img, 6)
+	case 180:
+		return applyOrientation(img, 3)
+	case 270:
+		return applyOrientation(img, 8)
+	}
+	return img
+}
+
+// resizeToCover scales an image so it covers width x height, then crops the
+// overflow equally from both sides
+func resizeToCover(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	scale := float64(width) / float64(bounds.Dx())
+	if s := float64(height) / float64(bounds.Dy()); s > scale {
+		scale = s
+	}
+
+	// The part of the source that ends up in the output
+	cropWidth := int(float64(width)/scale + 0.5)
+	cropHeight := int(float64(height)/scale + 0.5)
+	if cropWidth > bounds.Dx() {
+		cropWidth = bounds.Dx()
+	}
+	if cropHeight > bounds.Dy() {
+		cropHeight = bounds.Dy()
+	}
+	x0 := bounds.Min.X + (bounds.Dx()-cropWidth)/2
+	y0 := bounds.Min.Y + (bounds.Dy()-cropHeight)/2
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, image.Rect(x0, y0, x0+cropWidth, y0+cropHeight), draw.Src, nil)
+	return dst
+}
+
+// resizeExact scales an image to exactly width x height, ignoring its aspect ratio
+func resizeExact(img image.Image, width, height int) image.Image {
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return dst
+}
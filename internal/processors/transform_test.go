@@ -0,0 +1,181 @@
+package processors
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestTransformOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options TransformOptions
+		want    TransformOptions
+		wantErr string
+	}{
+		{"defaults", TransformOptions{}, TransformOptions{Fit: FitContain, Quality: defaultThumbnailQuality}, ""},
+		{"width only", TransformOptions{Width: 100}, TransformOptions{Width: 100, Fit: FitContain, Quality: defaultThumbnailQuality}, ""},
+		{"normalized", TransformOptions{Width: 10, Height: 20, Fit: "COVER", Format: "JPG", Quality: 60, Rotate: -90},
+			TransformOptions{Width: 10, Height: 20, Fit: FitCover, Format: ThumbnailFormatJPEG, Quality: 60, Rotate: 270}, ""},
+		{"full turns", TransformOptions{Rotate: 450, Format: "png"}, TransformOptions{Fit: FitContain, Format: ThumbnailFormatPNG, Quality: defaultThumbnailQuality, Rotate: 90}, ""},
+		{"largest", TransformOptions{Width: MaxTransformDimension, Height: MaxTransformDimension, Fit: FitFill},
+			TransformOptions{Width: MaxTransformDimension, Height: MaxTransformDimension, Fit: FitFill, Quality: defaultThumbnailQuality}, ""},
+		{"negative width", TransformOptions{Width: -1}, TransformOptions{}, "width and height"},
+		{"too tall", TransformOptions{Height: MaxTransformDimension + 1}, TransformOptions{}, "width and height"},
+		{"unknown fit", TransformOptions{Fit: "stretch"}, TransformOptions{}, "fit must be"},
+		{"cover without height", TransformOptions{Width: 10, Fit: FitCover}, TransformOptions{}, "needs both"},
+		{"fill without width", TransformOptions{Height: 10, Fit: FitFill}, TransformOptions{}, "needs both"},
+		{"unknown format", TransformOptions{Format: "gif"}, TransformOptions{}, "format must be"},
+		{"quality above 100", TransformOptions{Quality: 101}, TransformOptions{}, "quality"},
+		{"negative quality", TransformOptions{Quality: -1}, TransformOptions{}, "quality"},
+		{"odd angle", TransformOptions{Rotate: 45}, TransformOptions{}, "multiple of 90"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := tt.options
+			err := options.Validate()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if options != tt.want {
+				t.Errorf("options = %+v, want %+v", options, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransformOptionsKey(t *testing.T) {
+	normalize := func(o TransformOptions) TransformOptions {
+		if err := o.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		return o
+	}
+
+	// Options that mean the same transformation share a key
+	a := normalize(TransformOptions{Width: 100, Format: "jpg", Rotate: -270})
+	b := normalize(TransformOptions{Width: 100, Fit: "contain", Format: "jpeg", Quality: defaultThumbnailQuality, Rotate: 90})
+	if a.Key() != b.Key() {
+		t.Errorf("keys %q and %q differ", a.Key(), b.Key())
+	}
+
+	// Every option changes the key
+	base := normalize(TransformOptions{Width: 100, Height: 50})
+	keys := map[string]bool{base.Key(): true}
+	for _, o := range []TransformOptions{
+		{Width: 50, Height: 100},
+		{Width: 100, Height: 50, Fit: FitCover},
+		{Width: 100, Height: 50, Format: "png"},
+		{Width: 100, Height: 50, Quality: 50},
+		{Width: 100, Height: 50, Rotate: 180},
+	} {
+		key := normalize(o).Key()
+		if keys[key] {
+			t.Errorf("%+v shares key %q", o, key)
+		}
+		keys[key] = true
+	}
+}
+
+// stripedImage returns an image made of three vertical stripes, red, green
+// and blue, each a third of the width
+func stripedImage(width, height int) *image.NRGBA {
+	stripes := []color.NRGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}}
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, stripes[x*3/width])
+		}
+	}
+	return img
+}
+
+func TestResizeToCover(t *testing.T) {
+	green := color.NRGBA{0, 255, 0, 255}
+
+	// Covering a square with a 3:1 image keeps only the middle stripe
+	img := resizeToCover(stripedImage(300, 100), 50, 50)
+	if size := img.Bounds().Size(); size != image.Pt(50, 50) {
+		t.Fatalf("size = %v, want 50x50", size)
+	}
+	for _, x := range []int{0, 25, 49} {
+		if got := color.NRGBAModel.Convert(img.At(x, 25)); got != green {
+			t.Errorf("pixel (%d, 25) = %v, want green", x, got)
+		}
+	}
+
+	// Covering a wider box crops the top and bottom instead, keeping all stripes
+	img = resizeToCover(stripedImage(300, 300), 90, 30)
+	if size := img.Bounds().Size(); size != image.Pt(90, 30) {
+		t.Fatalf("size = %v, want 90x30", size)
+	}
+	for x, want := range map[int]color.NRGBA{5: {255, 0, 0, 255}, 45: green, 85: {0, 0, 255, 255}} {
+		if got := color.NRGBAModel.Convert(img.At(x, 15)); got != want {
+			t.Errorf("pixel (%d, 15) = %v, want %v", x, got, want)
+		}
+	}
+
+	// A box larger than the image scales it up
+	if size := resizeToCover(stripedImage(30, 10), 60, 60).Bounds().Size(); size != image.Pt(60, 60) {
+		t.Errorf("upscaled size = %v, want 60x60", size)
+	}
+}
+
+func TestTransform(t *testing.T) {
+	source := encodedPNG(t) // 16x16
+	landscape := func() []byte {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, stripedImage(60, 30)); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}()
+
+	tests := []struct {
+		name        string
+		data        []byte
+		options     TransformOptions
+		size        image.Point
+		contentType string
+	}{
+		{"no change", source, TransformOptions{}, image.Pt(16, 16), "image/png"},
+		{"contain", landscape, TransformOptions{Width: 20, Height: 20}, image.Pt(20, 10), "image/png"},
+		{"contain by height", landscape, TransformOptions{Height: 15}, image.Pt(30, 15), "image/png"},
+		{"cover", landscape, TransformOptions{Width: 20, Height: 20, Fit: FitCover}, image.Pt(20, 20), "image/png"},
+		{"fill", landscape, TransformOptions{Width: 20, Height: 20, Fit: FitFill}, image.Pt(20, 20), "image/png"},
+		{"rotated", landscape, TransformOptions{Rotate: 90}, image.Pt(30, 60), "image/png"},
+		{"re-encoded", landscape, TransformOptions{Format: "jpg"}, image.Pt(60, 30), "image/jpeg"},
+		{"rotated upright first", rotatedJPEG(t), TransformOptions{Rotate: 90}, image.Pt(64, 32), "image/jpeg"},
+	}
+	for _, tt := range tests {
+		data, contentType, err := NewImageProcessor().Transform(tt.data, tt.options)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if img.Bounds().Size() != tt.size || contentType != tt.contentType {
+			t.Errorf("%s: got %s of %v, want %s of %v", tt.name, contentType, img.Bounds().Size(), tt.contentType, tt.size)
+		}
+	}
+
+	if _, _, err := NewImageProcessor().Transform([]byte(`<svg width="1" height="1"/>`), TransformOptions{}); err == nil {
+		t.Error("expected an error transforming an SVG")
+	}
+	if _, _, err := NewImageProcessor().Transform(source, TransformOptions{Rotate: 45}); err == nil {
+		t.Error("expected an error for invalid options")
+	}
+}
@@ -6,8 +6,8 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -20,66 +20,63 @@ func NewVideoProcessor() *VideoProcessor {
 }
 
 // Process processes a video file
-func (p *VideoProcessor) Process(ctx context.Context, reader io.Reader, filename string, options ProcessOptions) (*ProcessResult, error) {
-	// Read the entire video into a temporary file since we can't process video streams directly
-	data, err := ioutil.ReadAll(reader)
+func (p *VideoProcessor) Process(ctx context.Context, reader io.Reader, filename string, options ProcessOptions) (_ *ProcessResult, err error) {
+	// Spool the video to a temporary file for ffmpeg, without holding it in memory
+	videoPath, _, err := spoolToTempFile(reader, "video-*"+filepath.Ext(filename))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read video: %w", err)
+		return nil, err
 	}
+	defer os.Remove(videoPath)
 
 	result := &ProcessResult{
 		Metadata: make(map[string]string),
 	}
+	// Remove the files of encoded streams if a later step fails
+	defer func() {
+		if err != nil {
+			result.Cleanup()
+		}
+	}()
 
-	// Create a temporary file to store the video
-	tempFile, err := ioutil.TempFile("", "video-*"+filepath.Ext(filename))
+	// Probe the video once; metadata, streams and thumbnails all use the result
+	formats, err := streamFormats(options)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+		return nil, err
 	}
-	defer os.Remove(tempFile.Name())
-	defer tempFile.Close()
+	wantsThumbnails := options.String("thumbnails", "") != "" || options.Bool("thumbnails")
+	needsProbe := len(formats) > 0 || wantsThumbnails || options.Bool("previewClip") || options.Bool("extractTracks")
 
-	if _, err = tempFile.Write(data); err != nil {
-		return nil, fmt.Errorf("failed to write to temporary file: %w", err)
+	// Requested outputs fail outright without their tools; metadata and the
+	// preview are skipped and the missing tools noted
+	if needsProbe {
+		if err := DefaultTools.Require(ToolFFprobe, ToolFFmpeg); err != nil {
+			return nil, err
+		}
+	} else if options.Bool("extractAudio") {
+		if err := DefaultTools.Require(ToolFFmpeg); err != nil {
+			return nil, err
+		}
 	}
-	tempFile.Close() // Close to ensure data is flushed
-
-	// Extract metadata using ffprobe if enabled and available
-	if options.ExtractMetadata {
-		cmd := exec.Command("ffprobe", "-v", "quiet", "-print_format", "json", "-show_format", "-show_streams", tempFile.Name())
-		metadataOutput, err := cmd.Output()
-
-		if err == nil {
-			// Store the JSON output as metadata
-			result.Metadata["format"] = strings.ToLower(filepath.Ext(filename))
-			result.Metadata["details"] = string(metadataOutput)
-
-			// Try to extract duration and dimensions using more direct ffprobe commands
-			// Duration
-			durationCmd := exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", tempFile.Name())
-			durationOutput, err := durationCmd.Output()
-			if err == nil {
-				result.Metadata["duration"] = strings.TrimSpace(string(durationOutput))
-			}
 
-			// Resolution
-			widthCmd := exec.Command("ffprobe", "-v", "error", "-select_streams", "v:0", "-show_entries", "stream=width", "-of", "default=noprint_wrappers=1:nokey=1", tempFile.Name())
-			widthOutput, err := widthCmd.Output()
-			heightCmd := exec.Command("ffprobe", "-v", "error", "-select_streams", "v:0", "-show_entries", "stream=height", "-of", "default=noprint_wrappers=1:nokey=1", tempFile.Name())
-			heightOutput, err2 := heightCmd.Output()
-
-			if err == nil && err2 == nil {
-				width := strings.TrimSpace(string(widthOutput))
-				height := strings.TrimSpace(string(heightOutput))
-				result.Metadata["width"] = width
-				result.Metadata["height"] = height
-				result.Metadata["resolution"] = width + "x" + height
-			}
+	var info *MediaInfo
+	if options.ExtractMetadata && !DefaultTools.Available(ToolFFprobe) {
+		noteMissingTools(result.Metadata, ToolFFprobe)
+	} else if options.ExtractMetadata || needsProbe {
+		info, err = probeMedia(ctx, videoPath)
+		if err != nil && needsProbe {
+			return nil, err
 		}
 	}
+	if options.ExtractMetadata && info != nil {
+		result.Data = info
+		result.Metadata["format"] = strings.ToLower(filepath.Ext(filename))
+		info.addMetadata(result.Metadata)
+	}
 
 	// Generate a thumbnail preview if requested and ffmpeg is available
-	if options.GeneratePreview {
+	if options.GeneratePreview && !DefaultTools.Available(ToolFFmpeg) {
+		noteMissingTools(result.Metadata, ToolFFmpeg)
+	} else if options.GeneratePreview {
 		// Create a temporary file for the thumbnail
 		thumbnailFile, err := ioutil.TempFile("", "thumbnail-*.jpg")
 		if err != nil {
@@ -89,13 +86,17 @@ func (p *VideoProcessor) Process(ctx context.Context, reader io.Reader, filename
 			defer os.Remove(thumbnailFile.Name())
 			thumbnailFile.Close()
 
-			// Try to generate thumbnail at 5 seconds or 10% into the video
-			cmd := exec.Command("ffmpeg", "-i", tempFile.Name(), "-ss", "00:00:05", "-vframes", "1", thumbnailFile.Name())
+			// Take the frame 10% into the video, at most 5 seconds in
+			seek := 5.0
+			if info != nil && info.Format.Duration > 0 && info.Format.Duration < 50 {
+				seek = info.Format.Duration / 10
+			}
+			cmd := DefaultTools.Command(ctx, ToolFFmpeg, "-y", "-i", videoPath, "-ss", strconv.FormatFloat(seek, 'f', 3, 64), "-vframes", "1", thumbnailFile.Name())
 			err = cmd.Run()
 
 			if err != nil {
-				// If failed at 5 seconds, try at beginning
-				cmd = exec.Command("ffmpeg", "-i", tempFile.Name(), "-vframes", "1", thumbnailFile.Name())
+				// If that failed, try at beginning
+				cmd = DefaultTools.Command(ctx, ToolFFmpeg, "-y", "-i", videoPath, "-vframes", "1", thumbnailFile.Name())
 				err = cmd.Run()
 			}
 
@@ -108,6 +109,112 @@ func (p *VideoProcessor) Process(ctx context.Context, reader io.Reader, filename
 		}
 	}
 
+	// Extract the audio track if requested, e.g. as the first step of a pipeline
+	if options.Bool("extractAudio") {
+		audioFile, err := ioutil.TempFile("", "audio-*.mp3")
+		if err == nil {
+			defer os.Remove(audioFile.Name())
+			audioFile.Close()
+
+			cmd := DefaultTools.Command(ctx, ToolFFmpeg, "-y", "-i", videoPath, "-vn", "-acodec", "libmp3lame", "-q:a", "4", audioFile.Name())
+			if err := cmd.Run(); err != nil {
+				return nil, fmt.Errorf("failed to extract audio: %w", err)
+			}
+
+			audioData, err := ioutil.ReadFile(audioFile.Name())
+			if err != nil {
+				return nil, fmt.Errorf("failed to read extracted audio: %w", err)
+			}
+
+			result.Derived = append(result.Derived, DerivedFile{
+				Name:        strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)) + ".mp3",
+				Role:        "audio",
+				ContentType: "audio/mpeg",
+				Data:        audioData,
+			})
+		}
+	}
+
+	// Encode adaptive streams if requested, so large videos can be played
+	// without downloading them
+	if len(formats) > 0 {
+		ladder := DefaultBitrateLadder
+		if value := options.String("streamLadder", ""); value != "" {
+			if ladder, err = ParseBitrateLadder(value); err != nil {
+				return nil, err
+			}
+		}
+		segmentSeconds := options.Int("segmentDuration", defaultSegmentSeconds)
+		if segmentSeconds < 1 || segmentSeconds > 60 {
+			return nil, fmt.Errorf("segment duration must be between 1 and 60 seconds")
+		}
+
+		files, renditions, dir, err := transcodeStreams(ctx, videoPath, filename, info, formats, ladder, segmentSeconds)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode streams: %w", err)
+		}
+		result.Derived = append(result.Derived, files...)
+		result.tempDirs = append(result.tempDirs, dir)
+
+		names := make([]string, len(renditions))
+		for i, r := range renditions {
+			names[i] = r.Name()
+		}
+		result.Metadata["streams"] = strings.Join(formats, ",")
+		result.Metadata["streamRenditions"] = strings.Join(names, ",")
+		for _, format := range formats {
+			if format == StreamHLS {
+				result.Metadata["hlsPlaylist"] = HLSPlaylist
+			} else {
+				result.Metadata["dashManifest"] = DASHManifest
+			}
+		}
+	}
+
+	// Take thumbnails along the video, with a sprite sheet and thumbnail track
+	// for scrubbing previews
+	if wantsThumbnails {
+		files, thumbnails, sheets, err := makeVideoThumbnails(ctx, videoPath, filename, info, options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to make thumbnails: %w", err)
+		}
+		result.Derived = append(result.Derived, files...)
+		result.Metadata["thumbnailCount"] = fmt.Sprintf("%d", thumbnails)
+		result.Metadata["spriteSheet"] = VideoSpriteSheet
+		result.Metadata["spriteSheets"] = fmt.Sprintf("%d", sheets)
+		result.Metadata["thumbnailTrack"] = VideoThumbnailTrack
+	}
+
+	// Encode a short animated preview
+	if options.Bool("previewClip") {
+		clip, err := makePreviewClip(ctx, videoPath, filename, info)
+		if err != nil {
+			return nil, fmt.Errorf("failed to make preview clip: %w", err)
+		}
+		result.Derived = append(result.Derived, clip)
+		result.Metadata["previewClip"] = VideoPreviewClip
+	}
+
+	// Extract subtitle and audio tracks and chapters, listing them in the
+	// result; subtitles and chapters are indexed for search when stored
+	if options.Bool("extractTracks") {
+		files, tracks, err := extractTracks(ctx, videoPath, filename, info)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract tracks: %w", err)
+		}
+		result.Derived = append(result.Derived, files...)
+		info.Tracks = tracks
+		result.Data = info
+
+		extracted := 0
+		for _, track := range tracks {
+			if track.Skipped == "" {
+				extracted++
+			}
+		}
+		result.Metadata["extractedTracks"] = strconv.Itoa(extracted)
+	}
+
 	// Generate summary
 	result.Summary = fmt.Sprintf("Video file: %s", filename)
 	if result.Metadata["duration"] != "" {
@@ -116,10 +223,35 @@ func (p *VideoProcessor) Process(ctx context.Context, reader io.Reader, filename
 	if result.Metadata["resolution"] != "" {
 		result.Summary += fmt.Sprintf(", Resolution: %s", result.Metadata["resolution"])
 	}
+	if result.Metadata["streamRenditions"] != "" {
+		result.Summary += fmt.Sprintf(", Streams: %s (%s)", result.Metadata["streams"], result.Metadata["streamRenditions"])
+	}
+	if result.Metadata["extractedTracks"] != "" {
+		result.Summary += fmt.Sprintf(", Extracted tracks: %s", result.Metadata["extractedTracks"])
+	}
 
 	return result, nil
 }
 
+// Features lists the features of the processor, all of which need ffmpeg or ffprobe
+func (p *VideoProcessor) Features() []Feature {
+	both := []string{ToolFFmpeg, ToolFFprobe}
+	return []Feature{
+		{Name: "metadata", Description: "Codec, resolution, duration, track and chapter metadata", Tools: []string{ToolFFprobe}},
+		{Name: "preview", Description: "Preview frames", Tools: []string{ToolFFmpeg}},
+		{Name: "extractAudio", Description: "MP3 audio extraction", Tools: []string{ToolFFmpeg}},
+		{Name: "stream", Description: "HLS and DASH adaptive streams", Tools: both},
+		{Name: "thumbnails", Description: "Thumbnails, sprite sheets and WebVTT thumbnail tracks", Tools: both},
+		{Name: "previewClip", Description: "Animated preview clips", Tools: both},
+		{Name: "extractTracks", Description: "Subtitle, audio and chapter track extraction", Tools: both},
+	}
+}
+
+// Name returns the processor name
+func (p *VideoProcessor) Name() string {
+	return "video"
+}
+
 // CanProcess returns true if this processor can process the given content type
 func (p *VideoProcessor) CanProcess(contentType, ext string) bool {
 	// Check content type
@@ -0,0 +1,345 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// Ways of choosing the frames of a video's thumbnails
+const (
+	ThumbnailsInterval = "interval" // One frame every thumbnailInterval seconds
+	ThumbnailsScenes   = "scenes"   // The first frame and one at every scene change
+)
+
+// Paths of the thumbnail outputs below the stream root, also used as their
+// derived file roles after StreamRolePrefix
+const (
+	VideoThumbnailTrack = "thumbnails/thumbnails.vtt"
+	VideoSpriteSheet    = "thumbnails/sprite.jpg"
+	VideoPreviewClip    = "preview.mp4"
+)
+
+// Video thumbnail defaults
+const (
+	defaultThumbnailInterval   = 10  // Seconds between interval thumbnails
+	defaultSceneThreshold      = 0.3 // Scene change score from 0 to 1
+	defaultMaxVideoThumbnails  = 100
+	defaultVideoThumbnailWidth = 160
+	spriteColumns              = 10
+)
+
+// Bounds of one sprite sheet. JPEG can't encode images wider or taller than
+// maxSpriteSide, and sheets are kept to maxSpritePixels (64MB as RGBA); the
+// thumbnails that don't fit go on further sheets.
+const (
+	maxSpriteSide   = 65535
+	maxSpritePixels = 16 << 20
+)
+
+// The animated preview is made of previewClipParts one-second excerpts spread
+// over the video
+const (
+	previewClipParts = 5
+	previewClipWidth = 320
+)
+
+// showinfoTime matches the timestamp of a frame logged by ffmpeg's showinfo filter
+var showinfoTime = regexp.MustCompile(`Parsed_showinfo.*pts_time:\s*([0-9.]+)`)
+
+// videoFrame is a thumbnail taken from a video
+type videoFrame struct {
+	time float64 // Seconds from the start of the video
+	data []byte  // JPEG
+}
+
+// spriteTile is where a thumbnail is in the sprite sheets
+type spriteTile struct {
+	sheet int
+	rect  image.Rectangle
+}
+
+// makeVideoThumbnails takes thumbnails along a video and lays them out in
+// sprite sheets with a WebVTT track mapping each stretch of the video to its
+// tile, as players expect for scrubbing previews. The frames, sheets and
+// track are returned as derived files below the stream root, with the number
+// of thumbnails and sheets.
+func makeVideoThumbnails(ctx context.Context, input, filename string, info *MediaInfo, options ProcessOptions) ([]DerivedFile, int, int, error) {
+	mode := strings.ToLower(options.String("thumbnails", ""))
+	if mode == "true" || options.Bool("thumbnails") {
+		mode = ThumbnailsInterval
+	}
+	if mode != ThumbnailsInterval && mode != ThumbnailsScenes {
+		return nil, 0, 0, fmt.Errorf("thumbnails must be %s or %s", ThumbnailsInterval, ThumbnailsScenes)
+	}
+	interval := options.Int("thumbnailInterval", defaultThumbnailInterval)
+	if interval < 1 {
+		return nil, 0, 0, fmt.Errorf("thumbnail interval must be at least 1 second")
+	}
+	maxFrames := options.Int("maxThumbnails", defaultMaxVideoThumbnails)
+	if maxFrames < 1 || maxFrames > 1000 {
+		return nil, 0, 0, fmt.Errorf("max thumbnails must be between 1 and 1000")
+	}
+	width := options.Int("thumbnailWidth", defaultVideoThumbnailWidth)
+	if width < 16 || width > 1920 {
+		return nil, 0, 0, fmt.Errorf("thumbnail width must be between 16 and 1920")
+	}
+	threshold := defaultSceneThreshold
+	if value := options.String("sceneThreshold", ""); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 || parsed >= 1 {
+			return nil, 0, 0, fmt.Errorf("scene threshold must be between 0 and 1")
+		}
+		threshold = parsed
+	}
+
+	source, err := info.streamSource()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	var filter string
+	if mode == ThumbnailsScenes {
+		filter = fmt.Sprintf("select=eq(n\\,0)+gt(scene\\,%g),showinfo,scale=%d:-2", threshold, width)
+	} else {
+		filter = fmt.Sprintf("fps=1/%d,showinfo,scale=%d:-2", interval, width)
+	}
+	frames, err := extractVideoFrames(ctx, input, filter, maxFrames)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if len(frames) == 0 {
+		return nil, 0, 0, fmt.Errorf("no frames could be extracted")
+	}
+	if mode == ThumbnailsInterval {
+		// The fps filter emits frames on the interval grid
+		for i := range frames {
+			frames[i].time = float64(i * interval)
+		}
+	}
+
+	sheets, tiles, err := buildSpriteSheets(frames)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	base := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	files := make([]DerivedFile, 0, len(frames)+len(sheets)+1)
+	for i, frame := range frames {
+		files = append(files, DerivedFile{
+			Name:        fmt.Sprintf("%s_thumbnail_%04d.jpg", base, i+1),
+			Role:        fmt.Sprintf("%sthumbnails/%04d.jpg", StreamRolePrefix, i+1),
+			ContentType: "image/jpeg",
+			Data:        frame.data,
+			Metadata:    map[string]string{"time": strconv.FormatFloat(frame.time, 'f', 3, 64)},
+		})
+	}
+	names := make([]string, len(sheets))
+	for i, sheet := range sheets {
+		names[i] = spriteSheetName(i)
+		files = append(files, DerivedFile{
+			Name:        base + "_" + names[i],
+			Role:        StreamRolePrefix + path.Join(path.Dir(VideoSpriteSheet), names[i]),
+			ContentType: "image/jpeg",
+			Data:        sheet,
+		})
+	}
+	files = append(files, DerivedFile{
+		Name:        base + "_thumbnails.vtt",
+		Role:        StreamRolePrefix + VideoThumbnailTrack,
+		ContentType: "text/vtt",
+		Data:        []byte(thumbnailTrack(frames, tiles, source.duration, names)),
+	})
+	return files, len(frames), len(sheets), nil
+}
+
+// spriteSheetName returns the file name of a sprite sheet: "sprite.jpg" for
+// the first, then "sprite_2.jpg" and so on
+func spriteSheetName(i int) string {
+	if i == 0 {
+		return path.Base(VideoSpriteSheet)
+	}
+	return fmt.Sprintf("sprite_%d.jpg", i+1)
+}
+
+// extractVideoFrames runs ffmpeg with a filter ending in showinfo and scale,
+// returning the frames it keeps with the timestamps showinfo logs
+func extractVideoFrames(ctx context.Context, input, filter string, maxFrames int) ([]videoFrame, error) {
+	dir, err := ioutil.TempDir("", "frames-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cmd := DefaultTools.Command(ctx, ToolFFmpeg, "-hide_banner", "-nostats", "-i", input,
+		"-vf", filter, "-vsync", "vfr", "-frames:v", strconv.Itoa(maxFrames), "-q:v", "4",
+		filepath.Join(dir, "frame_%04d.jpg"))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed to extract frames: %w: %s", err, lastLines(stderr.String(), 5))
+	}
+
+	var times []float64
+	for _, match := range showinfoTime.FindAllStringSubmatch(stderr.String(), -1) {
+		t, _ := strconv.ParseFloat(match[1], 64)
+		times = append(times, t)
+	}
+
+	names, err := filepath.Glob(filepath.Join(dir, "frame_*.jpg"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	frames := make([]videoFrame, 0, len(names))
+	for i, name := range names {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read frame: %w", err)
+		}
+		frame := videoFrame{data: data}
+		if i < len(times) {
+			frame.time = times[i]
+		}
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// buildSpriteSheets lays frames out left to right and top to bottom in grids
+// of up to spriteColumns columns, starting a new sheet when one would exceed
+// maxSpriteSide or maxSpritePixels. It returns the sheets as JPEG and each
+// frame's tile. Frames are decoded one at a time as they are drawn.
+func buildSpriteSheets(frames []videoFrame) ([][]byte, []spriteTile, error) {
+	// Every frame has the size of the first, as they come from the same video
+	config, _, err := image.DecodeConfig(bytes.NewReader(frames[0].data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode frame: %w", err)
+	}
+	tile := image.Pt(config.Width, config.Height)
+	if tile.X < 1 || tile.Y < 1 || tile.X > maxSpriteSide || tile.Y > maxSpriteSide {
+		return nil, nil, fmt.Errorf("thumbnails of %dx%d pixels can't be laid out in a sprite sheet", tile.X, tile.Y)
+	}
+
+	tilePixels := tile.X * tile.Y
+	columns := min(spriteColumns, len(frames), maxSpriteSide/tile.X, max(maxSpritePixels/tilePixels, 1))
+	rows := min(maxSpriteSide/tile.Y, max(maxSpritePixels/(columns*tilePixels), 1))
+	perSheet := columns * rows
+
+	var sheets [][]byte
+	tiles := make([]spriteTile, len(frames))
+	for start := 0; start < len(frames); start += perSheet {
+		count := min(perSheet, len(frames)-start)
+		sheetRows := (count + columns - 1) / columns
+		sheet := image.NewRGBA(image.Rect(0, 0, min(count, columns)*tile.X, sheetRows*tile.Y))
+
+		for i := start; i < start+count; i++ {
+			img, _, err := image.Decode(bytes.NewReader(frames[i].data))
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to decode frame: %w", err)
+			}
+			n := i - start
+			at := image.Pt(n%columns*tile.X, n/columns*tile.Y)
+			tiles[i] = spriteTile{sheet: len(sheets), rect: image.Rectangle{Min: at, Max: at.Add(tile)}}
+			draw.Draw(sheet, tiles[i].rect, img, img.Bounds().Min, draw.Src)
+		}
+
+		data, _, err := encodeImage(sheet, ThumbnailFormatJPEG, 80)
+		if err != nil {
+			return nil, nil, err
+		}
+		sheets = append(sheets, data)
+	}
+	return sheets, tiles, nil
+}
+
+// thumbnailTrack writes a WebVTT track whose cues point into the sprite sheets
+// with media fragments, each cue lasting until the next frame
+func thumbnailTrack(frames []videoFrame, tiles []spriteTile, duration float64, sheets []string) string {
+	var track strings.Builder
+	track.WriteString("WEBVTT\n")
+	for i, frame := range frames {
+		end := duration
+		if i+1 < len(frames) {
+			end = frames[i+1].time
+		}
+		if end <= frame.time {
+			end = frame.time + 1
+		}
+		tile := tiles[i].rect
+		fmt.Fprintf(&track, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			vttTimestamp(frame.time), vttTimestamp(end), sheets[tiles[i].sheet],
+			tile.Min.X, tile.Min.Y, tile.Dx(), tile.Dy())
+	}
+	return track.String()
+}
+
+// vttTimestamp formats seconds as a WebVTT timestamp (HH:MM:SS.mmm)
+func vttTimestamp(seconds float64) string {
+	ms := int64(seconds*1000 + 0.5)
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// makePreviewClip encodes a short muted clip of one-second excerpts spread
+// over the video, for animated previews
+func makePreviewClip(ctx context.Context, input, filename string, info *MediaInfo) (DerivedFile, error) {
+	source, err := info.streamSource()
+	if err != nil {
+		return DerivedFile{}, err
+	}
+
+	output, err := ioutil.TempFile("", "preview-*.mp4")
+	if err != nil {
+		return DerivedFile{}, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	output.Close()
+	defer os.Remove(output.Name())
+
+	// Short videos are previewed from the start; longer ones keep the first
+	// second of each of previewClipParts equal stretches
+	filter := fmt.Sprintf("scale=%d:-2", previewClipWidth)
+	if source.duration > 2*previewClipParts {
+		period := source.duration / previewClipParts
+		filter = fmt.Sprintf("select=lt(mod(t\\,%.3f)\\,1),setpts=N/FRAME_RATE/TB,%s", period, filter)
+	}
+
+	cmd := DefaultTools.Command(ctx, ToolFFmpeg, "-y", "-v", "error", "-i", input,
+		"-vf", filter, "-an", "-t", strconv.Itoa(previewClipParts),
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "28", "-pix_fmt", "yuv420p",
+		"-movflags", "+faststart", output.Name())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return DerivedFile{}, fmt.Errorf("ffmpeg failed to encode preview clip: %w: %s", err, lastLines(string(out), 5))
+	}
+
+	data, err := ioutil.ReadFile(output.Name())
+	if err != nil {
+		return DerivedFile{}, fmt.Errorf("failed to read preview clip: %w", err)
+	}
+	return DerivedFile{
+		Name:        strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)) + "_preview.mp4",
+		Role:        StreamRolePrefix + VideoPreviewClip,
+		ContentType: "video/mp4",
+		Data:        data,
+	}, nil
+}
+
+// lastLines returns the last n lines of a command's output, for error messages
+func lastLines(output string, n int) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
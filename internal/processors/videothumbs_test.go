@@ -0,0 +1,178 @@
+package processors
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"reflect"
+	"testing"
+)
+
+// jpegFrames returns n video frames of the given size, each filled with a
+// different grey and a second apart
+func jpegFrames(t *testing.T, n, width, height int) []videoFrame {
+	t.Helper()
+	frames := make([]videoFrame, n)
+	for i := range frames {
+		img := image.NewGray(image.Rect(0, 0, width, height))
+		for j := range img.Pix {
+			img.Pix[j] = uint8(i * 255 / n)
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, nil); err != nil {
+			t.Fatal(err)
+		}
+		frames[i] = videoFrame{time: float64(i), data: buf.Bytes()}
+	}
+	return frames
+}
+
+func TestBuildSpriteSheets(t *testing.T) {
+	frames := jpegFrames(t, 23, 16, 9)
+	sheets, tiles, err := buildSpriteSheets(frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sheets) != 1 || len(tiles) != len(frames) {
+		t.Fatalf("got %d sheets and %d tiles, want one sheet of %d", len(sheets), len(tiles), len(frames))
+	}
+
+	// Frames fill rows of spriteColumns, left to right
+	sheet, _, err := image.Decode(bytes.NewReader(sheets[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := sheet.Bounds().Size(); size != image.Pt(spriteColumns*16, 3*9) {
+		t.Errorf("sheet is %v, want 10 columns and 3 rows of 16x9", size)
+	}
+	for i, want := range map[int]image.Rectangle{
+		0:  image.Rect(0, 0, 16, 9),
+		9:  image.Rect(144, 0, 160, 9),
+		10: image.Rect(0, 9, 16, 18),
+		22: image.Rect(32, 18, 48, 27),
+	} {
+		if tiles[i] != (spriteTile{sheet: 0, rect: want}) {
+			t.Errorf("tile %d = %+v, want %v", i, tiles[i], want)
+		}
+	}
+
+	// Each tile shows its own frame
+	for _, i := range []int{0, 11, 22} {
+		center := tiles[i].rect.Min.Add(image.Pt(8, 4))
+		got := int(color.GrayModel.Convert(sheet.At(center.X, center.Y)).(color.Gray).Y)
+		if want := i * 255 / len(frames); got < want-8 || got > want+8 {
+			t.Errorf("tile %d has grey %d, want about %d", i, got, want)
+		}
+	}
+}
+
+func TestBuildSpriteSheetsSplits(t *testing.T) {
+	// Frames taller than half of maxSpriteSide fit one row to a sheet
+	frames := jpegFrames(t, spriteColumns+3, 2, maxSpriteSide/2+1)
+	sheets, tiles, err := buildSpriteSheets(frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sheets) != 2 {
+		t.Fatalf("got %d sheets, want 2", len(sheets))
+	}
+	last := tiles[len(tiles)-1]
+	if last.sheet != 1 || last.rect.Min != image.Pt(4, 0) {
+		t.Errorf("last tile = %+v, want the third on the second sheet", last)
+	}
+	second, _, err := image.DecodeConfig(bytes.NewReader(sheets[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Width != 3*2 || second.Height != maxSpriteSide/2+1 {
+		t.Errorf("second sheet is %dx%d, want it cut to its three frames", second.Width, second.Height)
+	}
+
+	if _, _, err := buildSpriteSheets([]videoFrame{{data: []byte("not a jpeg")}}); err == nil {
+		t.Error("expected an error for a frame that can't be decoded")
+	}
+}
+
+func TestThumbnailTrack(t *testing.T) {
+	frames := []videoFrame{{time: 0}, {time: 10}, {time: 10}, {time: 3725.5}}
+	tiles := []spriteTile{
+		{0, image.Rect(0, 0, 160, 90)},
+		{0, image.Rect(160, 0, 320, 90)},
+		{0, image.Rect(320, 0, 480, 90)},
+		{1, image.Rect(0, 0, 160, 90)},
+	}
+	got := thumbnailTrack(frames, tiles, 3730, []string{"sprite.jpg", "sprite_2.jpg"})
+
+	// Cues last until the next frame, and at least a second
+	want := `WEBVTT
+
+00:00:00.000 --> 00:00:10.000
+sprite.jpg#xywh=0,0,160,90
+
+00:00:10.000 --> 00:00:11.000
+sprite.jpg#xywh=160,0,160,90
+
+00:00:10.000 --> 01:02:05.500
+sprite.jpg#xywh=320,0,160,90
+
+01:02:05.500 --> 01:02:10.000
+sprite_2.jpg#xywh=0,0,160,90
+`
+	if got != want {
+		t.Errorf("track =\n%s\nwant\n%s", got, want)
+	}
+
+	// Cues are read back by the WebVTT parser used for subtitles
+	if cues := ParseWebVTT([]byte(got)); len(cues) != 4 || cues[3].Text != "sprite_2.jpg#xywh=0,0,160,90" {
+		t.Errorf("parsed cues = %+v", cues)
+	}
+}
+
+func TestVTTTimestamp(t *testing.T) {
+	tests := map[float64]string{
+		0:        "00:00:00.000",
+		1.0004:   "00:00:01.000",
+		59.9996:  "00:01:00.000",
+		3600:     "01:00:00.000",
+		86399.25: "23:59:59.250",
+	}
+	for seconds, want := range tests {
+		if got := vttTimestamp(seconds); got != want {
+			t.Errorf("vttTimestamp(%v) = %q, want %q", seconds, got, want)
+		}
+	}
+}
+
+func TestSpriteSheetName(t *testing.T) {
+	var names []string
+	for i := 0; i < 3; i++ {
+		names = append(names, spriteSheetName(i))
+	}
+	if want := []string{"sprite.jpg", "sprite_2.jpg", "sprite_3.jpg"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+}
+
+func TestShowinfoTime(t *testing.T) {
+	log := `[Parsed_showinfo_1 @ 0x1] n:   0 pts:      0 pts_time:0       duration:1
+[Parsed_showinfo_1 @ 0x1] n:   1 pts: 126000 pts_time:12.6    duration:1
+frame=    2 fps=0.0 q=4.0 size=N/A time=00:00:12.60
+[Parsed_showinfo_1 @ 0x1] n:   2 pts: 250000 pts_time:25.04   duration:1`
+	var times []string
+	for _, match := range showinfoTime.FindAllStringSubmatch(log, -1) {
+		times = append(times, match[1])
+	}
+	if want := []string{"0", "12.6", "25.04"}; !reflect.DeepEqual(times, want) {
+		t.Errorf("times = %v, want %v", times, want)
+	}
+}
+
+func TestLastLines(t *testing.T) {
+	if got := lastLines("a\nb\nc\nd\n", 2); got != "c\nd" {
+		t.Errorf("lastLines = %q, want the last two lines", got)
+	}
+	if got := lastLines("only", 5); got != "only" {
+		t.Errorf("lastLines = %q, want all of it", got)
+	}
+}
@@ -0,0 +1,320 @@
+package processors
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Watermark positions
+const (
+	PositionTopLeft     = "top-left"
+	PositionTop         = "top"
+	PositionTopRight    = "top-right"
+	PositionLeft        = "left"
+	PositionCenter      = "center"
+	PositionRight       = "right"
+	PositionBottomLeft  = "bottom-left"
+	PositionBottom      = "bottom"
+	PositionBottomRight = "bottom-right"
+)
+
+// Redaction modes
+const (
+	RedactBox  = "box"  // Fill the region with black
+	RedactBlur = "blur" // Blur the region beyond recognition
+)
+
+// Watermark defaults
+const (
+	defaultWatermarkOpacity = 0.5
+	defaultWatermarkScale   = 0.3
+)
+
+// watermarkFontSize is the size text watermarks are rendered at before being
+// scaled to the image
+const watermarkFontSize = 64
+
+// maxWatermarkText is the longest watermark text, in characters. The text is
+// rendered as one line at watermarkFontSize on every protected download, so
+// its length bounds the memory each one takes.
+const maxWatermarkText = 200
+
+// Watermark is a text or image mark drawn over an image
+type Watermark struct {
+	Text     string  `json:"text,omitempty"`
+	Image    []byte  `json:"image,omitempty"`    // PNG or JPEG logo, base64 in JSON; used when Text is empty
+	Position string  `json:"position,omitempty"` // One of the Position constants, bottom-right by default
+	Opacity  float64 `json:"opacity,omitempty"`  // 0 to 1, 0.5 by default
+	Scale    float64 `json:"scale,omitempty"`    // Width of the mark relative to the image, 0.3 by default
+	Tile     bool    `json:"tile,omitempty"`     // Repeat the mark across the whole image, ignoring Position
+}
+
+// Redaction hides a rectangular region of an image. Coordinates are fractions
+// of the upright image's width and height, so the same region is covered in
+// the original and in every thumbnail of it.
+type Redaction struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	Mode   string  `json:"mode,omitempty"` // RedactBox or RedactBlur, box by default
+}
+
+// ProtectOptions describes the redactions and watermark applied to an image
+// before it is shared
+type ProtectOptions struct {
+	Watermark  *Watermark  `json:"watermark,omitempty"`
+	Redactions []Redaction `json:"redactions,omitempty"`
+}
+
+// Validate normalizes the options and checks they are in range. The watermark
+// and redactions are copied before being normalized, so options sharing them
+// are left untouched.
+func (o *ProtectOptions) Validate() error {
+	if o.Watermark == nil && len(o.Redactions) == 0 {
+		return fmt.Errorf("a watermark or at least one redaction is required")
+	}
+	if o.Watermark != nil {
+		watermark := *o.Watermark
+		o.Watermark = &watermark
+	}
+	o.Redactions = append([]Redaction(nil), o.Redactions...)
+
+	if w := o.Watermark; w != nil {
+		if w.Text == "" && len(w.Image) == 0 {
+			return fmt.Errorf("watermark needs a text or an image")
+		}
+		if utf8.RuneCountInString(w.Text) > maxWatermarkText {
+			return fmt.Errorf("watermark text must be at most %d characters", maxWatermarkText)
+		}
+		if len(w.Image) > 0 {
+			if _, _, err := image.DecodeConfig(bytes.NewReader(w.Image)); err != nil {
+				return fmt.Errorf("failed to decode watermark image: %w", err)
+			}
+		}
+
+		w.Position = strings.ToLower(w.Position)
+		switch w.Position {
+		case "":
+			w.Position = PositionBottomRight
+		case PositionTopLeft, PositionTop, PositionTopRight, PositionLeft, PositionCenter,
+			PositionRight, PositionBottomLeft, PositionBottom, PositionBottomRight:
+		default:
+			return fmt.Errorf("unknown watermark position: %s", w.Position)
+		}
+
+		if w.Opacity < 0 || w.Opacity > 1 {
+			return fmt.Errorf("watermark opacity must be between 0 and 1")
+		}
+		if w.Opacity == 0 {
+			w.Opacity = defaultWatermarkOpacity
+		}
+		if w.Scale < 0 || w.Scale > 1 {
+			return fmt.Errorf("watermark scale must be between 0 and 1")
+		}
+		if w.Scale == 0 {
+			w.Scale = defaultWatermarkScale
+		}
+	}
+
+	for i := range o.Redactions {
+		r := &o.Redactions[i]
+		if r.X < 0 || r.Y < 0 || r.Width <= 0 || r.Height <= 0 || r.X+r.Width > 1 || r.Y+r.Height > 1 {
+			return fmt.Errorf("redaction %d must lie within the image, as fractions between 0 and 1", i+1)
+		}
+		r.Mode = strings.ToLower(r.Mode)
+		switch r.Mode {
+		case "":
+			r.Mode = RedactBox
+		case RedactBox, RedactBlur:
+		default:
+			return fmt.Errorf("redaction mode must be %s or %s", RedactBox, RedactBlur)
+		}
+	}
+	return nil
+}
+
+// Protect redacts and watermarks an image, turned upright according to its EXIF
+// orientation first, and returns it with its content type. The image is
+// re-encoded, so its embedded metadata is dropped as well.
+func (p *ImageProcessor) Protect(data []byte, options ProtectOptions) ([]byte, string, error) {
+	if err := options.Validate(); err != nil {
+		return nil, "", err
+	}
+	if isSVG(data) {
+		return nil, "", fmt.Errorf("SVG images can't be watermarked or redacted")
+	}
+
+	img, format, err := decodeImage(data)
+	if err != nil {
+		return nil, "", err
+	}
+	exif, _ := readEXIF(data)
+	img = applyOrientation(img, exif.Orientation())
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(canvas, canvas.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	// Redact first so the watermark stays visible over redacted regions
+	for _, r := range options.Redactions {
+		redact(canvas, r)
+	}
+	if options.Watermark != nil {
+		if err := applyWatermark(canvas, *options.Watermark); err != nil {
+			return nil, "", err
+		}
+	}
+
+	outputFormat := ""
+	if format == ThumbnailFormatJPEG || format == ThumbnailFormatPNG {
+		outputFormat = format
+	}
+	return encodeImage(canvas, outputFormat, 0)
+}
+
+// redact hides a region of img
+func redact(img *image.NRGBA, r Redaction) {
+	bounds := img.Bounds()
+	rect := image.Rect(
+		int(r.X*float64(bounds.Dx())),
+		int(r.Y*float64(bounds.Dy())),
+		int((r.X+r.Width)*float64(bounds.Dx())+0.5),
+		int((r.Y+r.Height)*float64(bounds.Dy())+0.5),
+	).Intersect(bounds)
+	if rect.Empty() {
+		return
+	}
+
+	if r.Mode == RedactBlur {
+		// Shrinking the region to a handful of pixels throws the detail away
+		// for good; scaling back up smooths the blocks into a blur
+		small := image.NewNRGBA(image.Rect(0, 0, max(1, rect.Dx()/16), max(1, rect.Dy()/16)))
+		draw.ApproxBiLinear.Scale(small, small.Bounds(), img, rect, draw.Src, nil)
+		draw.BiLinear.Scale(img, rect, small, small.Bounds(), draw.Src, nil)
+		return
+	}
+	draw.Draw(img, rect, image.NewUniform(color.Black), image.Point{}, draw.Src)
+}
+
+// applyWatermark draws a watermark over img
+func applyWatermark(img *image.NRGBA, w Watermark) error {
+	var mark image.Image
+	var err error
+	if w.Text != "" {
+		if mark, err = renderText(w.Text); err != nil {
+			return err
+		}
+	} else if mark, _, err = decodeImage(w.Image); err != nil {
+		return fmt.Errorf("watermark image: %w", err)
+	}
+
+	// Scale the mark to its share of the image width, without overflowing the height
+	bounds := img.Bounds()
+	markBounds := mark.Bounds()
+	width := int(w.Scale * float64(bounds.Dx()))
+	height := width * markBounds.Dy() / markBounds.Dx()
+	if height > bounds.Dy() {
+		height = bounds.Dy()
+		width = height * markBounds.Dx() / markBounds.Dy()
+	}
+	if width < 1 || height < 1 {
+		return nil
+	}
+	scaled := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), mark, markBounds, draw.Src, nil)
+
+	opacity := image.NewUniform(color.Alpha{A: uint8(w.Opacity*255 + 0.5)})
+	for _, at := range watermarkOrigins(bounds, scaled.Bounds().Size(), w) {
+		draw.DrawMask(img, image.Rectangle{Min: at, Max: at.Add(scaled.Bounds().Size())}, scaled, image.Point{}, opacity, image.Point{}, draw.Over)
+	}
+	return nil
+}
+
+// watermarkOrigins returns where the top-left corners of the copies of a mark
+// go: a single one at the watermark's position, or a grid when it is tiled
+func watermarkOrigins(bounds image.Rectangle, size image.Point, w Watermark) []image.Point {
+	if w.Tile {
+		// Leave a gap of half a mark between copies and offset every other row
+		stepX, stepY := size.X*3/2, size.Y*2
+		var origins []image.Point
+		for row, y := 0, bounds.Min.Y+size.Y/2; y < bounds.Max.Y; row, y = row+1, y+stepY {
+			x := bounds.Min.X
+			if row%2 == 1 {
+				x -= stepX / 2
+			}
+			for ; x < bounds.Max.X; x += stepX {
+				origins = append(origins, image.Pt(x, y))
+			}
+		}
+		return origins
+	}
+
+	margin := min(bounds.Dx(), bounds.Dy()) / 50
+	x := bounds.Min.X + (bounds.Dx()-size.X)/2
+	y := bounds.Min.Y + (bounds.Dy()-size.Y)/2
+	if strings.HasSuffix(w.Position, "left") {
+		x = bounds.Min.X + margin
+	} else if strings.HasSuffix(w.Position, "right") {
+		x = bounds.Max.X - size.X - margin
+	}
+	if strings.HasPrefix(w.Position, "top") {
+		y = bounds.Min.Y + margin
+	} else if strings.HasPrefix(w.Position, "bottom") {
+		y = bounds.Max.Y - size.Y - margin
+	}
+	return []image.Point{image.Pt(x, y)}
+}
+
+var (
+	watermarkFont     *opentype.Font
+	watermarkFontErr  error
+	watermarkFontOnce sync.Once
+)
+
+// renderText draws a line of white text with a dark outline, so it stays
+// readable on both light and dark images
+func renderText(text string) (image.Image, error) {
+	watermarkFontOnce.Do(func() {
+		watermarkFont, watermarkFontErr = opentype.Parse(goregular.TTF)
+	})
+	if watermarkFontErr != nil {
+		return nil, fmt.Errorf("failed to load watermark font: %w", watermarkFontErr)
+	}
+	face, err := opentype.NewFace(watermarkFont, &opentype.FaceOptions{Size: watermarkFontSize, DPI: 72})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load watermark font: %w", err)
+	}
+	defer face.Close()
+
+	const outline = 3
+	metrics := face.Metrics()
+	width := font.MeasureString(face, text).Ceil() + 2*outline
+	height := (metrics.Ascent + metrics.Descent).Ceil() + 2*outline
+	mark := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	drawer := &font.Drawer{Dst: mark, Face: face}
+	baseline := outline + metrics.Ascent.Ceil()
+	shadow := image.NewUniform(color.NRGBA{A: 160})
+	for dy := -outline; dy <= outline; dy += outline {
+		for dx := -outline; dx <= outline; dx += outline {
+			drawer.Src = shadow
+			drawer.Dot = fixed.P(outline+dx, baseline+dy)
+			drawer.DrawString(text)
+		}
+	}
+	drawer.Src = image.White
+	drawer.Dot = fixed.P(outline, baseline)
+	drawer.DrawString(text)
+	return mark, nil
+}
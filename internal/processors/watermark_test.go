@@ -0,0 +1,206 @@
+package processors
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProtectOptionsValidate(t *testing.T) {
+	logo := encodedPNG(t)
+
+	tests := []struct {
+		name    string
+		options ProtectOptions
+		want    ProtectOptions
+		wantErr string
+	}{
+		{
+			name:    "text defaults",
+			options: ProtectOptions{Watermark: &Watermark{Text: "Draft"}},
+			want:    ProtectOptions{Watermark: &Watermark{Text: "Draft", Position: PositionBottomRight, Opacity: 0.5, Scale: 0.3}},
+		},
+		{
+			name:    "image mark",
+			options: ProtectOptions{Watermark: &Watermark{Image: logo, Position: "Top-Left", Opacity: 1, Scale: 0.1}},
+			want:    ProtectOptions{Watermark: &Watermark{Image: logo, Position: PositionTopLeft, Opacity: 1, Scale: 0.1}},
+		},
+		{
+			name:    "redactions only",
+			options: ProtectOptions{Redactions: []Redaction{{X: 0.5, Y: 0.5, Width: 0.5, Height: 0.5}, {Width: 1, Height: 1, Mode: "BLUR"}}},
+			want:    ProtectOptions{Redactions: []Redaction{{X: 0.5, Y: 0.5, Width: 0.5, Height: 0.5, Mode: RedactBox}, {Width: 1, Height: 1, Mode: RedactBlur}}},
+		},
+		{
+			name:    "longest text",
+			options: ProtectOptions{Watermark: &Watermark{Text: strings.Repeat("é", maxWatermarkText)}},
+			want:    ProtectOptions{Watermark: &Watermark{Text: strings.Repeat("é", maxWatermarkText), Position: PositionBottomRight, Opacity: 0.5, Scale: 0.3}},
+		},
+		{name: "nothing", options: ProtectOptions{}, wantErr: "required"},
+		{name: "empty mark", options: ProtectOptions{Watermark: &Watermark{}}, wantErr: "text or an image"},
+		{name: "text too long", options: ProtectOptions{Watermark: &Watermark{Text: strings.Repeat("a", maxWatermarkText+1)}}, wantErr: "at most"},
+		{name: "bad image", options: ProtectOptions{Watermark: &Watermark{Image: []byte("not an image")}}, wantErr: "decode"},
+		{name: "bad position", options: ProtectOptions{Watermark: &Watermark{Text: "x", Position: "middle"}}, wantErr: "position"},
+		{name: "negative opacity", options: ProtectOptions{Watermark: &Watermark{Text: "x", Opacity: -0.1}}, wantErr: "opacity"},
+		{name: "opacity above 1", options: ProtectOptions{Watermark: &Watermark{Text: "x", Opacity: 1.5}}, wantErr: "opacity"},
+		{name: "scale above 1", options: ProtectOptions{Watermark: &Watermark{Text: "x", Scale: 2}}, wantErr: "scale"},
+		{name: "redaction outside", options: ProtectOptions{Redactions: []Redaction{{X: 0.6, Width: 0.5, Height: 0.1}}}, wantErr: "redaction 1"},
+		{name: "empty redaction", options: ProtectOptions{Redactions: []Redaction{{X: 0.1, Y: 0.1}}}, wantErr: "redaction 1"},
+		{name: "redaction mode", options: ProtectOptions{Redactions: []Redaction{{Width: 1, Height: 1, Mode: "pixelate"}}}, wantErr: "mode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := tt.options
+			err := options.Validate()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(options, tt.want) {
+				t.Errorf("options = %+v, want %+v", options, tt.want)
+			}
+		})
+	}
+}
+
+func TestProtectOptionsValidateCopies(t *testing.T) {
+	watermark := &Watermark{Text: "Draft", Position: "TOP"}
+	redactions := []Redaction{{Width: 1, Height: 1}}
+	options := ProtectOptions{Watermark: watermark, Redactions: redactions}
+	if err := options.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if watermark.Position != "TOP" || watermark.Opacity != 0 || redactions[0].Mode != "" {
+		t.Errorf("Validate modified the shared watermark %+v or redactions %+v", watermark, redactions)
+	}
+}
+
+// filledImage returns a w by h image filled with c
+func filledImage(w, h int, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
+
+func TestRedactBox(t *testing.T) {
+	white := color.NRGBA{255, 255, 255, 255}
+	img := filledImage(100, 50, white)
+	redact(img, Redaction{X: 0.1, Y: 0.2, Width: 0.3, Height: 0.4, Mode: RedactBox})
+
+	// The region covers x 10-40 and y 10-30
+	for _, tt := range []struct {
+		x, y int
+		want color.NRGBA
+	}{
+		{10, 10, color.NRGBA{0, 0, 0, 255}},
+		{39, 29, color.NRGBA{0, 0, 0, 255}},
+		{9, 10, white},
+		{40, 20, white},
+		{20, 30, white},
+		{99, 49, white},
+	} {
+		if got := img.NRGBAAt(tt.x, tt.y); got != tt.want {
+			t.Errorf("pixel (%d, %d) = %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestRedactBlur(t *testing.T) {
+	// Alternating black and white columns blur into an even grey
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			v := uint8(0)
+			if x%2 == 0 {
+				v = 255
+			}
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+	redact(img, Redaction{Width: 0.5, Height: 1, Mode: RedactBlur})
+
+	for x := 4; x < 28; x++ {
+		if v := img.NRGBAAt(x, 32).R; v < 64 || v > 192 {
+			t.Errorf("blurred pixel (%d, 32) = %d, want grey", x, v)
+		}
+	}
+	// Outside the region the stripes are kept
+	if img.NRGBAAt(40, 32).R != 255 || img.NRGBAAt(41, 32).R != 0 {
+		t.Error("blur spilled outside the redaction")
+	}
+}
+
+func TestWatermarkOrigins(t *testing.T) {
+	bounds := image.Rect(0, 0, 1000, 500)
+	size := image.Pt(200, 100)
+	// The margin is a fiftieth of the shorter side
+	const margin = 10
+
+	tests := []struct {
+		position string
+		want     image.Point
+	}{
+		{PositionTopLeft, image.Pt(margin, margin)},
+		{PositionTop, image.Pt(400, margin)},
+		{PositionTopRight, image.Pt(1000-200-margin, margin)},
+		{PositionLeft, image.Pt(margin, 200)},
+		{PositionCenter, image.Pt(400, 200)},
+		{PositionRight, image.Pt(1000-200-margin, 200)},
+		{PositionBottomLeft, image.Pt(margin, 500-100-margin)},
+		{PositionBottom, image.Pt(400, 500-100-margin)},
+		{PositionBottomRight, image.Pt(1000-200-margin, 500-100-margin)},
+	}
+	for _, tt := range tests {
+		origins := watermarkOrigins(bounds, size, Watermark{Position: tt.position})
+		if len(origins) != 1 || origins[0] != tt.want {
+			t.Errorf("%s: origins = %v, want %v", tt.position, origins, tt.want)
+		}
+	}
+
+	// Bounds that don't start at the origin shift the mark with them
+	shifted := watermarkOrigins(bounds.Add(image.Pt(50, 20)), size, Watermark{Position: PositionTopLeft})
+	if want := image.Pt(50+margin, 20+margin); shifted[0] != want {
+		t.Errorf("shifted origin = %v, want %v", shifted[0], want)
+	}
+}
+
+func TestWatermarkOriginsTiled(t *testing.T) {
+	bounds := image.Rect(0, 0, 600, 500)
+	size := image.Pt(100, 50)
+	origins := watermarkOrigins(bounds, size, Watermark{Position: PositionBottomRight, Tile: true})
+
+	// Rows start half a mark down, with a mark's height between them, and every other
+	// row is offset by half a step so the copies are staggered
+	want := []image.Point{}
+	for row, y := 0, 25; y < 500; row, y = row+1, y+100 {
+		x := 0
+		if row%2 == 1 {
+			x = -75
+		}
+		for ; x < 600; x += 150 {
+			want = append(want, image.Pt(x, y))
+		}
+	}
+	if !reflect.DeepEqual(origins, want) {
+		t.Errorf("origins = %v, want %v", origins, want)
+	}
+}
+
+func TestRenderTextLongest(t *testing.T) {
+	mark, err := renderText(strings.Repeat("W", maxWatermarkText))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The capped text stays well within what decodeImage accepts for an image
+	if b := mark.Bounds(); int64(b.Dx()*b.Dy()) > DefaultMaxImagePixels/10 {
+		t.Errorf("mark is %dx%d", b.Dx(), b.Dy())
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"strings"
 	"time"
 
@@ -22,9 +21,8 @@ func NewWordProcessor() *WordProcessor {
 
 // Process processes a Word document
 func (p *WordProcessor) Process(ctx context.Context, reader io.Reader, filename string, options ProcessOptions) (*ProcessResult, error) {
-	// Read the entire document into memory
-	// Note: This may not be ideal for very large documents
-	data, err := ioutil.ReadAll(reader)
+	// Read the entire document into memory, up to the memory limit
+	data, err := readAllLimited(reader, options.memoryLimit())
 	if err != nil {
 		return nil, fmt.Errorf("failed to read Word document: %w", err)
 	}
@@ -115,6 +113,11 @@ func (p *WordProcessor) Process(ctx context.Context, reader io.Reader, filename
 	return result, nil
 }
 
+// Name returns the processor name
+func (p *WordProcessor) Name() string {
+	return "word"
+}
+
 // CanProcess returns true if this processor can process the given content type
 func (p *WordProcessor) CanProcess(contentType, ext string) bool {
 	// Check content type
@@ -2,6 +2,8 @@
 package processors
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"sync"
 	"time"
@@ -9,13 +11,44 @@ import (
 
 // Task represents a processing task
 type Task struct {
-	ID         string                         // Unique ID for the task
-	Process    func() (*ProcessResult, error) // Function to execute
-	Result     chan *ProcessResult            // Channel to receive the result
-	Error      chan error                     // Channel to receive errors
-	Status     string                         // Status of the task
-	UpdateChan chan map[string]interface{}    // Channel for progress updates
-	Timestamp  time.Time                      // When the task was created
+	ID         string                                 // Unique ID for the task
+	Process    func() (*ProcessResult, error)         // Function to execute
+	Result     chan *ProcessResult                    // Channel to receive the result
+	Error      chan error                             // Channel to receive errors
+	Status     string                                 // Status of the task
+	UpdateChan chan map[string]interface{}            // Channel for progress updates
+	Timestamp  time.Time                              // When the task was created
+	Spec       *TaskSpec                              // Serializable description; tasks with a spec can be leased by remote workers
+	OnComplete func(result *ProcessResult, err error) // Called once the task finishes, locally or remotely
+	Attempts   int                                    // Number of times the task has been leased
+}
+
+// TaskSpec describes a processing task in a form that can be sent to a remote worker
+type TaskSpec struct {
+	FileID      string         `json:"fileId"`
+	StorageID   string         `json:"storageId"`
+	StorageType string         `json:"storageType"`
+	Name        string         `json:"name"`
+	ContentType string         `json:"contentType"`
+	Options     ProcessOptions `json:"options"`
+}
+
+// Lease grants a remote worker exclusive use of a task until it expires
+type Lease struct {
+	ID        string    `json:"id"`
+	TaskID    string    `json:"taskId"`
+	WorkerID  string    `json:"workerId"`
+	Attempt   int       `json:"attempt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	task *Task
+}
+
+// RemoteWorker is the status of a remote worker as seen by the pool
+type RemoteWorker struct {
+	ID       string    `json:"id"`
+	LastSeen time.Time `json:"lastSeen"`
+	Leases   int       `json:"leases"`
 }
 
 // NewTask creates a new task with the given ID and process function
@@ -33,13 +66,17 @@ func NewTask(id string, process func() (*ProcessResult, error)) *Task {
 
 // WorkerPool manages a pool of worker goroutines
 type WorkerPool struct {
-	tasks       chan *Task
-	workers     int
-	maxAttempts int
-	wg          sync.WaitGroup
-	quit        chan struct{}
-	active      map[string]*Task
-	mu          sync.RWMutex
+	tasks        chan *Task
+	leasable     chan *Task
+	workers      int
+	maxAttempts  int
+	wg           sync.WaitGroup
+	quit         chan struct{}
+	active       map[string]*Task
+	leases       map[string]*Lease
+	remote       map[string]*RemoteWorker
+	leaseTimeout time.Duration
+	mu           sync.RWMutex
 }
 
 // DefaultPool is the default worker pool used by the application
@@ -70,11 +107,15 @@ func NewWorkerPool(workers, queueSize, maxAttempts int) *WorkerPool {
 	}
 
 	pool := &WorkerPool{
-		tasks:       make(chan *Task, queueSize),
-		workers:     workers,
-		maxAttempts: maxAttempts,
-		quit:        make(chan struct{}),
-		active:      make(map[string]*Task),
+		tasks:        make(chan *Task, queueSize),
+		leasable:     make(chan *Task, queueSize),
+		workers:      workers,
+		maxAttempts:  maxAttempts,
+		quit:         make(chan struct{}),
+		active:       make(map[string]*Task),
+		leases:       make(map[string]*Lease),
+		remote:       make(map[string]*RemoteWorker),
+		leaseTimeout: time.Minute,
 	}
 	pool.Start()
 	return pool
@@ -86,6 +127,8 @@ func (p *WorkerPool) Start() {
 	for i := 0; i < p.workers; i++ {
 		go p.worker(i)
 	}
+	p.wg.Add(1)
+	go p.reapLeases()
 	log.Printf("Started worker pool with %d workers", p.workers)
 }
 
@@ -103,9 +146,16 @@ func (p *WorkerPool) Submit(task *Task) error {
 	p.active[task.ID] = task
 	p.mu.Unlock()
 
+	// Tasks with a spec go to the queue that remote workers lease from;
+	// local workers take tasks from both queues
+	queue := p.tasks
+	if task.Spec != nil {
+		queue = p.leasable
+	}
+
 	// Submit to the queue
 	select {
-	case p.tasks <- task:
+	case queue <- task:
 		return nil
 	default:
 		// Queue is full
@@ -149,30 +199,258 @@ func (p *WorkerPool) worker(id int) {
 	log.Printf("Worker %d started", id)
 
 	for {
+		var task *Task
 		select {
-		case task := <-p.tasks:
-			log.Printf("Worker %d processing task %s", id, task.ID)
-
-			// Process the task
-			result, err := task.Process()
-
-			// Update status
-			p.mu.Lock()
-			delete(p.active, task.ID)
-			p.mu.Unlock()
-
-			// Send result or error
-			if err != nil {
-				log.Printf("Worker %d failed task %s: %v", id, task.ID, err)
-				task.Error <- err
-			} else {
-				log.Printf("Worker %d completed task %s", id, task.ID)
-				task.Result <- result
-			}
+		case task = <-p.tasks:
+		case task = <-p.leasable:
 		case <-p.quit:
 			log.Printf("Worker %d stopping", id)
 			return
 		}
+
+		log.Printf("Worker %d processing task %s", id, task.ID)
+
+		// Process the task
+		result, err := task.Process()
+
+		if err != nil {
+			log.Printf("Worker %d failed task %s: %v", id, task.ID, err)
+		} else {
+			log.Printf("Worker %d completed task %s", id, task.ID)
+		}
+		p.finish(task, result, err)
+	}
+}
+
+// finish removes a task from the active set and delivers its result or error
+func (p *WorkerPool) finish(task *Task, result *ProcessResult, err error) {
+	// Update status
+	p.mu.Lock()
+	delete(p.active, task.ID)
+	if err != nil {
+		task.Status = "failed"
+	} else {
+		task.Status = "completed"
+	}
+	p.mu.Unlock()
+
+	// Send result or error
+	if err != nil {
+		task.Error <- err
+	} else {
+		task.Result <- result
+	}
+
+	if task.OnComplete != nil {
+		task.OnComplete(result, err)
+	}
+}
+
+// SetLeaseTimeout sets how long a remote worker may hold a task without a heartbeat
+func (p *WorkerPool) SetLeaseTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.leaseTimeout = timeout
+}
+
+// Lease waits up to wait for a task that a remote worker can run and leases it to the worker.
+// It returns nil when no task became available or ctx was cancelled.
+func (p *WorkerPool) Lease(ctx context.Context, workerID string, wait time.Duration) *Lease {
+	p.touchWorker(workerID)
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	var task *Task
+	select {
+	case task = <-p.leasable:
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return nil
+	case <-p.quit:
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	task.Attempts++
+	task.Status = "leased"
+	lease := &Lease{
+		ID:        fmt.Sprintf("lease-%s-%d", task.ID, time.Now().UnixNano()),
+		TaskID:    task.ID,
+		WorkerID:  workerID,
+		Attempt:   task.Attempts,
+		ExpiresAt: time.Now().Add(p.leaseTimeout),
+		task:      task,
+	}
+	p.leases[lease.ID] = lease
+	log.Printf("Leased task %s to remote worker %s (attempt %d)", task.ID, workerID, task.Attempts)
+
+	return lease
+}
+
+// GetLease gets a lease by ID
+func (p *WorkerPool) GetLease(id string) (*Lease, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	lease, ok := p.leases[id]
+	return lease, ok
+}
+
+// Spec returns the spec of the leased task
+func (l *Lease) Spec() *TaskSpec {
+	return l.task.Spec
+}
+
+// Heartbeat extends the given leases held by a worker and returns the IDs of
+// the leases that are still valid; the worker should abandon any others
+func (p *WorkerPool) Heartbeat(workerID string, leaseIDs []string) []string {
+	p.touchWorker(workerID)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	valid := make([]string, 0, len(leaseIDs))
+	for _, id := range leaseIDs {
+		lease, ok := p.leases[id]
+		if !ok || lease.WorkerID != workerID {
+			continue
+		}
+		lease.ExpiresAt = time.Now().Add(p.leaseTimeout)
+		valid = append(valid, id)
+	}
+	return valid
+}
+
+// CompleteLease records the outcome of a leased task reported by a remote worker
+func (p *WorkerPool) CompleteLease(workerID, leaseID string, result *ProcessResult, taskErr error) error {
+	p.touchWorker(workerID)
+
+	p.mu.Lock()
+	lease, ok := p.leases[leaseID]
+	if !ok || lease.WorkerID != workerID {
+		p.mu.Unlock()
+		return ErrLeaseNotFound
+	}
+	delete(p.leases, leaseID)
+	p.mu.Unlock()
+
+	p.finish(lease.task, result, taskErr)
+	return nil
+}
+
+// RemoteWorkers returns the remote workers seen by the pool
+func (p *WorkerPool) RemoteWorkers() []RemoteWorker {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	workers := make([]RemoteWorker, 0, len(p.remote))
+	for _, w := range p.remote {
+		status := *w
+		for _, lease := range p.leases {
+			if lease.WorkerID == w.ID {
+				status.Leases++
+			}
+		}
+		workers = append(workers, status)
+	}
+	return workers
+}
+
+// touchWorker records that a remote worker is alive
+func (p *WorkerPool) touchWorker(workerID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	w, ok := p.remote[workerID]
+	if !ok {
+		w = &RemoteWorker{ID: workerID}
+		p.remote[workerID] = w
+		log.Printf("Remote worker %s connected", workerID)
+	}
+	w.LastSeen = time.Now()
+}
+
+// reapLeases requeues tasks whose remote worker stopped sending heartbeats
+func (p *WorkerPool) reapLeases() {
+	defer p.wg.Done()
+
+	timer := time.NewTimer(p.reapInterval())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			p.expireLeases(time.Now())
+			timer.Reset(p.reapInterval())
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// reapInterval returns how often leases are checked for expiry: every
+// second, or more often for short lease timeouts, so tasks are requeued soon
+// after their lease expires
+func (p *WorkerPool) reapInterval() time.Duration {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	interval := p.leaseTimeout / 4
+	if interval > time.Second {
+		interval = time.Second
+	}
+	return interval
+}
+
+// expireLeases requeues the tasks of leases that expired before now and
+// forgets remote workers that have been gone for a while
+func (p *WorkerPool) expireLeases(now time.Time) {
+	var expired []*Lease
+
+	p.mu.Lock()
+	for id, lease := range p.leases {
+		if now.After(lease.ExpiresAt) {
+			delete(p.leases, id)
+			expired = append(expired, lease)
+		}
+	}
+	for id, w := range p.remote {
+		if now.Sub(w.LastSeen) > 10*p.leaseTimeout {
+			delete(p.remote, id)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, lease := range expired {
+		p.requeue(lease)
+	}
+}
+
+// requeue puts the task of an expired lease back on the queue, or fails it
+// once it has used up its attempts
+func (p *WorkerPool) requeue(lease *Lease) {
+	task := lease.task
+	log.Printf("Lease %s on task %s expired (worker %s)", lease.ID, task.ID, lease.WorkerID)
+
+	if task.Attempts >= p.maxAttempts {
+		p.finish(task, nil, fmt.Errorf("%w after %d attempts", ErrLeaseExpired, task.Attempts))
+		return
+	}
+
+	p.mu.Lock()
+	task.Status = "queued"
+	p.mu.Unlock()
+
+	select {
+	case p.leasable <- task:
+	default:
+		p.finish(task, nil, ErrQueueFull)
 	}
 }
 
@@ -0,0 +1,211 @@
+package processors
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newLeasingPool returns a pool whose only local worker is kept busy, so
+// tasks with a spec stay queued for remote workers to lease
+func newLeasingPool(t *testing.T, maxAttempts int) *WorkerPool {
+	t.Helper()
+	pool := NewWorkerPool(1, 10, maxAttempts)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	busy := NewTask("busy", func() (*ProcessResult, error) {
+		close(started)
+		<-release
+		return &ProcessResult{}, nil
+	})
+	if err := pool.Submit(busy); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	t.Cleanup(func() {
+		close(release)
+		pool.Stop()
+	})
+	return pool
+}
+
+// submitLeasable submits a task that only a remote worker runs
+func submitLeasable(t *testing.T, pool *WorkerPool, id string) *Task {
+	t.Helper()
+	task := NewTask(id, func() (*ProcessResult, error) {
+		t.Errorf("task %s ran locally", id)
+		return nil, nil
+	})
+	task.Spec = &TaskSpec{FileID: id, StorageType: "local"}
+	if err := pool.Submit(task); err != nil {
+		t.Fatal(err)
+	}
+	return task
+}
+
+// mustLease leases the next task, failing the test if none is queued
+func mustLease(t *testing.T, pool *WorkerPool, workerID string) *Lease {
+	t.Helper()
+	lease := pool.Lease(context.Background(), workerID, time.Second)
+	if lease == nil {
+		t.Fatal("no task was leased")
+	}
+	return lease
+}
+
+func TestLeaseAndComplete(t *testing.T) {
+	pool := newLeasingPool(t, 3)
+	task := submitLeasable(t, pool, "task-1")
+
+	var completed *ProcessResult
+	task.OnComplete = func(result *ProcessResult, err error) { completed = result }
+
+	lease := mustLease(t, pool, "worker-a")
+	if lease.TaskID != "task-1" || lease.Attempt != 1 || lease.Spec().FileID != "task-1" {
+		t.Errorf("lease = %+v, want attempt 1 of task-1", lease)
+	}
+	if workers := pool.RemoteWorkers(); len(workers) != 1 || workers[0].Leases != 1 {
+		t.Errorf("RemoteWorkers = %+v, want worker-a with one lease", workers)
+	}
+
+	// Only the worker holding the lease can report on it
+	if err := pool.CompleteLease("worker-b", lease.ID, &ProcessResult{}, nil); !errors.Is(err, ErrLeaseNotFound) {
+		t.Errorf("completion by another worker: err = %v, want ErrLeaseNotFound", err)
+	}
+
+	result := &ProcessResult{Summary: "done"}
+	if err := pool.CompleteLease("worker-a", lease.ID, result, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-task.Result; got != result || completed != result {
+		t.Errorf("task result = %v, OnComplete got %v, want %v", got, completed, result)
+	}
+	if _, ok := pool.GetTask("task-1"); ok {
+		t.Error("completed task is still active")
+	}
+
+	// A second report for the same lease is rejected
+	if err := pool.CompleteLease("worker-a", lease.ID, result, nil); !errors.Is(err, ErrLeaseNotFound) {
+		t.Errorf("repeated completion: err = %v, want ErrLeaseNotFound", err)
+	}
+}
+
+func TestLeaseNothingQueued(t *testing.T) {
+	pool := newLeasingPool(t, 3)
+	if lease := pool.Lease(context.Background(), "worker-a", 10*time.Millisecond); lease != nil {
+		t.Errorf("Lease = %+v, want nil with no tasks queued", lease)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if lease := pool.Lease(ctx, "worker-a", time.Minute); lease != nil {
+		t.Errorf("Lease = %+v, want nil once the context is cancelled", lease)
+	}
+}
+
+func TestLeaseHeartbeat(t *testing.T) {
+	pool := newLeasingPool(t, 3)
+	pool.SetLeaseTimeout(time.Hour)
+	submitLeasable(t, pool, "task-1")
+	lease := mustLease(t, pool, "worker-a")
+	expiresAt := lease.ExpiresAt
+
+	time.Sleep(time.Millisecond)
+	valid := pool.Heartbeat("worker-a", []string{lease.ID, "lease-unknown"})
+	if len(valid) != 1 || valid[0] != lease.ID {
+		t.Errorf("Heartbeat = %v, want only %s", valid, lease.ID)
+	}
+	if !lease.ExpiresAt.After(expiresAt) {
+		t.Error("heartbeat didn't extend the lease")
+	}
+
+	// Another worker can't keep the lease alive
+	if valid := pool.Heartbeat("worker-b", []string{lease.ID}); len(valid) != 0 {
+		t.Errorf("Heartbeat from another worker = %v, want none", valid)
+	}
+
+	// The extended lease survives past its original expiry
+	pool.expireLeases(expiresAt.Add(time.Millisecond))
+	if _, ok := pool.GetLease(lease.ID); !ok {
+		t.Error("lease expired despite the heartbeat")
+	}
+}
+
+func TestLeaseExpiryRequeues(t *testing.T) {
+	pool := newLeasingPool(t, 3)
+	task := submitLeasable(t, pool, "task-1")
+
+	first := mustLease(t, pool, "worker-a")
+	pool.expireLeases(first.ExpiresAt.Add(time.Millisecond))
+	if _, ok := pool.GetLease(first.ID); ok {
+		t.Fatal("lease didn't expire")
+	}
+
+	// The task is leased again, and the first worker's heartbeat and late
+	// result are refused
+	second := mustLease(t, pool, "worker-b")
+	if second.TaskID != "task-1" || second.Attempt != 2 {
+		t.Errorf("second lease = %+v, want attempt 2 of task-1", second)
+	}
+	if valid := pool.Heartbeat("worker-a", []string{first.ID}); len(valid) != 0 {
+		t.Errorf("Heartbeat on an expired lease = %v, want none", valid)
+	}
+	if err := pool.CompleteLease("worker-a", first.ID, &ProcessResult{}, nil); !errors.Is(err, ErrLeaseNotFound) {
+		t.Errorf("completion after expiry: err = %v, want ErrLeaseNotFound", err)
+	}
+	select {
+	case <-task.Result:
+		t.Fatal("late result was delivered")
+	default:
+	}
+
+	if err := pool.CompleteLease("worker-b", second.ID, &ProcessResult{Summary: "done"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if result := <-task.Result; result.Summary != "done" {
+		t.Errorf("result = %+v, want the second worker's", result)
+	}
+}
+
+func TestLeaseMaxAttempts(t *testing.T) {
+	pool := newLeasingPool(t, 2)
+	task := submitLeasable(t, pool, "task-1")
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		lease := mustLease(t, pool, "worker-a")
+		if lease.Attempt != attempt {
+			t.Errorf("lease attempt = %d, want %d", lease.Attempt, attempt)
+		}
+		pool.expireLeases(lease.ExpiresAt.Add(time.Millisecond))
+	}
+
+	select {
+	case err := <-task.Error:
+		if !errors.Is(err, ErrLeaseExpired) {
+			t.Errorf("task error = %v, want ErrLeaseExpired", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("task didn't fail after its last attempt")
+	}
+	if task.Status != "failed" {
+		t.Errorf("Status = %q, want failed", task.Status)
+	}
+	if lease := pool.Lease(context.Background(), "worker-a", 10*time.Millisecond); lease != nil {
+		t.Errorf("failed task was leased again: %+v", lease)
+	}
+}
+
+func TestLeaseReaper(t *testing.T) {
+	pool := newLeasingPool(t, 3)
+	pool.SetLeaseTimeout(50 * time.Millisecond)
+	submitLeasable(t, pool, "task-1")
+
+	first := mustLease(t, pool, "worker-a")
+
+	// Without heartbeats the reaper requeues the task on its own
+	second := pool.Lease(context.Background(), "worker-b", 5*time.Second)
+	if second == nil || second.TaskID != first.TaskID || second.Attempt != 2 {
+		t.Fatalf("lease after expiry = %+v, want attempt 2 of %s", second, first.TaskID)
+	}
+}
@@ -0,0 +1,488 @@
+package processors
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Column types detected in spreadsheets
+const (
+	ColumnTypeEmpty   = "empty"
+	ColumnTypeNumber  = "number"
+	ColumnTypeBoolean = "boolean"
+	ColumnTypeString  = "string"
+)
+
+// SheetSummary describes one worksheet of a spreadsheet
+type SheetSummary struct {
+	Name        string   `json:"name"`
+	Dimensions  string   `json:"dimensions"` // Used range, e.g. "A1:D20"
+	Rows        int      `json:"rows"`
+	Columns     int      `json:"columns"`
+	Headers     []string `json:"headers"`
+	ColumnTypes []string `json:"columnTypes"`
+	Formulas    int      `json:"formulas"`
+}
+
+// SpreadsheetDocument is the structured data produced by the XLSX processor
+type SpreadsheetDocument struct {
+	Sheets []SheetSummary `json:"sheets"`
+}
+
+// XLSXProcessor processes Excel spreadsheets (.xlsx)
+type XLSXProcessor struct{}
+
+// NewXLSXProcessor creates a new spreadsheet processor
+func NewXLSXProcessor() *XLSXProcessor {
+	return &XLSXProcessor{}
+}
+
+// Process processes a spreadsheet. The workbook is read straight from its
+// SpreadsheetML parts: cell values, shared strings and the number formats
+// that mark a number as a date.
+func (p *XLSXProcessor) Process(ctx context.Context, reader io.Reader, filename string, options ProcessOptions) (*ProcessResult, error) {
+	// Read the entire workbook into memory, up to the memory limit
+	data, err := readAllLimited(reader, options.memoryLimit())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spreadsheet: %w", err)
+	}
+
+	pkg, err := openOfficePackage(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse spreadsheet: %w", err)
+	}
+	wb, err := readWorkbook(pkg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse spreadsheet: %w", err)
+	}
+
+	doc := &SpreadsheetDocument{}
+	var firstSheet [][]string
+	totalFormulas := 0
+
+	for i, sheet := range wb.sheets {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		var ws xlsxWorksheet
+		if err := readZipXML(pkg.files[sheet.part], &ws); err != nil {
+			return nil, fmt.Errorf("failed to parse sheet %q: %w", sheet.name, err)
+		}
+		summary, rows := wb.summarizeSheet(sheet.name, &ws)
+		doc.Sheets = append(doc.Sheets, summary)
+		totalFormulas += summary.Formulas
+		if i == 0 {
+			firstSheet = rows
+		}
+	}
+
+	result := &ProcessResult{
+		Metadata: make(map[string]string),
+		Data:     doc,
+	}
+
+	// Generate summary
+	result.Summary = fmt.Sprintf("Spreadsheet with %d sheets", len(doc.Sheets))
+	if len(doc.Sheets) > 0 {
+		first := doc.Sheets[0]
+		result.Summary += fmt.Sprintf(", first sheet %q has %d rows and %d columns", first.Name, first.Rows, first.Columns)
+	}
+
+	// Extract metadata
+	if options.ExtractMetadata {
+		pkg.addCoreProperties(result.Metadata)
+
+		names := make([]string, len(doc.Sheets))
+		for i, sheet := range doc.Sheets {
+			names[i] = sheet.Name
+		}
+		result.Metadata["sheets"] = fmt.Sprintf("%d", len(doc.Sheets))
+		result.Metadata["sheetNames"] = strings.Join(names, ",")
+		result.Metadata["formulas"] = fmt.Sprintf("%d", totalFormulas)
+
+		// Describe the first sheet the same way the CSV processor describes a file
+		if len(doc.Sheets) > 0 {
+			first := doc.Sheets[0]
+			result.Metadata["rows"] = fmt.Sprintf("%d", first.Rows)
+			result.Metadata["columns"] = fmt.Sprintf("%d", first.Columns)
+			result.Metadata["dimensions"] = first.Dimensions
+			if len(first.Headers) > 0 {
+				result.Metadata["headers"] = strings.Join(first.Headers, ",")
+				result.Metadata["columnTypes"] = strings.Join(first.ColumnTypes, ",")
+			}
+		}
+	}
+
+	// Generate a CSV preview of the first rows of the first sheet
+	if options.GeneratePreview && len(firstSheet) > 0 {
+		maxPreviewRows := 10
+		if maxPreviewRows > len(firstSheet) {
+			maxPreviewRows = len(firstSheet)
+		}
+
+		var previewBuilder strings.Builder
+		w := csv.NewWriter(&previewBuilder)
+		w.WriteAll(firstSheet[:maxPreviewRows])
+
+		result.Preview = []byte(previewBuilder.String())
+	}
+
+	return result, nil
+}
+
+// xlsxWorkbook holds what is needed to read the cells of a workbook's sheets
+type xlsxWorkbook struct {
+	sheets        []xlsxSheet
+	sharedStrings []string
+	dateStyles    map[int]bool // Cell styles whose number format is a date or time
+	date1904      bool         // Dates count from 1904 rather than 1900
+}
+
+// xlsxSheet is a worksheet and the package part holding it
+type xlsxSheet struct {
+	name string
+	part string
+}
+
+// xlsxWorksheet is the content of a worksheet part
+type xlsxWorksheet struct {
+	Rows []struct {
+		Ref   int        `xml:"r,attr"` // One-based row number; optional
+		Cells []xlsxCell `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// xlsxCell is a cell of a worksheet
+type xlsxCell struct {
+	Ref     string       `xml:"r,attr"` // e.g. "B3"; optional
+	Type    string       `xml:"t,attr"` // s, inlineStr, str, b, e, d or n
+	Style   int          `xml:"s,attr"`
+	Formula *struct{}    `xml:"f"`
+	Value   string       `xml:"v"`
+	Inline  xlsxRichText `xml:"is"`
+}
+
+// xlsxRichText is a string item: plain text or runs of formatted text
+type xlsxRichText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+// String returns the text of the item without its formatting
+func (t xlsxRichText) String() string {
+	text := t.Text
+	for _, run := range t.Runs {
+		text += run.Text
+	}
+	return text
+}
+
+// readWorkbook reads the sheet list, shared strings and date styles of a workbook
+func readWorkbook(pkg *officePackage) (*xlsxWorkbook, error) {
+	part := pkg.mainPart("xl/workbook.xml")
+	var workbook struct {
+		XMLName    xml.Name
+		Properties struct {
+			Date1904 bool `xml:"date1904,attr"`
+		} `xml:"workbookPr"`
+		Sheets []struct {
+			Name  string `xml:"name,attr"`
+			RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := readZipXML(pkg.files[part], &workbook); err != nil {
+		return nil, fmt.Errorf("failed to read workbook: %w", err)
+	}
+	if workbook.XMLName.Local != "workbook" {
+		return nil, fmt.Errorf("main part is a %s, not a workbook", workbook.XMLName.Local)
+	}
+
+	wb := &xlsxWorkbook{date1904: workbook.Properties.Date1904}
+	targets := relationshipTargets(pkg.files, part)
+	for _, sheet := range workbook.Sheets {
+		target, ok := targets[sheet.RelID]
+		if !ok {
+			return nil, fmt.Errorf("sheet %q has no part", sheet.Name)
+		}
+		wb.sheets = append(wb.sheets, xlsxSheet{name: sheet.Name, part: target})
+	}
+
+	for _, target := range relationshipTargetsByType(pkg.files, part, "/sharedStrings") {
+		var sst struct {
+			Items []xlsxRichText `xml:"si"`
+		}
+		if err := readZipXML(pkg.files[target], &sst); err != nil {
+			return nil, fmt.Errorf("failed to read shared strings: %w", err)
+		}
+		for _, item := range sst.Items {
+			wb.sharedStrings = append(wb.sharedStrings, item.String())
+		}
+	}
+
+	for _, target := range relationshipTargetsByType(pkg.files, part, "/styles") {
+		var styles struct {
+			NumFmts []struct {
+				ID   int    `xml:"numFmtId,attr"`
+				Code string `xml:"formatCode,attr"`
+			} `xml:"numFmts>numFmt"`
+			CellXfs []struct {
+				NumFmtID int `xml:"numFmtId,attr"`
+			} `xml:"cellXfs>xf"`
+		}
+		// Without styles, numbers are shown as they are stored
+		if readZipXML(pkg.files[target], &styles) != nil {
+			continue
+		}
+		customDates := make(map[int]bool)
+		for _, format := range styles.NumFmts {
+			customDates[format.ID] = isDateFormat(format.Code)
+		}
+		wb.dateStyles = make(map[int]bool)
+		for i, xf := range styles.CellXfs {
+			if builtinDateFormat(xf.NumFmtID) || customDates[xf.NumFmtID] {
+				wb.dateStyles[i] = true
+			}
+		}
+	}
+	return wb, nil
+}
+
+// builtinDateFormat reports whether a built-in number format shows a date or time
+func builtinDateFormat(id int) bool {
+	return (id >= 14 && id <= 22) || (id >= 45 && id <= 47)
+}
+
+// isDateFormat reports whether a custom number format code shows a date or
+// time: it has day, month, year, hour or second placeholders outside quoted
+// text and bracketed colors or conditions
+func isDateFormat(code string) bool {
+	inQuotes, inBrackets, escaped := false, false, false
+	for _, r := range strings.ToLower(code) {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			inQuotes = !inQuotes
+		case inQuotes:
+		case r == '[':
+			inBrackets = true
+		case r == ']':
+			inBrackets = false
+		case inBrackets:
+		case strings.ContainsRune("dmyhs", r):
+			return true
+		}
+	}
+	return false
+}
+
+// summarizeSheet describes a worksheet and returns its cell values as rows of text.
+// The first row is treated as the header row.
+func (wb *xlsxWorkbook) summarizeSheet(name string, ws *xlsxWorksheet) (SheetSummary, [][]string) {
+	summary := SheetSummary{Name: name}
+	if len(ws.Rows) == 0 {
+		return summary, nil
+	}
+
+	// Place the cells in their columns; cells without a reference follow the
+	// previous one, and rows without a number the previous row
+	type placedCell struct {
+		column int
+		cell   xlsxCell
+	}
+	placed := make([][]placedCell, len(ws.Rows))
+	minRow, minCol, maxRow, maxCol := -1, -1, -1, -1
+	rowIndex := -1
+	for i, row := range ws.Rows {
+		rowIndex++
+		if row.Ref > 0 {
+			rowIndex = row.Ref - 1
+		}
+		column := -1
+		for _, cell := range row.Cells {
+			column++
+			if col, _, ok := parseCellRef(cell.Ref); ok {
+				column = col
+			}
+			placed[i] = append(placed[i], placedCell{column, cell})
+
+			if cell.Value == "" && cell.Inline.String() == "" && cell.Formula == nil {
+				continue
+			}
+			if minRow < 0 || rowIndex < minRow {
+				minRow = rowIndex
+			}
+			if minCol < 0 || column < minCol {
+				minCol = column
+			}
+			maxRow = max(maxRow, rowIndex)
+			maxCol = max(maxCol, column)
+		}
+	}
+	if maxCol < 0 {
+		return summary, nil
+	}
+
+	summary.Dimensions = cellRef(minCol, minRow) + ":" + cellRef(maxCol, maxRow)
+	summary.Rows = len(ws.Rows)
+	summary.Columns = maxCol + 1
+
+	values := make([][]string, 0, len(ws.Rows))
+	types := make([]string, summary.Columns)
+
+	for i, cells := range placed {
+		rowValues := make([]string, summary.Columns)
+		for _, pc := range cells {
+			if pc.column >= summary.Columns {
+				continue
+			}
+			if pc.cell.Formula != nil {
+				summary.Formulas++
+			}
+			value, kind := wb.cellValue(pc.cell)
+			if value == "" {
+				continue
+			}
+			rowValues[pc.column] = value
+
+			// Column types are detected from the data rows below the header
+			if i > 0 {
+				types[pc.column] = mergeColumnType(types[pc.column], kind)
+			}
+		}
+
+		if i == 0 {
+			summary.Headers = rowValues
+		}
+		values = append(values, rowValues)
+	}
+
+	for j := range types {
+		if types[j] == "" {
+			types[j] = ColumnTypeEmpty
+		}
+	}
+	summary.ColumnTypes = types
+
+	return summary, values
+}
+
+// cellValue returns the text of a cell and its detected type. Numbers in a
+// date style are shown as dates, other numbers as they are stored.
+func (wb *xlsxWorkbook) cellValue(cell xlsxCell) (string, string) {
+	switch cell.Type {
+	case "s":
+		index, err := strconv.Atoi(strings.TrimSpace(cell.Value))
+		if err != nil || index < 0 || index >= len(wb.sharedStrings) {
+			return "", ColumnTypeString
+		}
+		return wb.sharedStrings[index], ColumnTypeString
+	case "inlineStr":
+		return cell.Inline.String(), ColumnTypeString
+	case "b":
+		if cell.Value == "" {
+			return "", ColumnTypeBoolean
+		}
+		if cell.Value == "1" {
+			return "TRUE", ColumnTypeBoolean
+		}
+		return "FALSE", ColumnTypeBoolean
+	case "str", "e", "d":
+		return cell.Value, ColumnTypeString
+	}
+
+	value := strings.TrimSpace(cell.Value)
+	if value == "" {
+		return "", ColumnTypeNumber
+	}
+	if serial, err := strconv.ParseFloat(value, 64); err == nil && wb.dateStyles[cell.Style] {
+		return formatExcelDate(serial, wb.date1904), ColumnTypeNumber
+	}
+	return value, ColumnTypeNumber
+}
+
+// formatExcelDate formats a date serial number: days since the workbook's
+// epoch, with the time of day as the fraction
+func formatExcelDate(serial float64, date1904 bool) string {
+	// The 1900 system counts a February 29, 1900 that never was, so serials
+	// from March 1900 on are one day ahead of a count from December 31, 1899
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	} else if serial < 61 {
+		epoch = epoch.AddDate(0, 0, 1)
+	}
+	days := math.Floor(serial)
+	seconds := math.Round((serial - days) * 86400)
+	t := epoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+
+	switch {
+	case days == 0 && seconds != 0:
+		return t.Format("15:04:05")
+	case seconds == 0:
+		return t.Format("2006-01-02")
+	default:
+		return t.Format("2006-01-02 15:04:05")
+	}
+}
+
+// parseCellRef parses a cell reference such as "B3" into zero-based column and row indexes
+func parseCellRef(ref string) (int, int, bool) {
+	i := 0
+	column := 0
+	for ; i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z'; i++ {
+		column = column*26 + int(ref[i]-'A') + 1
+	}
+	row, err := strconv.Atoi(ref[i:])
+	if i == 0 || err != nil || row < 1 || column > 16384 {
+		return 0, 0, false
+	}
+	return column - 1, row - 1, true
+}
+
+// cellRef formats zero-based column and row indexes as a cell reference
+func cellRef(column, row int) string {
+	var letters []byte
+	for n := column + 1; n > 0; n = (n - 1) / 26 {
+		letters = append([]byte{byte('A' + (n-1)%26)}, letters...)
+	}
+	return string(letters) + strconv.Itoa(row+1)
+}
+
+// mergeColumnType combines the type seen so far for a column with the type of another cell;
+// columns holding more than one type are treated as strings
+func mergeColumnType(current, next string) string {
+	if current == "" || current == next {
+		return next
+	}
+	return ColumnTypeString
+}
+
+// Name returns the processor name
+func (p *XLSXProcessor) Name() string {
+	return "xlsx"
+}
+
+// CanProcess returns true if this processor can process the given content type
+func (p *XLSXProcessor) CanProcess(contentType, ext string) bool {
+	if contentType == "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet" {
+		return true
+	}
+	return strings.ToLower(ext) == ".xlsx"
+}
+
+// init registers the processor with the registry
+func init() {
+	Register(NewXLSXProcessor(), "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+}
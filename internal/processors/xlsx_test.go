@@ -0,0 +1,186 @@
+package processors
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// processWorkbook runs the XLSX processor over the workbook fixture, which
+// has a sheet of sales with shared, rich and inline strings, a formula,
+// booleans and dates, and a second sheet with a time and a string formula
+func processWorkbook(t *testing.T, options ProcessOptions) *ProcessResult {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "workbook.xlsx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := NewXLSXProcessor().Process(context.Background(), bytes.NewReader(data), "workbook.xlsx", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestXLSXProcessorSheets(t *testing.T) {
+	result := processWorkbook(t, ProcessOptions{})
+	doc := result.Data.(*SpreadsheetDocument)
+
+	want := []SheetSummary{
+		{
+			Name:       "Sales",
+			Dimensions: "A1:E3",
+			Rows:       3,
+			Columns:    5,
+			Headers:    []string{"Region", "Units", "Price", "Shipped", "Paid"},
+			// The price column mixes numbers and text
+			ColumnTypes: []string{ColumnTypeString, ColumnTypeNumber, ColumnTypeString, ColumnTypeNumber, ColumnTypeBoolean},
+			Formulas:    1,
+		},
+		{
+			Name:        "Notes",
+			Dimensions:  "B2:C2",
+			Rows:        1,
+			Columns:     3,
+			Headers:     []string{"", "18:00:00", "Due soon"},
+			ColumnTypes: []string{ColumnTypeEmpty, ColumnTypeEmpty, ColumnTypeEmpty},
+			Formulas:    1,
+		},
+	}
+	if !reflect.DeepEqual(doc.Sheets, want) {
+		t.Errorf("sheets = %+v, want %+v", doc.Sheets, want)
+	}
+	if want := `Spreadsheet with 2 sheets, first sheet "Sales" has 3 rows and 5 columns`; result.Summary != want {
+		t.Errorf("summary = %q, want %q", result.Summary, want)
+	}
+}
+
+func TestXLSXProcessorCells(t *testing.T) {
+	result := processWorkbook(t, ProcessOptions{GeneratePreview: true})
+
+	// Dates are formatted, numbers kept as stored, and a format with quoted
+	// text isn't mistaken for a date
+	want := "Region,Units,Price,Shipped,Paid\n" +
+		"North,12,3.5,2024-01-01,TRUE\n" +
+		"South (new),24,n/a,2024-02-01 12:00:00,FALSE\n"
+	if string(result.Preview) != want {
+		t.Errorf("preview =\n%s\nwant\n%s", result.Preview, want)
+	}
+}
+
+func TestXLSXProcessorMetadata(t *testing.T) {
+	result := processWorkbook(t, ProcessOptions{ExtractMetadata: true})
+
+	want := map[string]string{
+		"title":          "Quarterly sales",
+		"author":         "Ada Lovelace",
+		"lastModifiedBy": "Grace Hopper",
+		"created":        "2024-03-01T09:30:00Z",
+		"modified":       "2024-03-02T10:00:00Z",
+		"sheets":         "2",
+		"sheetNames":     "Sales,Notes",
+		"formulas":       "2",
+		"rows":           "3",
+		"columns":        "5",
+		"dimensions":     "A1:E3",
+		"headers":        "Region,Units,Price,Shipped,Paid",
+		"columnTypes":    "string,number,string,number,boolean",
+	}
+	if !reflect.DeepEqual(result.Metadata, want) {
+		t.Errorf("metadata = %v, want %v", result.Metadata, want)
+	}
+}
+
+func TestXLSXProcessorInvalid(t *testing.T) {
+	presentation, err := os.ReadFile(filepath.Join("testdata", "presentation.pptx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("word/document.xml")
+	w.Write([]byte("<document/>"))
+	zw.Close()
+
+	for name, data := range map[string][]byte{
+		"not a zip":      []byte("Region,Units\nNorth,12\n"),
+		"no main part":   buf.Bytes(),
+		"not a workbook": presentation,
+	} {
+		_, err := NewXLSXProcessor().Process(context.Background(), bytes.NewReader(data), "bad.xlsx", ProcessOptions{})
+		if err == nil || !strings.Contains(err.Error(), "failed to parse spreadsheet") {
+			t.Errorf("%s: err = %v, want a parse error", name, err)
+		}
+	}
+}
+
+func TestCellRef(t *testing.T) {
+	tests := map[string][2]int{
+		"A1":      {0, 0},
+		"B3":      {1, 2},
+		"Z10":     {25, 9},
+		"AA1":     {26, 0},
+		"XFD1048": {16383, 1047},
+	}
+	for ref, want := range tests {
+		column, row, ok := parseCellRef(ref)
+		if !ok || column != want[0] || row != want[1] {
+			t.Errorf("parseCellRef(%q) = %d, %d, %v; want %v", ref, column, row, ok, want)
+		}
+		if got := cellRef(want[0], want[1]); got != ref {
+			t.Errorf("cellRef(%d, %d) = %q, want %q", want[0], want[1], got, ref)
+		}
+	}
+	for _, ref := range []string{"", "A", "12", "a1", "A0", "XFE1"} {
+		if _, _, ok := parseCellRef(ref); ok {
+			t.Errorf("parseCellRef(%q) succeeded", ref)
+		}
+	}
+}
+
+func TestFormatExcelDate(t *testing.T) {
+	tests := []struct {
+		serial   float64
+		date1904 bool
+		want     string
+	}{
+		{1, false, "1900-01-01"},
+		{59, false, "1900-02-28"},
+		{61, false, "1900-03-01"},
+		{45292, false, "2024-01-01"},
+		{45292.25, false, "2024-01-01 06:00:00"},
+		{0.5, false, "12:00:00"},
+		{0, true, "1904-01-01"},
+		{43830, true, "2024-01-01"},
+	}
+	for _, tt := range tests {
+		if got := formatExcelDate(tt.serial, tt.date1904); got != tt.want {
+			t.Errorf("formatExcelDate(%v, %v) = %q, want %q", tt.serial, tt.date1904, got, tt.want)
+		}
+	}
+}
+
+func TestIsDateFormat(t *testing.T) {
+	tests := map[string]bool{
+		"dd/mm/yyyy":         true,
+		"h:mm AM/PM":         true,
+		"[$-409]mmmm d":      true,
+		"0.00":               false,
+		`"Day" 0`:            false,
+		"[Red]#,##0":         false,
+		`0\d`:                false,
+		"General":            false,
+		"#,##0 \"units\"":    false,
+		"yyyy-mm-dd\\ hh:mm": true,
+	}
+	for code, want := range tests {
+		if got := isDateFormat(code); got != want {
+			t.Errorf("isDateFormat(%q) = %v, want %v", code, got, want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{"* * * * *", false},
+		{"0 2 * * *", false},
+		{"*/15 * * * *", false},
+		{"5/15 * * * *", false},
+		{"0 9-17 * * 1-5", false},
+		{"0,30 8,20 1,15 * *", false},
+		{"0 0 ? * ?", false},
+		{"0 0 * * 7", false},
+		{"0 0 1 1-12/3 *", false},
+		{"@daily", false},
+		{"@hourly", false},
+		{"@yearly", false},
+		{"@every 6h", false},
+		{"@every 1m", false},
+		{"  @weekly  ", false},
+
+		{"", true},
+		{"* * * *", true},
+		{"* * * * * *", true},
+		{"60 * * * *", true},
+		{"* 24 * * *", true},
+		{"* * 0 * *", true},
+		{"* * 32 * *", true},
+		{"* * * 13 *", true},
+		{"* * * * 8", true},
+		{"5-1 * * * *", true},
+		{"*/0 * * * *", true},
+		{"*/x * * * *", true},
+		{"a * * * *", true},
+		{"1-b * * * *", true},
+		{"@fortnightly", true},
+		{"@every 30s", true},
+		{"@every soon", true},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseSchedule(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSchedule(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseFieldBits(t *testing.T) {
+	tests := []struct {
+		field    string
+		min, max int
+		want     []int
+	}{
+		{"*", 0, 5, []int{0, 1, 2, 3, 4, 5}},
+		{"*/2", 0, 5, []int{0, 2, 4}},
+		{"1-3", 0, 5, []int{1, 2, 3}},
+		{"1-5/2", 0, 5, []int{1, 3, 5}},
+		{"3/2", 0, 9, []int{3, 5, 7, 9}},
+		{"0,4,5", 0, 5, []int{0, 4, 5}},
+		{"1-2,4", 1, 5, []int{1, 2, 4}},
+	}
+
+	for _, tt := range tests {
+		got, err := parseField(tt.field, tt.min, tt.max)
+		if err != nil {
+			t.Errorf("parseField(%q) error = %v", tt.field, err)
+			continue
+		}
+		var want uint64
+		for _, v := range tt.want {
+			want |= 1 << uint(v)
+		}
+		if got != want {
+			t.Errorf("parseField(%q) = %b, want %b", tt.field, got, want)
+		}
+	}
+}
+
+func TestParseScheduleSundaySeven(t *testing.T) {
+	zero, err := ParseSchedule("0 0 * * 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seven, err := ParseSchedule("0 0 * * 7")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from := time.Date(2024, time.March, 6, 12, 0, 0, 0, time.UTC) // a Wednesday
+	want := time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC)
+	if got := zero.Next(from); !got.Equal(want) {
+		t.Errorf("Next with 0 = %v, want %v", got, want)
+	}
+	if got := seven.Next(from); !got.Equal(want) {
+		t.Errorf("Next with 7 = %v, want %v", got, want)
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	date := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		spec  string
+		after time.Time
+		want  time.Time
+	}{
+		// Later the same day, and the next day once the time has passed
+		{"0 2 * * *", date(2024, time.March, 6, 1, 0), date(2024, time.March, 6, 2, 0)},
+		{"0 2 * * *", date(2024, time.March, 6, 2, 0), date(2024, time.March, 7, 2, 0)},
+		// Seconds are dropped and the next whole minute is the earliest run
+		{"* * * * *", time.Date(2024, time.March, 6, 10, 0, 30, 0, time.UTC), date(2024, time.March, 6, 10, 1)},
+		{"*/15 * * * *", date(2024, time.March, 6, 10, 7), date(2024, time.March, 6, 10, 15)},
+		{"*/15 * * * *", date(2024, time.March, 6, 10, 45), date(2024, time.March, 6, 11, 0)},
+		{"0 9-17 * * 1-5", date(2024, time.March, 8, 18, 0), date(2024, time.March, 11, 9, 0)},
+		// Month and year rollover
+		{"0 0 1 * *", date(2024, time.January, 31, 12, 0), date(2024, time.February, 1, 0, 0)},
+		{"@yearly", date(2024, time.June, 1, 0, 0), date(2025, time.January, 1, 0, 0)},
+		{"0 0 31 * *", date(2024, time.April, 1, 0, 0), date(2024, time.May, 31, 0, 0)},
+		{"0 0 29 2 *", date(2024, time.March, 1, 0, 0), date(2028, time.February, 29, 0, 0)},
+		// With both day fields restricted, either one matches: the 13th or a Friday
+		{"0 0 13 * 5", date(2024, time.March, 1, 12, 0), date(2024, time.March, 8, 0, 0)},
+		{"0 0 13 * 5", date(2024, time.March, 8, 12, 0), date(2024, time.March, 13, 0, 0)},
+		// With only one restricted, only that one applies
+		{"0 0 13 * *", date(2024, time.March, 1, 12, 0), date(2024, time.March, 13, 0, 0)},
+		{"0 0 * * 5", date(2024, time.March, 1, 12, 0), date(2024, time.March, 8, 0, 0)},
+		{"0 0 ? * 5", date(2024, time.March, 1, 12, 0), date(2024, time.March, 8, 0, 0)},
+		// Impossible dates give up with the zero time
+		{"0 0 30 2 *", date(2024, time.January, 1, 0, 0), time.Time{}},
+		{"0 0 31 4 *", date(2024, time.January, 1, 0, 0), time.Time{}},
+		// Intervals are measured from the given time
+		{"@every 6h", time.Date(2024, time.March, 6, 10, 0, 30, 0, time.UTC), time.Date(2024, time.March, 6, 16, 0, 30, 0, time.UTC)},
+		{"@every 90m", date(2024, time.March, 6, 23, 0), date(2024, time.March, 7, 0, 30)},
+	}
+
+	for _, tt := range tests {
+		schedule, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q) error = %v", tt.spec, err)
+			continue
+		}
+		if got := schedule.Next(tt.after); !got.Equal(tt.want) {
+			t.Errorf("%q.Next(%v) = %v, want %v", tt.spec, tt.after, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,456 @@
+// Package scheduler runs declarative jobs on cron-style schedules through the processing worker pool
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/example/fileprocessor/internal/processors"
+)
+
+// Missed run policies applied to jobs whose run time passed while the server was down
+const (
+	MissedRunOnce = "run_once" // Run the job once as soon as the scheduler starts
+	MissedRunSkip = "skip"     // Skip the missed runs and wait for the next scheduled time
+)
+
+// Common errors
+var (
+	ErrJobNotFound   = errors.New("job not found")
+	ErrUnknownAction = errors.New("unknown job action")
+	ErrJobRunning    = errors.New("job is already running")
+)
+
+// ActionFunc executes a job action with the job's parameters and returns a short summary
+type ActionFunc func(ctx context.Context, params map[string]string) (string, error)
+
+// Job is a declarative job definition together with its run status
+type Job struct {
+	ID              string            `json:"id"`
+	Name            string            `json:"name"`
+	Schedule        string            `json:"schedule"`
+	Action          string            `json:"action"`
+	Params          map[string]string `json:"params,omitempty"`
+	Enabled         bool              `json:"enabled"`
+	MissedRunPolicy string            `json:"missedRunPolicy,omitempty"`
+	CreatedAt       time.Time         `json:"createdAt"`
+	LastRun         time.Time         `json:"lastRun,omitempty"`
+	NextRun         time.Time         `json:"nextRun,omitempty"`
+	LastStatus      string            `json:"lastStatus,omitempty"` // "running", "succeeded", "failed"
+	LastResult      string            `json:"lastResult,omitempty"`
+	LastError       string            `json:"lastError,omitempty"`
+	LastDuration    string            `json:"lastDuration,omitempty"`
+	MissedRuns      int               `json:"missedRuns,omitempty"`
+
+	schedule Schedule
+	running  bool
+}
+
+// Scheduler keeps job definitions, persists them to disk and submits due jobs to the worker pool
+type Scheduler struct {
+	jobs      map[string]*Job
+	actions   map[string]ActionFunc
+	stateFile string
+	interval  time.Duration
+	quit      chan struct{}
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	saveMu    sync.Mutex
+}
+
+// NewScheduler creates a scheduler that stores its jobs in stateFile and checks
+// for due jobs every interval
+func NewScheduler(stateFile string, interval time.Duration) *Scheduler {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	return &Scheduler{
+		jobs:      make(map[string]*Job),
+		actions:   make(map[string]ActionFunc),
+		stateFile: stateFile,
+		interval:  interval,
+		quit:      make(chan struct{}),
+	}
+}
+
+// RegisterAction registers a named action that jobs can refer to
+func (s *Scheduler) RegisterAction(name string, action ActionFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.actions[name] = action
+}
+
+// Actions returns the names of the registered actions
+func (s *Scheduler) Actions() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.actions))
+	for name := range s.actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Start loads the persisted jobs, applies the missed run policies and starts the scheduling loop
+func (s *Scheduler) Start() error {
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var missed []*Job
+
+	s.mu.Lock()
+	for _, job := range s.jobs {
+		if job.Enabled && !job.NextRun.IsZero() && job.NextRun.Before(now) {
+			job.MissedRuns++
+			log.Printf("Scheduled job %s (%s) missed its run at %s", job.ID, job.Name, job.NextRun.Format(time.RFC3339))
+			if job.MissedRunPolicy != MissedRunSkip {
+				missed = append(missed, job)
+			}
+		}
+		if job.LastStatus == "running" {
+			// The server stopped while the job was running
+			job.LastStatus = "failed"
+			job.LastError = "interrupted by server shutdown"
+		}
+		job.NextRun = job.schedule.Next(now)
+	}
+	s.mu.Unlock()
+
+	for _, job := range missed {
+		if err := s.run(job.ID); err != nil {
+			log.Printf("Failed to run missed job %s: %v", job.ID, err)
+		}
+	}
+
+	if err := s.save(); err != nil {
+		log.Printf("Failed to save scheduler state: %v", err)
+	}
+
+	s.wg.Add(1)
+	go s.loop()
+
+	log.Printf("Scheduler started with %d jobs", len(s.jobs))
+	return nil
+}
+
+// Stop stops the scheduling loop
+func (s *Scheduler) Stop() {
+	close(s.quit)
+	s.wg.Wait()
+	log.Println("Scheduler stopped")
+}
+
+// List returns all jobs ordered by name
+func (s *Scheduler) List() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Name < jobs[j].Name
+	})
+	return jobs
+}
+
+// Get returns a job by ID
+func (s *Scheduler) Get(id string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return *job, nil
+}
+
+// Create validates and adds a new job
+func (s *Scheduler) Create(job Job) (Job, error) {
+	if err := s.prepare(&job); err != nil {
+		return Job{}, err
+	}
+
+	job.ID = fmt.Sprintf("job-%d", time.Now().UnixNano())
+	job.CreatedAt = time.Now()
+
+	s.mu.Lock()
+	s.jobs[job.ID] = &job
+	created := job
+	s.mu.Unlock()
+
+	return created, s.save()
+}
+
+// Update replaces the definition of an existing job, keeping its run history
+func (s *Scheduler) Update(id string, update Job) (Job, error) {
+	if err := s.prepare(&update); err != nil {
+		return Job{}, err
+	}
+
+	s.mu.Lock()
+	job, ok := s.jobs[id]
+	if !ok {
+		s.mu.Unlock()
+		return Job{}, ErrJobNotFound
+	}
+
+	job.Name = update.Name
+	job.Schedule = update.Schedule
+	job.Action = update.Action
+	job.Params = update.Params
+	job.Enabled = update.Enabled
+	job.MissedRunPolicy = update.MissedRunPolicy
+	job.NextRun = update.NextRun
+	job.schedule = update.schedule
+	updated := *job
+	s.mu.Unlock()
+
+	return updated, s.save()
+}
+
+// Delete removes a job
+func (s *Scheduler) Delete(id string) error {
+	s.mu.Lock()
+	if _, ok := s.jobs[id]; !ok {
+		s.mu.Unlock()
+		return ErrJobNotFound
+	}
+	delete(s.jobs, id)
+	s.mu.Unlock()
+
+	return s.save()
+}
+
+// RunNow submits a job immediately, regardless of its schedule
+func (s *Scheduler) RunNow(id string) error {
+	return s.run(id)
+}
+
+// prepare validates a job definition and fills in defaults
+func (s *Scheduler) prepare(job *Job) error {
+	if job.Name == "" {
+		job.Name = job.Action
+	}
+
+	schedule, err := ParseSchedule(job.Schedule)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	_, ok := s.actions[job.Action]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownAction, job.Action)
+	}
+
+	switch job.MissedRunPolicy {
+	case "":
+		job.MissedRunPolicy = MissedRunOnce
+	case MissedRunOnce, MissedRunSkip:
+	default:
+		return fmt.Errorf("invalid missed run policy: %s", job.MissedRunPolicy)
+	}
+
+	job.schedule = schedule
+	job.NextRun = schedule.Next(time.Now())
+	return nil
+}
+
+// loop periodically submits jobs whose next run time has passed
+func (s *Scheduler) loop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			s.mu.Lock()
+			var due []string
+			for id, job := range s.jobs {
+				if job.Enabled && !job.running && !job.NextRun.IsZero() && !job.NextRun.After(now) {
+					due = append(due, id)
+				}
+			}
+			s.mu.Unlock()
+
+			for _, id := range due {
+				if err := s.run(id); err != nil {
+					log.Printf("Failed to run scheduled job %s: %v", id, err)
+				}
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// run submits a job to the worker pool and records its outcome when it finishes
+func (s *Scheduler) run(id string) error {
+	s.mu.Lock()
+	job, ok := s.jobs[id]
+	if !ok {
+		s.mu.Unlock()
+		return ErrJobNotFound
+	}
+	if job.running {
+		s.mu.Unlock()
+		return ErrJobRunning
+	}
+	action, ok := s.actions[job.Action]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrUnknownAction, job.Action)
+	}
+
+	params := make(map[string]string, len(job.Params))
+	for k, v := range job.Params {
+		params[k] = v
+	}
+	started := time.Now()
+	job.running = true
+	job.LastRun = started
+	job.LastStatus = "running"
+	job.NextRun = job.schedule.Next(started)
+	s.mu.Unlock()
+
+	task := processors.NewTask(fmt.Sprintf("%s-%d", id, started.UnixNano()), func() (*processors.ProcessResult, error) {
+		summary, err := action(context.Background(), params)
+		if err != nil {
+			return nil, err
+		}
+		return &processors.ProcessResult{Summary: summary}, nil
+	})
+
+	if err := processors.Submit(task); err != nil {
+		s.finish(id, started, nil, err)
+		return err
+	}
+
+	go func() {
+		select {
+		case result := <-task.Result:
+			s.finish(id, started, result, nil)
+		case err := <-task.Error:
+			s.finish(id, started, nil, err)
+		}
+	}()
+
+	return nil
+}
+
+// finish records the outcome of a job run
+func (s *Scheduler) finish(id string, started time.Time, result *processors.ProcessResult, err error) {
+	s.mu.Lock()
+	if job, ok := s.jobs[id]; ok {
+		job.running = false
+		job.LastDuration = time.Since(started).Round(time.Millisecond).String()
+		if err != nil {
+			job.LastStatus = "failed"
+			job.LastError = err.Error()
+			job.LastResult = ""
+			log.Printf("Scheduled job %s (%s) failed: %v", job.ID, job.Name, err)
+		} else {
+			job.LastStatus = "succeeded"
+			job.LastError = ""
+			job.LastResult = result.Summary
+			log.Printf("Scheduled job %s (%s) completed: %s", job.ID, job.Name, result.Summary)
+		}
+	}
+	s.mu.Unlock()
+
+	if err := s.save(); err != nil {
+		log.Printf("Failed to save scheduler state: %v", err)
+	}
+}
+
+// load reads the persisted jobs from the state file
+func (s *Scheduler) load() error {
+	if s.stateFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.stateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read scheduler state: %w", err)
+	}
+
+	var jobs []*Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return fmt.Errorf("failed to parse scheduler state: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range jobs {
+		schedule, err := ParseSchedule(job.Schedule)
+		if err != nil {
+			log.Printf("Skipping scheduled job %s with invalid schedule: %v", job.ID, err)
+			continue
+		}
+		job.schedule = schedule
+		s.jobs[job.ID] = job
+	}
+
+	return nil
+}
+
+// save writes the jobs to the state file
+func (s *Scheduler) save() error {
+	if s.stateFile == "" {
+		return nil
+	}
+
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	s.mu.Lock()
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobCopy := *job
+		jobs = append(jobs, &jobCopy)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode scheduler state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.stateFile), 0755); err != nil {
+		return fmt.Errorf("failed to create scheduler state directory: %w", err)
+	}
+
+	// Write to a temporary file first so a crash can't leave a truncated state file
+	tmpFile := s.stateFile + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write scheduler state: %w", err)
+	}
+	return os.Rename(tmpFile, s.stateFile)
+}
@@ -0,0 +1,174 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/example/fileprocessor/internal/processors"
+)
+
+// useWorkerPool installs a worker pool for the duration of a test
+func useWorkerPool(t *testing.T) {
+	t.Helper()
+	previous := processors.DefaultPool
+	processors.DefaultPool = processors.NewWorkerPool(1, 10, 1)
+	t.Cleanup(func() {
+		processors.DefaultPool.Stop()
+		processors.DefaultPool = previous
+	})
+}
+
+// writeState writes jobs to a scheduler state file
+func writeState(t *testing.T, jobs []Job) string {
+	t.Helper()
+	data, err := json.Marshal(jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateFile := filepath.Join(t.TempDir(), "scheduler.json")
+	if err := os.WriteFile(stateFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return stateFile
+}
+
+// waitForStatus waits until a job has finished running
+func waitForStatus(t *testing.T, s *Scheduler, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := s.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.LastStatus != "running" && !job.LastRun.IsZero() {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return Job{}
+}
+
+func TestStartMissedRuns(t *testing.T) {
+	useWorkerPool(t)
+
+	past := time.Now().Add(-2 * time.Hour)
+	future := time.Now().Add(2 * time.Hour)
+	stateFile := writeState(t, []Job{
+		{ID: "once", Name: "once", Schedule: "@hourly", Action: "count", Params: map[string]string{"id": "once"}, Enabled: true, MissedRunPolicy: MissedRunOnce, NextRun: past},
+		{ID: "default", Name: "default", Schedule: "@hourly", Action: "count", Params: map[string]string{"id": "default"}, Enabled: true, NextRun: past},
+		{ID: "skip", Name: "skip", Schedule: "@hourly", Action: "count", Params: map[string]string{"id": "skip"}, Enabled: true, MissedRunPolicy: MissedRunSkip, NextRun: past},
+		{ID: "disabled", Name: "disabled", Schedule: "@hourly", Action: "count", Params: map[string]string{"id": "disabled"}, Enabled: false, NextRun: past},
+		{ID: "due-later", Name: "due-later", Schedule: "@hourly", Action: "count", Params: map[string]string{"id": "due-later"}, Enabled: true, NextRun: future},
+	})
+
+	var mu sync.Mutex
+	runs := make(map[string]int)
+	s := NewScheduler(stateFile, time.Hour)
+	s.RegisterAction("count", func(ctx context.Context, params map[string]string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		runs[params["id"]]++
+		return "counted", nil
+	})
+
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	for _, id := range []string{"once", "default"} {
+		job := waitForStatus(t, s, id)
+		if job.LastStatus != "succeeded" || job.LastResult != "counted" {
+			t.Errorf("job %s: status %q result %q, want a successful run", id, job.LastStatus, job.LastResult)
+		}
+	}
+
+	tests := []struct {
+		id         string
+		missedRuns int
+		runs       int
+	}{
+		{"once", 1, 1},
+		{"default", 1, 1},
+		{"skip", 1, 0},
+		{"disabled", 0, 0},
+		{"due-later", 0, 0},
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, tt := range tests {
+		job, err := s.Get(tt.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.MissedRuns != tt.missedRuns {
+			t.Errorf("job %s: MissedRuns = %d, want %d", tt.id, job.MissedRuns, tt.missedRuns)
+		}
+		if runs[tt.id] != tt.runs {
+			t.Errorf("job %s: ran %d times, want %d", tt.id, runs[tt.id], tt.runs)
+		}
+		if !job.NextRun.After(time.Now()) {
+			t.Errorf("job %s: NextRun %v is not in the future", tt.id, job.NextRun)
+		}
+	}
+}
+
+func TestStartInterruptedRun(t *testing.T) {
+	stateFile := writeState(t, []Job{
+		{ID: "interrupted", Name: "interrupted", Schedule: "@daily", Action: "count", Enabled: true, LastStatus: "running", NextRun: time.Now().Add(time.Hour)},
+	})
+
+	s := NewScheduler(stateFile, time.Hour)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	job, err := s.Get("interrupted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.LastStatus != "failed" || job.LastError == "" {
+		t.Errorf("status %q error %q, want the run marked failed", job.LastStatus, job.LastError)
+	}
+	if job.MissedRuns != 0 {
+		t.Errorf("MissedRuns = %d, want 0", job.MissedRuns)
+	}
+}
+
+func TestCreateMissedRunPolicy(t *testing.T) {
+	s := NewScheduler("", time.Hour)
+	s.RegisterAction("count", func(ctx context.Context, params map[string]string) (string, error) {
+		return "", nil
+	})
+
+	tests := []struct {
+		policy  string
+		want    string
+		wantErr bool
+	}{
+		{"", MissedRunOnce, false},
+		{MissedRunOnce, MissedRunOnce, false},
+		{MissedRunSkip, MissedRunSkip, false},
+		{"run_all", "", true},
+	}
+
+	for _, tt := range tests {
+		job, err := s.Create(Job{Schedule: "@daily", Action: "count", MissedRunPolicy: tt.policy})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Create with policy %q error = %v, wantErr %v", tt.policy, err, tt.wantErr)
+			continue
+		}
+		if err == nil && job.MissedRunPolicy != tt.want {
+			t.Errorf("Create with policy %q: policy = %q, want %q", tt.policy, job.MissedRunPolicy, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// Package worker runs file processing tasks leased from a coordinating server,
+// so processing can be spread across several machines that share storage
+package worker
+
+import (
+	"github.com/example/fileprocessor/internal/catalog"
+	"github.com/example/fileprocessor/internal/processors"
+)
+
+// API paths served by the coordinating server
+const (
+	LeasePath     = "/api/workers/lease"
+	HeartbeatPath = "/api/workers/heartbeat"
+	CompletePath  = "/api/workers/complete"
+)
+
+// LeaseRequest asks the server for a task
+type LeaseRequest struct {
+	WorkerID    string `json:"workerId"`
+	WaitSeconds int    `json:"waitSeconds"` // How long the server may hold the request open
+}
+
+// LeaseResponse carries a leased task; both fields are nil when no task was available
+type LeaseResponse struct {
+	Lease *processors.Lease    `json:"lease"`
+	Spec  *processors.TaskSpec `json:"spec"`
+}
+
+// HeartbeatRequest keeps the worker's leases alive
+type HeartbeatRequest struct {
+	WorkerID string   `json:"workerId"`
+	LeaseIDs []string `json:"leaseIds"`
+}
+
+// HeartbeatResponse lists the leases that are still held; the worker should
+// stop work on any others because their tasks have been requeued
+type HeartbeatResponse struct {
+	LeaseIDs []string `json:"leaseIds"`
+}
+
+// CompleteRequest reports the outcome of a leased task
+type CompleteRequest struct {
+	WorkerID string  `json:"workerId"`
+	LeaseID  string  `json:"leaseId"`
+	Result   *Result `json:"result,omitempty"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// Result is the serializable part of a processing result. Derived files are
+// already stored through the shared provider and are reported as catalog entries.
+type Result struct {
+	Summary  string            `json:"summary"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Preview  []byte            `json:"preview,omitempty"`
+	Text     string            `json:"text,omitempty"` // Data, when the processor produced text
+	Derived  []catalog.Entry   `json:"derived,omitempty"`
+}
+
+// ProcessResult converts the reported result back into a processing result
+func (r *Result) ProcessResult() *processors.ProcessResult {
+	result := &processors.ProcessResult{
+		Summary:  r.Summary,
+		Metadata: r.Metadata,
+		Preview:  r.Preview,
+	}
+	if r.Text != "" {
+		result.Data = r.Text
+	}
+	return result
+}
@@ -0,0 +1,271 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/fileprocessor/internal/catalog"
+	"github.com/example/fileprocessor/internal/processors"
+	"github.com/example/fileprocessor/internal/storage"
+)
+
+// leaseWait is how long a lease request may wait on the server for a task
+const leaseWait = 20 * time.Second
+
+// ProviderFunc returns the storage provider for a storage type
+type ProviderFunc func(storageType string) (storage.Provider, error)
+
+// Worker leases tasks from a coordinating server and runs them
+type Worker struct {
+	ID                string
+	ServerURL         string
+	Token             string
+	Concurrency       int
+	HeartbeatInterval time.Duration
+	Providers         ProviderFunc
+
+	client *http.Client
+	leases map[string]context.CancelFunc
+	mu     sync.Mutex
+}
+
+// New creates a worker that connects to serverURL with the given token
+func New(id, serverURL, token string, concurrency int, providers ProviderFunc) *Worker {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	return &Worker{
+		ID:                id,
+		ServerURL:         strings.TrimRight(serverURL, "/"),
+		Token:             token,
+		Concurrency:       concurrency,
+		HeartbeatInterval: 15 * time.Second,
+		Providers:         providers,
+		client:            &http.Client{Timeout: leaseWait + 30*time.Second},
+		leases:            make(map[string]context.CancelFunc),
+	}
+}
+
+// Run leases and processes tasks until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) error {
+	if w.ServerURL == "" {
+		return fmt.Errorf("server URL is required")
+	}
+	if w.Token == "" {
+		return fmt.Errorf("worker token is required")
+	}
+
+	log.Printf("Worker %s connecting to %s with %d slots", w.ID, w.ServerURL, w.Concurrency)
+
+	var wg sync.WaitGroup
+	wg.Add(w.Concurrency + 1)
+	go func() {
+		defer wg.Done()
+		w.heartbeatLoop(ctx)
+	}()
+	for i := 0; i < w.Concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			w.leaseLoop(ctx)
+		}()
+	}
+	wg.Wait()
+
+	log.Printf("Worker %s stopped", w.ID)
+	return nil
+}
+
+// leaseLoop repeatedly leases a task and runs it
+func (w *Worker) leaseLoop(ctx context.Context) {
+	for ctx.Err() == nil {
+		var resp LeaseResponse
+		err := w.call(ctx, LeasePath, LeaseRequest{
+			WorkerID:    w.ID,
+			WaitSeconds: int(leaseWait / time.Second),
+		}, &resp)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to lease task: %v", err)
+				sleep(ctx, 5*time.Second)
+			}
+			continue
+		}
+		if resp.Lease == nil || resp.Spec == nil {
+			continue
+		}
+
+		w.runLease(ctx, resp.Lease, resp.Spec)
+	}
+}
+
+// runLease processes a leased task and reports the outcome
+func (w *Worker) runLease(ctx context.Context, lease *processors.Lease, spec *processors.TaskSpec) {
+	taskCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w.mu.Lock()
+	w.leases[lease.ID] = cancel
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.leases, lease.ID)
+		w.mu.Unlock()
+	}()
+
+	log.Printf("Processing task %s (%s, attempt %d)", lease.TaskID, spec.Name, lease.Attempt)
+	result, err := w.execute(taskCtx, spec)
+
+	// The lease was lost or the worker is shutting down; the server requeues the task
+	if taskCtx.Err() != nil {
+		log.Printf("Abandoned task %s", lease.TaskID)
+		return
+	}
+
+	req := CompleteRequest{WorkerID: w.ID, LeaseID: lease.ID, Result: result}
+	if err != nil {
+		log.Printf("Task %s failed: %v", lease.TaskID, err)
+		req.Result = nil
+		req.Error = err.Error()
+	}
+	if err := w.call(ctx, CompletePath, req, nil); err != nil {
+		log.Printf("Failed to report task %s: %v", lease.TaskID, err)
+	}
+}
+
+// execute retrieves the file from shared storage, processes it and stores any derived files
+func (w *Worker) execute(ctx context.Context, spec *processors.TaskSpec) (*Result, error) {
+	provider, err := w.Providers(spec.StorageType)
+	if err != nil {
+		return nil, fmt.Errorf("storage %s unavailable: %w", spec.StorageType, err)
+	}
+
+	reader, _, err := provider.Retrieve(ctx, spec.StorageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve file: %w", err)
+	}
+	defer reader.Close()
+
+	processor, err := processors.SelectProcessor(spec.Options.Processor, spec.ContentType, filepath.Ext(spec.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	processed, err := processor.Process(ctx, reader, spec.Name, spec.Options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process file: %w", err)
+	}
+	defer processed.Cleanup()
+
+	result := &Result{
+		Summary:  processed.Summary,
+		Metadata: processed.Metadata,
+		Preview:  processed.Preview,
+	}
+	if text, ok := processed.Data.(string); ok {
+		result.Text = text
+	}
+
+	if len(processed.Derived) > 0 {
+		result.Derived, err = catalog.StoreFiles(ctx, provider, spec.StorageType, spec.FileID, processed.Derived)
+		if err != nil {
+			log.Printf("Failed to store derived files for %s: %v", spec.FileID, err)
+		}
+	}
+
+	return result, nil
+}
+
+// heartbeatLoop extends the worker's leases and cancels work on leases the server dropped
+func (w *Worker) heartbeatLoop(ctx context.Context) {
+	ticker := time.NewTicker(w.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.mu.Lock()
+			ids := make([]string, 0, len(w.leases))
+			for id := range w.leases {
+				ids = append(ids, id)
+			}
+			w.mu.Unlock()
+
+			var resp HeartbeatResponse
+			if err := w.call(ctx, HeartbeatPath, HeartbeatRequest{WorkerID: w.ID, LeaseIDs: ids}, &resp); err != nil {
+				log.Printf("Heartbeat failed: %v", err)
+				continue
+			}
+
+			held := make(map[string]bool, len(resp.LeaseIDs))
+			for _, id := range resp.LeaseIDs {
+				held[id] = true
+			}
+
+			w.mu.Lock()
+			for _, id := range ids {
+				if cancel, ok := w.leases[id]; ok && !held[id] {
+					log.Printf("Lease %s was revoked by the server", id)
+					cancel()
+				}
+			}
+			w.mu.Unlock()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// call posts a JSON request to the server and decodes the response data into out
+func (w *Worker) call(ctx context.Context, path string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.ServerURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+w.Token)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var apiResp struct {
+		Success bool            `json:"success"`
+		Data    json.RawMessage `json:"data,omitempty"`
+		Error   string          `json:"error,omitempty"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return fmt.Errorf("invalid response from server (status %d): %w", resp.StatusCode, err)
+	}
+	if !apiResp.Success {
+		return fmt.Errorf("server error (status %d): %s", resp.StatusCode, apiResp.Error)
+	}
+
+	if out != nil && len(apiResp.Data) > 0 {
+		return json.Unmarshal(apiResp.Data, out)
+	}
+	return nil
+}
+
+// sleep waits for d or until ctx is cancelled
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+	}
+}